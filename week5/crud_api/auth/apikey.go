@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"crud_api/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// APIKeyHeader carries a static API key
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyPrefix starts every generated key, so leaked keys are easy to recognise
+const apiKeyPrefix = "crud_"
+
+// GenerateAPIKey returns a new random API key and the hash to store for it
+func GenerateAPIKey() (key, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key = apiKeyPrefix + hex.EncodeToString(b)
+	return key, HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the hex SHA-256 hash API keys are stored and looked up by.
+// Keys are long and random, so a fast unsalted hash is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeys returns an Authenticator for keys sent in the X-API-Key header.
+// lookup returns the stored key with a hash, or notFound if there is none.
+func APIKeys(lookup func(hash string) (models.APIKey, error), notFound error) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (Principal, error) {
+		key := r.Header.Get(APIKeyHeader)
+		if key == "" {
+			return Principal{}, ErrNoCredentials
+		}
+
+		stored, err := lookup(HashAPIKey(key))
+		if errors.Is(err, notFound) {
+			return Principal{}, fmt.Errorf("%w: unknown api key", ErrInvalidCredentials)
+		}
+		if err != nil {
+			return Principal{}, err
+		}
+
+		return Principal{Subject: "apikey:" + stored.Name, Scopes: stored.Scopes}, nil
+	})
+}
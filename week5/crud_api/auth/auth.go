@@ -0,0 +1,131 @@
+// Package auth authenticates API requests. Authenticators turn the credentials
+// a request carries into a Principal, and Middleware requires one of them to
+// succeed before a request reaches the handlers.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Scopes a principal can be granted. Reads need ScopeRead and everything else ScopeWrite.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request carries
+// no credentials of the kind it handles
+var ErrNoCredentials = errors.New("no credentials")
+
+// ErrInvalidCredentials is returned by an Authenticator when the request's
+// credentials are malformed, unknown, expired or wrongly signed
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	// Subject names the caller: "apikey:<name>" or the subject of a token
+	Subject string
+	// Scopes lists what the caller may do
+	Scopes []string
+}
+
+// HasScope reports whether the principal has been granted scope
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator checks one kind of credentials
+type Authenticator interface {
+	// Authenticate returns the principal the request's credentials identify. It
+	// returns ErrNoCredentials if there are none it handles and an error wrapping
+	// ErrInvalidCredentials if they are rejected.
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+// AuthenticatorFunc adapts a function to an Authenticator
+type AuthenticatorFunc func(r *http.Request) (Principal, error)
+
+// Authenticate calls f(r)
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (Principal, error) {
+	return f(r)
+}
+
+// contextKey is the type of the request context keys set by this package
+type contextKey int
+
+// principalKey holds the Principal of a request
+const principalKey contextKey = iota
+
+// WithPrincipal returns a copy of ctx recording principal as the caller of the request
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// PrincipalFromContext returns the caller of the request, if it was authenticated
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey).(Principal)
+	return principal, ok
+}
+
+// Middleware authenticates every request before calling next, trying each
+// authenticator in turn until one finds credentials it handles. Requests
+// without credentials or with rejected ones get 401; callers lacking the
+// scope the method needs get 403.
+func Middleware(next http.Handler, authenticators ...Authenticator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := authenticate(r, authenticators)
+		switch {
+		case errors.Is(err, ErrNoCredentials):
+			writeError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		case errors.Is(err, ErrInvalidCredentials):
+			writeError(w, http.StatusUnauthorized, "Invalid credentials")
+			return
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, "Failed to authenticate")
+			return
+		}
+
+		scope := ScopeWrite
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			scope = ScopeRead
+		}
+		if !principal.HasScope(scope) {
+			writeError(w, http.StatusForbidden, "Credentials lack the "+scope+" scope")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// authenticate returns the principal from the first authenticator that finds credentials in r
+func authenticate(r *http.Request, authenticators []Authenticator) (Principal, error) {
+	for _, authenticator := range authenticators {
+		principal, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return principal, err
+	}
+	return Principal{}, ErrNoCredentials
+}
+
+// writeError responds with status and the error message in the handlers' JSON shape.
+// 401 responses name the schemes a client can authenticate with.
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api", ApiKey realm="api"`)
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"crud_api/models"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSecret is an HS256 secret long enough to be accepted
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// signToken returns a compact JWT with the given header algorithm and claims,
+// signed by sign
+func signToken(t *testing.T, alg string, claims map[string]interface{}, sign func(signed []byte) []byte) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+// signHMAC signs with testSecret
+func signHMAC(signed []byte) []byte {
+	mac := hmac.New(sha256.New, testSecret)
+	mac.Write(signed)
+	return mac.Sum(nil)
+}
+
+// testHandler responds with the principal it was called with
+var testHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFromContext(r.Context())
+	json.NewEncoder(w).Encode(principal)
+})
+
+// TestMiddleware tests authenticating requests with API keys and HS256 tokens
+func TestMiddleware(t *testing.T) {
+	keys := map[string]models.APIKey{
+		HashAPIKey("crud_writer"): {Name: "writer", Scopes: []string{ScopeRead, ScopeWrite}},
+		HashAPIKey("crud_reader"): {Name: "reader", Scopes: []string{ScopeRead}},
+	}
+	errNotFound := errors.New("not found")
+	lookup := func(hash string) (models.APIKey, error) {
+		key, ok := keys[hash]
+		if !ok {
+			return key, errNotFound
+		}
+		return key, nil
+	}
+
+	key, err := NewHMACKey(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := Middleware(testHandler, APIKeys(lookup, errNotFound), JWT(key))
+
+	now := time.Now()
+	valid := signToken(t, AlgHS256, map[string]interface{}{"sub": "3", "exp": now.Add(time.Hour).Unix()}, signHMAC)
+	readOnly := signToken(t, AlgHS256, map[string]interface{}{"sub": "svc", "exp": now.Add(time.Hour).Unix(), "scope": "read"}, signHMAC)
+	expired := signToken(t, AlgHS256, map[string]interface{}{"sub": "3", "exp": now.Add(-time.Minute).Unix()}, signHMAC)
+	noExpiry := signToken(t, AlgHS256, map[string]interface{}{"sub": "3"}, signHMAC)
+	notYet := signToken(t, AlgHS256, map[string]interface{}{"sub": "3", "exp": now.Add(time.Hour).Unix(), "nbf": now.Add(time.Minute).Unix()}, signHMAC)
+	tampered := valid[:len(valid)-2] + "AA"
+	unsigned := signToken(t, "none", map[string]interface{}{"sub": "3", "exp": now.Add(time.Hour).Unix()}, func([]byte) []byte { return nil })
+
+	tests := []struct {
+		name       string
+		method     string
+		header     string
+		value      string
+		wantStatus int
+		wantBody   string // a substring of the response body
+	}{
+		{"No Credentials", "GET", "", "", http.StatusUnauthorized, "Authentication required"},
+		{"Unknown Key", "GET", APIKeyHeader, "crud_unknown", http.StatusUnauthorized, "Invalid credentials"},
+		{"Writer Key", "POST", APIKeyHeader, "crud_writer", http.StatusOK, `"Subject":"apikey:writer"`},
+		{"Read-Only Key Reads", "GET", APIKeyHeader, "crud_reader", http.StatusOK, `"Subject":"apikey:reader"`},
+		{"Read-Only Key Writes", "DELETE", APIKeyHeader, "crud_reader", http.StatusForbidden, "write scope"},
+		{"Valid Token", "PATCH", "Authorization", "Bearer " + valid, http.StatusOK, `"Scopes":["read","write"]`},
+		{"Lowercase Scheme", "GET", "Authorization", "bearer " + valid, http.StatusOK, `"Subject":"3"`},
+		{"Read-Only Token Writes", "POST", "Authorization", "Bearer " + readOnly, http.StatusForbidden, "write scope"},
+		{"Expired Token", "GET", "Authorization", "Bearer " + expired, http.StatusUnauthorized, "Invalid credentials"},
+		{"Token Without Expiry", "GET", "Authorization", "Bearer " + noExpiry, http.StatusUnauthorized, "Invalid credentials"},
+		{"Token Not Valid Yet", "GET", "Authorization", "Bearer " + notYet, http.StatusUnauthorized, "Invalid credentials"},
+		{"Tampered Token", "GET", "Authorization", "Bearer " + tampered, http.StatusUnauthorized, "Invalid credentials"},
+		{"Unsigned Token", "GET", "Authorization", "Bearer " + unsigned, http.StatusUnauthorized, "Invalid credentials"},
+		{"Malformed Token", "GET", "Authorization", "Bearer not-a-token", http.StatusUnauthorized, "Invalid credentials"},
+		{"Basic Auth", "GET", "Authorization", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, "Authentication required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/items", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("body %s does not contain %s", rr.Body.String(), tt.wantBody)
+			}
+			if rr.Code == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 response has no WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+// TestAPIKeyHashing tests that generated keys are recognisable and stored only as their hash
+func TestAPIKeyHashing(t *testing.T) {
+	key, hash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey() error = %v", err)
+	}
+	if !strings.HasPrefix(key, apiKeyPrefix) || len(key) != len(apiKeyPrefix)+64 {
+		t.Errorf("GenerateAPIKey() key = %q, want %s and 64 hex digits", key, apiKeyPrefix)
+	}
+	if hash != HashAPIKey(key) || hash == key || len(hash) != 64 {
+		t.Errorf("GenerateAPIKey() hash = %q, want the hex SHA-256 of the key", hash)
+	}
+	if HashAPIKey("crud_a") == HashAPIKey("crud_b") {
+		t.Error("HashAPIKey() gave two keys the same hash")
+	}
+
+	other, _, err := GenerateAPIKey()
+	if err != nil || other == key {
+		t.Errorf("GenerateAPIKey() returned %q twice, %v", key, err)
+	}
+}
+
+// TestLookupError tests that a failing key lookup is a server error, not a rejected key
+func TestLookupError(t *testing.T) {
+	lookup := func(hash string) (models.APIKey, error) {
+		return models.APIKey{}, errors.New("database is locked")
+	}
+	handler := Middleware(testHandler, APIKeys(lookup, errors.New("not found")))
+
+	req := httptest.NewRequest("GET", "/items", nil)
+	req.Header.Set(APIKeyHeader, "crud_key")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+// TestLoadJWTKey tests loading HS256 secrets and RS256 public keys from files
+func TestLoadJWTKey(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkix, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("HS256 Secret", func(t *testing.T) {
+		key, err := LoadJWTKey(write("secret", append(testSecret, '\n')))
+		if err != nil {
+			t.Fatalf("LoadJWTKey() error = %v", err)
+		}
+		if key.Alg() != AlgHS256 {
+			t.Errorf("Alg() = %s, want %s", key.Alg(), AlgHS256)
+		}
+	})
+
+	t.Run("Short Secret", func(t *testing.T) {
+		if _, err := LoadJWTKey(write("short", []byte("secret"))); err == nil {
+			t.Error("LoadJWTKey() of a short secret succeeded")
+		}
+	})
+
+	t.Run("RS256 Public Key", func(t *testing.T) {
+		for _, block := range []*pem.Block{
+			{Type: "PUBLIC KEY", Bytes: pkix},
+			{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&private.PublicKey)},
+		} {
+			key, err := LoadJWTKey(write("public.pem", pem.EncodeToMemory(block)))
+			if err != nil {
+				t.Fatalf("LoadJWTKey(%s) error = %v", block.Type, err)
+			}
+
+			exp := time.Now().Add(time.Hour).Unix()
+			signRSA := func(signed []byte) []byte {
+				digest := sha256.Sum256(signed)
+				signature, err := rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, digest[:])
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signature
+			}
+			if _, err := key.verify(signToken(t, AlgRS256, map[string]interface{}{"sub": "1", "exp": exp}, signRSA), time.Now()); err != nil {
+				t.Errorf("verify() of an RS256 token error = %v", err)
+			}
+
+			// A token can't switch to HS256 and use the public key as the secret
+			forged := signToken(t, AlgHS256, map[string]interface{}{"sub": "1", "exp": exp}, func(signed []byte) []byte {
+				mac := hmac.New(sha256.New, pem.EncodeToMemory(block))
+				mac.Write(signed)
+				return mac.Sum(nil)
+			})
+			if _, err := key.verify(forged, time.Now()); err == nil {
+				t.Error("verify() accepted an HS256 token for an RS256 key")
+			}
+		}
+	})
+
+	t.Run("Private Key", func(t *testing.T) {
+		block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)}
+		if _, err := LoadJWTKey(write("private.pem", pem.EncodeToMemory(block))); err == nil {
+			t.Error("LoadJWTKey() of a private key succeeded")
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Algorithms a JWTKey verifies
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+)
+
+// minHMACSecretLength is the shortest HS256 secret accepted, in bytes.
+// RFC 7518 requires a key at least as long as the hash output.
+const minHMACSecretLength = 32
+
+// JWTKey verifies the signatures of bearer tokens. It holds either an HS256
+// secret or an RS256 public key, and only accepts tokens signed with that
+// algorithm, so a token can't pick the algorithm it is checked with.
+type JWTKey struct {
+	alg    string
+	secret []byte
+	public *rsa.PublicKey
+}
+
+// Alg returns the algorithm the key verifies
+func (k JWTKey) Alg() string {
+	return k.alg
+}
+
+// NewHMACKey returns a key verifying HS256 tokens signed with secret
+func NewHMACKey(secret []byte) (JWTKey, error) {
+	if len(secret) < minHMACSecretLength {
+		return JWTKey{}, fmt.Errorf("HS256 secret must be at least %d bytes", minHMACSecretLength)
+	}
+	return JWTKey{alg: AlgHS256, secret: secret}, nil
+}
+
+// NewRSAKey returns a key verifying RS256 tokens signed with the private half of public
+func NewRSAKey(public *rsa.PublicKey) JWTKey {
+	return JWTKey{alg: AlgRS256, public: public}
+}
+
+// LoadJWTKey reads a key file. A PEM-encoded RSA public key ("PUBLIC KEY" or
+// "RSA PUBLIC KEY") verifies RS256 tokens; anything else is taken as an
+// HS256 secret, ignoring surrounding whitespace.
+func LoadJWTKey(path string) (JWTKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return JWTKey{}, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return NewHMACKey(bytes.TrimSpace(data))
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return JWTKey{}, err
+		}
+		public, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return JWTKey{}, errors.New("public key is not an RSA key")
+		}
+		return NewRSAKey(public), nil
+	case "RSA PUBLIC KEY":
+		public, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return JWTKey{}, err
+		}
+		return NewRSAKey(public), nil
+	default:
+		return JWTKey{}, fmt.Errorf("unsupported PEM block %q; expected an RSA public key", block.Type)
+	}
+}
+
+// claims are the token claims the API reads
+type claims struct {
+	Subject   string   `json:"sub"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	// Scope is a space-separated list of scopes; tokens without one get every scope
+	Scope *string `json:"scope"`
+}
+
+// JWT returns an Authenticator for tokens sent as "Authorization: Bearer <token>".
+// Tokens must be signed with key, name a subject and carry an expiry.
+func JWT(key JWTKey) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (Principal, error) {
+		header := r.Header.Get("Authorization")
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			return Principal{}, ErrNoCredentials
+		}
+
+		c, err := key.verify(strings.TrimSpace(token), time.Now())
+		if err != nil {
+			return Principal{}, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+		}
+
+		principal := Principal{Subject: c.Subject, Scopes: []string{ScopeRead, ScopeWrite}}
+		if c.Scope != nil {
+			principal.Scopes = strings.Fields(*c.Scope)
+		}
+		return principal, nil
+	})
+}
+
+// verify checks a compact JWT's algorithm, signature and validity period at now
+// and returns its claims
+func (k JWTKey) verify(token string, now time.Time) (claims, error) {
+	var c claims
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return c, errors.New("token must have three parts")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return c, fmt.Errorf("header: %v", err)
+	}
+	if header.Alg != k.alg {
+		return c, fmt.Errorf("token is signed with %q, expected %q", header.Alg, k.alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return c, fmt.Errorf("signature: %v", err)
+	}
+	if err := k.checkSignature(parts[0]+"."+parts[1], signature); err != nil {
+		return c, err
+	}
+
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return c, fmt.Errorf("claims: %v", err)
+	}
+	if c.Subject == "" {
+		return c, errors.New("token has no subject")
+	}
+	if c.ExpiresAt == nil {
+		return c, errors.New("token has no expiry")
+	}
+	if !now.Before(time.Unix(int64(*c.ExpiresAt), 0)) {
+		return c, errors.New("token has expired")
+	}
+	if c.NotBefore != nil && now.Before(time.Unix(int64(*c.NotBefore), 0)) {
+		return c, errors.New("token is not valid yet")
+	}
+	return c, nil
+}
+
+// checkSignature verifies the signature over the token's header and claims
+func (k JWTKey) checkSignature(signed string, signature []byte) error {
+	switch k.alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case AlgRS256:
+		digest := sha256.Sum256([]byte(signed))
+		if err := rsa.VerifyPKCS1v15(k.public, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return errors.New("no key configured")
+	}
+}
+
+// decodeSegment decodes a base64url-encoded JSON token segment into v
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crud_api/auth"
+	"crud_api/database"
+	"crud_api/models"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const apiKeyUsage = `usage: main apikey <command>
+
+commands:
+  create [-scopes read,write] <name>  create a key and print it; it is not shown again
+  list                                list keys without revealing them
+  revoke <id>                         delete a key`
+
+// runAPIKey implements the "apikey" subcommand
+func runAPIKey(args []string) error {
+	if len(args) == 0 {
+		return errors.New(apiKeyUsage)
+	}
+
+	database.InitDB(databasePath)
+	defer database.DB.Close()
+
+	switch args[0] {
+	case "create":
+		return createAPIKey(args[1:])
+	case "list":
+		return printAPIKeys()
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New(apiKeyUsage)
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid key ID %q", args[1])
+		}
+		err = database.DeleteAPIKey(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no key with ID %d", id)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("revoked key %d\n", id)
+		return nil
+	default:
+		return errors.New(apiKeyUsage)
+	}
+}
+
+// createAPIKey stores a new key and prints it
+func createAPIKey(args []string) error {
+	flags := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+	scopes := flags.String("scopes", auth.ScopeRead+","+auth.ScopeWrite, "comma-separated scopes granted to the key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New(apiKeyUsage)
+	}
+
+	stored := models.APIKey{Name: flags.Arg(0)}
+	for _, scope := range strings.Split(*scopes, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope != auth.ScopeRead && scope != auth.ScopeWrite {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+		stored.Scopes = append(stored.Scopes, scope)
+	}
+
+	key, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		return err
+	}
+	stored.KeyHash = hash
+
+	id, err := database.InsertAPIKey(stored)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created key %d; send it in the %s header:\n%s\n", id, auth.APIKeyHeader, key)
+	return nil
+}
+
+// printAPIKeys writes a table of every key
+func printAPIKeys() error {
+	keys, err := database.GetAllAPIKeys()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSCOPES\tCREATED AT")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", key.ID, key.Name,
+			strings.Join(key.Scopes, ","), key.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+	return w.Flush()
+}
@@ -1,20 +1,66 @@
 package main
 
 import (
+	"crud_api/auth"
 	"crud_api/database"
 	"crud_api/handlers"
+	"database/sql"
+	"flag"
 	"log"
 	"net/http"
+	"os"
 	"strings"
 )
 
+// databasePath is the SQLite database file used by the server and the migrate command
+const databasePath = "items.db"
+
 func main() {
-	// Initialize the database
-	database.InitDB("items.db")
-	
+	// "migrate" manages the schema instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+	// "apikey" manages API keys instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		if err := runAPIKey(os.Args[2:]); err != nil {
+			log.Fatalf("apikey: %v", err)
+		}
+		return
+	}
+
+	requireAuth := flag.Bool("auth", false, "require an API key or bearer token on every request; off by default")
+	jwtKeyPath := flag.String("jwt-key", "", "HS256 secret or RS256 PEM public key file for verifying bearer tokens")
+	idempotencyTTL := flag.Duration("idempotency-ttl", handlers.DefaultIdempotencyTTL, "how long an Idempotency-Key is remembered for retries of POST /items")
+	flag.Parse()
+
+	// An Idempotency-Key has to be remembered for a while to catch retries
+	if *idempotencyTTL <= 0 {
+		log.Fatalf("Invalid idempotency TTL: %v must be positive", *idempotencyTTL)
+	}
+
+	// Initialize the database, applying any pending migrations
+	database.InitDB(databasePath)
+
+	// Accept API keys, and bearer tokens when there is a key to verify them with
+	var items http.Handler = itemsRouter(handlers.NewItemsHandler(handlers.WithIdempotencyTTL(*idempotencyTTL)))
+	if *requireAuth {
+		authenticators := []auth.Authenticator{auth.APIKeys(database.GetAPIKeyByHash, sql.ErrNoRows)}
+		if *jwtKeyPath != "" {
+			jwtKey, err := auth.LoadJWTKey(*jwtKeyPath)
+			if err != nil {
+				log.Fatalf("Failed to load JWT key: %v", err)
+			}
+			authenticators = append(authenticators, auth.JWT(jwtKey))
+		}
+		items = auth.Middleware(items, authenticators...)
+	}
+
 	// Set up the router
-	http.HandleFunc("/items", itemsRouter)
-	http.HandleFunc("/items/", itemsRouter)
+	http.Handle("/items", items)
+	http.Handle("/items/", items)
 	
 	// Start the server
 	log.Println("CRUD API server running on :8080")
@@ -22,13 +68,15 @@ func main() {
 }
 
 // itemsRouter routes all requests to the items handler
-func itemsRouter(w http.ResponseWriter, r *http.Request) {
-	// Simple routing based on the URL path
-	if r.URL.Path == "/items" || strings.HasPrefix(r.URL.Path, "/items/") {
-		handlers.ItemsHandler(w, r)
-		return
+func itemsRouter(items http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Simple routing based on the URL path
+		if r.URL.Path == "/items" || strings.HasPrefix(r.URL.Path, "/items/") {
+			items.ServeHTTP(w, r)
+			return
+		}
+
+		// If we get here, the path is not supported
+		w.WriteHeader(http.StatusNotFound)
 	}
-	
-	// If we get here, the path is not supported
-	w.WriteHeader(http.StatusNotFound)
 }
@@ -3,30 +3,49 @@ package database
 import (
 	"crud_api/models"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	_ "github.com/mattn/go-sqlite3"
 	"log"
+	"strings"
+	"time"
 )
 
 // DB is the database connection
 var DB *sql.DB
 
-// InitDB initializes the database connection and creates the items table if it doesn't exist
+// Open opens the SQLite database at dataSourceName
+func Open(dataSourceName string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", dataSourceName)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	// SQLite allows a single writer, so keep the pool to one connection
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+	return db, nil
+}
+
+// InitDB initializes the database connection and applies any pending migrations
 func InitDB(dataSourceName string) {
 	var err error
-	DB, err = sql.Open("sqlite3", dataSourceName)
+	DB, err = Open(dataSourceName)
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
-	if err := DB.Ping(); err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
-	}
-	createTable := `CREATE TABLE IF NOT EXISTS items (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL
-	);`
-	_, err = DB.Exec(createTable)
+
+	migrator, err := NewMigrator(DB)
 	if err != nil {
-		log.Fatalf("Failed to create table: %v", err)
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	if err := migrator.Up(); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
 	}
 }
 
@@ -76,3 +95,118 @@ func DeleteItem(id int) error {
 	_, err := DB.Exec("DELETE FROM items WHERE id = ?", id)
 	return err
 }
+
+// InsertAPIKey stores a new API key by its hash
+func InsertAPIKey(key models.APIKey) (int64, error) {
+	res, err := DB.Exec("INSERT INTO api_keys (name, key_hash, scopes, created_at) VALUES (?, ?, ?, ?)",
+		key.Name, key.KeyHash, strings.Join(key.Scopes, " "), time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// GetAPIKeyByHash retrieves the API key with the given hash, or sql.ErrNoRows
+func GetAPIKeyByHash(hash string) (models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	err := DB.QueryRow("SELECT id, name, key_hash, scopes, created_at FROM api_keys WHERE key_hash = ?", hash).
+		Scan(&key.ID, &key.Name, &key.KeyHash, &scopes, &key.CreatedAt)
+	key.Scopes = strings.Fields(scopes)
+	return key, err
+}
+
+// GetAllAPIKeys retrieves every API key, oldest first
+func GetAllAPIKeys() ([]models.APIKey, error) {
+	rows, err := DB.Query("SELECT id, name, key_hash, scopes, created_at FROM api_keys ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		var key models.APIKey
+		var scopes string
+		if err := rows.Scan(&key.ID, &key.Name, &key.KeyHash, &scopes, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+		key.Scopes = strings.Fields(scopes)
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey revokes an API key, returning sql.ErrNoRows if there is none with the ID
+func DeleteAPIKey(id int) error {
+	res, err := DB.Exec("DELETE FROM api_keys WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ErrIdempotencyKeyUsed is returned when claiming an idempotency key a caller has already used and that hasn't expired
+var ErrIdempotencyKeyUsed = errors.New("idempotency key already used")
+
+// ClaimIdempotencyKey records that key.Caller is sending a request with key.Key, in progress until
+// CompleteIdempotencyKey stores its response, and removes the keys that have expired at key.CreatedAt.
+// If the caller has used the key already, it returns the stored key and ErrIdempotencyKeyUsed.
+func ClaimIdempotencyKey(key models.IdempotencyKey) (models.IdempotencyKey, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return models.IdempotencyKey{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM idempotency_keys WHERE expires_at <= ?", key.CreatedAt.UTC()); err != nil {
+		return models.IdempotencyKey{}, err
+	}
+
+	var existing models.IdempotencyKey
+	var header string
+	err = tx.QueryRow(`SELECT caller, idempotency_key, request_hash, status_code, header, body, created_at, expires_at
+		FROM idempotency_keys WHERE caller = ? AND idempotency_key = ?`, key.Caller, key.Key).
+		Scan(&existing.Caller, &existing.Key, &existing.RequestHash, &existing.StatusCode, &header,
+			&existing.Body, &existing.CreatedAt, &existing.ExpiresAt)
+	if err == nil {
+		if err := json.Unmarshal([]byte(header), &existing.Header); err != nil {
+			return models.IdempotencyKey{}, err
+		}
+		return existing, ErrIdempotencyKeyUsed
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.IdempotencyKey{}, err
+	}
+
+	_, err = tx.Exec("INSERT INTO idempotency_keys (caller, idempotency_key, request_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		key.Caller, key.Key, key.RequestHash, key.CreatedAt.UTC(), key.ExpiresAt.UTC())
+	if err != nil {
+		return models.IdempotencyKey{}, err
+	}
+	return key, tx.Commit()
+}
+
+// CompleteIdempotencyKey stores the status, headers and body of the response to a claimed key's request
+func CompleteIdempotencyKey(key models.IdempotencyKey) error {
+	header, err := json.Marshal(key.Header)
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec("UPDATE idempotency_keys SET status_code = ?, header = ?, body = ? WHERE caller = ? AND idempotency_key = ?",
+		key.StatusCode, string(header), key.Body, key.Caller, key.Key)
+	return err
+}
+
+// ReleaseIdempotencyKey removes a key whose request is still in progress, so it can be used again
+func ReleaseIdempotencyKey(caller, key string) error {
+	_, err := DB.Exec("DELETE FROM idempotency_keys WHERE caller = ? AND idempotency_key = ? AND status_code = 0", caller, key)
+	return err
+}
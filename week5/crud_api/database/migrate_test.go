@@ -0,0 +1,216 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+// testMigrations is a small migration set independent of the real schema
+var testMigrations = fstest.MapFS{
+	"migrations/0001_create_widgets.up.sql":   {Data: []byte("CREATE TABLE widgets (id INTEGER PRIMARY KEY);")},
+	"migrations/0001_create_widgets.down.sql": {Data: []byte("DROP TABLE widgets;")},
+	"migrations/0002_add_name.up.sql":         {Data: []byte("ALTER TABLE widgets ADD COLUMN name TEXT;")},
+	"migrations/0002_add_name.down.sql":       {Data: []byte("ALTER TABLE widgets DROP COLUMN name;")},
+	"migrations/0003_create_gadgets.up.sql":   {Data: []byte("CREATE TABLE gadgets (id INTEGER PRIMARY KEY);")},
+	"migrations/0003_create_gadgets.down.sql": {Data: []byte("DROP TABLE gadgets;")},
+}
+
+// setupMigrator opens an empty in-memory database with a Migrator for testMigrations
+func setupMigrator(t *testing.T) *Migrator {
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := newMigrator(db, testMigrations)
+	if err != nil {
+		t.Fatalf("newMigrator() error = %v", err)
+	}
+	return migrator
+}
+
+// tableExists reports whether the migrator's database has the named table
+func tableExists(t *testing.T, migrator *Migrator, name string) bool {
+	var count int
+	err := migrator.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to query sqlite_master: %v", err)
+	}
+	return count > 0
+}
+
+// TestMigratorUpDownTo tests applying and rolling back migrations
+func TestMigratorUpDownTo(t *testing.T) {
+	migrator := setupMigrator(t)
+
+	// Test cases run in order against the same database
+	testCases := []struct {
+		name        string
+		run         func() error
+		wantVersion int
+		wantGadgets bool
+	}{
+		{name: "Up", run: migrator.Up, wantVersion: 3, wantGadgets: true},
+		{name: "Up Again Is A No-op", run: migrator.Up, wantVersion: 3, wantGadgets: true},
+		{name: "Down", run: migrator.Down, wantVersion: 2, wantGadgets: false},
+		{name: "To Earlier Version", run: func() error { return migrator.To(1) }, wantVersion: 1},
+		{name: "To Later Version", run: func() error { return migrator.To(3) }, wantVersion: 3, wantGadgets: true},
+		{name: "To Zero", run: func() error { return migrator.To(0) }, wantVersion: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.run(); err != nil {
+				t.Fatalf("migration error = %v", err)
+			}
+
+			version, err := migrator.Current()
+			if err != nil {
+				t.Fatalf("Current() error = %v", err)
+			}
+			if version != tc.wantVersion {
+				t.Errorf("Current() = %d, want %d", version, tc.wantVersion)
+			}
+			if got := tableExists(t, migrator, "gadgets"); got != tc.wantGadgets {
+				t.Errorf("gadgets table exists = %v, want %v", got, tc.wantGadgets)
+			}
+			if got := tableExists(t, migrator, "widgets"); got != (tc.wantVersion > 0) {
+				t.Errorf("widgets table exists = %v at version %d", got, tc.wantVersion)
+			}
+		})
+	}
+
+	if err := migrator.To(7); err == nil {
+		t.Error("To() with an unknown version should fail")
+	}
+}
+
+// TestMigratorFailedStep tests that a migration that fails is rolled back as a whole
+func TestMigratorFailedStep(t *testing.T) {
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer db.Close()
+
+	broken := fstest.MapFS{
+		"migrations/0001_create_widgets.up.sql":   testMigrations["migrations/0001_create_widgets.up.sql"],
+		"migrations/0001_create_widgets.down.sql": testMigrations["migrations/0001_create_widgets.down.sql"],
+		"migrations/0002_broken.up.sql":           {Data: []byte("CREATE TABLE gadgets (id INTEGER PRIMARY KEY); SELECT * FROM missing;")},
+		"migrations/0002_broken.down.sql":         {Data: []byte("DROP TABLE gadgets;")},
+	}
+	migrator, err := newMigrator(db, broken)
+	if err != nil {
+		t.Fatalf("newMigrator() error = %v", err)
+	}
+
+	if err := migrator.Up(); err == nil {
+		t.Fatal("Up() with a broken migration should fail")
+	}
+	if version, _ := migrator.Current(); version != 1 {
+		t.Errorf("Current() = %d, want 1", version)
+	}
+	if tableExists(t, migrator, "gadgets") {
+		t.Error("the broken migration's table was kept")
+	}
+}
+
+// TestMigratorVerify tests that edited and unknown migrations are refused
+func TestMigratorVerify(t *testing.T) {
+	t.Run("Modified Migration", func(t *testing.T) {
+		migrator := setupMigrator(t)
+		if err := migrator.Up(); err != nil {
+			t.Fatalf("Up() error = %v", err)
+		}
+
+		// Simulate editing a migration after it was applied
+		if _, err := migrator.db.Exec("UPDATE schema_migrations SET checksum = 'edited' WHERE version = 2"); err != nil {
+			t.Fatal(err)
+		}
+
+		statuses, err := migrator.Status()
+		if err != nil || !statuses[1].Modified {
+			t.Errorf("Status() = %+v, %v, want migration 2 modified", statuses, err)
+		}
+		if err := migrator.Down(); !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("Down() error = %v, want ErrChecksumMismatch", err)
+		}
+		if version, _ := migrator.Current(); version != 3 {
+			t.Errorf("Down() changed the version to %d despite the mismatch", version)
+		}
+	})
+
+	t.Run("Unknown Migration", func(t *testing.T) {
+		migrator := setupMigrator(t)
+		if err := migrator.Up(); err != nil {
+			t.Fatalf("Up() error = %v", err)
+		}
+
+		// Simulate a database migrated by a newer build
+		_, err := migrator.db.Exec("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (4, 'future', 'x', CURRENT_TIMESTAMP)")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := migrator.Up(); !errors.Is(err, ErrUnknownMigration) {
+			t.Errorf("Up() error = %v, want ErrUnknownMigration", err)
+		}
+	})
+}
+
+// TestMigrations tests that the real migrations apply, roll back, carry stored
+// data forward and adopt a database created before migrations existed
+func TestMigrations(t *testing.T) {
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer db.Close()
+
+	// The schema and data written by the original InitDB
+	_, err = db.Exec(`CREATE TABLE items (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL);
+	INSERT INTO items (name) VALUES ('Old item');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	if err := migrator.To(3); err != nil {
+		t.Fatalf("To(3) error = %v", err)
+	}
+	// A response stored before headers other than Content-Type were kept
+	_, err = db.Exec(`INSERT INTO idempotency_keys (caller, idempotency_key, request_hash, status_code, content_type, body, created_at, expires_at)
+		VALUES ('apikey:alice', 'laptop-1', 'hash', 201, 'application/json', '{}', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	var header string
+	if err := db.QueryRow("SELECT header FROM idempotency_keys").Scan(&header); err != nil || header != `{"Content-Type":"application/json"}` {
+		t.Errorf("migrated idempotency key header = %s, %v, want its content type", header, err)
+	}
+	var name string
+	if err := db.QueryRow("SELECT name FROM items").Scan(&name); err != nil || name != "Old item" {
+		t.Errorf("migrated item = %q, %v, want Old item", name, err)
+	}
+	if !tableExists(t, migrator, "idempotency_keys") {
+		t.Error("Up() didn't create idempotency_keys")
+	}
+
+	if err := migrator.To(0); err != nil {
+		t.Fatalf("To(0) error = %v", err)
+	}
+	for _, table := range []string{"items", "api_keys", "idempotency_keys"} {
+		if tableExists(t, migrator, table) {
+			t.Errorf("To(0) left the %s table", table)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+-- IF NOT EXISTS lets databases created before migrations adopt this baseline
+CREATE TABLE IF NOT EXISTS items (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL
+);
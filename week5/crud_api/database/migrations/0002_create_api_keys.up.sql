@@ -0,0 +1,8 @@
+-- Only the SHA-256 hash of a key is stored; the key itself is shown once, when it is created
+CREATE TABLE api_keys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	created_at DATETIME NOT NULL
+);
@@ -0,0 +1,5 @@
+ALTER TABLE idempotency_keys ADD COLUMN content_type TEXT NOT NULL DEFAULT '';
+
+UPDATE idempotency_keys SET content_type = COALESCE(json_extract(header, '$."Content-Type"'), '');
+
+ALTER TABLE idempotency_keys DROP COLUMN header;
@@ -0,0 +1,6 @@
+-- header is a JSON object of the response headers to replay, replacing content_type
+ALTER TABLE idempotency_keys ADD COLUMN header TEXT NOT NULL DEFAULT '{}';
+
+UPDATE idempotency_keys SET header = json_object('Content-Type', content_type) WHERE content_type != '';
+
+ALTER TABLE idempotency_keys DROP COLUMN content_type;
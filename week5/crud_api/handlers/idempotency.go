@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"bytes"
+	"crud_api/auth"
+	"crud_api/database"
+	"crud_api/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// IdempotencyKeyHeader lets a client retry a request without repeating what it did:
+// a retry with the same key gets the response to the first request instead
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set to true on responses replayed for a reused key
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// DefaultIdempotencyTTL is how long a key is remembered unless WithIdempotencyTTL says otherwise
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// Limits on requests sent with an idempotency key, whose bodies are read in full to hash them
+const (
+	maxIdempotencyKeyLength = 255
+	maxIdempotentBodySize   = 1 << 20 // bytes
+)
+
+// replayedHeaders are the response headers stored with a key and sent again with its response
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// WithIdempotencyTTL sets how long an idempotency key is remembered after its first request
+func WithIdempotencyTTL(ttl time.Duration) Option {
+	return func(h *ItemsHandler) {
+		h.idempotencyTTL = ttl
+	}
+}
+
+// idempotent calls next for a request without an Idempotency-Key header. With one,
+// the first request with the key is passed to next and its response stored; a
+// retry with the same key, method, path and body gets that response again with
+// Idempotent-Replayed set, while reusing the key for a different request gets 422
+// and retrying before the first request finishes gets 409. Keys belong to the
+// caller who sent them. Server errors and panics aren't stored, so the request can
+// be retried.
+func (h *ItemsHandler) idempotent(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	value, ok := r.Header[IdempotencyKeyHeader]
+	if !ok {
+		next(w, r)
+		return
+	}
+	if len(value) != 1 || !validIdempotencyKey(value[0]) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Idempotency-Key must be 1 to 255 printable ASCII characters"})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodySize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Request body is too large"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	caller := "anonymous"
+	if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+		caller = principal.Subject
+	}
+	hash := requestHash(r, body)
+	now := time.Now().UTC()
+	key, err := database.ClaimIdempotencyKey(models.IdempotencyKey{
+		Caller:      caller,
+		Key:         value[0],
+		RequestHash: hash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(h.idempotencyTTL),
+	})
+	if errors.Is(err, database.ErrIdempotencyKeyUsed) {
+		replayIdempotentResponse(w, key, hash)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to claim idempotency key"})
+		return
+	}
+
+	// Release the key unless its response is stored, so that retries repeat a
+	// request that failed with a server error, or panicked, instead of waiting on it
+	completed := false
+	defer func() {
+		if !completed {
+			database.ReleaseIdempotencyKey(key.Caller, key.Key)
+		}
+	}()
+
+	recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+	next(recorder, r)
+
+	if recorder.status >= http.StatusInternalServerError {
+		return
+	}
+	key.StatusCode = recorder.status
+	key.Header = map[string]string{}
+	for _, name := range replayedHeaders {
+		if value := w.Header().Get(name); value != "" {
+			key.Header[name] = value
+		}
+	}
+	key.Body = recorder.body.Bytes()
+	// The response has been sent, so a key that can't be completed is released instead,
+	// leaving it to the retry to repeat the request rather than wait on it forever
+	completed = database.CompleteIdempotencyKey(key) == nil
+}
+
+// replayIdempotentResponse responds to a request with a key that was used before
+// with the stored response, if the key was used for the same request and it finished
+func replayIdempotentResponse(w http.ResponseWriter, key models.IdempotencyKey, hash string) {
+	if key.RequestHash != hash {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Idempotency-Key was already used for a different request"})
+		return
+	}
+	if !key.Completed() {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "A request with this Idempotency-Key is still in progress"})
+		return
+	}
+	for name, value := range key.Header {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(key.StatusCode)
+	w.Write(key.Body)
+}
+
+// validIdempotencyKey reports whether a client-chosen idempotency key is short printable ASCII
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestHash identifies a request by its method, path and body in hex
+func requestHash(r *http.Request, body []byte) string {
+	digest := sha256.New()
+	io.WriteString(digest, r.Method+" "+r.URL.Path+"\n")
+	digest.Write(body)
+	return hex.EncodeToString(digest.Sum(nil))
+}
+
+// responseRecorder passes a response through to the client while keeping its status and body
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+// WriteHeader records the status before sending it
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write records what is written before sending it
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"bytes"
+	"crud_api/auth"
+	"crud_api/database"
+	"crud_api/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupDatabase points the database package at a fresh, migrated in-memory database
+func setupDatabase(t *testing.T) {
+	db, err := database.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	if err := migrator.Up(); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		db.Close()
+	})
+}
+
+// postItem sends POST /items with body to handler as the caller with subject
+// "apikey:<caller>", with key as the Idempotency-Key header if it isn't empty
+func postItem(t *testing.T, handler http.Handler, caller, key, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req, err := http.NewRequest("POST", "/items", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{
+		Subject: "apikey:" + caller,
+		Scopes:  []string{auth.ScopeRead, auth.ScopeWrite},
+	}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+// TestIdempotencyKey tests replaying, rejecting and waiting on reused Idempotency-Keys
+func TestIdempotencyKey(t *testing.T) {
+	setupDatabase(t)
+	handler := NewItemsHandler()
+
+	// A request with the key "busy" is still being handled
+	busy := httptest.NewRequest("POST", "/items", nil)
+	database.ClaimIdempotencyKey(models.IdempotencyKey{Caller: "apikey:alice", Key: "busy", RequestHash: requestHash(busy, []byte(`{"name": "Notebook"}`)),
+		CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)})
+
+	// Steps run in order against the same database
+	steps := []struct {
+		name         string
+		caller       string
+		key          string // the Idempotency-Key header, if any
+		body         string
+		wantStatus   int
+		wantBody     string // a substring of the response body
+		wantReplayed bool
+	}{
+		{"First Request", "alice", "laptop-1", `{"name": "Notebook"}`, http.StatusCreated, `"id":1,"name":"Notebook"`, false},
+		{"Retry", "alice", "laptop-1", `{"name": "Notebook"}`, http.StatusCreated, `"id":1,"name":"Notebook"`, true},
+		{"Different Body", "alice", "laptop-1", `{"name": "Pen"}`, http.StatusUnprocessableEntity, "already used for a different request", false},
+		{"Other Caller", "bob", "laptop-1", `{"name": "Notebook"}`, http.StatusCreated, `"id":2,"name":"Notebook"`, false},
+		{"Invalid Request", "alice", "laptop-2", `{"name": `, http.StatusBadRequest, "Invalid request body", false},
+		{"Retry Invalid Request", "alice", "laptop-2", `{"name": `, http.StatusBadRequest, "Invalid request body", true},
+		{"In Progress", "alice", "busy", `{"name": "Notebook"}`, http.StatusConflict, "still in progress", false},
+		{"Invalid Key", "alice", "café", `{"name": "Notebook"}`, http.StatusBadRequest, "Idempotency-Key must be", false},
+		{"Without Key", "alice", "", `{"name": "Notebook"}`, http.StatusCreated, `"id":3,"name":"Notebook"`, false},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			rr := postItem(t, handler, step.caller, step.key, step.body)
+
+			if rr.Code != step.wantStatus {
+				t.Errorf("status = %d, want %d, body %s", rr.Code, step.wantStatus, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), step.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", rr.Body.String(), step.wantBody)
+			}
+			if replayed := rr.Header().Get(IdempotentReplayedHeader) == "true"; replayed != step.wantReplayed {
+				t.Errorf("%s = %q, want replayed %v", IdempotentReplayedHeader, rr.Header().Get(IdempotentReplayedHeader), step.wantReplayed)
+			}
+			if step.wantReplayed && step.wantStatus == http.StatusCreated && rr.Header().Get("Location") != "/items/1" {
+				t.Errorf("replayed headers = %v, want the Location of the first response", rr.Header())
+			}
+		})
+	}
+
+	if items, _ := database.GetAllItems(); len(items) != 3 {
+		t.Errorf("items created = %d, want 3", len(items))
+	}
+}
+
+// TestIdempotencyKeyPanic tests that a request that panics releases its key for retries
+func TestIdempotencyKeyPanic(t *testing.T) {
+	setupDatabase(t)
+	handler := NewItemsHandler()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("idempotent() swallowed the panic")
+			}
+		}()
+		req := httptest.NewRequest("POST", "/items", strings.NewReader(`{"name": "Notebook"}`))
+		req.Header.Set(IdempotencyKeyHeader, "laptop-1")
+		req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Subject: "apikey:alice"}))
+		handler.idempotent(httptest.NewRecorder(), req, func(w http.ResponseWriter, r *http.Request) {
+			panic("lost the database")
+		})
+	}()
+
+	// The retry is handled again rather than waiting on the key
+	rr := postItem(t, handler, "alice", "laptop-1", `{"name": "Notebook"}`)
+	if rr.Code != http.StatusCreated || rr.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Errorf("retry after a panic = %d %s, want a new 201", rr.Code, rr.Body.String())
+	}
+}
+
+// TestIdempotencyTTL tests that a key can be used for another request once it expires
+func TestIdempotencyTTL(t *testing.T) {
+	setupDatabase(t)
+	handler := NewItemsHandler(WithIdempotencyTTL(time.Nanosecond))
+
+	requests := []struct {
+		body     string
+		wantBody string
+	}{
+		{`{"name": "Notebook"}`, `"id":1,"name":"Notebook"`},
+		{`{"name": "Pen"}`, `"id":2,"name":"Pen"`},
+	}
+	for _, request := range requests {
+		rr := postItem(t, handler, "alice", "laptop-1", request.body)
+		if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), request.wantBody) {
+			t.Errorf("POST %s = %d %s, want %d with %s", request.body, rr.Code, rr.Body.String(), http.StatusCreated, request.wantBody)
+		}
+	}
+}
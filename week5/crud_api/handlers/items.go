@@ -7,10 +7,28 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // ItemsHandler handles all requests to the /items endpoint
-func ItemsHandler(w http.ResponseWriter, r *http.Request) {
+type ItemsHandler struct {
+	idempotencyTTL time.Duration
+}
+
+// Option configures an ItemsHandler
+type Option func(*ItemsHandler)
+
+// NewItemsHandler creates an ItemsHandler, configured by options
+func NewItemsHandler(options ...Option) *ItemsHandler {
+	h := &ItemsHandler{idempotencyTTL: DefaultIdempotencyTTL}
+	for _, option := range options {
+		option(h)
+	}
+	return h
+}
+
+// ServeHTTP routes a request to the handler for its method
+func (h *ItemsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	switch r.Method {
@@ -22,7 +40,7 @@ func ItemsHandler(w http.ResponseWriter, r *http.Request) {
 			getItem(w, r)
 		}
 	case http.MethodPost:
-		createItem(w, r)
+		h.idempotent(w, r, createItem)
 	case http.MethodPut:
 		updateItem(w, r)
 	case http.MethodDelete:
@@ -81,6 +99,7 @@ func createItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	item.ID = int(id)
+	w.Header().Set("Location", "/items/"+strconv.Itoa(item.ID))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(item)
 }
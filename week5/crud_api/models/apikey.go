@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// APIKey is a static credential for the API. Only the SHA-256 hash of the key
+// is stored, so the key itself can't be recovered once it has been handed out.
+type APIKey struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	KeyHash   string    `json:"-"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
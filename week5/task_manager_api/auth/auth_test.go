@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"task_manager_api/models"
+	"testing"
+	"time"
+)
+
+// testSecret is an HS256 secret long enough to be accepted
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// signToken returns a compact JWT with the given header algorithm and claims,
+// signed by sign
+func signToken(t *testing.T, alg string, claims map[string]interface{}, sign func(signed []byte) []byte) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+// signHMAC signs with testSecret
+func signHMAC(signed []byte) []byte {
+	mac := hmac.New(sha256.New, testSecret)
+	mac.Write(signed)
+	return mac.Sum(nil)
+}
+
+// testHandler responds with the principal it was called with
+var testHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFromContext(r.Context())
+	json.NewEncoder(w).Encode(principal)
+})
+
+// TestMiddleware tests authenticating requests with API keys and HS256 tokens
+func TestMiddleware(t *testing.T) {
+	userID := 7
+	keys := map[string]models.APIKey{
+		HashAPIKey("tm_writer"): {Name: "writer", UserID: &userID, Scopes: []string{ScopeRead, ScopeWrite}},
+		HashAPIKey("tm_reader"): {Name: "reader", Scopes: []string{ScopeRead}},
+	}
+	errNotFound := errors.New("not found")
+	lookup := func(hash string) (models.APIKey, error) {
+		key, ok := keys[hash]
+		if !ok {
+			return key, errNotFound
+		}
+		return key, nil
+	}
+
+	key, err := NewHMACKey(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := Middleware(testHandler, APIKeys(lookup, errNotFound), JWT(key))
+
+	now := time.Now()
+	valid := signToken(t, AlgHS256, map[string]interface{}{"sub": "3", "exp": now.Add(time.Hour).Unix()}, signHMAC)
+	readOnly := signToken(t, AlgHS256, map[string]interface{}{"sub": "svc", "exp": now.Add(time.Hour).Unix(), "scope": "read"}, signHMAC)
+	expired := signToken(t, AlgHS256, map[string]interface{}{"sub": "3", "exp": now.Add(-time.Minute).Unix()}, signHMAC)
+	noExpiry := signToken(t, AlgHS256, map[string]interface{}{"sub": "3"}, signHMAC)
+	notYet := signToken(t, AlgHS256, map[string]interface{}{"sub": "3", "exp": now.Add(time.Hour).Unix(), "nbf": now.Add(time.Minute).Unix()}, signHMAC)
+	tampered := valid[:len(valid)-2] + "AA"
+	unsigned := signToken(t, "none", map[string]interface{}{"sub": "3", "exp": now.Add(time.Hour).Unix()}, func([]byte) []byte { return nil })
+
+	tests := []struct {
+		name       string
+		method     string
+		header     string
+		value      string
+		wantStatus int
+		wantBody   string // a substring of the response body
+	}{
+		{"No Credentials", "GET", "", "", http.StatusUnauthorized, "Authentication required"},
+		{"Unknown Key", "GET", APIKeyHeader, "tm_unknown", http.StatusUnauthorized, "Invalid credentials"},
+		{"Key With User", "POST", APIKeyHeader, "tm_writer", http.StatusOK, `"UserID":7`},
+		{"Read-Only Key Reads", "GET", APIKeyHeader, "tm_reader", http.StatusOK, `"Subject":"apikey:reader"`},
+		{"Read-Only Key Writes", "DELETE", APIKeyHeader, "tm_reader", http.StatusForbidden, "write scope"},
+		{"Valid Token", "PATCH", "Authorization", "Bearer " + valid, http.StatusOK, `"UserID":3`},
+		{"Lowercase Scheme", "GET", "Authorization", "bearer " + valid, http.StatusOK, `"Subject":"3"`},
+		{"Read-Only Token Writes", "POST", "Authorization", "Bearer " + readOnly, http.StatusForbidden, "write scope"},
+		{"Expired Token", "GET", "Authorization", "Bearer " + expired, http.StatusUnauthorized, "Invalid credentials"},
+		{"Token Without Expiry", "GET", "Authorization", "Bearer " + noExpiry, http.StatusUnauthorized, "Invalid credentials"},
+		{"Token Not Valid Yet", "GET", "Authorization", "Bearer " + notYet, http.StatusUnauthorized, "Invalid credentials"},
+		{"Tampered Token", "GET", "Authorization", "Bearer " + tampered, http.StatusUnauthorized, "Invalid credentials"},
+		{"Unsigned Token", "GET", "Authorization", "Bearer " + unsigned, http.StatusUnauthorized, "Invalid credentials"},
+		{"Malformed Token", "GET", "Authorization", "Bearer not-a-token", http.StatusUnauthorized, "Invalid credentials"},
+		{"Basic Auth", "GET", "Authorization", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, "Authentication required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/tasks", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("body %s does not contain %s", rr.Body.String(), tt.wantBody)
+			}
+			if rr.Code == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 response has no WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+// TestLookupError tests that a failing key lookup is a server error, not a rejected key
+func TestLookupError(t *testing.T) {
+	lookup := func(hash string) (models.APIKey, error) {
+		return models.APIKey{}, errors.New("database is locked")
+	}
+	handler := Middleware(testHandler, APIKeys(lookup, errors.New("not found")))
+
+	req := httptest.NewRequest("GET", "/tasks", nil)
+	req.Header.Set(APIKeyHeader, "tm_key")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+// TestLoadJWTKey tests loading HS256 secrets and RS256 public keys from files
+func TestLoadJWTKey(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkix, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("HS256 Secret", func(t *testing.T) {
+		key, err := LoadJWTKey(write("secret", append(testSecret, '\n')))
+		if err != nil {
+			t.Fatalf("LoadJWTKey() error = %v", err)
+		}
+		if key.Alg() != AlgHS256 {
+			t.Errorf("Alg() = %s, want %s", key.Alg(), AlgHS256)
+		}
+	})
+
+	t.Run("Short Secret", func(t *testing.T) {
+		if _, err := LoadJWTKey(write("short", []byte("secret"))); err == nil {
+			t.Error("LoadJWTKey() of a short secret succeeded")
+		}
+	})
+
+	t.Run("RS256 Public Key", func(t *testing.T) {
+		for _, block := range []*pem.Block{
+			{Type: "PUBLIC KEY", Bytes: pkix},
+			{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&private.PublicKey)},
+		} {
+			key, err := LoadJWTKey(write("public.pem", pem.EncodeToMemory(block)))
+			if err != nil {
+				t.Fatalf("LoadJWTKey(%s) error = %v", block.Type, err)
+			}
+
+			exp := time.Now().Add(time.Hour).Unix()
+			signRSA := func(signed []byte) []byte {
+				digest := sha256.Sum256(signed)
+				signature, err := rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, digest[:])
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signature
+			}
+			if _, err := key.verify(signToken(t, AlgRS256, map[string]interface{}{"sub": "1", "exp": exp}, signRSA), time.Now()); err != nil {
+				t.Errorf("verify() of an RS256 token error = %v", err)
+			}
+
+			// A token can't switch to HS256 and use the public key as the secret
+			forged := signToken(t, AlgHS256, map[string]interface{}{"sub": "1", "exp": exp}, func(signed []byte) []byte {
+				mac := hmac.New(sha256.New, pem.EncodeToMemory(block))
+				mac.Write(signed)
+				return mac.Sum(nil)
+			})
+			if _, err := key.verify(forged, time.Now()); err == nil {
+				t.Error("verify() accepted an HS256 token for an RS256 key")
+			}
+		}
+	})
+
+	t.Run("Private Key", func(t *testing.T) {
+		block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)}
+		if _, err := LoadJWTKey(write("private.pem", pem.EncodeToMemory(block))); err == nil {
+			t.Error("LoadJWTKey() of a private key succeeded")
+		}
+	})
+}
@@ -0,0 +1,201 @@
+// Package blobs stores file contents on the local filesystem under their
+// SHA-256 hash, so identical files are stored once however often they are
+// uploaded. Blobs that nothing refers to any more are removed by Sweep.
+package blobs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrTooLarge is returned by Put when the content is larger than allowed
+var ErrTooLarge = errors.New("blob too large")
+
+// ErrNotFound is returned when no blob is stored under a hash
+var ErrNotFound = errors.New("blob not found")
+
+// SweepGrace is how old an unreferenced blob must be before Sweep removes it.
+// It covers the time between storing a blob and recording the reference to it.
+const SweepGrace = 10 * time.Minute
+
+// Store keeps blobs in a directory, each in a file named by its hash under a
+// subdirectory named by the hash's first two characters
+type Store struct {
+	dir string
+	mu  sync.Mutex // held while a blob is added or swept, so a sweep can't remove one being stored again
+}
+
+// NewStore returns a Store keeping its blobs in dir, creating it if needed
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "tmp"), 0o755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Put stores the content read from r and returns its hash and size. Content
+// larger than maxSize bytes isn't stored, and Put returns ErrTooLarge.
+func (s *Store) Put(r io.Reader, maxSize int64) (hash string, size int64, err error) {
+	tmp, err := os.CreateTemp(filepath.Join(s.dir, "tmp"), "upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	digest := sha256.New()
+	size, err = io.Copy(io.MultiWriter(tmp, digest), io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return "", 0, err
+	}
+	if size > maxSize {
+		return "", 0, ErrTooLarge
+	}
+	if err = tmp.Sync(); err != nil {
+		return "", 0, err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", 0, err
+	}
+
+	hash = hex.EncodeToString(digest.Sum(nil))
+	path := s.path(hash)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", 0, err
+	}
+	// Replacing an existing copy also renews its age, keeping it from the next sweep
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, err
+	}
+	return hash, size, nil
+}
+
+// Open opens the blob stored under hash for reading, or returns ErrNotFound
+func (s *Store) Open(hash string) (*os.File, error) {
+	if !validHash(hash) {
+		return nil, ErrNotFound
+	}
+	file, err := os.Open(s.path(hash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+// Delete removes the blob stored under hash; removing a missing blob is not an error
+func (s *Store) Delete(hash string) error {
+	if !validHash(hash) {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.path(hash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Sweep removes the blobs last stored before cutoff that inUse reports nothing
+// refers to, along with uploads abandoned before cutoff, and returns how many
+// blobs it removed
+func (s *Store) Sweep(inUse func(hash string) (bool, error), cutoff time.Time) (int, error) {
+	removed := 0
+	err := filepath.WalkDir(s.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			return err
+		}
+		if filepath.Base(filepath.Dir(path)) == "tmp" {
+			return os.Remove(path)
+		}
+		hash := entry.Name()
+		if !validHash(hash) {
+			return nil
+		}
+
+		used, err := inUse(hash)
+		if err != nil || used {
+			return err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// Check again in case the blob was stored again since it was listed
+		if info, err := os.Stat(path); err != nil || !info.ModTime().Before(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
+
+// StartSweeper sweeps the blobs inUse reports nothing refers to, once straight
+// away and then every interval, until the returned stop function is called
+func (s *Store) StartSweeper(inUse func(hash string) (bool, error), interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			removed, err := s.Sweep(inUse, time.Now().Add(-SweepGrace))
+			if err != nil {
+				log.Printf("Failed to sweep attachment blobs: %v", err)
+			} else if removed > 0 {
+				log.Printf("Removed %d unused attachment blobs", removed)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		wg.Wait()
+	}
+}
+
+// path returns the file the blob with hash is stored in
+func (s *Store) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+// validHash reports whether hash is a hex SHA-256 hash, so it can't name a file outside the store
+func validHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
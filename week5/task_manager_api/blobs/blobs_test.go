@@ -0,0 +1,92 @@
+package blobs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPutAndOpen(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	hash, size, err := store.Put(strings.NewReader("test"), 4)
+	if err != nil || size != 4 || hash != "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08" {
+		t.Fatalf("Put() = %q, %d, %v, want the SHA-256 of the content", hash, size, err)
+	}
+	if again, _, err := store.Put(strings.NewReader("test"), 4); err != nil || again != hash {
+		t.Errorf("Put() of the same content = %q, %v, want %q", again, err, hash)
+	}
+
+	file, err := store.Open(hash)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	content, _ := io.ReadAll(file)
+	file.Close()
+	if string(content) != "test" {
+		t.Errorf("Open() content = %q, want %q", content, "test")
+	}
+
+	if _, _, err := store.Put(strings.NewReader("too long"), 4); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Put() over the limit error = %v, want ErrTooLarge", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(store.dir, "tmp")); len(entries) != 0 {
+		t.Errorf("%d temporary files left after a rejected upload", len(entries))
+	}
+
+	for _, name := range []string{"missing", "../../etc/passwd", strings.Repeat("0", 64)} {
+		if _, err := store.Open(name); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Open(%q) error = %v, want ErrNotFound", name, err)
+		}
+	}
+
+	if err := store.Delete(hash); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := store.Delete(hash); err != nil {
+		t.Errorf("Delete() of a missing blob error = %v, want nil", err)
+	}
+	if _, err := store.Open(hash); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open() after Delete() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	kept, _, _ := store.Put(strings.NewReader("kept"), 100)
+	orphan, _, _ := store.Put(strings.NewReader("orphan"), 100)
+	abandoned, _ := os.CreateTemp(filepath.Join(store.dir, "tmp"), "upload-*")
+	abandoned.Close()
+	inUse := func(hash string) (bool, error) { return hash == kept, nil }
+
+	// Recently stored blobs are left alone, since their attachment may not be recorded yet
+	if removed, err := store.Sweep(inUse, time.Now().Add(-time.Hour)); err != nil || removed != 0 {
+		t.Errorf("Sweep() of new blobs = %d, %v, want 0 removed", removed, err)
+	}
+
+	removed, err := store.Sweep(inUse, time.Now().Add(time.Hour))
+	if err != nil || removed != 1 {
+		t.Errorf("Sweep() = %d, %v, want the orphan removed", removed, err)
+	}
+	if _, err := store.Open(orphan); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open() of the swept orphan error = %v, want ErrNotFound", err)
+	}
+	if file, err := store.Open(kept); err != nil {
+		t.Errorf("Open() of the blob in use error = %v", err)
+	} else {
+		file.Close()
+	}
+	if _, err := os.Stat(abandoned.Name()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("abandoned upload still exists after Sweep(): %v", err)
+	}
+}
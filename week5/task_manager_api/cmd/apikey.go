@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"task_manager_api/auth"
+	"task_manager_api/database"
+	"task_manager_api/models"
+	"text/tabwriter"
+)
+
+const apiKeyUsage = `usage: main apikey <command>
+
+commands:
+  create [-user <id>] [-scopes read,write] <name>  create a key and print it; it is not shown again
+  list                                             list keys without revealing them
+  revoke <id>                                      delete a key`
+
+// runAPIKey implements the "apikey" subcommand
+func runAPIKey(args []string) error {
+	if len(args) == 0 {
+		return errors.New(apiKeyUsage)
+	}
+
+	store, err := database.NewSQLiteStore(databasePath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "create":
+		return createAPIKey(store, args[1:])
+	case "list":
+		return printAPIKeys(store)
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New(apiKeyUsage)
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid key ID %q", args[1])
+		}
+		if err := store.DeleteAPIKey(id); err != nil {
+			return err
+		}
+		fmt.Printf("revoked key %d\n", id)
+		return nil
+	default:
+		return errors.New(apiKeyUsage)
+	}
+}
+
+// createAPIKey stores a new key and prints it
+func createAPIKey(store database.TaskStore, args []string) error {
+	flags := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+	userID := flags.Int("user", 0, "ID of the user the key acts as")
+	scopes := flags.String("scopes", auth.ScopeRead+","+auth.ScopeWrite, "comma-separated scopes granted to the key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New(apiKeyUsage)
+	}
+
+	stored := models.APIKey{Name: flags.Arg(0)}
+	if *userID != 0 {
+		stored.UserID = userID
+	}
+	for _, scope := range strings.Split(*scopes, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope != auth.ScopeRead && scope != auth.ScopeWrite {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+		stored.Scopes = append(stored.Scopes, scope)
+	}
+
+	key, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		return err
+	}
+	stored.KeyHash = hash
+
+	id, err := store.CreateAPIKey(stored)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created key %d; send it in the %s header:\n%s\n", id, auth.APIKeyHeader, key)
+	return nil
+}
+
+// printAPIKeys writes a table of every key
+func printAPIKeys(store database.TaskStore) error {
+	keys, err := store.ListAPIKeys()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tUSER\tSCOPES\tCREATED AT")
+	for _, key := range keys {
+		user := "-"
+		if key.UserID != nil {
+			user = strconv.Itoa(*key.UserID)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", key.ID, key.Name, user,
+			strings.Join(key.Scopes, ","), key.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+	return w.Flush()
+}
@@ -1,35 +1,194 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
+	"os"
 	"strings"
+	"task_manager_api/auth"
+	"task_manager_api/blobs"
 	"task_manager_api/database"
 	"task_manager_api/handlers"
+	"task_manager_api/models"
+	"task_manager_api/reminders"
+	"task_manager_api/webhooks"
+	"time"
 )
 
+// databasePath is the SQLite database file used by the server and the migrate command
+const databasePath = "tasks.db"
+
+// trashPurgeInterval is how often tasks whose trash retention has expired are purged
+const trashPurgeInterval = time.Hour
+
+// attachmentSweepInterval is how often attachment content that nothing refers to is removed
+const attachmentSweepInterval = time.Hour
+
 func main() {
-	// Initialize the database
-	database.InitDB("tasks.db")
-	
+	// "migrate" manages the schema instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+	// "apikey" manages API keys instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		if err := runAPIKey(os.Args[2:]); err != nil {
+			log.Fatalf("apikey: %v", err)
+		}
+		return
+	}
+
+	workflowPath := flag.String("workflow", "", "JSON file defining the allowed task status transitions")
+	nextWeights := flag.String("next-weights", "", "comma-separated factor=weight pairs GET /tasks/next scores tasks with, such as priority=4,due=3,blocking=2,age=1")
+	trashRetention := flag.Duration("trash-retention", 30*24*time.Hour, "how long deleted tasks stay in the trash; 0 keeps them forever")
+	requireAuth := flag.Bool("auth", false, "require an API key or bearer token on every request; off by default")
+	jwtKeyPath := flag.String("jwt-key", "", "HS256 secret or RS256 PEM public key file for verifying bearer tokens")
+	reminderInterval := flag.Duration("reminder-interval", time.Minute, "how often to check for due and overdue tasks; 0 disables reminders")
+	reminderLeadTimes := flag.String("reminder-lead-times", "24h,1h", "comma-separated times before a task's due date to send reminders")
+	reminderWebhook := flag.String("reminder-webhook", "", "URL to POST reminders to as JSON")
+	reminderSpool := flag.String("reminder-spool", "", "directory to write reminders to as JSON files")
+	webhookInterval := flag.Duration("webhook-interval", 5*time.Second, "how often to send queued webhook deliveries; 0 only queues them")
+	idempotencyTTL := flag.Duration("idempotency-ttl", handlers.DefaultIdempotencyTTL, "how long an Idempotency-Key is remembered for retries of POST /tasks")
+	attachmentsDir := flag.String("attachments-dir", "attachments", "directory to store task attachments in; empty disables attachments")
+	maxAttachmentSize := flag.Int64("max-attachment-size", handlers.DefaultAttachmentLimits.MaxSize, "largest attachment accepted, in bytes")
+	attachmentTypes := flag.String("attachment-types", strings.Join(handlers.DefaultAttachmentLimits.Types, ","), "comma-separated media types accepted as attachments, such as image/* or application/pdf")
+	flag.Parse()
+
+	// Load the status workflow, falling back to the default one
+	workflow := models.DefaultWorkflow()
+	if *workflowPath != "" {
+		file, err := os.Open(*workflowPath)
+		if err != nil {
+			log.Fatalf("Failed to open workflow: %v", err)
+		}
+		workflow, err = models.LoadWorkflow(file)
+		file.Close()
+		if err != nil {
+			log.Fatalf("Failed to load workflow: %v", err)
+		}
+	}
+
+	// Weigh the factors that rank the tasks to work on next
+	weights, err := models.ParseScoreWeights(*nextWeights)
+	if err != nil {
+		log.Fatalf("Invalid score weights: %v", err)
+	}
+
+	// Initialize the database, applying any pending migrations
+	store, err := database.NewSQLiteStore(databasePath)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer store.Close()
+
+	// Permanently remove tasks that have been in the trash too long
+	if *trashRetention > 0 {
+		stopPurger := database.StartTrashPurger(store, *trashRetention, trashPurgeInterval)
+		defer stopPurger()
+	}
+
+	// Send reminders about tasks coming due, and mark late ones overdue
+	if *reminderInterval > 0 {
+		leadTimes, err := reminders.ParseLeadTimes(*reminderLeadTimes)
+		if err != nil {
+			log.Fatalf("Invalid reminder lead times: %v", err)
+		}
+		notifiers := []reminders.Notifier{reminders.LogNotifier()}
+		if *reminderWebhook != "" {
+			notifiers = append(notifiers, reminders.WebhookNotifier(*reminderWebhook))
+		}
+		if *reminderSpool != "" {
+			spool, err := reminders.SpoolNotifier(*reminderSpool)
+			if err != nil {
+				log.Fatalf("Failed to open reminder spool: %v", err)
+			}
+			notifiers = append(notifiers, spool)
+		}
+		stopReminders := reminders.NewScheduler(store, leadTimes, notifiers...).Start(*reminderInterval)
+		defer stopReminders()
+	}
+
+	// Send the task events queued for webhooks
+	if *webhookInterval > 0 {
+		stopDispatcher := webhooks.NewDispatcher(store).Start(*webhookInterval)
+		defer stopDispatcher()
+	}
+
+	// An Idempotency-Key has to be remembered for a while to catch retries
+	if *idempotencyTTL <= 0 {
+		log.Fatalf("Invalid idempotency TTL: %v must be positive", *idempotencyTTL)
+	}
+
+	// Store attachments by their hash, removing the content nothing refers to any more
+	options := []handlers.Option{handlers.WithWorkflow(workflow), handlers.WithScoreWeights(weights), handlers.WithIdempotencyTTL(*idempotencyTTL)}
+	if *attachmentsDir != "" {
+		blobStore, err := blobs.NewStore(*attachmentsDir)
+		if err != nil {
+			log.Fatalf("Failed to open attachment storage: %v", err)
+		}
+		limits := handlers.AttachmentLimits{MaxSize: *maxAttachmentSize}
+		for _, mediaType := range strings.Split(*attachmentTypes, ",") {
+			if mediaType = strings.TrimSpace(mediaType); mediaType != "" {
+				limits.Types = append(limits.Types, mediaType)
+			}
+		}
+		options = append(options, handlers.WithAttachments(blobStore, limits))
+		stopSweeper := blobStore.StartSweeper(store.BlobInUse, attachmentSweepInterval)
+		defer stopSweeper()
+	}
+
+	// Accept API keys, and bearer tokens when there is a key to verify them with
+	authenticators := []auth.Authenticator{auth.APIKeys(store.GetAPIKeyByHash, database.ErrAPIKeyNotFound)}
+	if *jwtKeyPath != "" {
+		jwtKey, err := auth.LoadJWTKey(*jwtKeyPath)
+		if err != nil {
+			log.Fatalf("Failed to load JWT key: %v", err)
+		}
+		authenticators = append(authenticators, auth.JWT(jwtKey))
+	}
+	protect := func(next http.Handler) http.Handler {
+		if !*requireAuth {
+			return next
+		}
+		return auth.Middleware(next, authenticators...)
+	}
+
 	// Set up the router
-	http.HandleFunc("/tasks", tasksRouter)
-	http.HandleFunc("/tasks/", tasksRouter)
-	
+	tasks := handlers.NewTasksHandler(store, options...)
+	users := handlers.NewUsersHandler(store)
+	http.Handle("/tasks", protect(tasksRouter(tasks)))
+	http.Handle("/tasks/", protect(tasksRouter(tasks)))
+	http.Handle("/tags", protect(handlers.NewTagsHandler(store)))
+	http.Handle("/users", protect(users))
+	http.Handle("/users/", protect(users))
+	projects := handlers.NewProjectsHandler(store)
+	http.Handle("/projects", protect(projects))
+	http.Handle("/projects/", protect(projects))
+	webhooksHandler := handlers.NewWebhooksHandler(store)
+	http.Handle("/webhooks", protect(webhooksHandler))
+	http.Handle("/webhooks/", protect(webhooksHandler))
+	http.Handle("/audit", protect(handlers.NewAuditHandler(store)))
+	http.Handle("/reports/", protect(handlers.NewReportsHandler(store)))
+
 	// Start the server
 	log.Println("Task Manager API server running on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	log.Fatal(http.ListenAndServe(":8080", handlers.RequestID(http.DefaultServeMux)))
 }
 
 // tasksRouter routes all requests to the tasks handler
-func tasksRouter(w http.ResponseWriter, r *http.Request) {
-	// Simple routing based on the URL path
-	if r.URL.Path == "/tasks" || strings.HasPrefix(r.URL.Path, "/tasks/") {
-		handlers.TasksHandler(w, r)
-		return
+func tasksRouter(tasks http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Simple routing based on the URL path
+		if r.URL.Path == "/tasks" || strings.HasPrefix(r.URL.Path, "/tasks/") {
+			tasks.ServeHTTP(w, r)
+			return
+		}
+
+		// If we get here, the path is not supported
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Not found"))
 	}
-	
-	// If we get here, the path is not supported
-	w.WriteHeader(http.StatusNotFound)
-	w.Write([]byte("Not found"))
 }
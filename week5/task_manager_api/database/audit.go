@@ -0,0 +1,137 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"task_manager_api/models"
+	"time"
+)
+
+// SystemActor is recorded as the actor of changes made without one, such as
+// those of the trash purger and the reminder scheduler
+const SystemActor = "system"
+
+// Actor identifies who makes a store's changes, for the audit log
+type Actor struct {
+	Name      string // who made the change; defaults to SystemActor
+	RequestID string // the request the change was made during, if any
+}
+
+// AuditFilter selects and pages the entries returned by ListAudit.
+// The zero value lists every entry, newest first.
+type AuditFilter struct {
+	Entity   string    // only entries about this kind of entity, such as models.AuditEntityTask
+	EntityID int       // only entries about the entity with this ID; 0 matches all
+	Since    time.Time // only entries made at or after this time
+	Until    time.Time // only entries made strictly before this time
+	Limit    int       // maximum entries per page; 0 means no limit
+	Cursor   string    // NextCursor from the previous page
+}
+
+// newAuditEntry returns the entry recording that actor changed an entity from
+// before to after. before is nil for an entity being created and after for one being removed.
+func newAuditEntry(actor Actor, entity string, entityID int, action string, before, after interface{}) (models.AuditEntry, error) {
+	entry := models.AuditEntry{
+		Entity:    entity,
+		EntityID:  entityID,
+		Action:    action,
+		Actor:     actor.Name,
+		RequestID: actor.RequestID,
+		CreatedAt: time.Now().UTC(),
+	}
+	if entry.Actor == "" {
+		entry.Actor = SystemActor
+	}
+
+	changes, err := models.Diff(before, after)
+	entry.Changes = changes
+	return entry, err
+}
+
+// taskAuditEntry returns the entry recording that actor changed a task from
+// before to after. before is nil for a task being created and after for one being purged.
+func taskAuditEntry(actor Actor, action string, before, after *models.Task) (models.AuditEntry, error) {
+	// Compare nil tasks as null rather than as zero-valued ones
+	var id int
+	var beforeValue, afterValue interface{}
+	if before != nil {
+		id, beforeValue = before.ID, before
+	}
+	if after != nil {
+		id, afterValue = after.ID, after
+	}
+	return newAuditEntry(actor, models.AuditEntityTask, id, action, beforeValue, afterValue)
+}
+
+// commentAuditEntry returns the entry recording that actor changed a comment
+// from before to after. before is nil for a comment being created and after for one being deleted.
+func commentAuditEntry(actor Actor, action string, before, after *models.Comment) (models.AuditEntry, error) {
+	var id int
+	var beforeValue, afterValue interface{}
+	if before != nil {
+		id, beforeValue = before.ID, before
+	}
+	if after != nil {
+		id, afterValue = after.ID, after
+	}
+	return newAuditEntry(actor, models.AuditEntityComment, id, action, beforeValue, afterValue)
+}
+
+// attachmentAuditEntry returns the entry recording that actor changed an
+// attachment from before to after. before is nil for an attachment being created
+// and after for one being deleted.
+func attachmentAuditEntry(actor Actor, action string, before, after *models.Attachment) (models.AuditEntry, error) {
+	var id int
+	var beforeValue, afterValue interface{}
+	if before != nil {
+		id, beforeValue = before.ID, before
+	}
+	if after != nil {
+		id, afterValue = after.ID, after
+	}
+	return newAuditEntry(actor, models.AuditEntityAttachment, id, action, beforeValue, afterValue)
+}
+
+// timeEntryAuditEntry returns the entry recording that actor changed a time
+// entry from before to after. before is nil for an entry being created and
+// after for one being deleted.
+func timeEntryAuditEntry(actor Actor, action string, before, after *models.TimeEntry) (models.AuditEntry, error) {
+	var id int
+	var beforeValue, afterValue interface{}
+	if before != nil {
+		id, beforeValue = before.ID, before
+	}
+	if after != nil {
+		id, afterValue = after.ID, after
+	}
+	return newAuditEntry(actor, models.AuditEntityTimeEntry, id, action, beforeValue, afterValue)
+}
+
+// auditCursor is the position of the last entry on a page of the audit log
+type auditCursor struct {
+	ID int `json:"id"`
+}
+
+// encodeAuditCursor turns the ID of the last entry on a page into the opaque string handed to clients
+func encodeAuditCursor(id int) string {
+	data, _ := json.Marshal(auditCursor{ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeAuditCursor returns the ID of the last entry on the previous page, or 0 for the first page
+func decodeAuditCursor(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	var c auditCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.ID < 1 {
+		return 0, ErrInvalidCursor
+	}
+
+	return c.ID, nil
+}
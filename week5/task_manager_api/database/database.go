@@ -2,180 +2,2421 @@ package database
 
 import (
 	"database/sql"
-	"log"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"task_manager_api/models"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// DB is the database connection
-var DB *sql.DB
+// SQLiteStore is a TaskStore backed by a SQLite database
+type SQLiteStore struct {
+	db  *sql.DB
+	q   querier // db, or the transaction a store returned by RunInTx works in
+	tx  *sql.Tx // nil outside RunInTx
+	fts bool    // whether the tasks_fts search index is available
 
-// InitDB initializes the database connection and creates the tasks table if it doesn't exist
-func InitDB(dataSourceName string) {
-	var err error
-	DB, err = sql.Open("sqlite3", dataSourceName)
+	savepoints int // savepoints started in tx so far, used to name the next one
+
+	log    *EventLog
+	events eventSink // log, or the events of the transaction a store returned by RunInTx works in
+	actor  Actor     // recorded in the audit log as making the store's changes
+}
+
+// Open opens the SQLite database at dataSourceName with foreign keys enforced
+func Open(dataSourceName string) (*sql.DB, error) {
+	separator := "?"
+	if strings.Contains(dataSourceName, "?") {
+		separator = "&"
+	}
+
+	db, err := sql.Open("sqlite3", dataSourceName+separator+"_foreign_keys=on")
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	// SQLite allows a single writer, and every connection to ":memory:"
+	// gets its own empty database, so keep the pool to one connection
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+
+	return db, nil
+}
+
+// NewSQLiteStore opens the SQLite database at dataSourceName and applies any pending migrations
+func NewSQLiteStore(dataSourceName string) (*SQLiteStore, error) {
+	db, err := Open(dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := migrator.Up(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate database: %w", err)
+	}
+
+	log := NewEventLog(DefaultEventLogSize)
+	store := &SQLiteStore{db: db, q: db, log: log, events: log}
+	if err := store.initSearchIndex(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create search index: %w", err)
+	}
+
+	return store, nil
+}
+
+// initSearchIndex creates the tasks_fts full-text index and the triggers that
+// keep it in sync with the tasks table. FTS5 is only compiled into the driver
+// with the sqlite_fts5 build tag; without it the store works but cannot search.
+func (s *SQLiteStore) initSearchIndex() error {
+	if err := s.db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&s.fts); err != nil {
+		return err
+	}
+	if !s.fts {
+		return nil
+	}
+
+	// An index created for an existing database must be filled from the tasks table
+	var exists int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'tasks_fts'").Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS tasks_fts USING fts5(
+			title, description, content='tasks', content_rowid='id'
+		)`,
+		`CREATE TRIGGER IF NOT EXISTS tasks_fts_insert AFTER INSERT ON tasks BEGIN
+			INSERT INTO tasks_fts(rowid, title, description) VALUES (new.id, new.title, new.description);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS tasks_fts_delete AFTER DELETE ON tasks BEGIN
+			INSERT INTO tasks_fts(tasks_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS tasks_fts_update AFTER UPDATE OF title, description ON tasks BEGIN
+			INSERT INTO tasks_fts(tasks_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+			INSERT INTO tasks_fts(rowid, title, description) VALUES (new.id, new.title, new.description);
+		END`,
+	}
+	if exists == 0 {
+		statements = append(statements, `INSERT INTO tasks_fts(tasks_fts) VALUES ('rebuild')`)
+	}
+
+	for _, statement := range statements {
+		if _, err := s.db.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the underlying database connection
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// CreateTask adds a new task to the database and records its initial status and creation
+func (s *SQLiteStore) CreateTask(task models.Task) (int64, error) {
+	tx, err := s.begin()
 	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+		return 0, err
 	}
-	if err := DB.Ping(); err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+	defer tx.Rollback()
+
+	id, err := insertTask(tx, task)
+	if err != nil {
+		return 0, err
 	}
-	
-	createTable := `CREATE TABLE IF NOT EXISTS tasks (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		title TEXT NOT NULL,
-		description TEXT,
-		status TEXT NOT NULL,
-		due_date DATETIME,
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL
-	);`
-	
-	_, err = DB.Exec(createTable)
+	created, err := getTask(tx, int(id))
 	if err != nil {
-		log.Fatalf("Failed to create table: %v", err)
+		return 0, err
 	}
+	if err := s.recordAudit(tx, models.AuditCreate, nil, &created); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	s.events.publish(taskEvent(models.EventTaskCreated, created))
+	return id, nil
 }
 
-// CreateTask adds a new task to the database
-func CreateTask(task models.Task) (int64, error) {
-	now := time.Now()
+// insertTask adds a new task through q, with its initial status and tags.
+// A recurring task without a series starts one of its own.
+func insertTask(q querier, task models.Task) (int64, error) {
+	now := time.Now().UTC()
 	task.CreatedAt = now
 	task.UpdatedAt = now
-	
+
 	if task.Status == "" {
-		task.Status = "pending"
+		task.Status = models.StatusPending
+	}
+	if task.Priority == "" {
+		task.Priority = models.PriorityMedium
+	}
+
+	if err := checkParent(q, task.ParentID); err != nil {
+		return 0, err
+	}
+	if err := checkUser(q, task.AssigneeID); err != nil {
+		return 0, err
 	}
-	
-	query := `INSERT INTO tasks 
-		(title, description, status, due_date, created_at, updated_at) 
-		VALUES (?, ?, ?, ?, ?, ?)`
-	
-	res, err := DB.Exec(query, 
-		task.Title, 
-		task.Description, 
-		task.Status, 
-		task.DueDate, 
-		task.CreatedAt, 
-		task.UpdatedAt)
-	
+	if err := checkProject(q, task.ProjectID); err != nil {
+		return 0, err
+	}
+	position, err := taskPosition(task, nil, func() (string, error) {
+		return lastPosition(q, *task.ProjectID, task.Status, 0)
+	})
 	if err != nil {
 		return 0, err
 	}
-	
-	return res.LastInsertId()
+	task.Position = position
+
+	query := `INSERT INTO tasks
+		(title, description, status, due_date, created_at, updated_at, parent_id, created_by, assignee_id, recurrence, series_id,
+		project_id, position, estimate_minutes, priority)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	res, err := q.Exec(query,
+		task.Title,
+		task.Description,
+		task.Status,
+		nullTime(task.DueDate),
+		task.CreatedAt,
+		task.UpdatedAt,
+		task.ParentID,
+		task.CreatedBy,
+		task.AssigneeID,
+		task.Recurrence,
+		task.SeriesID,
+		task.ProjectID,
+		task.Position,
+		task.Estimate,
+		task.Priority)
+
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if task.Recurrence != "" && task.SeriesID == nil {
+		if _, err := q.Exec("UPDATE tasks SET series_id = id WHERE id = ?", id); err != nil {
+			return 0, err
+		}
+	}
+	if err := recordStatusChange(q, int(id), "", task.Status, now); err != nil {
+		return 0, err
+	}
+	if err := setTags(q, int(id), task.Tags); err != nil {
+		return 0, err
+	}
+
+	return id, nil
 }
 
 // GetAllTasks retrieves all tasks from the database
-func GetAllTasks() ([]models.Task, error) {
-	query := `SELECT id, title, description, status, due_date, created_at, updated_at 
-		FROM tasks ORDER BY created_at DESC`
-	
-	rows, err := DB.Query(query)
+func (s *SQLiteStore) GetAllTasks() ([]models.Task, error) {
+	page, err := s.ListTasks(TaskFilter{})
+	return page.Tasks, err
+}
+
+// sortExpressions maps each sort field to the SQL expression ordered on.
+// Tasks without a due date sort as if they were due at the end of time.
+var sortExpressions = map[string]string{
+	SortCreatedAt: "created_at",
+	SortUpdatedAt: "updated_at",
+	SortDueDate:   "COALESCE(due_date, '9999-12-31 23:59:59+00:00')",
+	SortTitle:     "title",
+	SortDeletedAt: "COALESCE(deleted_at, '9999-12-31 23:59:59+00:00')",
+}
+
+// ListTasks retrieves one page of the tasks matching filter
+func (s *SQLiteStore) ListTasks(filter TaskFilter) (models.TaskPage, error) {
+	filter = filter.withDefaults()
+	page := models.TaskPage{Tasks: []models.Task{}}
+
+	sortExpr, ok := sortExpressions[filter.Sort]
+	if !ok {
+		return page, fmt.Errorf("unknown sort field %q", filter.Sort)
+	}
+
+	// Build the WHERE clause shared by the count and page queries
+	conditions := []string{"deleted_at IS NULL"}
+	if filter.Trashed {
+		conditions = []string{"deleted_at IS NOT NULL"}
+	}
+	var args []interface{}
+	if len(filter.Statuses) > 0 {
+		conditions = append(conditions, "status IN (?"+strings.Repeat(", ?", len(filter.Statuses)-1)+")")
+		for _, status := range filter.Statuses {
+			args = append(args, status)
+		}
+	}
+	if !filter.DueBefore.IsZero() {
+		conditions = append(conditions, "due_date < ?")
+		args = append(args, filter.DueBefore.UTC())
+	}
+	if !filter.DueAfter.IsZero() {
+		conditions = append(conditions, "due_date > ?")
+		args = append(args, filter.DueAfter.UTC())
+	}
+	if filter.UserID != 0 {
+		conditions = append(conditions, "(created_by = ? OR assignee_id = ?)")
+		args = append(args, filter.UserID, filter.UserID)
+	}
+	if filter.ProjectID != 0 {
+		conditions = append(conditions, "project_id = ?")
+		args = append(args, filter.ProjectID)
+	}
+	if len(filter.Tags) > 0 {
+		// With TagModeAll a task must have as many of the tags as were asked for
+		condition := `id IN (SELECT tt.task_id FROM task_tags tt JOIN tags g ON g.id = tt.tag_id
+			WHERE g.name IN (?` + strings.Repeat(", ?", len(filter.Tags)-1) + `)`
+		for _, tag := range filter.Tags {
+			args = append(args, tag)
+		}
+		if filter.TagMode == TagModeAll {
+			condition += " GROUP BY tt.task_id HAVING COUNT(*) = ?"
+			args = append(args, len(filter.Tags))
+		}
+		conditions = append(conditions, condition+")")
+	}
+
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	// Count every matching task, ignoring the cursor and limit
+	if err := s.q.QueryRow("SELECT COUNT(*) FROM tasks"+where, args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	// Resume after the last task of the previous page
+	if filter.Cursor != "" {
+		c, err := decodeCursor(filter)
+		if err != nil {
+			return page, err
+		}
+
+		op := ">"
+		if filter.Order == OrderDesc {
+			op = "<"
+		}
+		conditions = append(conditions, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", sortExpr, op))
+		args = append(args, c.Key, c.Key, c.ID)
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	direction := "ASC"
+	if filter.Order == OrderDesc {
+		direction = "DESC"
+	}
+
+	query := `SELECT ` + selectTaskColumns("") + `, CAST(` + sortExpr + ` AS TEXT)
+		FROM tasks` + where + `
+		ORDER BY ` + sortExpr + ` ` + direction + `, id ` + direction
+
+	// Fetch one extra row to find out whether there is another page
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit+1)
+	}
+
+	rows, err := s.q.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return page, err
 	}
 	defer rows.Close()
-	
-	var tasks []models.Task
+
+	var lastKey string
 	for rows.Next() {
-		var task models.Task
-		var dueDate sql.NullTime
-		
-		err := rows.Scan(
-			&task.ID, 
-			&task.Title, 
-			&task.Description, 
-			&task.Status, 
-			&dueDate, 
-			&task.CreatedAt, 
-			&task.UpdatedAt)
-		
+		if filter.Limit > 0 && len(page.Tasks) == filter.Limit {
+			last := page.Tasks[len(page.Tasks)-1]
+			page.NextCursor = encodeCursor(cursor{Sort: filter.Sort, Order: filter.Order, Key: lastKey, ID: last.ID})
+			break
+		}
+
+		var key string
+		task, err := scanTask(rows, &key)
 		if err != nil {
-			return nil, err
+			return page, err
 		}
-		
-		if dueDate.Valid {
-			task.DueDate = dueDate.Time
+		page.Tasks = append(page.Tasks, task)
+		lastKey = key
+	}
+
+	return page, rows.Err()
+}
+
+// SearchTasks ranks tasks matching query by relevance, weighting title
+// matches above description matches, and returns one page of results
+func (s *SQLiteStore) SearchTasks(query string, limit int, cursor string) (models.SearchPage, error) {
+	page := models.SearchPage{Tasks: []models.SearchResult{}}
+
+	terms, err := parseSearchQuery(query)
+	if err != nil {
+		return page, err
+	}
+	offset, err := decodeSearchCursor(cursor, query)
+	if err != nil {
+		return page, err
+	}
+	if !s.fts {
+		return page, ErrSearchUnavailable
+	}
+	match := ftsQuery(terms)
+	if limit <= 0 {
+		limit = -1
+	}
+
+	err = s.q.QueryRow(`SELECT COUNT(*)
+		FROM tasks_fts JOIN tasks t ON t.id = tasks_fts.rowid
+		WHERE tasks_fts MATCH ? AND t.deleted_at IS NULL`, match).Scan(&page.Total)
+	if err != nil {
+		return page, err
+	}
+
+	// bm25 scores are negative with the best match lowest. The highlights are made
+	// like MemoryStore's rather than by FTS5's highlight() and snippet(), which
+	// leave the text around their markers unescaped.
+	rows, err := s.q.Query(`SELECT `+selectTaskColumns("t.")+`,
+			-bm25(tasks_fts, 10.0, 1.0)
+		FROM tasks_fts JOIN tasks t ON t.id = tasks_fts.rowid
+		WHERE tasks_fts MATCH ? AND t.deleted_at IS NULL
+		ORDER BY bm25(tasks_fts, 10.0, 1.0), t.id
+		LIMIT ? OFFSET ?`,
+		match, limit, offset)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result models.SearchResult
+		result.Task, err = scanTask(rows, &result.Score)
+		if err != nil {
+			return page, err
 		}
-		
-		tasks = append(tasks, task)
+		result.Highlights.Title = highlight(result.Task.Title, terms, 0)
+		result.Highlights.Description = highlight(result.Task.Description, terms, snippetWords)
+
+		page.Tasks = append(page.Tasks, result)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	if next := offset + len(page.Tasks); next < page.Total && len(page.Tasks) > 0 {
+		page.NextCursor = encodeSearchCursor(searchCursor{Query: query, Offset: next})
 	}
-	
-	return tasks, nil
+
+	return page, nil
 }
 
-// GetTaskByID retrieves a single task by ID
-func GetTaskByID(id int) (models.Task, error) {
-	query := `SELECT id, title, description, status, due_date, created_at, updated_at 
-		FROM tasks WHERE id = ?`
-	
-	var task models.Task
-	var dueDate sql.NullTime
-	
-	err := DB.QueryRow(query, id).Scan(
-		&task.ID, 
-		&task.Title, 
-		&task.Description, 
-		&task.Status, 
-		&dueDate, 
-		&task.CreatedAt, 
-		&task.UpdatedAt)
-	
-	if dueDate.Valid {
-		task.DueDate = dueDate.Time
+// GetTaskByID retrieves a single task by ID, unless it is in the trash
+func (s *SQLiteStore) GetTaskByID(id int) (models.Task, error) {
+	return getTask(s.q, id)
+}
+
+// GetTrashedTask retrieves a single task by ID if it is in the trash
+func (s *SQLiteStore) GetTrashedTask(id int) (models.Task, error) {
+	query := `SELECT ` + selectTaskColumns("") + `
+		FROM tasks WHERE id = ? AND deleted_at IS NOT NULL`
+
+	task, err := scanTask(s.q.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return task, ErrTaskNotFound
 	}
-	
+
 	return task, err
 }
 
-// UpdateTask updates an existing task
-func UpdateTask(id int, task models.Task) error {
-	existingTask, err := GetTaskByID(id)
-	if err != nil {
-		return err
-	}
-	
-	// Update only the fields that are provided
-	if task.Title != "" {
-		existingTask.Title = task.Title
-	}
-	if task.Description != "" {
-		existingTask.Description = task.Description
-	}
-	if task.Status != "" {
-		existingTask.Status = task.Status
-	}
-	if !task.DueDate.IsZero() {
-		existingTask.DueDate = task.DueDate
-	}
-	
-	existingTask.UpdatedAt = time.Now()
-	
-	query := `UPDATE tasks SET 
-		title = ?, 
-		description = ?, 
-		status = ?, 
-		due_date = ?, 
-		updated_at = ? 
-		WHERE id = ?`
-	
-	_, err = DB.Exec(query, 
-		existingTask.Title, 
-		existingTask.Description, 
-		existingTask.Status, 
-		existingTask.DueDate, 
-		existingTask.UpdatedAt, 
-		id)
-	
-	return err
+// getAnyTask retrieves a single task by ID through q, whether or not it is in the trash
+func getAnyTask(q querier, id int) (models.Task, error) {
+	task, err := scanTask(q.QueryRow(`SELECT `+selectTaskColumns("")+` FROM tasks WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return task, ErrTaskNotFound
+	}
+	return task, err
 }
 
-// DeleteTask removes a task from the database
-func DeleteTask(id int) error {
-	query := "DELETE FROM tasks WHERE id = ?"
-	_, err := DB.Exec(query, id)
-	return err
+// getTask retrieves a single task that isn't in the trash by ID through q
+func getTask(q querier, id int) (models.Task, error) {
+	query := `SELECT ` + selectTaskColumns("") + `
+		FROM tasks WHERE id = ? AND deleted_at IS NULL`
+
+	task, err := scanTask(q.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return task, ErrTaskNotFound
+	}
+
+	return task, err
+}
+
+// UpdateTask updates an existing task, recording any status change and the
+// update, reading, checking the version and writing inside one transaction
+func (s *SQLiteStore) UpdateTask(id int, task models.Task) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	existingTask, err := getTask(tx, id)
+	if err != nil {
+		return err
+	}
+	if task.Version != 0 && task.Version != existingTask.Version {
+		return ErrVersionConflict
+	}
+	before := existingTask
+	previousStatus := existingTask.Status
+
+	// A task can't become a subtask of itself or of one of its own subtasks
+	if err := checkParent(tx, task.ParentID); err != nil {
+		return err
+	}
+	if task.ParentID != nil {
+		if err := checkCycle(id, *task.ParentID, parentsOf(tx)); err != nil {
+			return err
+		}
+	}
+	if err := checkUser(tx, task.AssigneeID); err != nil {
+		return err
+	}
+	if err := checkProject(tx, task.ProjectID); err != nil {
+		return err
+	}
+	position, err := taskPosition(task, &existingTask, func() (string, error) {
+		return lastPosition(tx, *task.ProjectID, task.Status, id)
+	})
+	if err != nil {
+		return err
+	}
+
+	// A new due date isn't overdue until the scheduler finds it so
+	if !task.DueDate.Equal(existingTask.DueDate) {
+		existingTask.OverdueAt = nil
+	}
+
+	// Replace every field the client controls; a zero due date clears it
+	existingTask.Title = task.Title
+	existingTask.Description = task.Description
+	existingTask.Status = task.Status
+	existingTask.DueDate = task.DueDate
+	existingTask.ParentID = task.ParentID
+	existingTask.Tags = models.NormalizeTags(task.Tags)
+	existingTask.AssigneeID = task.AssigneeID
+	existingTask.ProjectID = task.ProjectID
+	existingTask.Position = position
+	existingTask.Estimate = task.Estimate
+	existingTask.Priority = task.Priority
+	if existingTask.Priority == "" {
+		existingTask.Priority = models.PriorityMedium
+	}
+	recurrence, err := models.NormalizeRecurrence(task.Recurrence)
+	if err != nil {
+		return err
+	}
+	existingTask.Recurrence = recurrence
+	if existingTask.Recurrence != "" && existingTask.SeriesID == nil {
+		existingTask.SeriesID = &existingTask.ID
+	}
+
+	existingTask.UpdatedAt = time.Now().UTC()
+
+	query := `UPDATE tasks SET
+		title = ?,
+		description = ?,
+		status = ?,
+		due_date = ?,
+		parent_id = ?,
+		assignee_id = ?,
+		recurrence = ?,
+		series_id = ?,
+		overdue_at = ?,
+		project_id = ?,
+		position = ?,
+		estimate_minutes = ?,
+		priority = ?,
+		updated_at = ?,
+		version = version + 1
+		WHERE id = ? AND version = ?`
+
+	res, err := tx.Exec(query,
+		existingTask.Title,
+		existingTask.Description,
+		existingTask.Status,
+		nullTime(existingTask.DueDate),
+		existingTask.ParentID,
+		existingTask.AssigneeID,
+		existingTask.Recurrence,
+		existingTask.SeriesID,
+		existingTask.OverdueAt,
+		existingTask.ProjectID,
+		existingTask.Position,
+		existingTask.Estimate,
+		existingTask.Priority,
+		existingTask.UpdatedAt,
+		id,
+		existingTask.Version)
+	if err != nil {
+		return err
+	}
+	if updated, err := res.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return ErrVersionConflict
+	}
+
+	if existingTask.Status != previousStatus {
+		err = recordStatusChange(tx, id, previousStatus, existingTask.Status, existingTask.UpdatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	if err := setTags(tx, id, existingTask.Tags); err != nil {
+		return err
+	}
+	updated, err := getTask(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.recordAudit(tx, models.AuditUpdate, &before, &updated); err != nil {
+		return err
+	}
+	events := []models.TaskEvent{taskEvent(models.EventTaskUpdated, updated)}
+	if existingTask.Status == models.StatusCompleted && previousStatus != models.StatusCompleted {
+		nextID, err := scheduleNextOccurrence(tx, existingTask, existingTask.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		if nextID != 0 {
+			next, err := getTask(tx, int(nextID))
+			if err != nil {
+				return err
+			}
+			if err := s.recordAudit(tx, models.AuditCreate, nil, &next); err != nil {
+				return err
+			}
+			events = append(events, taskEvent(models.EventTaskCreated, next))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.events.publish(events...)
+	return nil
+}
+
+// DeleteTask moves a task to the trash and records the deletion
+func (s *SQLiteStore) DeleteTask(id int, version int) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getTask(tx, id)
+	if errors.Is(err, ErrTaskNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if version != 0 && before.Version != version {
+		return ErrVersionConflict
+	}
+
+	now := time.Now().UTC()
+	_, err = tx.Exec("UPDATE tasks SET deleted_at = ?, version = version + 1 WHERE id = ?", now, id)
+	if err != nil {
+		return err
+	}
+	task, err := getAnyTask(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.recordAudit(tx, models.AuditDelete, &before, &task); err != nil {
+		return err
+	}
+	if err := s.stopTimers(tx, id, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.events.publish(taskEvent(models.EventTaskDeleted, task))
+	return nil
+}
+
+// PurgeTask permanently removes a task, whether or not it is in the trash;
+// its status history and dependencies are removed with it, and the
+// tasks_orphan_subtasks trigger turns its subtasks into top-level tasks
+func (s *SQLiteStore) PurgeTask(id int, version int) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	task, err := getAnyTask(tx, id)
+	if errors.Is(err, ErrTaskNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if version != 0 && task.Version != version {
+		return ErrVersionConflict
+	}
+	events, err := s.purgeTask(tx, task, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.events.publish(events...)
+	return nil
+}
+
+// purgeTask permanently removes task through q, records the purge and the
+// detaching of the subtasks the tasks_orphan_subtasks trigger makes top-level,
+// and returns the events for them, leaving out subtasks in skip
+func (s *SQLiteStore) purgeTask(q querier, task models.Task, skip map[int]bool) ([]models.TaskEvent, error) {
+	ids, err := queryTaskIDs(q, "SELECT id FROM tasks WHERE parent_id = ?", task.ID)
+	if err != nil {
+		return nil, err
+	}
+	var subtasks []models.Task
+	for _, id := range ids {
+		if skip[id] {
+			continue
+		}
+		subtask, err := getAnyTask(q, id)
+		if err != nil {
+			return nil, err
+		}
+		subtasks = append(subtasks, subtask)
+	}
+
+	if _, err := q.Exec("DELETE FROM tasks WHERE id = ?", task.ID); err != nil {
+		return nil, err
+	}
+	if err := s.recordAudit(q, models.AuditPurge, &task, nil); err != nil {
+		return nil, err
+	}
+
+	events := []models.TaskEvent{taskEvent(models.EventTaskDeleted, task)}
+	for _, before := range subtasks {
+		subtask, err := getAnyTask(q, before.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.recordAudit(q, models.AuditUpdate, &before, &subtask); err != nil {
+			return nil, err
+		}
+		events = append(events, taskEvent(models.EventTaskUpdated, subtask))
+	}
+	return events, nil
+}
+
+// queryTaskIDs runs a query selecting task IDs through q
+func queryTaskIDs(q querier, query string, args ...interface{}) ([]int, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// RestoreTask moves a task out of the trash and records the restoration
+func (s *SQLiteStore) RestoreTask(id int) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getAnyTask(tx, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt == nil {
+		return ErrTaskNotFound
+	}
+
+	if _, err := tx.Exec("UPDATE tasks SET deleted_at = NULL, version = version + 1 WHERE id = ?", id); err != nil {
+		return err
+	}
+	task, err := getTask(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.recordAudit(tx, models.AuditRestore, &before, &task); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.events.publish(taskEvent(models.EventTaskUpdated, task))
+	return nil
+}
+
+// PurgeTrash permanently removes every task that was moved to the trash before cutoff
+func (s *SQLiteStore) PurgeTrash(cutoff time.Time) (int64, error) {
+	tx, err := s.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	expired, err := queryTaskIDs(tx, "SELECT id FROM tasks WHERE deleted_at IS NOT NULL AND deleted_at < ?", cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	// Subtasks purged along with their parent get no update event
+	purging := make(map[int]bool, len(expired))
+	for _, id := range expired {
+		purging[id] = true
+	}
+	var events []models.TaskEvent
+	for _, id := range expired {
+		task, err := getAnyTask(tx, id)
+		if err != nil {
+			return 0, err
+		}
+		taskEvents, err := s.purgeTask(tx, task, purging)
+		if err != nil {
+			return 0, err
+		}
+		events = append(events, taskEvents...)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	s.events.publish(events...)
+	return int64(len(expired)), nil
+}
+
+// recordStatusChange appends an entry to a task's status history
+func recordStatusChange(q querier, taskID int, from, to models.Status, at time.Time) error {
+	var fromStatus interface{}
+	if from != "" {
+		fromStatus = from
+	}
+
+	_, err := q.Exec(`INSERT INTO task_status_history (task_id, from_status, to_status, changed_at)
+		VALUES (?, ?, ?, ?)`, taskID, fromStatus, to, at.UTC())
+	return err
+}
+
+// GetStatusHistory returns every status change of a task, oldest first
+func (s *SQLiteStore) GetStatusHistory(id int) ([]models.StatusChange, error) {
+	if _, err := s.GetTaskByID(id); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.q.Query(`SELECT id, task_id, from_status, to_status, changed_at
+		FROM task_status_history WHERE task_id = ? ORDER BY changed_at, id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []models.StatusChange{}
+	for rows.Next() {
+		var change models.StatusChange
+		var from sql.NullString
+		if err := rows.Scan(&change.ID, &change.TaskID, &from, &change.To, &change.At); err != nil {
+			return nil, err
+		}
+		change.From = models.Status(from.String)
+		history = append(history, change)
+	}
+
+	return history, rows.Err()
+}
+
+// checkParent returns ErrParentNotFound unless parentID is nil or a task outside the trash
+func checkParent(q querier, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	if _, err := getTask(q, *parentID); errors.Is(err, ErrTaskNotFound) {
+		return ErrParentNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// parentsOf returns a findPath step from a task to its parent, through q
+func parentsOf(q querier) func(id int) ([]int, error) {
+	return func(id int) ([]int, error) {
+		var parentID sql.NullInt64
+		err := q.QueryRow("SELECT parent_id FROM tasks WHERE id = ?", id).Scan(&parentID)
+		if errors.Is(err, sql.ErrNoRows) || !parentID.Valid {
+			return nil, nil
+		}
+		return []int{int(parentID.Int64)}, err
+	}
+}
+
+// blockedBy returns a findPath step from a task to the tasks it blocks, through q
+func blockedBy(q querier) func(id int) ([]int, error) {
+	return func(id int) ([]int, error) {
+		rows, err := q.Query("SELECT blocked_id FROM task_dependencies WHERE blocker_id = ? ORDER BY blocked_id", id)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var blocked []int
+		for rows.Next() {
+			var blockedID int
+			if err := rows.Scan(&blockedID); err != nil {
+				return nil, err
+			}
+			blocked = append(blocked, blockedID)
+		}
+		return blocked, rows.Err()
+	}
+}
+
+// GetSubtasks returns the subtasks of a task that aren't in the trash, oldest first
+func (s *SQLiteStore) GetSubtasks(id int) ([]models.Task, error) {
+	if _, err := s.GetTaskByID(id); err != nil {
+		return nil, err
+	}
+
+	return s.queryTasks(`SELECT `+selectTaskColumns("")+`
+		FROM tasks WHERE parent_id = ? AND deleted_at IS NULL ORDER BY id`, id)
+}
+
+// GetBlockers returns the tasks blocking a task that aren't in the trash, oldest first
+func (s *SQLiteStore) GetBlockers(id int) ([]models.Task, error) {
+	if _, err := s.GetTaskByID(id); err != nil {
+		return nil, err
+	}
+
+	return s.queryTasks(`SELECT `+selectTaskColumns("t.")+`
+		FROM task_dependencies d JOIN tasks t ON t.id = d.blocker_id
+		WHERE d.blocked_id = ? AND t.deleted_at IS NULL ORDER BY t.id`, id)
+}
+
+// OpenDependencies returns the dependencies between open tasks outside the trash
+func (s *SQLiteStore) OpenDependencies() ([]Dependency, error) {
+	rows, err := s.q.Query(`SELECT d.blocker_id, d.blocked_id
+		FROM task_dependencies d
+		JOIN tasks blocker ON blocker.id = d.blocker_id
+		JOIN tasks blocked ON blocked.id = d.blocked_id
+		WHERE blocker.deleted_at IS NULL AND blocker.status != ?
+		AND blocked.deleted_at IS NULL AND blocked.status != ?
+		ORDER BY d.blocker_id, d.blocked_id`, models.StatusCompleted, models.StatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dependencies := []Dependency{}
+	for rows.Next() {
+		var dependency Dependency
+		if err := rows.Scan(&dependency.BlockerID, &dependency.BlockedID); err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, dependency)
+	}
+	return dependencies, rows.Err()
+}
+
+// scheduleNextOccurrence creates the occurrence that follows a recurring task
+// completed at completedAt and returns its ID, unless the series ends or already
+// continues past it, as it does when an occurrence is reopened and completed
+// again; then it returns 0
+func scheduleNextOccurrence(q querier, task models.Task, completedAt time.Time) (int64, error) {
+	if task.Recurrence == "" || task.SeriesID == nil {
+		return 0, nil
+	}
+
+	var continues bool
+	err := q.QueryRow("SELECT COUNT(*) > 0 FROM tasks WHERE series_id = ? AND id > ?", *task.SeriesID, task.ID).Scan(&continues)
+	if err != nil || continues {
+		return 0, err
+	}
+
+	next, ok := models.NextOccurrence(task, completedAt)
+	if !ok {
+		return 0, nil
+	}
+	// A parent that has gone to the trash isn't carried over
+	if err := checkParent(q, next.ParentID); errors.Is(err, ErrParentNotFound) {
+		next.ParentID = nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return insertTask(q, next)
+}
+
+// MarkOverdue records that an open task outside the trash was found past its due date at
+func (s *SQLiteStore) MarkOverdue(id int, at time.Time) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getTask(tx, id)
+	if errors.Is(err, ErrTaskNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`UPDATE tasks SET overdue_at = ?, version = version + 1
+		WHERE id = ? AND overdue_at IS NULL AND status <> ?`,
+		at.UTC(), id, models.StatusCompleted)
+	if err != nil {
+		return err
+	}
+	if marked, err := res.RowsAffected(); err != nil || marked == 0 {
+		return err
+	}
+
+	task, err := getTask(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.recordAudit(tx, models.AuditUpdate, &before, &task); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.events.publish(taskEvent(models.EventTaskUpdated, task))
+	return nil
+}
+
+// Events returns the log of the changes made to tasks
+func (s *SQLiteStore) Events() *EventLog {
+	return s.log
+}
+
+// WithActor returns a store on the same database whose changes to tasks are
+// recorded in the audit log as made by actor
+func (s *SQLiteStore) WithActor(actor Actor) TaskStore {
+	store := *s
+	store.actor = actor
+	return &store
+}
+
+// recordAudit appends the entry for a change to a task by the store's actor through q
+func (s *SQLiteStore) recordAudit(q querier, action string, before, after *models.Task) error {
+	entry, err := taskAuditEntry(s.actor, action, before, after)
+	if err != nil {
+		return err
+	}
+	return insertAuditEntry(q, entry)
+}
+
+// recordCommentAudit appends the entry for a change to a comment by the store's actor through q
+func (s *SQLiteStore) recordCommentAudit(q querier, action string, before, after *models.Comment) error {
+	entry, err := commentAuditEntry(s.actor, action, before, after)
+	if err != nil {
+		return err
+	}
+	return insertAuditEntry(q, entry)
+}
+
+// recordAttachmentAudit appends the entry for a change to an attachment by the store's actor through q
+func (s *SQLiteStore) recordAttachmentAudit(q querier, action string, before, after *models.Attachment) error {
+	entry, err := attachmentAuditEntry(s.actor, action, before, after)
+	if err != nil {
+		return err
+	}
+	return insertAuditEntry(q, entry)
+}
+
+// recordTimeEntryAudit appends the entry for a change to a time entry by the store's actor through q
+func (s *SQLiteStore) recordTimeEntryAudit(q querier, action string, before, after *models.TimeEntry) error {
+	entry, err := timeEntryAuditEntry(s.actor, action, before, after)
+	if err != nil {
+		return err
+	}
+	return insertAuditEntry(q, entry)
+}
+
+// insertAuditEntry appends entry to the audit log through q
+func insertAuditEntry(q querier, entry models.AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(`INSERT INTO audit_log (entity, entity_id, action, actor, request_id, changes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		entry.Entity, entry.EntityID, entry.Action, entry.Actor, entry.RequestID, string(changes), entry.CreatedAt)
+	return err
+}
+
+// ListAudit retrieves one page of the audit log entries matching filter, newest first
+func (s *SQLiteStore) ListAudit(filter AuditFilter) (models.AuditPage, error) {
+	page := models.AuditPage{Entries: []models.AuditEntry{}}
+	afterID, err := decodeAuditCursor(filter.Cursor)
+	if err != nil {
+		return page, err
+	}
+
+	var conditions []string
+	var args []interface{}
+	if filter.Entity != "" {
+		conditions = append(conditions, "entity = ?")
+		args = append(args, filter.Entity)
+	}
+	if filter.EntityID != 0 {
+		conditions = append(conditions, "entity_id = ?")
+		args = append(args, filter.EntityID)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.Until.UTC())
+	}
+	if afterID != 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, afterID)
+	}
+
+	query := "SELECT id, entity, entity_id, action, actor, request_id, changes, created_at FROM audit_log"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		// Fetch one extra entry to find out whether there is another page
+		query += " LIMIT ?"
+		args = append(args, filter.Limit+1)
+	}
+
+	rows, err := s.q.Query(query, args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.AuditEntry
+		var changes string
+		if err := rows.Scan(&entry.ID, &entry.Entity, &entry.EntityID, &entry.Action, &entry.Actor,
+			&entry.RequestID, &changes, &entry.CreatedAt); err != nil {
+			return page, err
+		}
+		if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			return page, err
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	if filter.Limit > 0 && len(page.Entries) > filter.Limit {
+		page.Entries = page.Entries[:filter.Limit]
+		page.NextCursor = encodeAuditCursor(page.Entries[filter.Limit-1].ID)
+	}
+	return page, nil
+}
+
+// ClaimReminder records that the reminder for a task, threshold and due date is
+// being sent, and reports whether it hadn't been already
+func (s *SQLiteStore) ClaimReminder(taskID int, threshold string, dueDate time.Time) (bool, error) {
+	res, err := s.q.Exec(`INSERT OR IGNORE INTO task_reminders (task_id, threshold, due_date, sent_at)
+		VALUES (?, ?, ?, ?)`, taskID, threshold, dueDate.UTC(), time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	claimed, err := res.RowsAffected()
+	return claimed == 1, err
+}
+
+// GetSeries returns the occurrences of a task's recurring series that aren't in the trash, oldest first
+func (s *SQLiteStore) GetSeries(id int) ([]models.Task, error) {
+	task, err := s.GetTaskByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if task.SeriesID == nil {
+		return nil, ErrNoSeries
+	}
+
+	return s.queryTasks(`SELECT `+selectTaskColumns("")+`
+		FROM tasks WHERE series_id = ? AND deleted_at IS NULL ORDER BY id`, *task.SeriesID)
+}
+
+// queryTasks runs a query selecting taskColumns and returns every task it finds
+func (s *SQLiteStore) queryTasks(query string, args ...interface{}) ([]models.Task, error) {
+	rows, err := s.q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []models.Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// AddDependency records that blockerID blocks blockedID, checking both tasks
+// and the dependency graph inside one transaction
+func (s *SQLiteStore) AddDependency(blockerID, blockedID int) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range []int{blockerID, blockedID} {
+		if _, err := getTask(tx, id); err != nil {
+			return err
+		}
+	}
+	if err := checkCycle(blockerID, blockedID, blockedBy(tx)); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT OR IGNORE INTO task_dependencies (blocker_id, blocked_id, created_at)
+		VALUES (?, ?, ?)`, blockerID, blockedID, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveDependency removes the dependency of blockedID on blockerID
+func (s *SQLiteStore) RemoveDependency(blockerID, blockedID int) error {
+	res, err := s.q.Exec("DELETE FROM task_dependencies WHERE blocker_id = ? AND blocked_id = ?", blockerID, blockedID)
+	if err != nil {
+		return err
+	}
+	if removed, err := res.RowsAffected(); err != nil {
+		return err
+	} else if removed == 0 {
+		return ErrDependencyNotFound
+	}
+	return nil
+}
+
+// setTags replaces the tags of a task, creating any tag that doesn't exist yet
+func setTags(q querier, taskID int, tags []string) error {
+	if _, err := q.Exec("DELETE FROM task_tags WHERE task_id = ?", taskID); err != nil {
+		return err
+	}
+
+	for _, tag := range models.NormalizeTags(tags) {
+		if _, err := q.Exec("INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO NOTHING", tag); err != nil {
+			return err
+		}
+		_, err := q.Exec("INSERT INTO task_tags (task_id, tag_id) SELECT ?, id FROM tags WHERE name = ?", taskID, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListTags returns every tag used by a task outside the trash, most used first
+func (s *SQLiteStore) ListTags() ([]models.TagCount, error) {
+	rows, err := s.q.Query(`SELECT g.name, COUNT(*)
+		FROM tags g
+		JOIN task_tags tt ON tt.tag_id = g.id
+		JOIN tasks t ON t.id = tt.task_id
+		WHERE t.deleted_at IS NULL
+		GROUP BY g.id
+		ORDER BY COUNT(*) DESC, g.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []models.TagCount{}
+	for rows.Next() {
+		var tag models.TagCount
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// checkUser returns ErrUserNotFound unless userID is nil or an existing user
+func checkUser(q querier, userID *int) error {
+	if userID == nil {
+		return nil
+	}
+	if _, err := getUser(q, *userID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkProject returns ErrProjectNotFound unless projectID is nil or an existing project
+func checkProject(q querier, projectID *int) error {
+	if projectID == nil {
+		return nil
+	}
+	if _, err := getProject(q, *projectID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// lastPosition returns the highest position in a project's board column, leaving
+// out the task with ID except, or "" if the column is empty
+func lastPosition(q querier, projectID int, status models.Status, except int) (string, error) {
+	var position string
+	err := q.QueryRow(`SELECT COALESCE(MAX(position), '') FROM tasks
+		WHERE project_id = ? AND status = ? AND deleted_at IS NULL AND id != ?`, projectID, status, except).Scan(&position)
+	return position, err
+}
+
+// CreateProject adds a new project
+func (s *SQLiteStore) CreateProject(project models.Project) (int64, error) {
+	columns, err := json.Marshal(project.Columns)
+	if err != nil {
+		return 0, err
+	}
+	res, err := s.q.Exec("INSERT INTO projects (name, description, columns, created_at) VALUES (?, ?, ?, ?)",
+		project.Name, project.Description, columns, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// projectColumns lists the projects columns in the order scanProject reads them
+const projectColumns = "id, name, description, columns, created_at"
+
+// GetProject retrieves a single project by ID
+func (s *SQLiteStore) GetProject(id int) (models.Project, error) {
+	return getProject(s.q, id)
+}
+
+// getProject retrieves a single project by ID through q
+func getProject(q querier, id int) (models.Project, error) {
+	project, err := scanProject(q.QueryRow("SELECT "+projectColumns+" FROM projects WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return project, ErrProjectNotFound
+	}
+	return project, err
+}
+
+// ListProjects retrieves every project, oldest first
+func (s *SQLiteStore) ListProjects() ([]models.Project, error) {
+	rows, err := s.q.Query("SELECT " + projectColumns + " FROM projects ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := []models.Project{}
+	for rows.Next() {
+		project, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+	return projects, rows.Err()
+}
+
+// UpdateProject replaces the name, description and columns of a project
+func (s *SQLiteStore) UpdateProject(project models.Project) error {
+	columns, err := json.Marshal(project.Columns)
+	if err != nil {
+		return err
+	}
+	res, err := s.q.Exec("UPDATE projects SET name = ?, description = ?, columns = ? WHERE id = ?",
+		project.Name, project.Description, columns, project.ID)
+	if err != nil {
+		return err
+	}
+	if updated, err := res.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return ErrProjectNotFound
+	}
+	return nil
+}
+
+// DeleteProject removes a project without tasks
+func (s *SQLiteStore) DeleteProject(id int) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := getProject(tx, id); err != nil {
+		return err
+	}
+	var used bool
+	if err := tx.QueryRow("SELECT COUNT(*) > 0 FROM tasks WHERE project_id = ?", id).Scan(&used); err != nil {
+		return err
+	}
+	if used {
+		return ErrProjectNotEmpty
+	}
+	if _, err := tx.Exec("DELETE FROM projects WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ProjectTasks retrieves the tasks of a project outside the trash in board order
+func (s *SQLiteStore) ProjectTasks(projectID int) ([]models.Task, error) {
+	if _, err := getProject(s.q, projectID); err != nil {
+		return nil, err
+	}
+	return s.queryTasks(`SELECT `+selectTaskColumns("")+`
+		FROM tasks WHERE project_id = ? AND deleted_at IS NULL ORDER BY position, id`, projectID)
+}
+
+// scanProject reads a row of projectColumns
+func scanProject(row rowScanner) (models.Project, error) {
+	var project models.Project
+	var columns string
+	if err := row.Scan(&project.ID, &project.Name, &project.Description, &columns, &project.CreatedAt); err != nil {
+		return project, err
+	}
+	err := json.Unmarshal([]byte(columns), &project.Columns)
+	return project, err
+}
+
+// CreateComment adds a comment to a task outside the trash and records its creation
+func (s *SQLiteStore) CreateComment(comment models.Comment) (int64, error) {
+	tx, err := s.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := getTask(tx, comment.TaskID); err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec("INSERT INTO task_comments (task_id, body, author, author_id, created_at) VALUES (?, ?, ?, ?, ?)",
+		comment.TaskID, comment.Body, comment.Author, comment.AuthorID, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	created, err := getComment(tx, comment.TaskID, int(id))
+	if err != nil {
+		return 0, err
+	}
+	if err := s.recordCommentAudit(tx, models.AuditCreate, nil, &created); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// commentColumns lists the task_comments columns in the order scanComment reads them
+const commentColumns = "id, task_id, body, author, author_id, created_at, edited_at"
+
+// GetComment retrieves a comment on a task outside the trash
+func (s *SQLiteStore) GetComment(taskID, id int) (models.Comment, error) {
+	return getComment(s.q, taskID, id)
+}
+
+// getComment retrieves a comment on a task outside the trash through q
+func getComment(q querier, taskID, id int) (models.Comment, error) {
+	if _, err := getTask(q, taskID); err != nil {
+		return models.Comment{}, err
+	}
+	comment, err := scanComment(q.QueryRow("SELECT "+commentColumns+" FROM task_comments WHERE task_id = ? AND id = ?", taskID, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return comment, ErrCommentNotFound
+	}
+	return comment, err
+}
+
+// ListComments retrieves the comments on a task outside the trash, oldest first
+func (s *SQLiteStore) ListComments(taskID int) ([]models.Comment, error) {
+	if _, err := getTask(s.q, taskID); err != nil {
+		return nil, err
+	}
+	rows, err := s.q.Query("SELECT "+commentColumns+" FROM task_comments WHERE task_id = ? ORDER BY id", taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []models.Comment{}
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// UpdateComment replaces the body of a comment and records the edit
+func (s *SQLiteStore) UpdateComment(comment models.Comment) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getComment(tx, comment.TaskID, comment.ID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE task_comments SET body = ?, edited_at = ? WHERE id = ?",
+		comment.Body, time.Now().UTC(), comment.ID); err != nil {
+		return err
+	}
+	after, err := getComment(tx, comment.TaskID, comment.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.recordCommentAudit(tx, models.AuditUpdate, &before, &after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteComment removes a comment and records the deletion
+func (s *SQLiteStore) DeleteComment(taskID, id int) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	comment, err := getComment(tx, taskID, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM task_comments WHERE id = ?", id); err != nil {
+		return err
+	}
+	if err := s.recordCommentAudit(tx, models.AuditDelete, &comment, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// scanComment reads a row of commentColumns
+func scanComment(row rowScanner) (models.Comment, error) {
+	var comment models.Comment
+	var authorID sql.NullInt64
+	var editedAt sql.NullTime
+	if err := row.Scan(&comment.ID, &comment.TaskID, &comment.Body, &comment.Author, &authorID,
+		&comment.CreatedAt, &editedAt); err != nil {
+		return comment, err
+	}
+	comment.AuthorID = nullID(authorID)
+	if editedAt.Valid {
+		comment.EditedAt = &editedAt.Time
+	}
+	return comment, nil
+}
+
+// CreateAttachment records a file attached to a task outside the trash and its creation
+func (s *SQLiteStore) CreateAttachment(attachment models.Attachment) (int64, error) {
+	tx, err := s.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := getTask(tx, attachment.TaskID); err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(`INSERT INTO task_attachments (task_id, filename, content_type, size, sha256, uploaded_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		attachment.TaskID, attachment.Filename, attachment.ContentType, attachment.Size, attachment.SHA256,
+		attachment.UploadedBy, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	created, err := getAttachment(tx, attachment.TaskID, int(id))
+	if err != nil {
+		return 0, err
+	}
+	if err := s.recordAttachmentAudit(tx, models.AuditCreate, nil, &created); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// attachmentColumns lists the task_attachments columns in the order scanAttachment reads them
+const attachmentColumns = "id, task_id, filename, content_type, size, sha256, uploaded_by, created_at"
+
+// GetAttachment retrieves an attachment of a task outside the trash
+func (s *SQLiteStore) GetAttachment(taskID, id int) (models.Attachment, error) {
+	return getAttachment(s.q, taskID, id)
+}
+
+// getAttachment retrieves an attachment of a task outside the trash through q
+func getAttachment(q querier, taskID, id int) (models.Attachment, error) {
+	if _, err := getTask(q, taskID); err != nil {
+		return models.Attachment{}, err
+	}
+	attachment, err := scanAttachment(q.QueryRow("SELECT "+attachmentColumns+" FROM task_attachments WHERE task_id = ? AND id = ?", taskID, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return attachment, ErrAttachmentNotFound
+	}
+	return attachment, err
+}
+
+// ListAttachments retrieves the attachments of a task outside the trash, oldest first
+func (s *SQLiteStore) ListAttachments(taskID int) ([]models.Attachment, error) {
+	if _, err := getTask(s.q, taskID); err != nil {
+		return nil, err
+	}
+	rows, err := s.q.Query("SELECT "+attachmentColumns+" FROM task_attachments WHERE task_id = ? ORDER BY id", taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []models.Attachment{}
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+// DeleteAttachment removes an attachment and records the deletion
+func (s *SQLiteStore) DeleteAttachment(taskID, id int) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	attachment, err := getAttachment(tx, taskID, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM task_attachments WHERE id = ?", id); err != nil {
+		return err
+	}
+	if err := s.recordAttachmentAudit(tx, models.AuditDelete, &attachment, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// BlobInUse reports whether any attachment has the content with hash
+func (s *SQLiteStore) BlobInUse(hash string) (bool, error) {
+	var used bool
+	err := s.q.QueryRow("SELECT COUNT(*) > 0 FROM task_attachments WHERE sha256 = ?", hash).Scan(&used)
+	return used, err
+}
+
+// scanAttachment reads a row of attachmentColumns
+func scanAttachment(row rowScanner) (models.Attachment, error) {
+	var attachment models.Attachment
+	err := row.Scan(&attachment.ID, &attachment.TaskID, &attachment.Filename, &attachment.ContentType,
+		&attachment.Size, &attachment.SHA256, &attachment.UploadedBy, &attachment.CreatedAt)
+	return attachment, err
+}
+
+// CreateTimeEntry records time spent on a task outside the trash, or starts a
+// timer for an entry without StoppedAt, and records its creation
+func (s *SQLiteStore) CreateTimeEntry(entry models.TimeEntry) (int64, error) {
+	tx, err := s.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := getTask(tx, entry.TaskID); err != nil {
+		return 0, err
+	}
+	if entry.StoppedAt == nil {
+		if _, err := runningTimer(tx, entry.TrackedBy); err == nil {
+			return 0, ErrTimerRunning
+		} else if !errors.Is(err, ErrTimerNotRunning) {
+			return 0, err
+		}
+	}
+	res, err := tx.Exec(`INSERT INTO time_entries (task_id, tracked_by, user_id, started_at, stopped_at, note, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		entry.TaskID, entry.TrackedBy, entry.UserID, entry.StartedAt.UTC(), nullTimePtr(entry.StoppedAt),
+		entry.Note, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	created, err := getTimeEntry(tx, entry.TaskID, int(id))
+	if err != nil {
+		return 0, err
+	}
+	if err := s.recordTimeEntryAudit(tx, models.AuditCreate, nil, &created); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// StopTimer stops the timer trackedBy has running on a task and records the change
+func (s *SQLiteStore) StopTimer(taskID int, trackedBy string, stoppedAt time.Time) (models.TimeEntry, error) {
+	tx, err := s.begin()
+	if err != nil {
+		return models.TimeEntry{}, err
+	}
+	defer tx.Rollback()
+
+	running, err := runningTimer(tx, trackedBy)
+	if err != nil {
+		return running, err
+	}
+	if running.TaskID != taskID {
+		return models.TimeEntry{}, ErrTimerNotRunning
+	}
+	stopped, err := s.stopTimer(tx, running, stoppedAt)
+	if err != nil {
+		return stopped, err
+	}
+	return stopped, tx.Commit()
+}
+
+// stopTimer stops a running entry at stoppedAt through q and records the change
+func (s *SQLiteStore) stopTimer(q querier, running models.TimeEntry, stoppedAt time.Time) (models.TimeEntry, error) {
+	// A timer can't stop before it started, even if the clocks disagree
+	if stoppedAt.Before(running.StartedAt) {
+		stoppedAt = running.StartedAt
+	}
+	if _, err := q.Exec("UPDATE time_entries SET stopped_at = ? WHERE id = ?", stoppedAt.UTC(), running.ID); err != nil {
+		return running, err
+	}
+	stopped, err := scanTimeEntry(q.QueryRow("SELECT "+timeEntryColumns+" FROM time_entries WHERE id = ?", running.ID))
+	if err != nil {
+		return stopped, err
+	}
+	return stopped, s.recordTimeEntryAudit(q, models.AuditUpdate, &running, &stopped)
+}
+
+// stopTimers stops every timer running on a task through q
+func (s *SQLiteStore) stopTimers(q querier, taskID int, stoppedAt time.Time) error {
+	rows, err := q.Query("SELECT "+timeEntryColumns+" FROM time_entries WHERE task_id = ? AND stopped_at IS NULL", taskID)
+	if err != nil {
+		return err
+	}
+	var running []models.TimeEntry
+	for rows.Next() {
+		entry, err := scanTimeEntry(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		running = append(running, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, entry := range running {
+		if _, err := s.stopTimer(q, entry, stoppedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunningTimer retrieves the entry of the timer trackedBy has running
+func (s *SQLiteStore) RunningTimer(trackedBy string) (models.TimeEntry, error) {
+	return runningTimer(s.q, trackedBy)
+}
+
+// runningTimer retrieves the entry of the timer trackedBy has running through q
+func runningTimer(q querier, trackedBy string) (models.TimeEntry, error) {
+	entry, err := scanTimeEntry(q.QueryRow("SELECT "+timeEntryColumns+" FROM time_entries WHERE tracked_by = ? AND stopped_at IS NULL", trackedBy))
+	if errors.Is(err, sql.ErrNoRows) {
+		return entry, ErrTimerNotRunning
+	}
+	return entry, err
+}
+
+// timeEntryColumns lists the time_entries columns in the order scanTimeEntry reads them
+const timeEntryColumns = "id, task_id, tracked_by, user_id, started_at, stopped_at, note, created_at"
+
+// GetTimeEntry retrieves a time entry of a task outside the trash
+func (s *SQLiteStore) GetTimeEntry(taskID, id int) (models.TimeEntry, error) {
+	return getTimeEntry(s.q, taskID, id)
+}
+
+// getTimeEntry retrieves a time entry of a task outside the trash through q
+func getTimeEntry(q querier, taskID, id int) (models.TimeEntry, error) {
+	if _, err := getTask(q, taskID); err != nil {
+		return models.TimeEntry{}, err
+	}
+	entry, err := scanTimeEntry(q.QueryRow("SELECT "+timeEntryColumns+" FROM time_entries WHERE task_id = ? AND id = ?", taskID, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return entry, ErrTimeEntryNotFound
+	}
+	return entry, err
+}
+
+// ListTimeEntries retrieves the time entries of a task outside the trash, oldest first
+func (s *SQLiteStore) ListTimeEntries(taskID int) ([]models.TimeEntry, error) {
+	if _, err := getTask(s.q, taskID); err != nil {
+		return nil, err
+	}
+	rows, err := s.q.Query("SELECT "+timeEntryColumns+" FROM time_entries WHERE task_id = ? ORDER BY started_at, id", taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.TimeEntry{}
+	for rows.Next() {
+		entry, err := scanTimeEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// DeleteTimeEntry removes a time entry and records the deletion
+func (s *SQLiteStore) DeleteTimeEntry(taskID, id int) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	entry, err := getTimeEntry(tx, taskID, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM time_entries WHERE id = ?", id); err != nil {
+		return err
+	}
+	if err := s.recordTimeEntryAudit(tx, models.AuditDelete, &entry, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// TimeReport totals the stopped time entries matching filter
+func (s *SQLiteStore) TimeReport(filter TimeReportFilter) (models.TimeReport, error) {
+	conditions := []string{"te.stopped_at IS NOT NULL"}
+	var args []interface{}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "te.started_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "te.started_at < ?")
+		args = append(args, filter.To.UTC())
+	}
+	if filter.TrackedBy != "" {
+		conditions = append(conditions, "te.tracked_by = ?")
+		args = append(args, filter.TrackedBy)
+	}
+
+	rows, err := s.q.Query(`SELECT te.`+strings.ReplaceAll(timeEntryColumns, ", ", ", te.")+`, t.title, t.status, t.estimate_minutes
+		FROM time_entries te JOIN tasks t ON t.id = te.task_id
+		WHERE `+strings.Join(conditions, " AND ")+` ORDER BY te.started_at, te.id`, args...)
+	if err != nil {
+		return models.TimeReport{}, err
+	}
+	defer rows.Close()
+
+	var entries []reportedEntry
+	for rows.Next() {
+		var e reportedEntry
+		var estimate sql.NullInt64
+		e.entry, err = scanTimeEntry(rows, &e.task.Title, &e.task.Status, &estimate)
+		if err != nil {
+			return models.TimeReport{}, err
+		}
+		e.task.ID = e.entry.TaskID
+		e.task.Estimate = nullID(estimate)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return models.TimeReport{}, err
+	}
+	return buildTimeReport(filter, entries), nil
+}
+
+// scanTimeEntry reads a row of timeEntryColumns, followed by any extra columns into extra
+func scanTimeEntry(row rowScanner, extra ...interface{}) (models.TimeEntry, error) {
+	var entry models.TimeEntry
+	var userID sql.NullInt64
+	var stoppedAt sql.NullTime
+	dest := []interface{}{&entry.ID, &entry.TaskID, &entry.TrackedBy, &userID, &entry.StartedAt, &stoppedAt, &entry.Note, &entry.CreatedAt}
+	err := row.Scan(append(dest, extra...)...)
+	entry.UserID = nullID(userID)
+	if stoppedAt.Valid {
+		entry.StoppedAt = &stoppedAt.Time
+	}
+	entry.Minutes = models.DurationMinutes(entry.Duration())
+	return entry, err
+}
+
+// idempotencyKeyColumns lists the idempotency_keys columns in the order scanIdempotencyKey reads them
+const idempotencyKeyColumns = "caller, idempotency_key, request_hash, status_code, header, body, created_at, expires_at"
+
+// ClaimIdempotencyKey records a request with an idempotency key, unless its caller has used the key already
+func (s *SQLiteStore) ClaimIdempotencyKey(key models.IdempotencyKey) (models.IdempotencyKey, error) {
+	tx, err := s.begin()
+	if err != nil {
+		return models.IdempotencyKey{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM idempotency_keys WHERE expires_at <= ?", key.CreatedAt.UTC()); err != nil {
+		return models.IdempotencyKey{}, err
+	}
+	existing, err := scanIdempotencyKey(tx.QueryRow("SELECT "+idempotencyKeyColumns+`
+		FROM idempotency_keys WHERE caller = ? AND idempotency_key = ?`, key.Caller, key.Key))
+	if err == nil {
+		return existing, ErrIdempotencyKeyUsed
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.IdempotencyKey{}, err
+	}
+
+	key.StatusCode = 0
+	key.Header = nil
+	key.Body = nil
+	if _, err := tx.Exec(`INSERT INTO idempotency_keys (caller, idempotency_key, request_hash, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)`, key.Caller, key.Key, key.RequestHash, key.CreatedAt.UTC(), key.ExpiresAt.UTC()); err != nil {
+		return models.IdempotencyKey{}, err
+	}
+	return key, tx.Commit()
+}
+
+// CompleteIdempotencyKey stores the response to a claimed key's request
+func (s *SQLiteStore) CompleteIdempotencyKey(key models.IdempotencyKey) error {
+	header, err := json.Marshal(key.Header)
+	if err != nil {
+		return err
+	}
+	_, err = s.q.Exec(`UPDATE idempotency_keys SET status_code = ?, header = ?, body = ?
+		WHERE caller = ? AND idempotency_key = ?`, key.StatusCode, string(header), key.Body, key.Caller, key.Key)
+	return err
+}
+
+// ReleaseIdempotencyKey removes a key whose request is still in progress
+func (s *SQLiteStore) ReleaseIdempotencyKey(caller, key string) error {
+	_, err := s.q.Exec("DELETE FROM idempotency_keys WHERE caller = ? AND idempotency_key = ? AND status_code = 0", caller, key)
+	return err
+}
+
+// scanIdempotencyKey reads a row selected with idempotencyKeyColumns
+func scanIdempotencyKey(row rowScanner) (models.IdempotencyKey, error) {
+	var key models.IdempotencyKey
+	var header string
+	if err := row.Scan(&key.Caller, &key.Key, &key.RequestHash, &key.StatusCode, &header, &key.Body, &key.CreatedAt, &key.ExpiresAt); err != nil {
+		return key, err
+	}
+	return key, json.Unmarshal([]byte(header), &key.Header)
+}
+
+// CreateUser adds a new user, unless another one has the same email
+func (s *SQLiteStore) CreateUser(user models.User) (int64, error) {
+	tx, err := s.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	if err := tx.QueryRow("SELECT COUNT(*) > 0 FROM users WHERE email = ?", user.Email).Scan(&taken); err != nil {
+		return 0, err
+	}
+	if taken {
+		return 0, ErrEmailTaken
+	}
+
+	res, err := tx.Exec("INSERT INTO users (name, email, created_at) VALUES (?, ?, ?)",
+		user.Name, user.Email, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// GetUserByID retrieves a single user by ID
+func (s *SQLiteStore) GetUserByID(id int) (models.User, error) {
+	return getUser(s.q, id)
+}
+
+// getUser retrieves a single user by ID through q
+func getUser(q querier, id int) (models.User, error) {
+	var user models.User
+	err := q.QueryRow("SELECT id, name, email, created_at FROM users WHERE id = ?", id).
+		Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, ErrUserNotFound
+	}
+	return user, err
+}
+
+// ListUsers retrieves every user, oldest first
+func (s *SQLiteStore) ListUsers() ([]models.User, error) {
+	rows, err := s.q.Query("SELECT id, name, email, created_at FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// CreateAPIKey stores a new API key by its hash
+func (s *SQLiteStore) CreateAPIKey(key models.APIKey) (int64, error) {
+	tx, err := s.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := checkUser(tx, key.UserID); err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec("INSERT INTO api_keys (name, key_hash, user_id, scopes, created_at) VALUES (?, ?, ?, ?, ?)",
+		key.Name, key.KeyHash, key.UserID, strings.Join(key.Scopes, " "), time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// apiKeyColumns lists the api_keys columns in the order scanAPIKey reads them
+const apiKeyColumns = "id, name, key_hash, user_id, scopes, created_at"
+
+// GetAPIKeyByHash retrieves the API key with the given hash
+func (s *SQLiteStore) GetAPIKeyByHash(hash string) (models.APIKey, error) {
+	key, err := scanAPIKey(s.q.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?", hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+// ListAPIKeys retrieves every API key, oldest first
+func (s *SQLiteStore) ListAPIKeys() ([]models.APIKey, error) {
+	rows, err := s.q.Query("SELECT " + apiKeyColumns + " FROM api_keys ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey revokes an API key
+func (s *SQLiteStore) DeleteAPIKey(id int) error {
+	res, err := s.q.Exec("DELETE FROM api_keys WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// scanAPIKey reads a row of apiKeyColumns
+func scanAPIKey(row rowScanner) (models.APIKey, error) {
+	var key models.APIKey
+	var userID sql.NullInt64
+	var scopes string
+	if err := row.Scan(&key.ID, &key.Name, &key.KeyHash, &userID, &scopes, &key.CreatedAt); err != nil {
+		return key, err
+	}
+	key.UserID = nullID(userID)
+	key.Scopes = strings.Fields(scopes)
+	return key, nil
+}
+
+// CreateWebhook stores a new webhook subscription
+func (s *SQLiteStore) CreateWebhook(webhook models.Webhook) (int64, error) {
+	res, err := s.q.Exec("INSERT INTO webhooks (url, events, secret, created_at) VALUES (?, ?, ?, ?)",
+		webhook.URL, strings.Join(webhook.Events, " "), webhook.Secret, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// webhookColumns lists the webhooks columns in the order scanWebhook reads them
+const webhookColumns = "id, url, events, secret, created_at"
+
+// GetWebhook retrieves a webhook by its ID
+func (s *SQLiteStore) GetWebhook(id int) (models.Webhook, error) {
+	webhook, err := scanWebhook(s.q.QueryRow("SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return webhook, ErrWebhookNotFound
+	}
+	return webhook, err
+}
+
+// ListWebhooks retrieves every webhook, oldest first
+func (s *SQLiteStore) ListWebhooks() ([]models.Webhook, error) {
+	rows, err := s.q.Query("SELECT " + webhookColumns + " FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook removes a webhook; its deliveries go with it
+func (s *SQLiteStore) DeleteWebhook(id int) error {
+	res, err := s.q.Exec("DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// scanWebhook reads a row of webhookColumns
+func scanWebhook(row rowScanner) (models.Webhook, error) {
+	var webhook models.Webhook
+	var events string
+	if err := row.Scan(&webhook.ID, &webhook.URL, &events, &webhook.Secret, &webhook.CreatedAt); err != nil {
+		return webhook, err
+	}
+	webhook.Events = strings.Fields(events)
+	return webhook, nil
+}
+
+// EnqueueEvent queues a delivery of payload to every webhook subscribed to event
+func (s *SQLiteStore) EnqueueEvent(event string, payload []byte) error {
+	webhooks, err := s.ListWebhooks()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(event) {
+			continue
+		}
+		if _, err := s.q.Exec(`INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`, webhook.ID, event, string(payload), models.DeliveryPending, now, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliveryColumns lists the webhook_deliveries columns in the order scanDelivery reads them
+const deliveryColumns = "id, webhook_id, event, payload, status, attempts, next_attempt_at, response_status, last_error, created_at, delivered_at"
+
+// ListDeliveries retrieves a webhook's deliveries, newest first, optionally only those with status
+func (s *SQLiteStore) ListDeliveries(webhookID int, status models.DeliveryStatus) ([]models.WebhookDelivery, error) {
+	if _, err := s.GetWebhook(webhookID); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + deliveryColumns + " FROM webhook_deliveries WHERE webhook_id = ?"
+	args := []interface{}{webhookID}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	return s.queryDeliveries(query+" ORDER BY id DESC", args...)
+}
+
+// DueDeliveries retrieves up to limit pending deliveries due by now, oldest first
+func (s *SQLiteStore) DueDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	return s.queryDeliveries("SELECT "+deliveryColumns+` FROM webhook_deliveries
+		WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?`,
+		models.DeliveryPending, now.UTC(), limit)
+}
+
+// queryDeliveries runs a query selecting deliveryColumns
+func (s *SQLiteStore) queryDeliveries(query string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	rows, err := s.q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// UpdateDelivery records the outcome of a delivery attempt
+func (s *SQLiteStore) UpdateDelivery(delivery models.WebhookDelivery) error {
+	_, err := s.q.Exec(`UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?,
+		response_status = ?, last_error = ?, delivered_at = ? WHERE id = ?`,
+		delivery.Status, delivery.Attempts, nullTimePtr(delivery.NextAttemptAt),
+		delivery.ResponseStatus, delivery.LastError, nullTimePtr(delivery.DeliveredAt), delivery.ID)
+	return err
+}
+
+// scanDelivery reads a row of deliveryColumns
+func scanDelivery(row rowScanner) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	var payload string
+	var nextAttemptAt, deliveredAt sql.NullTime
+	err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &payload, &delivery.Status, &delivery.Attempts,
+		&nextAttemptAt, &delivery.ResponseStatus, &delivery.LastError, &delivery.CreatedAt, &deliveredAt)
+	if err != nil {
+		return delivery, err
+	}
+	delivery.Payload = []byte(payload)
+	if nextAttemptAt.Valid {
+		delivery.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if deliveredAt.Valid {
+		delivery.DeliveredAt = &deliveredAt.Time
+	}
+	return delivery, nil
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// nullTime converts a time to UTC for storage, mapping the zero time to NULL.
+// Storing every timestamp in UTC keeps SQLite's text comparisons in time order.
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+// nullTimePtr is nullTime for an optional time
+func nullTimePtr(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return nullTime(*t)
+}
+
+// nullID converts a nullable ID column to a pointer that is nil for NULL
+func nullID(id sql.NullInt64) *int {
+	if !id.Valid {
+		return nil
+	}
+	i := int(id.Int64)
+	return &i
+}
+
+// taskColumns are the columns scanTask reads, in order
+var taskColumns = []string{
+	"id", "title", "description", "status", "due_date", "created_at", "updated_at", "version", "deleted_at", "parent_id",
+	"created_by", "assignee_id", "recurrence", "series_id", "overdue_at", "project_id", "position",
+	"estimate_minutes", "priority",
+}
+
+// tagsColumn selects a task's tags as a comma-separated list; %s is the task's id column
+const tagsColumn = `(SELECT group_concat(g.name, ',') FROM task_tags tt
+	JOIN tags g ON g.id = tt.tag_id WHERE tt.task_id = %s)`
+
+// selectTaskColumns lists taskColumns for a SELECT, each qualified with prefix,
+// followed by the task's tags
+func selectTaskColumns(prefix string) string {
+	// Inside the subquery a bare "id" would refer to tags.id
+	idColumn := prefix + "id"
+	if prefix == "" {
+		idColumn = "tasks.id"
+	}
+	return prefix + strings.Join(taskColumns, ", "+prefix) + ", " + fmt.Sprintf(tagsColumn, idColumn)
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTask reads the columns listed by selectTaskColumns,
+// followed by any extra columns into extra
+func scanTask(row rowScanner, extra ...interface{}) (models.Task, error) {
+	var task models.Task
+	var description sql.NullString
+	var dueDate, deletedAt, overdueAt sql.NullTime
+	var parentID, createdBy, assigneeID, seriesID, projectID, estimate sql.NullInt64
+	var tags sql.NullString
+
+	dest := []interface{}{
+		&task.ID,
+		&task.Title,
+		&description,
+		&task.Status,
+		&dueDate,
+		&task.CreatedAt,
+		&task.UpdatedAt,
+		&task.Version,
+		&deletedAt,
+		&parentID,
+		&createdBy,
+		&assigneeID,
+		&task.Recurrence,
+		&seriesID,
+		&overdueAt,
+		&projectID,
+		&task.Position,
+		&estimate,
+		&task.Priority,
+		&tags,
+	}
+	err := row.Scan(append(dest, extra...)...)
+
+	if description.Valid {
+		task.Description = description.String
+	}
+	if dueDate.Valid {
+		task.DueDate = dueDate.Time
+	}
+	if deletedAt.Valid {
+		task.DeletedAt = &deletedAt.Time
+	}
+	if overdueAt.Valid {
+		task.OverdueAt = &overdueAt.Time
+	}
+	task.ParentID = nullID(parentID)
+	task.CreatedBy = nullID(createdBy)
+	task.AssigneeID = nullID(assigneeID)
+	task.SeriesID = nullID(seriesID)
+	task.ProjectID = nullID(projectID)
+	task.Estimate = nullID(estimate)
+	task.Tags = []string{}
+	if tags.Valid {
+		task.Tags = strings.Split(tags.String, ",")
+		sort.Strings(task.Tags)
+	}
+
+	return task, err
 }
@@ -1,304 +1,2046 @@
 package database
 
 import (
-	"os"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
 	"task_manager_api/models"
 	"testing"
 	"time"
 )
 
-// Setup test database
-func setupTestDB(t *testing.T) {
-	// Use an in-memory SQLite database for testing
-	InitDB(":memory:")
+// forEachStore runs fn against a fresh instance of every TaskStore implementation
+func forEachStore(t *testing.T, fn func(t *testing.T, store TaskStore)) {
+	t.Run("SQLite", func(t *testing.T) {
+		// Use an in-memory SQLite database for testing
+		store, err := NewSQLiteStore(":memory:")
+		if err != nil {
+			t.Fatalf("Failed to open test database: %v", err)
+		}
+		defer store.Close()
+
+		fn(t, store)
+	})
+
+	t.Run("Memory", func(t *testing.T) {
+		fn(t, NewMemoryStore())
+	})
 }
 
 // TestCreateTask tests the CreateTask function
 func TestCreateTask(t *testing.T) {
-	setupTestDB(t)
-
-	// Test cases
-	testCases := []struct {
-		name     string
-		task     models.Task
-		wantErr  bool
-		checkID  bool
-	}{
-		{
-			name: "Valid Task",
-			task: models.Task{
-				Title:       "Test Task",
-				Description: "This is a test task",
-				Status:      "pending",
-				DueDate:     time.Now().Add(24 * time.Hour),
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		// Test cases
+		testCases := []struct {
+			name    string
+			task    models.Task
+			wantErr bool
+			checkID bool
+		}{
+			{
+				name: "Valid Task",
+				task: models.Task{
+					Title:       "Test Task",
+					Description: "This is a test task",
+					Status:      "pending",
+					DueDate:     time.Now().Add(24 * time.Hour),
+				},
+				wantErr: false,
+				checkID: true,
 			},
-			wantErr: false,
-			checkID: true,
-		},
-		{
-			name: "Empty Title",
-			task: models.Task{
-				Description: "Task with empty title",
+			{
+				name: "Empty Title",
+				task: models.Task{
+					Description: "Task with empty title",
+					Status:      "pending",
+				},
+				wantErr: false, // SQLite doesn't enforce NOT NULL at driver level
+				checkID: true,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				id, err := store.CreateTask(tc.task)
+
+				// Check error
+				if (err != nil) != tc.wantErr {
+					t.Errorf("store.CreateTask() error = %v, wantErr %v", err, tc.wantErr)
+					return
+				}
+
+				// Check ID
+				if tc.checkID && id <= 0 {
+					t.Errorf("store.CreateTask() returned invalid ID: %d", id)
+				}
+			})
+		}
+	})
+}
+
+// TestGetAllTasks tests the GetAllTasks function
+func TestGetAllTasks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		// Create some test tasks
+		tasks := []models.Task{
+			{
+				Title:       "Task 1",
+				Description: "Description 1",
 				Status:      "pending",
 			},
-			wantErr: false, // SQLite doesn't enforce NOT NULL at driver level
-			checkID: true,
-		},
-	}
+			{
+				Title:       "Task 2",
+				Description: "Description 2",
+				Status:      "in_progress",
+			},
+		}
+
+		for _, task := range tasks {
+			_, err := store.CreateTask(task)
+			if err != nil {
+				t.Fatalf("Failed to create test task: %v", err)
+			}
+		}
+
+		// Test GetAllTasks
+		gotTasks, err := store.GetAllTasks()
+		if err != nil {
+			t.Errorf("store.GetAllTasks() error = %v", err)
+			return
+		}
+
+		// Check if we got the expected number of tasks
+		if len(gotTasks) != len(tasks) {
+			t.Errorf("store.GetAllTasks() returned %d tasks, want %d", len(gotTasks), len(tasks))
+		}
+	})
+}
+
+// TestListTasks tests filtering, sorting and paging with ListTasks
+func TestListTasks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		// Duplicate titles exercise the ID tie-break when paging by title
+		base := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+		tasks := []models.Task{
+			{Title: "b", Status: "pending", DueDate: base.AddDate(0, 0, 3)},
+			{Title: "a", Status: "completed", DueDate: base.AddDate(0, 0, 1)},
+			{Title: "b", Status: "pending"},
+			{Title: "c", Status: "pending", DueDate: base.AddDate(0, 0, 2)},
+			{Title: "a", Status: "in_progress", DueDate: base},
+		}
+		for _, task := range tasks {
+			if _, err := store.CreateTask(task); err != nil {
+				t.Fatalf("Failed to create test task: %v", err)
+			}
+		}
+
+		t.Run("Pages Cover Every Task In Order", func(t *testing.T) {
+			filter := TaskFilter{Sort: SortTitle, Order: OrderAsc, Limit: 2}
+			var titles []string
+			for {
+				page, err := store.ListTasks(filter)
+				if err != nil {
+					t.Fatalf("ListTasks() error = %v", err)
+				}
+				if page.Total != len(tasks) {
+					t.Errorf("ListTasks() total = %d, want %d", page.Total, len(tasks))
+				}
+				for _, task := range page.Tasks {
+					titles = append(titles, task.Title)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				filter.Cursor = page.NextCursor
+			}
+
+			want := []string{"a", "a", "b", "b", "c"}
+			if strings.Join(titles, ",") != strings.Join(want, ",") {
+				t.Errorf("ListTasks() titles = %v, want %v", titles, want)
+			}
+		})
+
+		t.Run("Filter By Status And Due Date", func(t *testing.T) {
+			page, err := store.ListTasks(TaskFilter{
+				Statuses:  []models.Status{models.StatusPending, models.StatusInProgress},
+				DueBefore: base.AddDate(0, 0, 3),
+				Sort:      SortDueDate,
+				Order:     OrderAsc,
+			})
+			if err != nil {
+				t.Fatalf("ListTasks() error = %v", err)
+			}
 
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			id, err := CreateTask(tc.task)
-			
-			// Check error
-			if (err != nil) != tc.wantErr {
-				t.Errorf("CreateTask() error = %v, wantErr %v", err, tc.wantErr)
-				return
+			// The pending task without a due date is excluded by DueBefore
+			if page.Total != 2 || len(page.Tasks) != 2 {
+				t.Fatalf("ListTasks() returned %d of %d tasks, want 2 of 2", len(page.Tasks), page.Total)
 			}
-			
-			// Check ID
-			if tc.checkID && id <= 0 {
-				t.Errorf("CreateTask() returned invalid ID: %d", id)
+			if page.Tasks[0].Title != "a" || page.Tasks[1].Title != "c" {
+				t.Errorf("ListTasks() returned %q, %q; want \"a\", \"c\"", page.Tasks[0].Title, page.Tasks[1].Title)
 			}
 		})
-	}
+
+		t.Run("Cursor From Another Sort", func(t *testing.T) {
+			page, err := store.ListTasks(TaskFilter{Sort: SortTitle, Limit: 1})
+			if err != nil {
+				t.Fatalf("ListTasks() error = %v", err)
+			}
+
+			_, err = store.ListTasks(TaskFilter{Sort: SortDueDate, Limit: 1, Cursor: page.NextCursor})
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("ListTasks() error = %v, want ErrInvalidCursor", err)
+			}
+		})
+	})
 }
 
-// TestGetAllTasks tests the GetAllTasks function
-func TestGetAllTasks(t *testing.T) {
-	setupTestDB(t)
-	
-	// Create some test tasks
-	tasks := []models.Task{
-		{
-			Title:       "Task 1",
-			Description: "Description 1",
-			Status:      "pending",
-		},
-		{
-			Title:       "Task 2",
-			Description: "Description 2",
-			Status:      "in_progress",
-		},
-	}
-	
-	for _, task := range tasks {
-		_, err := CreateTask(task)
+// TestSearchTasks tests full-text search with SearchTasks
+func TestSearchTasks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		tasks := []models.Task{
+			{Title: "Write release notes", Description: "Summarize the changes for the deployment"},
+			{Title: "Deploy to staging", Description: "Run the deployment pipeline"},
+			{Title: "Fix login bug", Description: "Users see an error after the release"},
+			{Title: "Plan sprint", Description: "Pick tasks for next week"},
+		}
+		for _, task := range tasks {
+			if _, err := store.CreateTask(task); err != nil {
+				t.Fatalf("Failed to create test task: %v", err)
+			}
+		}
+
+		if _, err := store.SearchTasks("release", 10, ""); errors.Is(err, ErrSearchUnavailable) {
+			t.Skip("SQLite was built without FTS5; run with -tags sqlite_fts5")
+		}
+
+		// Test cases
+		testCases := []struct {
+			name       string
+			query      string
+			wantTitles []string
+			wantErr    error
+		}{
+			{
+				name:       "Title Match Ranks First",
+				query:      "release",
+				wantTitles: []string{"Write release notes", "Fix login bug"},
+			},
+			{
+				name:       "Prefix",
+				query:      "deploy*",
+				wantTitles: []string{"Deploy to staging", "Write release notes"},
+			},
+			{
+				name:       "Phrase",
+				query:      `"release notes"`,
+				wantTitles: []string{"Write release notes"},
+			},
+			{
+				name:       "All Terms Must Match",
+				query:      "login release",
+				wantTitles: []string{"Fix login bug"},
+			},
+			{
+				name:       "Updated Task Is Reindexed",
+				query:      "retrospective",
+				wantTitles: []string{"Plan sprint"},
+			},
+			{
+				name:    "No Searchable Words",
+				query:   "*** !!",
+				wantErr: ErrInvalidQuery,
+			},
+		}
+
+		// The search index must follow updates to the tasks table
+		planSprint, err := store.GetTaskByID(4)
 		if err != nil {
-			t.Fatalf("Failed to create test task: %v", err)
+			t.Fatalf("Failed to get test task: %v", err)
 		}
-	}
-	
-	// Test GetAllTasks
-	gotTasks, err := GetAllTasks()
-	if err != nil {
-		t.Errorf("GetAllTasks() error = %v", err)
-		return
-	}
-	
-	// Check if we got the expected number of tasks
-	if len(gotTasks) != len(tasks) {
-		t.Errorf("GetAllTasks() returned %d tasks, want %d", len(gotTasks), len(tasks))
-	}
+		planSprint.Description = "Hold the retrospective"
+		if err := store.UpdateTask(4, planSprint); err != nil {
+			t.Fatalf("Failed to update test task: %v", err)
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				page, err := store.SearchTasks(tc.query, 10, "")
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("SearchTasks() error = %v, wantErr %v", err, tc.wantErr)
+				}
+
+				var titles []string
+				for _, result := range page.Tasks {
+					titles = append(titles, result.Title)
+				}
+				if strings.Join(titles, ",") != strings.Join(tc.wantTitles, ",") {
+					t.Errorf("SearchTasks() titles = %v, want %v", titles, tc.wantTitles)
+				}
+			})
+		}
+
+		t.Run("Highlights", func(t *testing.T) {
+			page, err := store.SearchTasks("deploy*", 10, "")
+			if err != nil || len(page.Tasks) == 0 {
+				t.Fatalf("SearchTasks() error = %v, results = %d", err, len(page.Tasks))
+			}
+
+			result := page.Tasks[0]
+			if result.Highlights.Title != "<mark>Deploy</mark> to staging" {
+				t.Errorf("title highlight = %q", result.Highlights.Title)
+			}
+			if !strings.Contains(result.Highlights.Description, "<mark>deployment</mark>") {
+				t.Errorf("description highlight = %q", result.Highlights.Description)
+			}
+		})
+
+		t.Run("Highlights Are Escaped", func(t *testing.T) {
+			id, err := store.CreateTask(models.Task{Title: `<script>alert("release")</script>`, Description: "Tom & Jerry's <b>release</b>"})
+			if err != nil {
+				t.Fatalf("Failed to create test task: %v", err)
+			}
+			defer store.PurgeTask(int(id), 0)
+
+			page, err := store.SearchTasks("alert", 10, "")
+			if err != nil || len(page.Tasks) != 1 {
+				t.Fatalf("SearchTasks() = %d results, %v, want the task", len(page.Tasks), err)
+			}
+			if got, want := page.Tasks[0].Highlights.Title, `&lt;script&gt;<mark>alert</mark>(&#34;release&#34;)&lt;/script&gt;`; got != want {
+				t.Errorf("title highlight = %q, want %q", got, want)
+			}
+			page, _ = store.SearchTasks("jerry", 10, "")
+			if got, want := page.Tasks[0].Highlights.Description, `Tom &amp; <mark>Jerry</mark>&#39;s &lt;b&gt;release&lt;/b&gt;`; got != want {
+				t.Errorf("description highlight = %q, want %q", got, want)
+			}
+		})
+
+		t.Run("Paging", func(t *testing.T) {
+			first, err := store.SearchTasks("release", 1, "")
+			if err != nil {
+				t.Fatalf("SearchTasks() error = %v", err)
+			}
+			if first.Total != 2 || len(first.Tasks) != 1 || first.NextCursor == "" {
+				t.Fatalf("first page: total %d, %d results, cursor %q", first.Total, len(first.Tasks), first.NextCursor)
+			}
+
+			second, err := store.SearchTasks("release", 1, first.NextCursor)
+			if err != nil {
+				t.Fatalf("SearchTasks() error = %v", err)
+			}
+			if len(second.Tasks) != 1 || second.NextCursor != "" || second.Tasks[0].ID == first.Tasks[0].ID {
+				t.Errorf("second page: %d results, cursor %q", len(second.Tasks), second.NextCursor)
+			}
+
+			// A cursor only applies to the query it was issued for
+			if _, err := store.SearchTasks("deploy", 1, first.NextCursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("SearchTasks() error = %v, want ErrInvalidCursor", err)
+			}
+		})
+	})
 }
 
 // TestGetTaskByID tests the GetTaskByID function
 func TestGetTaskByID(t *testing.T) {
-	setupTestDB(t)
-	
-	// Create a test task
-	task := models.Task{
-		Title:       "Test Task",
-		Description: "This is a test task",
-		Status:      "pending",
-	}
-	
-	id, err := CreateTask(task)
-	if err != nil {
-		t.Fatalf("Failed to create test task: %v", err)
-	}
-	
-	// Test cases
-	testCases := []struct {
-		name    string
-		id      int
-		wantErr bool
-	}{
-		{
-			name:    "Existing Task",
-			id:      int(id),
-			wantErr: false,
-		},
-		{
-			name:    "Non-existent Task",
-			id:      9999,
-			wantErr: true,
-		},
-	}
-	
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			gotTask, err := GetTaskByID(tc.id)
-			
-			// Check error
-			if (err != nil) != tc.wantErr {
-				t.Errorf("GetTaskByID() error = %v, wantErr %v", err, tc.wantErr)
-				return
-			}
-			
-			// If we expect success, check the task details
-			if !tc.wantErr {
-				if gotTask.ID != tc.id {
-					t.Errorf("GetTaskByID() got task with ID = %d, want %d", gotTask.ID, tc.id)
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		// Create a test task
+		task := models.Task{
+			Title:       "Test Task",
+			Description: "This is a test task",
+			Status:      "pending",
+		}
+
+		id, err := store.CreateTask(task)
+		if err != nil {
+			t.Fatalf("Failed to create test task: %v", err)
+		}
+
+		// Test cases
+		testCases := []struct {
+			name    string
+			id      int
+			wantErr bool
+		}{
+			{
+				name:    "Existing Task",
+				id:      int(id),
+				wantErr: false,
+			},
+			{
+				name:    "Non-existent Task",
+				id:      9999,
+				wantErr: true,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				gotTask, err := store.GetTaskByID(tc.id)
+
+				// Check error
+				if (err != nil) != tc.wantErr {
+					t.Errorf("store.GetTaskByID() error = %v, wantErr %v", err, tc.wantErr)
+					return
 				}
-				if gotTask.Title != task.Title {
-					t.Errorf("GetTaskByID() got task with Title = %s, want %s", gotTask.Title, task.Title)
+
+				// If we expect success, check the task details
+				if !tc.wantErr {
+					if gotTask.ID != tc.id {
+						t.Errorf("store.GetTaskByID() got task with ID = %d, want %d", gotTask.ID, tc.id)
+					}
+					if gotTask.Title != task.Title {
+						t.Errorf("store.GetTaskByID() got task with Title = %s, want %s", gotTask.Title, task.Title)
+					}
 				}
-			}
-		})
-	}
+			})
+		}
+	})
 }
 
 // TestUpdateTask tests the UpdateTask function
 func TestUpdateTask(t *testing.T) {
-	setupTestDB(t)
-	
-	// Create a test task
-	task := models.Task{
-		Title:       "Original Title",
-		Description: "Original Description",
-		Status:      "pending",
-	}
-	
-	id, err := CreateTask(task)
-	if err != nil {
-		t.Fatalf("Failed to create test task: %v", err)
-	}
-	
-	// Test cases
-	testCases := []struct {
-		name       string
-		id         int
-		updateTask models.Task
-		wantErr    bool
-	}{
-		{
-			name: "Update Title",
-			id:   int(id),
-			updateTask: models.Task{
-				Title: "Updated Title",
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		// Create a test task
+		dueDate := time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)
+		task := models.Task{
+			Title:       "Original Title",
+			Description: "Original Description",
+			Status:      "pending",
+			DueDate:     dueDate,
+		}
+
+		id, err := store.CreateTask(task)
+		if err != nil {
+			t.Fatalf("Failed to create test task: %v", err)
+		}
+
+		// Test cases
+		testCases := []struct {
+			name       string
+			id         int
+			updateTask models.Task
+			wantErr    bool
+		}{
+			{
+				name: "Update Title",
+				id:   int(id),
+				updateTask: models.Task{
+					Title:       "Updated Title",
+					Description: "Original Description",
+					Status:      "pending",
+					DueDate:     dueDate,
+				},
+				wantErr: false,
 			},
-			wantErr: false,
-		},
-		{
-			name: "Update Status",
-			id:   int(id),
-			updateTask: models.Task{
-				Status: "completed",
+			{
+				name: "Update Status",
+				id:   int(id),
+				updateTask: models.Task{
+					Title:       "Updated Title",
+					Description: "Original Description",
+					Status:      "completed",
+					DueDate:     dueDate,
+				},
+				wantErr: false,
 			},
-			wantErr: false,
-		},
-		{
-			name: "Non-existent Task",
-			id:   9999,
-			updateTask: models.Task{
-				Title: "This Won't Work",
+			{
+				name: "Clear Description And Due Date",
+				id:   int(id),
+				updateTask: models.Task{
+					Title:  "Updated Title",
+					Status: "completed",
+				},
+				wantErr: false,
 			},
-			wantErr: true,
-		},
-	}
-	
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			err := UpdateTask(tc.id, tc.updateTask)
-			
-			// Check error
-			if (err != nil) != tc.wantErr {
-				t.Errorf("UpdateTask() error = %v, wantErr %v", err, tc.wantErr)
-				return
-			}
-			
-			// If we expect success, check the task was updated
-			if !tc.wantErr {
-				updatedTask, err := GetTaskByID(tc.id)
-				if err != nil {
-					t.Errorf("Failed to get updated task: %v", err)
+			{
+				name: "Non-existent Task",
+				id:   9999,
+				updateTask: models.Task{
+					Title: "This Won't Work",
+				},
+				wantErr: true,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				err := store.UpdateTask(tc.id, tc.updateTask)
+
+				// Check error
+				if (err != nil) != tc.wantErr {
+					t.Errorf("store.UpdateTask() error = %v, wantErr %v", err, tc.wantErr)
 					return
 				}
-				
-				// Check if the field was updated
-				if tc.updateTask.Title != "" && updatedTask.Title != tc.updateTask.Title {
-					t.Errorf("UpdateTask() failed to update Title, got %s, want %s", 
-						updatedTask.Title, tc.updateTask.Title)
+
+				// If we expect success, check the task was updated
+				if !tc.wantErr {
+					updatedTask, err := store.GetTaskByID(tc.id)
+					if err != nil {
+						t.Errorf("Failed to get updated task: %v", err)
+						return
+					}
+
+					// Every field is replaced, including empty ones
+					if updatedTask.Title != tc.updateTask.Title {
+						t.Errorf("store.UpdateTask() failed to update Title, got %s, want %s",
+							updatedTask.Title, tc.updateTask.Title)
+					}
+					if updatedTask.Description != tc.updateTask.Description {
+						t.Errorf("store.UpdateTask() failed to update Description, got %q, want %q",
+							updatedTask.Description, tc.updateTask.Description)
+					}
+					if updatedTask.Status != tc.updateTask.Status {
+						t.Errorf("store.UpdateTask() failed to update Status, got %s, want %s",
+							updatedTask.Status, tc.updateTask.Status)
+					}
+					if !updatedTask.DueDate.Equal(tc.updateTask.DueDate) {
+						t.Errorf("store.UpdateTask() failed to update DueDate, got %v, want %v",
+							updatedTask.DueDate, tc.updateTask.DueDate)
+					}
+				}
+			})
+		}
+	})
+}
+
+// TestDeleteTask tests the DeleteTask function
+func TestDeleteTask(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		// Create a test task
+		task := models.Task{
+			Title:  "Task to Delete",
+			Status: "pending",
+		}
+
+		id, err := store.CreateTask(task)
+		if err != nil {
+			t.Fatalf("Failed to create test task: %v", err)
+		}
+
+		// Test cases
+		testCases := []struct {
+			name    string
+			id      int
+			wantErr bool
+		}{
+			{
+				name:    "Existing Task",
+				id:      int(id),
+				wantErr: false,
+			},
+			{
+				name:    "Non-existent Task",
+				id:      9999,
+				wantErr: false, // SQLite doesn't return error for non-existent ID
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				err := store.DeleteTask(tc.id, 0)
+
+				// Check error
+				if (err != nil) != tc.wantErr {
+					t.Errorf("store.DeleteTask() error = %v, wantErr %v", err, tc.wantErr)
+					return
 				}
-				if tc.updateTask.Status != "" && updatedTask.Status != tc.updateTask.Status {
-					t.Errorf("UpdateTask() failed to update Status, got %s, want %s", 
-						updatedTask.Status, tc.updateTask.Status)
+
+				// Verify task was deleted
+				if !tc.wantErr {
+					_, err := store.GetTaskByID(tc.id)
+					if err == nil {
+						t.Errorf("store.DeleteTask() failed to delete task with ID = %d", tc.id)
+					}
 				}
+			})
+		}
+	})
+}
+
+// TestTaskVersions tests that updates increment the version and stale versions are rejected
+func TestTaskVersions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		id, err := store.CreateTask(models.Task{Title: "Versioned", Status: models.StatusPending})
+		if err != nil {
+			t.Fatalf("CreateTask() error = %v", err)
+		}
+
+		task, err := store.GetTaskByID(int(id))
+		if err != nil {
+			t.Fatalf("GetTaskByID() error = %v", err)
+		}
+		if task.Version != 1 {
+			t.Fatalf("new task has version %d, want 1", task.Version)
+		}
+
+		// An update at the current version succeeds and moves to the next one
+		task.Title = "Versioned once"
+		if err := store.UpdateTask(int(id), task); err != nil {
+			t.Fatalf("UpdateTask() at current version error = %v", err)
+		}
+
+		// Writing again with the version read before the update fails
+		task.Title = "Lost update"
+		if err := store.UpdateTask(int(id), task); !errors.Is(err, ErrVersionConflict) {
+			t.Errorf("UpdateTask() at stale version error = %v, want ErrVersionConflict", err)
+		}
+		if err := store.DeleteTask(int(id), task.Version); !errors.Is(err, ErrVersionConflict) {
+			t.Errorf("DeleteTask() at stale version error = %v, want ErrVersionConflict", err)
+		}
+
+		current, err := store.GetTaskByID(int(id))
+		if err != nil {
+			t.Fatalf("GetTaskByID() error = %v", err)
+		}
+		if current.Version != 2 || current.Title != "Versioned once" {
+			t.Errorf("task = version %d %q, want version 2 %q", current.Version, current.Title, "Versioned once")
+		}
+
+		// Version 0 skips the check
+		task.Version = 0
+		if err := store.UpdateTask(int(id), task); err != nil {
+			t.Errorf("UpdateTask() without version error = %v", err)
+		}
+		if err := store.DeleteTask(int(id), 3); err != nil {
+			t.Errorf("DeleteTask() at current version error = %v", err)
+		}
+	})
+}
+
+// TestRunInTx tests that transactions commit, roll back and nest
+func TestRunInTx(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		errRollback := errors.New("roll back")
+
+		// A failed transaction leaves no trace
+		err := store.RunInTx(func(tx TaskStore) error {
+			if _, err := tx.CreateTask(models.Task{Title: "Rolled back", Status: models.StatusPending}); err != nil {
+				return err
 			}
+			return errRollback
 		})
-	}
+		if !errors.Is(err, errRollback) {
+			t.Fatalf("RunInTx() error = %v, want errRollback", err)
+		}
+
+		// A nested failure only undoes the nested writes
+		err = store.RunInTx(func(tx TaskStore) error {
+			if _, err := tx.CreateTask(models.Task{Title: "Outer", Status: models.StatusPending}); err != nil {
+				return err
+			}
+			nestedErr := tx.RunInTx(func(nested TaskStore) error {
+				if _, err := nested.CreateTask(models.Task{Title: "Inner", Status: models.StatusPending}); err != nil {
+					return err
+				}
+				return errRollback
+			})
+			if !errors.Is(nestedErr, errRollback) {
+				t.Errorf("nested RunInTx() error = %v, want errRollback", nestedErr)
+			}
+
+			// Reads inside the transaction see its own writes
+			tasks, err := tx.GetAllTasks()
+			if err != nil {
+				return err
+			}
+			if len(tasks) != 1 || tasks[0].Title != "Outer" {
+				t.Errorf("tasks inside transaction = %v, want only Outer", tasks)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("RunInTx() error = %v", err)
+		}
+
+		tasks, err := store.GetAllTasks()
+		if err != nil {
+			t.Fatalf("GetAllTasks() error = %v", err)
+		}
+		if len(tasks) != 1 || tasks[0].Title != "Outer" {
+			t.Errorf("tasks after transactions = %v, want only Outer", tasks)
+		}
+	})
 }
 
-// TestDeleteTask tests the DeleteTask function
-func TestDeleteTask(t *testing.T) {
-	setupTestDB(t)
-	
-	// Create a test task
-	task := models.Task{
-		Title:  "Task to Delete",
-		Status: "pending",
-	}
-	
-	id, err := CreateTask(task)
+// TestTrash tests soft deletion, restoring and purging
+func TestTrash(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		var ids []int
+		for _, title := range []string{"Keep", "Trash", "Purge"} {
+			id, err := store.CreateTask(models.Task{Title: title, Status: models.StatusPending})
+			if err != nil {
+				t.Fatalf("CreateTask() error = %v", err)
+			}
+			ids = append(ids, int(id))
+		}
+		keep, trash, purge := ids[0], ids[1], ids[2]
+
+		// Deleting moves the task to the trash
+		if err := store.DeleteTask(trash, 0); err != nil {
+			t.Fatalf("DeleteTask() error = %v", err)
+		}
+		if _, err := store.GetTaskByID(trash); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("GetTaskByID() of trashed task error = %v, want ErrTaskNotFound", err)
+		}
+		trashed, err := store.GetTrashedTask(trash)
+		if err != nil {
+			t.Fatalf("GetTrashedTask() error = %v", err)
+		}
+		if trashed.DeletedAt == nil || trashed.Version != 2 {
+			t.Errorf("trashed task has deleted_at %v and version %d, want a time and 2", trashed.DeletedAt, trashed.Version)
+		}
+		if err := store.UpdateTask(trash, models.Task{Title: "Edited", Status: models.StatusPending}); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("UpdateTask() of trashed task error = %v, want ErrTaskNotFound", err)
+		}
+
+		// Listings show either active tasks or the trash
+		for _, tc := range []struct {
+			trashed bool
+			want    int
+		}{{false, 2}, {true, 1}} {
+			page, err := store.ListTasks(TaskFilter{Trashed: tc.trashed})
+			if err != nil {
+				t.Fatalf("ListTasks() error = %v", err)
+			}
+			if page.Total != tc.want || len(page.Tasks) != tc.want {
+				t.Errorf("ListTasks(Trashed: %v) returned %d tasks, want %d", tc.trashed, page.Total, tc.want)
+			}
+		}
+
+		// Restoring brings the task back
+		if err := store.RestoreTask(trash); err != nil {
+			t.Fatalf("RestoreTask() error = %v", err)
+		}
+		if restored, err := store.GetTaskByID(trash); err != nil || restored.DeletedAt != nil {
+			t.Errorf("GetTaskByID() after restore = %+v, %v", restored, err)
+		}
+		if err := store.RestoreTask(keep); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("RestoreTask() of active task error = %v, want ErrTaskNotFound", err)
+		}
+
+		// Purging removes tasks for good, whether or not they are in the trash
+		if err := store.PurgeTask(purge, 0); err != nil {
+			t.Fatalf("PurgeTask() error = %v", err)
+		}
+		if _, err := store.GetTrashedTask(purge); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("GetTrashedTask() of purged task error = %v, want ErrTaskNotFound", err)
+		}
+
+		// Only tasks trashed before the cutoff are purged from the trash
+		if err := store.DeleteTask(trash, 0); err != nil {
+			t.Fatalf("DeleteTask() error = %v", err)
+		}
+		if purged, err := store.PurgeTrash(time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+			t.Errorf("PurgeTrash() of an hour ago = %d, %v, want 0", purged, err)
+		}
+		if purged, err := store.PurgeTrash(time.Now().Add(time.Second)); err != nil || purged != 1 {
+			t.Errorf("PurgeTrash() of now = %d, %v, want 1", purged, err)
+		}
+		if _, err := store.GetTrashedTask(trash); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("GetTrashedTask() after PurgeTrash() error = %v, want ErrTaskNotFound", err)
+		}
+	})
+}
+
+// TestStartTrashPurger tests that the purger empties the trash of expired tasks
+func TestStartTrashPurger(t *testing.T) {
+	store := NewMemoryStore()
+	id, err := store.CreateTask(models.Task{Title: "Expired", Status: models.StatusPending})
 	if err != nil {
-		t.Fatalf("Failed to create test task: %v", err)
+		t.Fatalf("CreateTask() error = %v", err)
 	}
-	
-	// Test cases
-	testCases := []struct {
-		name    string
-		id      int
-		wantErr bool
-	}{
-		{
-			name:    "Existing Task",
-			id:      int(id),
-			wantErr: false,
-		},
-		{
-			name:    "Non-existent Task",
-			id:      9999,
-			wantErr: false, // SQLite doesn't return error for non-existent ID
-		},
+	if err := store.DeleteTask(int(id), 0); err != nil {
+		t.Fatalf("DeleteTask() error = %v", err)
 	}
-	
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			err := DeleteTask(tc.id)
-			
-			// Check error
-			if (err != nil) != tc.wantErr {
-				t.Errorf("DeleteTask() error = %v, wantErr %v", err, tc.wantErr)
-				return
-			}
-			
-			// Verify task was deleted
-			if !tc.wantErr {
-				_, err := GetTaskByID(tc.id)
-				if err == nil {
-					t.Errorf("DeleteTask() failed to delete task with ID = %d", tc.id)
-				}
-			}
-		})
+
+	stop := StartTrashPurger(store, -time.Second, time.Hour)
+	defer stop()
+
+	// The first purge runs straight away
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := store.GetTrashedTask(int(id)); errors.Is(err, ErrTaskNotFound) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("StartTrashPurger() did not purge the expired task")
+		}
+		time.Sleep(5 * time.Millisecond)
 	}
 }
 
-// TestMain handles setup and teardown for all tests
-func TestMain(m *testing.M) {
-	// Run tests
-	code := m.Run()
-	
-	// Clean up
-	os.Exit(code)
+// TestStatusHistory tests that status changes are recorded and removed with their task
+func TestStatusHistory(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		id, err := store.CreateTask(models.Task{Title: "History", Status: models.StatusPending})
+		if err != nil {
+			t.Fatalf("CreateTask() error = %v", err)
+		}
+
+		// A change of any other field doesn't add an entry
+		updates := []models.Task{
+			{Title: "History", Status: models.StatusInProgress},
+			{Title: "History renamed", Status: models.StatusInProgress},
+			{Title: "History renamed", Status: models.StatusCompleted},
+		}
+		for _, update := range updates {
+			if err := store.UpdateTask(int(id), update); err != nil {
+				t.Fatalf("UpdateTask() error = %v", err)
+			}
+		}
+
+		history, err := store.GetStatusHistory(int(id))
+		if err != nil {
+			t.Fatalf("GetStatusHistory() error = %v", err)
+		}
+
+		want := []struct{ from, to models.Status }{
+			{"", models.StatusPending},
+			{models.StatusPending, models.StatusInProgress},
+			{models.StatusInProgress, models.StatusCompleted},
+		}
+		if len(history) != len(want) {
+			t.Fatalf("GetStatusHistory() returned %d entries, want %d", len(history), len(want))
+		}
+		for i, change := range history {
+			if change.TaskID != int(id) || change.From != want[i].from || change.To != want[i].to {
+				t.Errorf("history[%d] = task %d %s -> %s, want task %d %s -> %s",
+					i, change.TaskID, change.From, change.To, id, want[i].from, want[i].to)
+			}
+			if change.At.IsZero() {
+				t.Errorf("history[%d] has no timestamp", i)
+			}
+		}
+
+		// A deleted task's history is no longer available
+		if err := store.DeleteTask(int(id), 0); err != nil {
+			t.Fatalf("DeleteTask() error = %v", err)
+		}
+		if _, err := store.GetStatusHistory(int(id)); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("GetStatusHistory() after delete error = %v, want ErrTaskNotFound", err)
+		}
+	})
+}
+
+// TestSubtasks tests parents, subtask listings and parent cycles
+func TestSubtasks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		create := func(title string, parentID *int) int {
+			t.Helper()
+			id, err := store.CreateTask(models.Task{Title: title, Status: models.StatusPending, ParentID: parentID})
+			if err != nil {
+				t.Fatalf("CreateTask(%q) error = %v", title, err)
+			}
+			return int(id)
+		}
+		root := create("Root", nil)
+		child := create("Child", &root)
+		grandchild := create("Grandchild", &child)
+
+		subtasks, err := store.GetSubtasks(root)
+		if err != nil {
+			t.Fatalf("GetSubtasks() error = %v", err)
+		}
+		if len(subtasks) != 1 || subtasks[0].ID != child || *subtasks[0].ParentID != root {
+			t.Errorf("GetSubtasks() = %+v, want only task %d", subtasks, child)
+		}
+
+		// Parents must exist outside the trash
+		missing := 999
+		if _, err := store.CreateTask(models.Task{Title: "Orphan", ParentID: &missing}); !errors.Is(err, ErrParentNotFound) {
+			t.Errorf("CreateTask() with a missing parent error = %v, want ErrParentNotFound", err)
+		}
+
+		// A task can't move under itself or its own subtasks
+		for _, parentID := range []int{root, grandchild} {
+			parentID := parentID
+			err := store.UpdateTask(root, models.Task{Title: "Root", Status: models.StatusPending, ParentID: &parentID})
+			var cycle *CycleError
+			if !errors.As(err, &cycle) || !errors.Is(err, ErrCycle) {
+				t.Fatalf("UpdateTask() with parent %d error = %v, want a CycleError", parentID, err)
+			}
+			if first, last := cycle.Path[0], cycle.Path[len(cycle.Path)-1]; first != root || last != root {
+				t.Errorf("cycle path = %v, want it to start and end with %d", cycle.Path, root)
+			}
+		}
+
+		// Purging a parent turns its subtasks into top-level tasks
+		if err := store.PurgeTask(child, 0); err != nil {
+			t.Fatalf("PurgeTask() error = %v", err)
+		}
+		orphan, err := store.GetTaskByID(grandchild)
+		if err != nil {
+			t.Fatalf("GetTaskByID() error = %v", err)
+		}
+		if orphan.ParentID != nil || orphan.Version != 2 {
+			t.Errorf("orphaned subtask has parent %v and version %d, want none and 2", orphan.ParentID, orphan.Version)
+		}
+	})
+}
+
+// TestDependencies tests adding, listing and removing blockers, and dependency cycles
+func TestDependencies(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		var ids []int
+		for _, title := range []string{"Design", "Build", "Ship"} {
+			id, err := store.CreateTask(models.Task{Title: title, Status: models.StatusPending})
+			if err != nil {
+				t.Fatalf("CreateTask() error = %v", err)
+			}
+			ids = append(ids, int(id))
+		}
+		design, build, ship := ids[0], ids[1], ids[2]
+
+		// Design blocks build, which blocks ship; adding one twice is fine
+		for _, dependency := range [][2]int{{design, build}, {build, ship}, {build, ship}} {
+			if err := store.AddDependency(dependency[0], dependency[1]); err != nil {
+				t.Fatalf("AddDependency(%d, %d) error = %v", dependency[0], dependency[1], err)
+			}
+		}
+		want := []Dependency{{BlockerID: design, BlockedID: build}, {BlockerID: build, BlockedID: ship}}
+		if got, err := store.OpenDependencies(); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("OpenDependencies() = %v, %v, want %v", got, err, want)
+		}
+		blockers, err := store.GetBlockers(ship)
+		if err != nil {
+			t.Fatalf("GetBlockers() error = %v", err)
+		}
+		if len(blockers) != 1 || blockers[0].ID != build {
+			t.Errorf("GetBlockers() = %+v, want only task %d", blockers, build)
+		}
+
+		// Ship already depends on design, so design can't depend on ship
+		err = store.AddDependency(ship, design)
+		var cycle *CycleError
+		if !errors.As(err, &cycle) {
+			t.Fatalf("AddDependency() closing a cycle error = %v, want a CycleError", err)
+		}
+		wantPath := []int{ship, design, build, ship}
+		if len(cycle.Path) != len(wantPath) {
+			t.Fatalf("cycle path = %v, want %v", cycle.Path, wantPath)
+		}
+		for i := range wantPath {
+			if cycle.Path[i] != wantPath[i] {
+				t.Fatalf("cycle path = %v, want %v", cycle.Path, wantPath)
+			}
+		}
+		if err := store.AddDependency(ship, ship); !errors.Is(err, ErrCycle) {
+			t.Errorf("AddDependency() of a task on itself error = %v, want ErrCycle", err)
+		}
+		if err := store.AddDependency(design, 999); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("AddDependency() on a missing task error = %v, want ErrTaskNotFound", err)
+		}
+
+		// Trashed blockers aren't listed, and purged ones are gone for good
+		if err := store.DeleteTask(design, 0); err != nil {
+			t.Fatalf("DeleteTask() error = %v", err)
+		}
+		if blockers, err := store.GetBlockers(build); err != nil || len(blockers) != 0 {
+			t.Errorf("GetBlockers() with a trashed blocker = %+v, %v, want none", blockers, err)
+		}
+
+		// Nor are dependencies on trashed or completed tasks open
+		want = []Dependency{{BlockerID: build, BlockedID: ship}}
+		if got, err := store.OpenDependencies(); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("OpenDependencies() with a trashed blocker = %v, %v, want %v", got, err, want)
+		}
+		shipTask, _ := store.GetTaskByID(ship)
+		shipTask.Status = models.StatusCompleted
+		if err := store.UpdateTask(ship, shipTask); err != nil {
+			t.Fatalf("UpdateTask() error = %v", err)
+		}
+		if got, err := store.OpenDependencies(); err != nil || len(got) != 0 {
+			t.Errorf("OpenDependencies() with a completed blocked task = %v, %v, want none", got, err)
+		}
+		if err := store.PurgeTask(design, 0); err != nil {
+			t.Fatalf("PurgeTask() error = %v", err)
+		}
+		if err := store.RemoveDependency(design, build); !errors.Is(err, ErrDependencyNotFound) {
+			t.Errorf("RemoveDependency() of a purged blocker error = %v, want ErrDependencyNotFound", err)
+		}
+
+		if err := store.RemoveDependency(build, ship); err != nil {
+			t.Fatalf("RemoveDependency() error = %v", err)
+		}
+		if blockers, err := store.GetBlockers(ship); err != nil || len(blockers) != 0 {
+			t.Errorf("GetBlockers() after RemoveDependency() = %+v, %v, want none", blockers, err)
+		}
+	})
+}
+
+// TestTags tests storing tags, filtering by them and counting them
+func TestPriority(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		id, err := store.CreateTask(models.Task{Title: "Unprioritized", Status: models.StatusPending})
+		if err != nil {
+			t.Fatalf("CreateTask() error = %v", err)
+		}
+		task, _ := store.GetTaskByID(int(id))
+		if task.Priority != models.PriorityMedium {
+			t.Errorf("Priority of a new task = %q, want %q", task.Priority, models.PriorityMedium)
+		}
+
+		task.Priority = models.PriorityUrgent
+		if err := store.UpdateTask(task.ID, task); err != nil {
+			t.Fatalf("UpdateTask() error = %v", err)
+		}
+		if task, _ = store.GetTaskByID(task.ID); task.Priority != models.PriorityUrgent {
+			t.Errorf("Priority after UpdateTask() = %q, want %q", task.Priority, models.PriorityUrgent)
+		}
+
+		// Replacing a task without a priority makes it medium again
+		task.Priority = ""
+		if err := store.UpdateTask(task.ID, task); err != nil {
+			t.Fatalf("UpdateTask() error = %v", err)
+		}
+		if task, _ = store.GetTaskByID(task.ID); task.Priority != models.PriorityMedium {
+			t.Errorf("Priority after UpdateTask() without one = %q, want %q", task.Priority, models.PriorityMedium)
+		}
+	})
+}
+
+func TestTags(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		tasks := []models.Task{
+			{Title: "API docs", Tags: []string{"Backend", " docs ", "backend"}},
+			{Title: "API server", Tags: []string{"backend"}},
+			{Title: "Landing page", Tags: []string{"frontend", "docs"}},
+			{Title: "Untagged"},
+		}
+		var ids []int
+		for _, task := range tasks {
+			task.Status = models.StatusPending
+			id, err := store.CreateTask(task)
+			if err != nil {
+				t.Fatalf("CreateTask() error = %v", err)
+			}
+			ids = append(ids, int(id))
+		}
+
+		// Tags are trimmed, lowercased, deduplicated and sorted
+		task, err := store.GetTaskByID(ids[0])
+		if err != nil {
+			t.Fatalf("GetTaskByID() error = %v", err)
+		}
+		if strings.Join(task.Tags, ",") != "backend,docs" {
+			t.Errorf("tags = %q, want [backend docs]", task.Tags)
+		}
+		if untagged, _ := store.GetTaskByID(ids[3]); untagged.Tags == nil || len(untagged.Tags) != 0 {
+			t.Errorf("untagged task has tags %#v, want an empty slice", untagged.Tags)
+		}
+
+		tests := []struct {
+			name    string
+			tags    []string
+			tagMode string
+			want    int
+		}{
+			{"All By Default", []string{"backend", "docs"}, "", 1},
+			{"Any", []string{"backend", "docs"}, TagModeAny, 3},
+			{"Single Tag", []string{"DOCS"}, TagModeAll, 2},
+			{"Unknown Tag", []string{"mobile"}, TagModeAny, 0},
+		}
+		for _, tt := range tests {
+			page, err := store.ListTasks(TaskFilter{Tags: tt.tags, TagMode: tt.tagMode})
+			if err != nil {
+				t.Fatalf("%s: ListTasks() error = %v", tt.name, err)
+			}
+			if page.Total != tt.want || len(page.Tasks) != tt.want {
+				t.Errorf("%s: ListTasks() returned %d tasks, want %d", tt.name, page.Total, tt.want)
+			}
+		}
+
+		// Updates replace the tags, and trashed tasks aren't counted
+		if err := store.UpdateTask(ids[1], models.Task{Title: "API server", Status: models.StatusPending, Tags: []string{"ops"}}); err != nil {
+			t.Fatalf("UpdateTask() error = %v", err)
+		}
+		if err := store.DeleteTask(ids[2], 0); err != nil {
+			t.Fatalf("DeleteTask() error = %v", err)
+		}
+		counts, err := store.ListTags()
+		if err != nil {
+			t.Fatalf("ListTags() error = %v", err)
+		}
+		want := []models.TagCount{{Name: "backend", Count: 1}, {Name: "docs", Count: 1}, {Name: "ops", Count: 1}}
+		if len(counts) != len(want) {
+			t.Fatalf("ListTags() = %+v, want %+v", counts, want)
+		}
+		for i := range want {
+			if counts[i] != want[i] {
+				t.Errorf("ListTags()[%d] = %+v, want %+v", i, counts[i], want[i])
+			}
+		}
+	})
+}
+
+// TestUsers tests users, task ownership and assignees
+func TestUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		var userIDs []int
+		for _, email := range []string{"ada@example.com", "bob@example.com"} {
+			id, err := store.CreateUser(models.User{Name: "User", Email: email})
+			if err != nil {
+				t.Fatalf("CreateUser() error = %v", err)
+			}
+			userIDs = append(userIDs, int(id))
+		}
+		ada, bob := userIDs[0], userIDs[1]
+
+		if _, err := store.CreateUser(models.User{Name: "Ada again", Email: "ada@example.com"}); !errors.Is(err, ErrEmailTaken) {
+			t.Errorf("CreateUser() with a taken email error = %v, want ErrEmailTaken", err)
+		}
+		if _, err := store.GetUserByID(999); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("GetUserByID() of a missing user error = %v, want ErrUserNotFound", err)
+		}
+		if users, err := store.ListUsers(); err != nil || len(users) != 2 || users[0].ID != ada {
+			t.Errorf("ListUsers() = %+v, %v, want both users oldest first", users, err)
+		}
+
+		// Assignees must exist
+		missing := 999
+		_, err := store.CreateTask(models.Task{Title: "Unassignable", Status: models.StatusPending, AssigneeID: &missing})
+		if !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("CreateTask() with a missing assignee error = %v, want ErrUserNotFound", err)
+		}
+
+		id, err := store.CreateTask(models.Task{Title: "Owned", Status: models.StatusPending, CreatedBy: &ada})
+		if err != nil {
+			t.Fatalf("CreateTask() error = %v", err)
+		}
+		if _, err := store.CreateTask(models.Task{Title: "Unowned", Status: models.StatusPending}); err != nil {
+			t.Fatalf("CreateTask() error = %v", err)
+		}
+
+		// Updates set the assignee but never change the creator
+		err = store.UpdateTask(int(id), models.Task{Title: "Owned", Status: models.StatusPending, CreatedBy: &bob, AssigneeID: &bob})
+		if err != nil {
+			t.Fatalf("UpdateTask() error = %v", err)
+		}
+		task, err := store.GetTaskByID(int(id))
+		if err != nil {
+			t.Fatalf("GetTaskByID() error = %v", err)
+		}
+		if task.CreatedBy == nil || *task.CreatedBy != ada || task.AssigneeID == nil || *task.AssigneeID != bob {
+			t.Errorf("task created by %v and assigned to %v, want %d and %d", task.CreatedBy, task.AssigneeID, ada, bob)
+		}
+
+		// Both the creator and the assignee see the task among their own
+		for _, userID := range []int{ada, bob} {
+			page, err := store.ListTasks(TaskFilter{UserID: userID})
+			if err != nil {
+				t.Fatalf("ListTasks() error = %v", err)
+			}
+			if page.Total != 1 || page.Tasks[0].ID != int(id) {
+				t.Errorf("ListTasks(UserID: %d) = %+v, want only task %d", userID, page.Tasks, id)
+			}
+		}
+	})
+}
+
+// TestRecurrence tests that completing a recurring task creates its next occurrence
+func TestRecurrence(t *testing.T) {
+	// 2026-03-02 is a Monday
+	due := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		recurrence string
+		due        time.Time
+		wantDue    time.Time // zero if the series ends
+		wantRule   string
+	}{
+		{"Daily", "FREQ=DAILY", due, due.AddDate(0, 0, 1), "FREQ=DAILY"},
+		{"Every Third Day", "rrule:freq=daily;interval=3", due, due.AddDate(0, 0, 3), "FREQ=DAILY;INTERVAL=3"},
+		{"Weekdays", "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR", due.AddDate(0, 0, 4), due.AddDate(0, 0, 7), "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR"},
+		{"Weekly", "FREQ=WEEKLY", due, due.AddDate(0, 0, 7), "FREQ=WEEKLY"},
+		{"Later The Same Week", "FREQ=WEEKLY;BYDAY=MO,TH", due, due.AddDate(0, 0, 3), "FREQ=WEEKLY;BYDAY=MO,TH"},
+		{"Fortnightly Wrap", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", due.AddDate(0, 0, 3), due.AddDate(0, 0, 14), "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH"},
+		{"Monthly", "FREQ=MONTHLY", due, due.AddDate(0, 1, 0), "FREQ=MONTHLY"},
+		{"Monthly Skips Short Months", "FREQ=MONTHLY", time.Date(2026, 1, 31, 9, 0, 0, 0, time.UTC), time.Date(2026, 3, 31, 9, 0, 0, 0, time.UTC), "FREQ=MONTHLY"},
+		{"Last Day Of Month", "FREQ=MONTHLY;BYMONTHDAY=-1", time.Date(2026, 1, 31, 9, 0, 0, 0, time.UTC), time.Date(2026, 2, 28, 9, 0, 0, 0, time.UTC), "FREQ=MONTHLY;BYMONTHDAY=-1"},
+		{"Twice Monthly", "FREQ=MONTHLY;BYMONTHDAY=1,15", due, time.Date(2026, 3, 15, 9, 30, 0, 0, time.UTC), "FREQ=MONTHLY;BYMONTHDAY=1,15"},
+		{"Yearly Leap Day", "FREQ=YEARLY", time.Date(2028, 2, 29, 9, 0, 0, 0, time.UTC), time.Date(2032, 2, 29, 9, 0, 0, 0, time.UTC), "FREQ=YEARLY"},
+		{"Count Counts Down", "FREQ=WEEKLY;COUNT=3", due, due.AddDate(0, 0, 7), "FREQ=WEEKLY;COUNT=2"},
+		{"Last Of Count", "FREQ=WEEKLY;COUNT=1", due, time.Time{}, ""},
+		{"Before Until", "FREQ=WEEKLY;UNTIL=20260309", due, due.AddDate(0, 0, 7), "FREQ=WEEKLY;UNTIL=20260309T235959Z"},
+		{"Past Until", "FREQ=WEEKLY;UNTIL=20260308T000000Z", due, time.Time{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachStore(t, func(t *testing.T, store TaskStore) {
+				id, err := store.CreateTask(models.Task{Title: "Chore", Status: models.StatusPending, DueDate: tt.due, Recurrence: tt.recurrence, Tags: []string{"home"}})
+				if err != nil {
+					t.Fatalf("CreateTask() error = %v", err)
+				}
+				if err := store.UpdateTask(int(id), models.Task{Title: "Chore", Status: models.StatusCompleted, DueDate: tt.due, Recurrence: tt.recurrence, Tags: []string{"home"}}); err != nil {
+					t.Fatalf("UpdateTask() error = %v", err)
+				}
+
+				series, err := store.GetSeries(int(id))
+				if err != nil {
+					t.Fatalf("GetSeries() error = %v", err)
+				}
+				if tt.wantDue.IsZero() {
+					if len(series) != 1 {
+						t.Errorf("series has %d occurrences, want the series to end", len(series))
+					}
+					return
+				}
+				if len(series) != 2 {
+					t.Fatalf("series has %d occurrences, want 2", len(series))
+				}
+
+				next := series[1]
+				if !next.DueDate.Equal(tt.wantDue) {
+					t.Errorf("next due date = %v, want %v", next.DueDate, tt.wantDue)
+				}
+				if next.Recurrence != tt.wantRule || next.Status != models.StatusPending || next.SeriesID == nil || *next.SeriesID != int(id) {
+					t.Errorf("next occurrence = %+v, want a pending task in series %d with rule %s", next, id, tt.wantRule)
+				}
+				if len(next.Tags) != 1 || next.Tags[0] != "home" {
+					t.Errorf("next occurrence tags = %v, want [home]", next.Tags)
+				}
+			})
+		})
+	}
+
+	t.Run("Series", func(t *testing.T) {
+		forEachStore(t, func(t *testing.T, store TaskStore) {
+			plain, err := store.CreateTask(models.Task{Title: "Once", Status: models.StatusPending})
+			if err != nil {
+				t.Fatalf("CreateTask() error = %v", err)
+			}
+			if _, err := store.GetSeries(int(plain)); !errors.Is(err, ErrNoSeries) {
+				t.Errorf("GetSeries() of a task that doesn't recur error = %v, want ErrNoSeries", err)
+			}
+
+			// Without a due date the next occurrence is due a period after completion
+			id, err := store.CreateTask(models.Task{Title: "Water plants", Status: models.StatusPending, Recurrence: "FREQ=DAILY"})
+			if err != nil {
+				t.Fatalf("CreateTask() error = %v", err)
+			}
+			first, _ := store.GetTaskByID(int(id))
+			first.Status = models.StatusCompleted
+			if err := store.UpdateTask(int(id), first); err != nil {
+				t.Fatalf("UpdateTask() error = %v", err)
+			}
+			series, _ := store.GetSeries(int(id))
+			if len(series) != 2 || series[1].DueDate.Before(time.Now().Add(23*time.Hour)) {
+				t.Fatalf("series = %+v, want a second occurrence due about a day from now", series)
+			}
+
+			// Reopening and completing an occurrence again doesn't add another
+			first, _ = store.GetTaskByID(int(id))
+			first.Status = models.StatusPending
+			store.UpdateTask(int(id), first)
+			first, _ = store.GetTaskByID(int(id))
+			first.Status = models.StatusCompleted
+			store.UpdateTask(int(id), first)
+			if series, _ := store.GetSeries(series[1].ID); len(series) != 2 {
+				t.Errorf("series has %d occurrences after completing one twice, want 2", len(series))
+			}
+		})
+	})
+}
+
+// TestAPIKeys tests storing, looking up and revoking API keys
+func TestAPIKeys(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		userID, err := store.CreateUser(models.User{Name: "Ada", Email: "ada@example.com"})
+		if err != nil {
+			t.Fatalf("CreateUser() error = %v", err)
+		}
+		ada := int(userID)
+
+		missing := 999
+		if _, err := store.CreateAPIKey(models.APIKey{Name: "orphan", KeyHash: "h0", UserID: &missing, Scopes: []string{"read"}}); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("CreateAPIKey() for a missing user error = %v, want ErrUserNotFound", err)
+		}
+
+		id, err := store.CreateAPIKey(models.APIKey{Name: "ci", KeyHash: "h1", UserID: &ada, Scopes: []string{"read", "write"}})
+		if err != nil {
+			t.Fatalf("CreateAPIKey() error = %v", err)
+		}
+		if _, err := store.CreateAPIKey(models.APIKey{Name: "reader", KeyHash: "h2", Scopes: []string{"read"}}); err != nil {
+			t.Fatalf("CreateAPIKey() error = %v", err)
+		}
+
+		key, err := store.GetAPIKeyByHash("h1")
+		if err != nil {
+			t.Fatalf("GetAPIKeyByHash() error = %v", err)
+		}
+		if key.ID != int(id) || key.Name != "ci" || key.UserID == nil || *key.UserID != ada || len(key.Scopes) != 2 || key.Scopes[1] != "write" {
+			t.Errorf("GetAPIKeyByHash() = %+v, want the ci key for user %d", key, ada)
+		}
+		if _, err := store.GetAPIKeyByHash("nope"); !errors.Is(err, ErrAPIKeyNotFound) {
+			t.Errorf("GetAPIKeyByHash() of a missing hash error = %v, want ErrAPIKeyNotFound", err)
+		}
+
+		if err := store.DeleteAPIKey(int(id)); err != nil {
+			t.Fatalf("DeleteAPIKey() error = %v", err)
+		}
+		if err := store.DeleteAPIKey(int(id)); !errors.Is(err, ErrAPIKeyNotFound) {
+			t.Errorf("DeleteAPIKey() twice error = %v, want ErrAPIKeyNotFound", err)
+		}
+		if keys, err := store.ListAPIKeys(); err != nil || len(keys) != 1 || keys[0].Name != "reader" || keys[0].UserID != nil {
+			t.Errorf("ListAPIKeys() = %+v, %v, want only the reader key", keys, err)
+		}
+	})
+}
+
+// TestReminders tests marking tasks overdue and claiming each reminder once
+func TestReminders(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		due := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+		id, err := store.CreateTask(models.Task{Title: "Late", Status: models.StatusPending, DueDate: due})
+		if err != nil {
+			t.Fatalf("CreateTask() error = %v", err)
+		}
+
+		at := time.Now().UTC().Truncate(time.Second)
+		if err := store.MarkOverdue(int(id), at); err != nil {
+			t.Fatalf("MarkOverdue() error = %v", err)
+		}
+		if err := store.MarkOverdue(int(id), at.Add(time.Minute)); err != nil {
+			t.Fatalf("MarkOverdue() twice error = %v", err)
+		}
+		task, err := store.GetTaskByID(int(id))
+		if err != nil {
+			t.Fatalf("GetTaskByID() error = %v", err)
+		}
+		if task.OverdueAt == nil || !task.OverdueAt.Equal(at) || task.Version != 2 {
+			t.Errorf("after MarkOverdue() OverdueAt = %v, version %d, want %v and version 2", task.OverdueAt, task.Version, at)
+		}
+
+		// Moving the due date clears the mark
+		task.DueDate = due.Add(48 * time.Hour)
+		if err := store.UpdateTask(int(id), task); err != nil {
+			t.Fatalf("UpdateTask() error = %v", err)
+		}
+		if task, _ := store.GetTaskByID(int(id)); task.OverdueAt != nil {
+			t.Errorf("after moving the due date OverdueAt = %v, want nil", task.OverdueAt)
+		}
+
+		for _, tt := range []struct {
+			threshold string
+			dueDate   time.Time
+			want      bool
+		}{
+			{"24h", due, true},
+			{"24h", due, false},
+			{"overdue", due, true},
+			{"24h", due.Add(48 * time.Hour), true},
+		} {
+			claimed, err := store.ClaimReminder(int(id), tt.threshold, tt.dueDate)
+			if err != nil || claimed != tt.want {
+				t.Errorf("ClaimReminder(%s, %v) = %v, %v, want %v", tt.threshold, tt.dueDate, claimed, err, tt.want)
+			}
+		}
+	})
+}
+
+// TestWebhooks tests webhook subscriptions and their delivery queue
+func TestWebhooks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		all, err := store.CreateWebhook(models.Webhook{URL: "https://example.com/all", Events: []string{models.EventAll}, Secret: "s1"})
+		if err != nil {
+			t.Fatalf("CreateWebhook() error = %v", err)
+		}
+		done, err := store.CreateWebhook(models.Webhook{URL: "https://example.com/done", Events: []string{models.EventTaskCompleted}, Secret: "s2"})
+		if err != nil {
+			t.Fatalf("CreateWebhook() error = %v", err)
+		}
+		if webhook, err := store.GetWebhook(int(done)); err != nil || webhook.Secret != "s2" || len(webhook.Events) != 1 {
+			t.Errorf("GetWebhook() = %+v, %v, want the done webhook with its secret", webhook, err)
+		}
+		if _, err := store.GetWebhook(99); !errors.Is(err, ErrWebhookNotFound) {
+			t.Errorf("GetWebhook() of a missing webhook error = %v, want ErrWebhookNotFound", err)
+		}
+
+		if err := store.EnqueueEvent(models.EventTaskCreated, []byte(`{"n":1}`)); err != nil {
+			t.Fatalf("EnqueueEvent() error = %v", err)
+		}
+		if err := store.EnqueueEvent(models.EventTaskCompleted, []byte(`{"n":2}`)); err != nil {
+			t.Fatalf("EnqueueEvent() error = %v", err)
+		}
+
+		now := time.Now().Add(time.Second)
+		due, err := store.DueDeliveries(now, 10)
+		if err != nil || len(due) != 3 || string(due[0].Payload) != `{"n":1}` || due[0].WebhookID != int(all) {
+			t.Fatalf("DueDeliveries() = %+v, %v, want 3 deliveries, oldest first", due, err)
+		}
+		if limited, _ := store.DueDeliveries(now, 2); len(limited) != 2 {
+			t.Errorf("DueDeliveries() with limit 2 returned %d", len(limited))
+		}
+
+		// One fails and waits for a retry, one is delivered and one is dead
+		retry := now.Add(time.Minute)
+		due[0].Attempts, due[0].LastError, due[0].NextAttemptAt, due[0].ResponseStatus = 1, "timeout", &retry, 503
+		due[1].Attempts, due[1].Status, due[1].NextAttemptAt, due[1].DeliveredAt = 1, models.DeliveryDelivered, nil, &now
+		due[2].Attempts, due[2].Status, due[2].NextAttemptAt = 8, models.DeliveryDead, nil
+		for _, delivery := range due {
+			if err := store.UpdateDelivery(delivery); err != nil {
+				t.Fatalf("UpdateDelivery() error = %v", err)
+			}
+		}
+		if pending, _ := store.DueDeliveries(now, 10); len(pending) != 0 {
+			t.Errorf("DueDeliveries() after the attempts = %+v, want none", pending)
+		}
+		if pending, _ := store.DueDeliveries(retry, 10); len(pending) != 1 || pending[0].LastError != "timeout" || pending[0].ResponseStatus != 503 {
+			t.Errorf("DueDeliveries() at the retry = %+v, want the failed delivery", pending)
+		}
+
+		if dead, err := store.ListDeliveries(int(done), models.DeliveryDead); err != nil || len(dead) != 1 || dead[0].Attempts != 8 {
+			t.Errorf("ListDeliveries(dead) = %+v, %v, want the dead delivery", dead, err)
+		}
+		if list, _ := store.ListDeliveries(int(all), ""); len(list) != 2 || list[0].ID < list[1].ID {
+			t.Errorf("ListDeliveries() = %+v, want 2 deliveries, newest first", list)
+		}
+
+		if err := store.DeleteWebhook(int(all)); err != nil {
+			t.Fatalf("DeleteWebhook() error = %v", err)
+		}
+		if _, err := store.ListDeliveries(int(all), ""); !errors.Is(err, ErrWebhookNotFound) {
+			t.Errorf("ListDeliveries() of a deleted webhook error = %v, want ErrWebhookNotFound", err)
+		}
+		if pending, _ := store.DueDeliveries(retry, 10); len(pending) != 0 {
+			t.Errorf("DueDeliveries() after deleting the webhook = %+v, want none", pending)
+		}
+	})
+}
+
+// TestEventLog tests that the log keeps the latest events and detects gaps
+func TestEventLog(t *testing.T) {
+	log := NewEventLog(3)
+	if events, _, ok := log.Since(0); !ok || len(events) != 0 {
+		t.Errorf("Since(0) of an empty log = %v, %v, want nothing", events, ok)
+	}
+
+	_, changed, _ := log.Since(0)
+	for i := 1; i <= 5; i++ {
+		log.publish(taskEvent(models.EventTaskCreated, models.Task{ID: i}))
+	}
+	select {
+	case <-changed:
+	default:
+		t.Error("publish() did not close the changed channel")
+	}
+
+	tests := []struct {
+		lastID  int64
+		wantIDs []int64
+		wantOK  bool
+	}{
+		{5, nil, true},
+		{3, []int64{4, 5}, true},
+		{2, []int64{3, 4, 5}, true},
+		{1, []int64{3, 4, 5}, false}, // event 2 was dropped
+		{9, []int64{3, 4, 5}, false}, // from before a restart
+	}
+	for _, tt := range tests {
+		events, _, ok := log.Since(tt.lastID)
+		var ids []int64
+		for _, event := range events {
+			ids = append(ids, event.ID)
+		}
+		if ok != tt.wantOK || len(ids) != len(tt.wantIDs) || (len(ids) > 0 && ids[0] != tt.wantIDs[0]) {
+			t.Errorf("Since(%d) = %v, %v, want %v, %v", tt.lastID, ids, ok, tt.wantIDs, tt.wantOK)
+		}
+	}
+	if log.LastID() != 5 {
+		t.Errorf("LastID() = %d, want 5", log.LastID())
+	}
+}
+
+// TestTaskEvents tests that writes publish events once they commit
+func TestTaskEvents(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		// since returns the events published since the last call as "event id" strings
+		var lastID int64
+		since := func() []string {
+			t.Helper()
+			events, _, ok := store.Events().Since(lastID)
+			if !ok {
+				t.Fatalf("Since(%d) lost events", lastID)
+			}
+			var got []string
+			for _, event := range events {
+				got = append(got, event.Event+" "+strconv.Itoa(event.Task.ID))
+				lastID = event.ID
+			}
+			return got
+		}
+		expect := func(step string, want ...string) {
+			t.Helper()
+			if got := since(); strings.Join(got, ", ") != strings.Join(want, ", ") {
+				t.Errorf("%s published %v, want %v", step, got, want)
+			}
+		}
+
+		parent, _ := store.CreateTask(models.Task{Title: "Parent", Status: models.StatusPending})
+		child, _ := store.CreateTask(models.Task{Title: "Child", Status: models.StatusPending, ParentID: intPtr(int(parent))})
+		expect("CreateTask()", "task.created 1", "task.created 2")
+
+		task, _ := store.GetTaskByID(int(child))
+		task.Title = "Renamed"
+		if err := store.UpdateTask(task.ID, task); err != nil {
+			t.Fatalf("UpdateTask() error = %v", err)
+		}
+		expect("UpdateTask()", "task.updated 2")
+
+		store.DeleteTask(int(parent), 0)
+		store.RestoreTask(int(parent))
+		expect("DeleteTask() and RestoreTask()", "task.deleted 1", "task.updated 1")
+
+		if err := store.PurgeTask(int(parent), 0); err != nil {
+			t.Fatalf("PurgeTask() error = %v", err)
+		}
+		expect("PurgeTask()", "task.deleted 1", "task.updated 2")
+
+		// Completing a recurring task also creates its next occurrence
+		recurring, _ := store.CreateTask(models.Task{Title: "Daily", Status: models.StatusPending, DueDate: time.Now(), Recurrence: "FREQ=DAILY"})
+		task, _ = store.GetTaskByID(int(recurring))
+		task.Status = models.StatusCompleted
+		store.UpdateTask(task.ID, task)
+		expect("completing a recurring task", "task.created 3", "task.updated 3", "task.created 4")
+
+		// Transactions publish only if they commit
+		store.RunInTx(func(tx TaskStore) error {
+			tx.CreateTask(models.Task{Title: "Rolled back", Status: models.StatusPending})
+			return errors.New("roll back")
+		})
+		expect("a rolled back transaction")
+		store.RunInTx(func(tx TaskStore) error {
+			tx.CreateTask(models.Task{Title: "Kept", Status: models.StatusPending})
+			return tx.RunInTx(func(savepoint TaskStore) error {
+				savepoint.DeleteTask(int(child), 0)
+				return nil
+			})
+		})
+		if got := since(); len(got) != 2 || got[1] != "task.deleted 2" {
+			t.Errorf("a committed transaction published %v, want a create and task.deleted 2", got)
+		}
+
+		store.PurgeTrash(time.Now().Add(time.Hour))
+		expect("PurgeTrash()", "task.deleted 2")
+	})
+}
+
+// intPtr returns a pointer to i
+func intPtr(i int) *int {
+	return &i
+}
+
+// TestAudit tests that task writes are audited with their actor and changes
+func TestAudit(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		alice := store.WithActor(Actor{Name: "apikey:alice", RequestID: "req-1"})
+
+		parent, err := alice.CreateTask(models.Task{Title: "Parent", Status: models.StatusPending})
+		if err != nil {
+			t.Fatalf("CreateTask() error = %v", err)
+		}
+		child, _ := alice.CreateTask(models.Task{Title: "Child", Status: models.StatusPending, ParentID: intPtr(int(parent))})
+		task, _ := alice.GetTaskByID(int(child))
+		task.Title = "Renamed"
+		if err := alice.UpdateTask(task.ID, task); err != nil {
+			t.Fatalf("UpdateTask() error = %v", err)
+		}
+		alice.DeleteTask(int(parent), 0)
+		alice.RestoreTask(int(parent))
+		alice.RunInTx(func(tx TaskStore) error {
+			tx.CreateTask(models.Task{Title: "Rolled back", Status: models.StatusPending})
+			return errors.New("roll back")
+		})
+		store.MarkOverdue(int(child), time.Now())
+		if err := alice.PurgeTask(int(parent), 0); err != nil {
+			t.Fatalf("PurgeTask() error = %v", err)
+		}
+
+		page, err := store.ListAudit(AuditFilter{})
+		if err != nil {
+			t.Fatalf("ListAudit() error = %v", err)
+		}
+		var got []string
+		for _, entry := range page.Entries {
+			got = append(got, fmt.Sprintf("%s %d %s", entry.Action, entry.EntityID, entry.Actor))
+		}
+		want := []string{
+			"update 2 apikey:alice", // detached from its purged parent
+			"purge 1 apikey:alice",
+			"update 2 system",
+			"restore 1 apikey:alice",
+			"delete 1 apikey:alice",
+			"update 2 apikey:alice",
+			"create 2 apikey:alice",
+			"create 1 apikey:alice",
+		}
+		if strings.Join(got, ", ") != strings.Join(want, ", ") {
+			t.Fatalf("ListAudit() = %v, want %v", got, want)
+		}
+
+		// Entries hold the changed fields only
+		rename := page.Entries[5]
+		if rename.RequestID != "req-1" || string(rename.Changes["title"].Before) != `"Child"` || string(rename.Changes["title"].After) != `"Renamed"` {
+			t.Errorf("update entry = %+v, want the title change in request req-1", rename)
+		}
+		if _, ok := rename.Changes["description"]; ok {
+			t.Errorf("update entry records the unchanged description: %+v", rename.Changes)
+		}
+		if purge := page.Entries[1]; string(purge.Changes["title"].After) != "null" || purge.EntityID != 1 {
+			t.Errorf("purge entry = %+v, want the task's fields becoming null", purge)
+		}
+
+		// Filters
+		tests := []struct {
+			name   string
+			filter AuditFilter
+			want   int
+		}{
+			{"By Task", AuditFilter{Entity: models.AuditEntityTask, EntityID: 2}, 4},
+			{"Other Entity", AuditFilter{Entity: "user"}, 0},
+			{"Since", AuditFilter{Since: page.Entries[0].CreatedAt}, 1},
+			{"Until", AuditFilter{Until: page.Entries[7].CreatedAt.Add(time.Nanosecond)}, 1},
+			{"Future", AuditFilter{Since: time.Now().Add(time.Hour)}, 0},
+		}
+		for _, tt := range tests {
+			filtered, err := store.ListAudit(tt.filter)
+			if err != nil || len(filtered.Entries) != tt.want {
+				t.Errorf("%s: ListAudit() returned %d entries, error %v, want %d", tt.name, len(filtered.Entries), err, tt.want)
+			}
+		}
+
+		// Pages
+		var ids []int
+		filter := AuditFilter{Limit: 3}
+		for {
+			page, err := store.ListAudit(filter)
+			if err != nil {
+				t.Fatalf("ListAudit(%+v) error = %v", filter, err)
+			}
+			for _, entry := range page.Entries {
+				ids = append(ids, entry.ID)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			filter.Cursor = page.NextCursor
+		}
+		if len(ids) != 8 || ids[0] != 8 || ids[7] != 1 {
+			t.Errorf("paged through %v, want entries 8 down to 1", ids)
+		}
+		if _, err := store.ListAudit(AuditFilter{Cursor: "bogus"}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("ListAudit() with a bad cursor error = %v, want ErrInvalidCursor", err)
+		}
+	})
+}
+
+// TestAuditAppendOnly tests that the SQLite audit log can't be changed
+func TestAuditAppendOnly(t *testing.T) {
+	store, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer store.Close()
+
+	store.CreateTask(models.Task{Title: "Audited", Status: models.StatusPending})
+	if _, err := store.db.Exec("UPDATE audit_log SET actor = 'someone else'"); err == nil {
+		t.Error("updating the audit log succeeded")
+	}
+	if _, err := store.db.Exec("DELETE FROM audit_log"); err == nil {
+		t.Error("deleting from the audit log succeeded")
+	}
+}
+
+// TestComments tests comments and how they follow their task to the trash and back
+func TestComments(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		if _, err := store.CreateComment(models.Comment{TaskID: 9, Body: "Lost"}); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("CreateComment() on a missing task error = %v, want ErrTaskNotFound", err)
+		}
+
+		taskID, _ := store.CreateTask(models.Task{Title: "Discussed", Status: models.StatusPending})
+		otherID, _ := store.CreateTask(models.Task{Title: "Quiet", Status: models.StatusPending})
+		task := int(taskID)
+		first, err := store.CreateComment(models.Comment{TaskID: task, Body: "**First**", Author: "apikey:alice", AuthorID: intPtr(1)})
+		if err != nil {
+			t.Fatalf("CreateComment() error = %v", err)
+		}
+		store.CreateComment(models.Comment{TaskID: task, Body: "Second", Author: "apikey:bob"})
+
+		comment, err := store.GetComment(task, int(first))
+		if err != nil || comment.Body != "**First**" || comment.Author != "apikey:alice" || *comment.AuthorID != 1 || comment.EditedAt != nil {
+			t.Errorf("GetComment() = %+v, %v, want the unedited first comment", comment, err)
+		}
+		if _, err := store.GetComment(int(otherID), int(first)); !errors.Is(err, ErrCommentNotFound) {
+			t.Errorf("GetComment() through another task error = %v, want ErrCommentNotFound", err)
+		}
+
+		comment.Body = "First, edited"
+		if err := store.UpdateComment(comment); err != nil {
+			t.Fatalf("UpdateComment() error = %v", err)
+		}
+		comments, err := store.ListComments(task)
+		if err != nil || len(comments) != 2 || comments[0].Body != "First, edited" || comments[0].EditedAt == nil || comments[1].Body != "Second" {
+			t.Errorf("ListComments() = %+v, %v, want the edited first comment then the second", comments, err)
+		}
+		if comments, _ := store.ListComments(int(otherID)); len(comments) != 0 {
+			t.Errorf("ListComments() of a task without comments = %+v, want none", comments)
+		}
+
+		if err := store.DeleteComment(task, comments[1].ID); err != nil {
+			t.Fatalf("DeleteComment() error = %v", err)
+		}
+		if err := store.DeleteComment(task, comments[1].ID); !errors.Is(err, ErrCommentNotFound) {
+			t.Errorf("DeleteComment() twice error = %v, want ErrCommentNotFound", err)
+		}
+
+		// Comments are hidden in the trash and come back with their task
+		store.DeleteTask(task, 0)
+		if _, err := store.ListComments(task); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("ListComments() of a trashed task error = %v, want ErrTaskNotFound", err)
+		}
+		if _, err := store.CreateComment(models.Comment{TaskID: task, Body: "Too late"}); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("CreateComment() on a trashed task error = %v, want ErrTaskNotFound", err)
+		}
+		store.RestoreTask(task)
+		if comments, _ := store.ListComments(task); len(comments) != 1 {
+			t.Errorf("ListComments() after restoring = %+v, want the remaining comment", comments)
+		}
+
+		page, _ := store.ListAudit(AuditFilter{Entity: models.AuditEntityComment})
+		if len(page.Entries) != 4 || page.Entries[0].Action != models.AuditDelete || page.Entries[1].Action != models.AuditUpdate {
+			t.Errorf("comment audit entries = %+v, want two creates, an update and a delete", page.Entries)
+		}
+
+		// Purging the task removes them
+		store.PurgeTask(task, 0)
+		if sqlite, ok := store.(*SQLiteStore); ok {
+			var count int
+			sqlite.db.QueryRow("SELECT COUNT(*) FROM task_comments").Scan(&count)
+			if count != 0 {
+				t.Errorf("%d comments left after purging their task", count)
+			}
+		} else if memory := store.(*MemoryStore); len(memory.comments) != 0 {
+			t.Errorf("%d comments left after purging their task", len(memory.comments))
+		}
+	})
+}
+
+func TestAttachments(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		const hash = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+		if _, err := store.CreateAttachment(models.Attachment{TaskID: 9, SHA256: hash}); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("CreateAttachment() on a missing task error = %v, want ErrTaskNotFound", err)
+		}
+
+		taskID, _ := store.CreateTask(models.Task{Title: "Documented", Status: models.StatusPending})
+		otherID, _ := store.CreateTask(models.Task{Title: "Bare", Status: models.StatusPending})
+		task := int(taskID)
+		first, err := store.CreateAttachment(models.Attachment{
+			TaskID: task, Filename: "spec.txt", ContentType: "text/plain; charset=utf-8", Size: 4, SHA256: hash, UploadedBy: "apikey:alice",
+		})
+		if err != nil {
+			t.Fatalf("CreateAttachment() error = %v", err)
+		}
+		store.CreateAttachment(models.Attachment{TaskID: task, Filename: "copy.txt", ContentType: "text/plain; charset=utf-8", Size: 4, SHA256: hash, UploadedBy: "apikey:bob"})
+
+		attachment, err := store.GetAttachment(task, int(first))
+		if err != nil || attachment.Filename != "spec.txt" || attachment.Size != 4 || attachment.UploadedBy != "apikey:alice" || attachment.CreatedAt.IsZero() {
+			t.Errorf("GetAttachment() = %+v, %v, want the first attachment", attachment, err)
+		}
+		if _, err := store.GetAttachment(int(otherID), int(first)); !errors.Is(err, ErrAttachmentNotFound) {
+			t.Errorf("GetAttachment() through another task error = %v, want ErrAttachmentNotFound", err)
+		}
+		attachments, err := store.ListAttachments(task)
+		if err != nil || len(attachments) != 2 || attachments[0].Filename != "spec.txt" || attachments[1].Filename != "copy.txt" {
+			t.Errorf("ListAttachments() = %+v, %v, want both attachments, oldest first", attachments, err)
+		}
+
+		// The content stays in use until its last attachment goes
+		if err := store.DeleteAttachment(task, int(first)); err != nil {
+			t.Fatalf("DeleteAttachment() error = %v", err)
+		}
+		if err := store.DeleteAttachment(task, int(first)); !errors.Is(err, ErrAttachmentNotFound) {
+			t.Errorf("DeleteAttachment() twice error = %v, want ErrAttachmentNotFound", err)
+		}
+		if used, err := store.BlobInUse(hash); err != nil || !used {
+			t.Errorf("BlobInUse() with one attachment left = %v, %v, want true", used, err)
+		}
+
+		// Attachments are hidden in the trash, but their content is still in use
+		store.DeleteTask(task, 0)
+		if _, err := store.ListAttachments(task); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("ListAttachments() of a trashed task error = %v, want ErrTaskNotFound", err)
+		}
+		if used, _ := store.BlobInUse(hash); !used {
+			t.Error("BlobInUse() of a trashed task's attachment = false, want true")
+		}
+
+		page, _ := store.ListAudit(AuditFilter{Entity: models.AuditEntityAttachment})
+		if len(page.Entries) != 3 || page.Entries[0].Action != models.AuditDelete || page.Entries[0].EntityID != int(first) {
+			t.Errorf("attachment audit entries = %+v, want two creates and a delete", page.Entries)
+		}
+
+		// Purging the task removes them
+		store.PurgeTask(task, 0)
+		if used, err := store.BlobInUse(hash); err != nil || used {
+			t.Errorf("BlobInUse() after purging = %v, %v, want false", used, err)
+		}
+	})
+}
+
+func TestTimeEntries(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+		if _, err := store.CreateTimeEntry(models.TimeEntry{TaskID: 9, TrackedBy: "apikey:alice", StartedAt: start}); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("CreateTimeEntry() on a missing task error = %v, want ErrTaskNotFound", err)
+		}
+
+		taskID, _ := store.CreateTask(models.Task{Title: "Billable", Status: models.StatusPending, Estimate: intPtr(120)})
+		otherID, _ := store.CreateTask(models.Task{Title: "Other", Status: models.StatusCompleted})
+		task, other := int(taskID), int(otherID)
+		if got, _ := store.GetTaskByID(task); got.Estimate == nil || *got.Estimate != 120 {
+			t.Errorf("task estimate = %v, want 120", got.Estimate)
+		}
+
+		// Each caller has one timer at a time
+		timerID, err := store.CreateTimeEntry(models.TimeEntry{TaskID: task, TrackedBy: "apikey:alice", StartedAt: start})
+		if err != nil {
+			t.Fatalf("CreateTimeEntry() of a timer error = %v", err)
+		}
+		if _, err := store.CreateTimeEntry(models.TimeEntry{TaskID: other, TrackedBy: "apikey:alice", StartedAt: start}); !errors.Is(err, ErrTimerRunning) {
+			t.Errorf("second timer error = %v, want ErrTimerRunning", err)
+		}
+		if _, err := store.CreateTimeEntry(models.TimeEntry{TaskID: other, TrackedBy: "apikey:bob", StartedAt: start}); err != nil {
+			t.Errorf("another caller's timer error = %v", err)
+		}
+		if running, err := store.RunningTimer("apikey:alice"); err != nil || running.ID != int(timerID) || running.StoppedAt != nil {
+			t.Errorf("RunningTimer() = %+v, %v, want the running timer", running, err)
+		}
+		if _, err := store.StopTimer(other, "apikey:alice", start.Add(time.Hour)); !errors.Is(err, ErrTimerNotRunning) {
+			t.Errorf("StopTimer() on the wrong task error = %v, want ErrTimerNotRunning", err)
+		}
+		stopped, err := store.StopTimer(task, "apikey:alice", start.Add(90*time.Minute))
+		if err != nil || stopped.ID != int(timerID) || stopped.Minutes != 90 || stopped.StoppedAt == nil {
+			t.Errorf("StopTimer() = %+v, %v, want the entry stopped after 90 minutes", stopped, err)
+		}
+		if _, err := store.RunningTimer("apikey:alice"); !errors.Is(err, ErrTimerNotRunning) {
+			t.Errorf("RunningTimer() after stopping error = %v, want ErrTimerNotRunning", err)
+		}
+
+		// Manual entries can be added whatever is running
+		stoppedAt := start.Add(26*time.Hour + 30*time.Second)
+		manualID, err := store.CreateTimeEntry(models.TimeEntry{TaskID: task, TrackedBy: "apikey:bob", StartedAt: start.Add(24 * time.Hour), StoppedAt: &stoppedAt, Note: "Review"})
+		if err != nil {
+			t.Fatalf("CreateTimeEntry() of a manual entry error = %v", err)
+		}
+		if entry, err := store.GetTimeEntry(task, int(manualID)); err != nil || entry.Minutes != 121 || entry.Note != "Review" {
+			t.Errorf("GetTimeEntry() = %+v, %v, want the 121 minute manual entry", entry, err)
+		}
+		if _, err := store.GetTimeEntry(other, int(manualID)); !errors.Is(err, ErrTimeEntryNotFound) {
+			t.Errorf("GetTimeEntry() through another task error = %v, want ErrTimeEntryNotFound", err)
+		}
+		entries, err := store.ListTimeEntries(task)
+		if err != nil || len(entries) != 2 || entries[0].ID != int(timerID) || entries[1].ID != int(manualID) {
+			t.Errorf("ListTimeEntries() = %+v, %v, want both entries, earliest first", entries, err)
+		}
+
+		report, err := store.TimeReport(TimeReportFilter{})
+		if err != nil || report.TotalMinutes != 211 || len(report.Groups) != 1 ||
+			report.Groups[0].TaskID != task || report.Groups[0].Entries != 2 || *report.Groups[0].Estimate != 120 {
+			t.Errorf("TimeReport() by task = %+v, %v, want 211 minutes on the billable task", report, err)
+		}
+		report, _ = store.TimeReport(TimeReportFilter{GroupBy: GroupByDay, From: start.Add(time.Hour)})
+		if len(report.Groups) != 1 || report.Groups[0].Key != "2026-03-03" || report.Groups[0].Minutes != 121 {
+			t.Errorf("TimeReport() by day from 10:00 = %+v, want only the second day", report.Groups)
+		}
+		report, _ = store.TimeReport(TimeReportFilter{GroupBy: GroupByStatus, TrackedBy: "apikey:alice"})
+		if len(report.Groups) != 1 || report.Groups[0].Key != "pending" || report.Groups[0].Minutes != 90 {
+			t.Errorf("TimeReport() of alice by status = %+v, want 90 pending minutes", report.Groups)
+		}
+
+		if err := store.DeleteTimeEntry(task, int(manualID)); err != nil {
+			t.Fatalf("DeleteTimeEntry() error = %v", err)
+		}
+		if err := store.DeleteTimeEntry(task, int(manualID)); !errors.Is(err, ErrTimeEntryNotFound) {
+			t.Errorf("DeleteTimeEntry() twice error = %v, want ErrTimeEntryNotFound", err)
+		}
+
+		// Trashing a task stops its timers, and its time is still reported
+		store.DeleteTask(other, 0)
+		if _, err := store.RunningTimer("apikey:bob"); !errors.Is(err, ErrTimerNotRunning) {
+			t.Errorf("RunningTimer() after trashing its task error = %v, want ErrTimerNotRunning", err)
+		}
+		report, _ = store.TimeReport(TimeReportFilter{TrackedBy: "apikey:bob"})
+		if len(report.Groups) != 1 || report.Groups[0].TaskID != other {
+			t.Errorf("TimeReport() of bob = %+v, want the trashed task's time", report.Groups)
+		}
+
+		page, _ := store.ListAudit(AuditFilter{Entity: models.AuditEntityTimeEntry})
+		if len(page.Entries) != 6 || page.Entries[0].Action != models.AuditUpdate || page.Entries[0].Actor != SystemActor {
+			t.Errorf("time entry audit entries = %+v, want three creates, a delete and two stops", page.Entries)
+		}
+
+		// Purging the task removes them
+		store.PurgeTask(task, 0)
+		if report, _ := store.TimeReport(TimeReportFilter{TrackedBy: "apikey:alice"}); len(report.Groups) != 0 {
+			t.Errorf("TimeReport() after purging = %+v, want no groups", report.Groups)
+		}
+	})
+}
+
+func TestProjects(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		if _, err := store.CreateTask(models.Task{Title: "Lost", ProjectID: intPtr(9)}); !errors.Is(err, ErrProjectNotFound) {
+			t.Errorf("CreateTask() in a missing project error = %v, want ErrProjectNotFound", err)
+		}
+
+		projectID, err := store.CreateProject(models.Project{Name: "Launch", Columns: models.DefaultColumns()})
+		if err != nil {
+			t.Fatalf("CreateProject() error = %v", err)
+		}
+		project := int(projectID)
+		if got, err := store.GetProject(project); err != nil || got.Name != "Launch" || len(got.Columns) != 3 || got.Columns[1].Status != models.StatusInProgress {
+			t.Errorf("GetProject() = %+v, %v, want the project with the default columns", got, err)
+		}
+
+		// Tasks join the end of their column; tasks outside a project have no position
+		first, _ := store.CreateTask(models.Task{Title: "First", Status: models.StatusPending, ProjectID: &project})
+		second, _ := store.CreateTask(models.Task{Title: "Second", Status: models.StatusPending, ProjectID: &project})
+		started, _ := store.CreateTask(models.Task{Title: "Started", Status: models.StatusInProgress, ProjectID: &project})
+		loose, _ := store.CreateTask(models.Task{Title: "Loose", Status: models.StatusPending, Position: "a5"})
+		firstTask, _ := store.GetTaskByID(int(first))
+		secondTask, _ := store.GetTaskByID(int(second))
+		startedTask, _ := store.GetTaskByID(int(started))
+		if firstTask.Position != models.FirstPosition || secondTask.Position <= firstTask.Position || startedTask.Position != models.FirstPosition {
+			t.Errorf("positions = %q, %q, %q, want the second after the first and the started task first in its column",
+				firstTask.Position, secondTask.Position, startedTask.Position)
+		}
+		if looseTask, _ := store.GetTaskByID(int(loose)); looseTask.Position != "" || looseTask.ProjectID != nil {
+			t.Errorf("task outside a project = %+v, want no project or position", looseTask)
+		}
+
+		// Moving between two tasks changes only the moved one
+		between, _ := models.PositionBetween("", firstTask.Position)
+		secondTask.Position = between
+		if err := store.UpdateTask(secondTask.ID, secondTask); err != nil {
+			t.Fatalf("UpdateTask() error = %v", err)
+		}
+		tasks, err := store.ProjectTasks(project)
+		if err != nil || len(tasks) != 3 || tasks[0].ID != int(second) || tasks[1].ID != int(first) || tasks[2].ID != int(started) {
+			t.Errorf("ProjectTasks() = %+v, %v, want the second, first and started tasks", tasks, err)
+		}
+		if firstAgain, _ := store.GetTaskByID(int(first)); firstAgain.Version != firstTask.Version {
+			t.Errorf("first task's version = %d after moving another, want %d", firstAgain.Version, firstTask.Version)
+		}
+
+		// Changing column without a new position goes to the end of the new column
+		firstTask, _ = store.GetTaskByID(int(first))
+		firstTask.Status = models.StatusInProgress
+		store.UpdateTask(firstTask.ID, firstTask)
+		if moved, _ := store.GetTaskByID(int(first)); moved.Position <= startedTask.Position {
+			t.Errorf("position after changing column = %q, want after %q", moved.Position, startedTask.Position)
+		}
+		secondTask, _ = store.GetTaskByID(int(second))
+		secondTask.Position = "not a position"
+		if err := store.UpdateTask(secondTask.ID, secondTask); !errors.Is(err, models.ErrInvalidPosition) {
+			t.Errorf("UpdateTask() with an invalid position error = %v, want ErrInvalidPosition", err)
+		}
+
+		page, _ := store.ListTasks(TaskFilter{ProjectID: project})
+		if len(page.Tasks) != 3 {
+			t.Errorf("ListTasks() of the project = %d tasks, want 3", len(page.Tasks))
+		}
+
+		project2 := models.Project{ID: project, Name: "Launch v2", Columns: []models.BoardColumn{{Name: "Doing", Status: models.StatusInProgress}}}
+		if err := store.UpdateProject(project2); err != nil {
+			t.Fatalf("UpdateProject() error = %v", err)
+		}
+		if got, _ := store.GetProject(project); got.Name != "Launch v2" || len(got.Columns) != 1 {
+			t.Errorf("GetProject() after UpdateProject() = %+v", got)
+		}
+		if err := store.UpdateProject(models.Project{ID: 99, Name: "Missing"}); !errors.Is(err, ErrProjectNotFound) {
+			t.Errorf("UpdateProject() of a missing project error = %v, want ErrProjectNotFound", err)
+		}
+
+		// A project can only be deleted once its tasks are gone, from the trash too
+		if err := store.DeleteProject(project); !errors.Is(err, ErrProjectNotEmpty) {
+			t.Errorf("DeleteProject() with tasks error = %v, want ErrProjectNotEmpty", err)
+		}
+		for _, id := range []int64{first, second, started} {
+			store.DeleteTask(int(id), 0)
+		}
+		if tasks, _ := store.ProjectTasks(project); len(tasks) != 0 {
+			t.Errorf("ProjectTasks() with every task in the trash = %+v, want none", tasks)
+		}
+		if err := store.DeleteProject(project); !errors.Is(err, ErrProjectNotEmpty) {
+			t.Errorf("DeleteProject() with tasks in the trash error = %v, want ErrProjectNotEmpty", err)
+		}
+		for _, id := range []int64{first, second, started} {
+			store.PurgeTask(int(id), 0)
+		}
+		if err := store.DeleteProject(project); err != nil {
+			t.Fatalf("DeleteProject() error = %v", err)
+		}
+		if projects, _ := store.ListProjects(); len(projects) != 0 {
+			t.Errorf("ListProjects() after deleting = %+v, want none", projects)
+		}
+	})
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store TaskStore) {
+		now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+		key := models.IdempotencyKey{Caller: "apikey:alice", Key: "retry-1", RequestHash: "abc", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+
+		claimed, err := store.ClaimIdempotencyKey(key)
+		if err != nil || claimed.Completed() {
+			t.Fatalf("ClaimIdempotencyKey() = %+v, %v, want an in-progress key", claimed, err)
+		}
+		if existing, err := store.ClaimIdempotencyKey(key); !errors.Is(err, ErrIdempotencyKeyUsed) || existing.RequestHash != "abc" || existing.Completed() {
+			t.Errorf("ClaimIdempotencyKey() while in progress = %+v, %v, want the key and ErrIdempotencyKeyUsed", existing, err)
+		}
+
+		// Each caller has keys of their own
+		bob := key
+		bob.Caller = "apikey:bob"
+		if _, err := store.ClaimIdempotencyKey(bob); err != nil {
+			t.Errorf("ClaimIdempotencyKey() of another caller error = %v", err)
+		}
+
+		// A released key can be claimed again, a completed one can't be released
+		if err := store.ReleaseIdempotencyKey(bob.Caller, bob.Key); err != nil {
+			t.Fatalf("ReleaseIdempotencyKey() error = %v", err)
+		}
+		if _, err := store.ClaimIdempotencyKey(bob); err != nil {
+			t.Errorf("ClaimIdempotencyKey() after releasing error = %v", err)
+		}
+
+		claimed.StatusCode = 201
+		claimed.Header = map[string]string{"Content-Type": "application/json"}
+		claimed.Body = []byte(`{"id":1}`)
+		if err := store.CompleteIdempotencyKey(claimed); err != nil {
+			t.Fatalf("CompleteIdempotencyKey() error = %v", err)
+		}
+		store.ReleaseIdempotencyKey(key.Caller, key.Key)
+		retry := key
+		retry.CreatedAt = now.Add(30 * time.Minute)
+		stored, err := store.ClaimIdempotencyKey(retry)
+		if !errors.Is(err, ErrIdempotencyKeyUsed) {
+			t.Fatalf("ClaimIdempotencyKey() of a completed key error = %v, want ErrIdempotencyKeyUsed", err)
+		}
+		if stored.StatusCode != 201 || stored.Header["Content-Type"] != "application/json" || string(stored.Body) != `{"id":1}` || !stored.ExpiresAt.Equal(key.ExpiresAt) {
+			t.Errorf("ClaimIdempotencyKey() of a completed key = %+v, want the stored response", stored)
+		}
+
+		// Once expired, the key starts over
+		retry.CreatedAt = now.Add(time.Hour)
+		retry.ExpiresAt = retry.CreatedAt.Add(time.Hour)
+		retry.RequestHash = "def"
+		if claimed, err := store.ClaimIdempotencyKey(retry); err != nil || claimed.Completed() || claimed.RequestHash != "def" {
+			t.Errorf("ClaimIdempotencyKey() of an expired key = %+v, %v, want a new in-progress key", claimed, err)
+		}
+	})
 }
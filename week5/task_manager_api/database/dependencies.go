@@ -0,0 +1,85 @@
+package database
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrParentNotFound is returned when a task's parent doesn't exist or is in the trash
+var ErrParentNotFound = errors.New("parent task not found")
+
+// ErrDependencyNotFound is returned when removing a dependency that doesn't exist
+var ErrDependencyNotFound = errors.New("dependency not found")
+
+// Dependency records that the task BlockerID blocks the task BlockedID
+type Dependency struct {
+	BlockerID int
+	BlockedID int
+}
+
+// ErrCycle matches every *CycleError
+var ErrCycle = errors.New("cycle")
+
+// CycleError is returned when a parent or dependency would make a task its own
+// ancestor or blocker. Path lists the tasks around the cycle, starting and
+// ending with the task being changed.
+type CycleError struct {
+	Path []int
+}
+
+func (e *CycleError) Error() string {
+	ids := make([]string, len(e.Path))
+	for i, id := range e.Path {
+		ids[i] = strconv.Itoa(id)
+	}
+	return "cycle: " + strings.Join(ids, " -> ")
+}
+
+// Is makes errors.Is(err, ErrCycle) true for every CycleError
+func (e *CycleError) Is(target error) bool {
+	return target == ErrCycle
+}
+
+// checkCycle returns a *CycleError if linking from to to would close a loop,
+// that is if from can already be reached from to by following next
+func checkCycle(from, to int, next func(id int) ([]int, error)) error {
+	path, err := findPath(to, from, next)
+	if err != nil || path == nil {
+		return err
+	}
+	return &CycleError{Path: append([]int{from}, path...)}
+}
+
+// findPath returns the shortest path from start to target following next,
+// including both ends, or nil if target can't be reached
+func findPath(start, target int, next func(id int) ([]int, error)) ([]int, error) {
+	previous := map[int]int{start: start}
+	queue := []int{start}
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		if id == target {
+			path := []int{id}
+			for id != start {
+				id = previous[id]
+				path = append([]int{id}, path...)
+			}
+			return path, nil
+		}
+
+		neighbours, err := next(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, neighbour := range neighbours {
+			if _, seen := previous[neighbour]; !seen {
+				previous[neighbour] = id
+				queue = append(queue, neighbour)
+			}
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"sync"
+	"task_manager_api/models"
+	"time"
+)
+
+// DefaultEventLogSize is how many events a store's log keeps
+const DefaultEventLogSize = 1000
+
+// EventLog keeps the most recent task events a store has published, so that
+// readers can follow changes and resume after the last event they saw
+type EventLog struct {
+	mu      sync.Mutex
+	events  []models.TaskEvent // oldest first
+	size    int
+	nextID  int64
+	changed chan struct{} // closed and replaced whenever events are published
+}
+
+// NewEventLog returns an empty log keeping the last size events
+func NewEventLog(size int) *EventLog {
+	return &EventLog{size: size, nextID: 1, changed: make(chan struct{})}
+}
+
+// publish numbers events, appends them and wakes every reader
+func (l *EventLog) publish(events ...models.TaskEvent) {
+	if len(events) == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, event := range events {
+		event.ID = l.nextID
+		l.nextID++
+		l.events = append(l.events, event)
+	}
+	if len(l.events) > l.size {
+		l.events = append([]models.TaskEvent(nil), l.events[len(l.events)-l.size:]...)
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Since returns the events after the one with ID lastID, oldest first, and a
+// channel that is closed when more are published. ok is false if the log
+// can't tell what came after lastID, because the events have been dropped or
+// lastID is from before a restart; the events returned are then every one it has.
+func (l *EventLog) Since(lastID int64) (events []models.TaskEvent, changed <-chan struct{}, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	first := l.nextID - int64(len(l.events))
+	if lastID < first-1 || lastID >= l.nextID {
+		return append([]models.TaskEvent(nil), l.events...), l.changed, false
+	}
+	return append([]models.TaskEvent(nil), l.events[lastID-first+1:]...), l.changed, true
+}
+
+// LastID returns the ID of the latest event, or 0 if there has been none
+func (l *EventLog) LastID() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.nextID - 1
+}
+
+// EventFilter selects events by their task. Empty fields match every task.
+type EventFilter struct {
+	Statuses []models.Status // match any of these statuses
+	Tags     []string        // match these tags, as TagMode says
+	TagMode  string          // TagModeAll or TagModeAny; defaults to TagModeAll
+}
+
+// Matches reports whether event's task passes the filter
+func (f EventFilter) Matches(event models.TaskEvent) bool {
+	filter := TaskFilter{Statuses: f.Statuses, Tags: f.Tags, TagMode: f.TagMode, Trashed: event.Task.DeletedAt != nil}
+	return matchesFilter(event.Task, filter.withDefaults())
+}
+
+// eventSink receives the events of a store's writes
+type eventSink interface {
+	publish(events ...models.TaskEvent)
+}
+
+// txEvents holds the events of a transaction until it commits
+type txEvents struct {
+	parent eventSink
+	events []models.TaskEvent
+}
+
+func (t *txEvents) publish(events ...models.TaskEvent) {
+	t.events = append(t.events, events...)
+}
+
+// commit passes the transaction's events on to the enclosing sink
+func (t *txEvents) commit() {
+	t.parent.publish(t.events...)
+	t.events = nil
+}
+
+// taskEvent returns an event about task that happened now
+func taskEvent(event string, task models.Task) models.TaskEvent {
+	return models.TaskEvent{Event: event, OccurredAt: time.Now().UTC(), Task: task}
+}
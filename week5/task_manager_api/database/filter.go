@@ -0,0 +1,99 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"task_manager_api/models"
+	"time"
+)
+
+// Fields a task listing can be sorted by
+const (
+	SortCreatedAt = "created_at"
+	SortUpdatedAt = "updated_at"
+	SortDueDate   = "due_date"
+	SortTitle     = "title"
+	SortDeletedAt = "deleted_at"
+)
+
+// Sort orders
+const (
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+// Ways of matching a filter's tags
+const (
+	TagModeAll = "all" // tasks with every tag
+	TagModeAny = "any" // tasks with at least one of the tags
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+// or was issued for a different sort
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// TaskFilter selects, orders and pages the tasks returned by ListTasks.
+// The zero value lists every task, newest first.
+type TaskFilter struct {
+	Statuses  []models.Status // match any of these statuses; empty matches all
+	DueBefore time.Time       // only tasks due strictly before this time
+	DueAfter  time.Time       // only tasks due strictly after this time
+	Sort      string          // one of the Sort* constants; defaults to SortCreatedAt
+	Order     string          // OrderAsc or OrderDesc; defaults to OrderDesc
+	Limit     int             // maximum tasks per page; 0 means no limit
+	Cursor    string          // NextCursor from the previous page
+	Trashed   bool            // list tasks in the trash instead of active ones
+	Tags      []string        // only tasks with these tags, matched as TagMode says; empty matches all
+	TagMode   string          // TagModeAll or TagModeAny; defaults to TagModeAll
+	UserID    int             // only tasks created by or assigned to this user; 0 matches all
+	ProjectID int             // only tasks in this project; 0 matches all
+}
+
+// withDefaults fills in the default sort, order and tag mode, and normalizes the tags
+func (f TaskFilter) withDefaults() TaskFilter {
+	if f.Sort == "" {
+		f.Sort = SortCreatedAt
+	}
+	if f.Order == "" {
+		f.Order = OrderDesc
+	}
+	if f.TagMode == "" {
+		f.TagMode = TagModeAll
+	}
+	f.Tags = models.NormalizeTags(f.Tags)
+	return f
+}
+
+// cursor is the position of the last task on a page. It records the sort
+// it was issued for so it can't be replayed against a different ordering.
+type cursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Key   string `json:"k"`
+	ID    int    `json:"id"`
+}
+
+// encodeCursor turns a cursor into the opaque string handed to clients
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses the filter's cursor and checks it matches the filter's sort
+func decodeCursor(f TaskFilter) (cursor, error) {
+	var c cursor
+
+	data, err := base64.RawURLEncoding.DecodeString(f.Cursor)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	if c.Sort != f.Sort || c.Order != f.Order {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
@@ -0,0 +1,1989 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"task_manager_api/models"
+	"time"
+)
+
+// MemoryStore is a TaskStore that keeps tasks in a map.
+// It is safe for concurrent use and is mainly useful for tests.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	tasks         map[int]models.Task
+	nextID        int
+	history       map[int][]models.StatusChange
+	nextHistoryID int
+	blocks        map[int]map[int]bool // blocker ID -> IDs of the tasks it blocks
+	users         map[int]models.User
+	nextUserID    int
+	projects      map[int]models.Project
+	nextProjectID int
+	apiKeys       map[int]models.APIKey
+	nextAPIKeyID  int
+	reminders     map[reminderKey]bool // reminders claimed by ClaimReminder
+	webhooks      map[int]models.Webhook
+	nextWebhookID int
+	deliveries    map[int]models.WebhookDelivery
+	nextDelivery  int
+	comments      map[int]models.Comment
+	nextCommentID int
+	attachments   map[int]models.Attachment
+	nextAttachID  int
+	timeEntries   map[int]models.TimeEntry
+	nextEntryID   int
+	idempotency   map[idempotencyID]models.IdempotencyKey
+	audit         []models.AuditEntry // oldest first
+	nextAuditID   int
+	log           *EventLog
+	events        eventSink // log, or the events of the transaction a store passed to RunInTx's fn works in
+	actor         Actor     // recorded in the audit log as making the store's changes
+}
+
+// idempotencyID identifies an idempotency key: its caller and the header's value
+type idempotencyID struct {
+	caller string
+	key    string
+}
+
+// reminderKey identifies a reminder: a task, a threshold and the due date it is for
+type reminderKey struct {
+	taskID    int
+	threshold string
+	dueDate   int64 // Unix nanoseconds
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		tasks:         make(map[int]models.Task),
+		nextID:        1,
+		history:       make(map[int][]models.StatusChange),
+		nextHistoryID: 1,
+		blocks:        make(map[int]map[int]bool),
+		users:         make(map[int]models.User),
+		nextUserID:    1,
+		projects:      make(map[int]models.Project),
+		nextProjectID: 1,
+		apiKeys:       make(map[int]models.APIKey),
+		nextAPIKeyID:  1,
+		reminders:     make(map[reminderKey]bool),
+		webhooks:      make(map[int]models.Webhook),
+		nextWebhookID: 1,
+		deliveries:    make(map[int]models.WebhookDelivery),
+		nextDelivery:  1,
+		comments:      make(map[int]models.Comment),
+		nextCommentID: 1,
+		attachments:   make(map[int]models.Attachment),
+		nextAttachID:  1,
+		timeEntries:   make(map[int]models.TimeEntry),
+		nextEntryID:   1,
+		idempotency:   make(map[idempotencyID]models.IdempotencyKey),
+		nextAuditID:   1,
+	}
+	s.log = NewEventLog(DefaultEventLogSize)
+	s.events = s.log
+	return s
+}
+
+// CreateTask adds a new task to the store
+func (s *MemoryStore) CreateTask(task models.Task) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insertTask(task)
+}
+
+// insertTask adds a new task with its initial status. A recurring task without
+// a series starts one of its own. The caller must hold the lock.
+func (s *MemoryStore) insertTask(task models.Task) (int64, error) {
+	now := time.Now()
+	task.CreatedAt = now
+	task.UpdatedAt = now
+
+	if task.Status == "" {
+		task.Status = models.StatusPending
+	}
+	if task.Priority == "" {
+		task.Priority = models.PriorityMedium
+	}
+	recurrence, err := models.NormalizeRecurrence(task.Recurrence)
+	if err != nil {
+		return 0, err
+	}
+	task.Recurrence = recurrence
+
+	if err := s.checkParent(task.ParentID); err != nil {
+		return 0, err
+	}
+	if err := s.checkUser(task.AssigneeID); err != nil {
+		return 0, err
+	}
+	if err := s.checkProject(task.ProjectID); err != nil {
+		return 0, err
+	}
+	position, err := taskPosition(task, nil, func() (string, error) {
+		return s.lastPosition(*task.ProjectID, task.Status, 0), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	task.Position = position
+
+	task.ID = s.nextID
+	task.ParentID = copyID(task.ParentID)
+	task.CreatedBy = copyID(task.CreatedBy)
+	task.AssigneeID = copyID(task.AssigneeID)
+	task.SeriesID = copyID(task.SeriesID)
+	task.ProjectID = copyID(task.ProjectID)
+	task.Estimate = copyID(task.Estimate)
+	if task.Recurrence != "" && task.SeriesID == nil {
+		task.SeriesID = copyID(&task.ID)
+	}
+	task.Tags = models.NormalizeTags(task.Tags)
+	task.Version = 1
+	s.nextID++
+	s.tasks[task.ID] = task
+	s.recordStatusChange(task.ID, "", task.Status, now)
+	s.events.publish(taskEvent(models.EventTaskCreated, task))
+	s.recordAudit(models.AuditCreate, nil, &task)
+
+	return int64(task.ID), nil
+}
+
+// GetAllTasks returns all tasks, newest first
+func (s *MemoryStore) GetAllTasks() ([]models.Task, error) {
+	page, err := s.ListTasks(TaskFilter{})
+	return page.Tasks, err
+}
+
+// memorySortKey returns the value a task is ordered by for the given sort field.
+// Times use a fixed-width UTC layout so that string order matches time order.
+func memorySortKey(task models.Task, sortField string) string {
+	const layout = "2006-01-02T15:04:05.000000000Z"
+
+	switch sortField {
+	case SortUpdatedAt:
+		return task.UpdatedAt.UTC().Format(layout)
+	case SortDueDate:
+		if task.DueDate.IsZero() {
+			return "9999-12-31T23:59:59.999999999Z"
+		}
+		return task.DueDate.UTC().Format(layout)
+	case SortTitle:
+		return task.Title
+	case SortDeletedAt:
+		if task.DeletedAt == nil {
+			return "9999-12-31T23:59:59.999999999Z"
+		}
+		return task.DeletedAt.UTC().Format(layout)
+	default:
+		return task.CreatedAt.UTC().Format(layout)
+	}
+}
+
+// sameID reports whether a nullable ID refers to id
+func sameID(nullable *int, id int) bool {
+	return nullable != nil && *nullable == id
+}
+
+// matchesFilter reports whether task passes the filter's trash, status, due date, user and tag conditions
+func matchesFilter(task models.Task, filter TaskFilter) bool {
+	if (task.DeletedAt != nil) != filter.Trashed {
+		return false
+	}
+	if len(filter.Statuses) > 0 {
+		found := false
+		for _, status := range filter.Statuses {
+			if task.Status == status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !filter.DueBefore.IsZero() && (task.DueDate.IsZero() || !task.DueDate.Before(filter.DueBefore)) {
+		return false
+	}
+	if !filter.DueAfter.IsZero() && (task.DueDate.IsZero() || !task.DueDate.After(filter.DueAfter)) {
+		return false
+	}
+	if filter.UserID != 0 && !sameID(task.CreatedBy, filter.UserID) && !sameID(task.AssigneeID, filter.UserID) {
+		return false
+	}
+	if filter.ProjectID != 0 && !sameID(task.ProjectID, filter.ProjectID) {
+		return false
+	}
+	if len(filter.Tags) > 0 {
+		matched := 0
+		for _, tag := range filter.Tags {
+			for _, taskTag := range task.Tags {
+				if tag == taskTag {
+					matched++
+					break
+				}
+			}
+		}
+		if matched == 0 || (filter.TagMode == TagModeAll && matched < len(filter.Tags)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ListTasks returns one page of the tasks matching filter
+func (s *MemoryStore) ListTasks(filter TaskFilter) (models.TaskPage, error) {
+	filter = filter.withDefaults()
+	page := models.TaskPage{Tasks: []models.Task{}}
+
+	if _, ok := sortExpressions[filter.Sort]; !ok {
+		return page, fmt.Errorf("unknown sort field %q", filter.Sort)
+	}
+
+	var after *cursor
+	if filter.Cursor != "" {
+		c, err := decodeCursor(filter)
+		if err != nil {
+			return page, err
+		}
+		after = &c
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// less reports whether (keyA, idA) comes before (keyB, idB) in the requested order
+	less := func(keyA string, idA int, keyB string, idB int) bool {
+		if keyA == keyB {
+			if filter.Order == OrderDesc {
+				return idA > idB
+			}
+			return idA < idB
+		}
+		if filter.Order == OrderDesc {
+			return keyA > keyB
+		}
+		return keyA < keyB
+	}
+
+	var matched []models.Task
+	for _, task := range s.tasks {
+		if matchesFilter(task, filter) {
+			matched = append(matched, task)
+		}
+	}
+	page.Total = len(matched)
+
+	sort.Slice(matched, func(i, j int) bool {
+		return less(memorySortKey(matched[i], filter.Sort), matched[i].ID,
+			memorySortKey(matched[j], filter.Sort), matched[j].ID)
+	})
+
+	for _, task := range matched {
+		key := memorySortKey(task, filter.Sort)
+
+		// Skip everything up to and including the cursor position
+		if after != nil && !less(after.Key, after.ID, key, task.ID) {
+			continue
+		}
+
+		if filter.Limit > 0 && len(page.Tasks) == filter.Limit {
+			last := page.Tasks[len(page.Tasks)-1]
+			page.NextCursor = encodeCursor(cursor{
+				Sort:  filter.Sort,
+				Order: filter.Order,
+				Key:   memorySortKey(last, filter.Sort),
+				ID:    last.ID,
+			})
+			break
+		}
+		page.Tasks = append(page.Tasks, task)
+	}
+
+	return page, nil
+}
+
+// SearchTasks ranks tasks matching query by how often each term appears,
+// counting title matches ten times as much as description matches
+func (s *MemoryStore) SearchTasks(query string, limit int, cursor string) (models.SearchPage, error) {
+	page := models.SearchPage{Tasks: []models.SearchResult{}}
+
+	terms, err := parseSearchQuery(query)
+	if err != nil {
+		return page, err
+	}
+	offset, err := decodeSearchCursor(cursor, query)
+	if err != nil {
+		return page, err
+	}
+
+	s.mu.RLock()
+	var results []models.SearchResult
+	for _, task := range s.tasks {
+		if task.DeletedAt != nil {
+			continue
+		}
+		titleWords := tokenize(task.Title)
+		descriptionWords := tokenize(task.Description)
+
+		// Every term has to match somewhere in the task
+		score := 0.0
+		for _, term := range terms {
+			hits := 10*len(matchTerm(titleWords, term)) + len(matchTerm(descriptionWords, term))
+			if hits == 0 {
+				score = 0
+				break
+			}
+			score += float64(hits)
+		}
+		if score == 0 {
+			continue
+		}
+
+		results = append(results, models.SearchResult{
+			Task:  task,
+			Score: score,
+			Highlights: models.SearchHighlights{
+				Title:       highlight(task.Title, terms, 0),
+				Description: highlight(task.Description, terms, snippetWords),
+			},
+		})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score == results[j].Score {
+			return results[i].ID < results[j].ID
+		}
+		return results[i].Score > results[j].Score
+	})
+	page.Total = len(results)
+
+	if offset < len(results) {
+		results = results[offset:]
+		if limit > 0 && len(results) > limit {
+			results = results[:limit]
+			page.NextCursor = encodeSearchCursor(searchCursor{Query: query, Offset: offset + limit})
+		}
+		page.Tasks = results
+	}
+
+	return page, nil
+}
+
+// GetTaskByID retrieves a single task by ID
+func (s *MemoryStore) GetTaskByID(id int) (models.Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	task, ok := s.tasks[id]
+	if !ok || task.DeletedAt != nil {
+		return models.Task{}, ErrTaskNotFound
+	}
+	return task, nil
+}
+
+// GetTrashedTask returns a task from the trash
+func (s *MemoryStore) GetTrashedTask(id int) (models.Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	task, ok := s.tasks[id]
+	if !ok || task.DeletedAt == nil {
+		return models.Task{}, ErrTaskNotFound
+	}
+	return task, nil
+}
+
+// UpdateTask replaces the client-controlled fields of an existing task
+func (s *MemoryStore) UpdateTask(id int, task models.Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existingTask, ok := s.tasks[id]
+	if !ok || existingTask.DeletedAt != nil {
+		return ErrTaskNotFound
+	}
+	if task.Version != 0 && task.Version != existingTask.Version {
+		return ErrVersionConflict
+	}
+	before := existingTask
+	previousStatus := existingTask.Status
+
+	// A task can't become a subtask of itself or of one of its own subtasks
+	if err := s.checkParent(task.ParentID); err != nil {
+		return err
+	}
+	if task.ParentID != nil {
+		if err := checkCycle(id, *task.ParentID, s.parentsOf); err != nil {
+			return err
+		}
+	}
+	if err := s.checkUser(task.AssigneeID); err != nil {
+		return err
+	}
+	if err := s.checkProject(task.ProjectID); err != nil {
+		return err
+	}
+	position, err := taskPosition(task, &existingTask, func() (string, error) {
+		return s.lastPosition(*task.ProjectID, task.Status, id), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// A new due date isn't overdue until the scheduler finds it so
+	if !task.DueDate.Equal(existingTask.DueDate) {
+		existingTask.OverdueAt = nil
+	}
+
+	// Replace every field the client controls; a zero due date clears it
+	existingTask.Title = task.Title
+	existingTask.Description = task.Description
+	existingTask.Status = task.Status
+	existingTask.DueDate = task.DueDate
+	existingTask.ParentID = copyID(task.ParentID)
+	existingTask.Tags = models.NormalizeTags(task.Tags)
+	existingTask.AssigneeID = copyID(task.AssigneeID)
+	existingTask.ProjectID = copyID(task.ProjectID)
+	existingTask.Position = position
+	existingTask.Estimate = copyID(task.Estimate)
+	existingTask.Priority = task.Priority
+	if existingTask.Priority == "" {
+		existingTask.Priority = models.PriorityMedium
+	}
+	recurrence, err := models.NormalizeRecurrence(task.Recurrence)
+	if err != nil {
+		return err
+	}
+	existingTask.Recurrence = recurrence
+	if existingTask.Recurrence != "" && existingTask.SeriesID == nil {
+		existingTask.SeriesID = copyID(&existingTask.ID)
+	}
+
+	existingTask.UpdatedAt = time.Now()
+	existingTask.Version++
+	s.tasks[id] = existingTask
+	s.events.publish(taskEvent(models.EventTaskUpdated, existingTask))
+	s.recordAudit(models.AuditUpdate, &before, &existingTask)
+
+	if existingTask.Status != previousStatus {
+		s.recordStatusChange(id, previousStatus, existingTask.Status, existingTask.UpdatedAt)
+	}
+	if existingTask.Status == models.StatusCompleted && previousStatus != models.StatusCompleted {
+		return s.scheduleNextOccurrence(existingTask, existingTask.UpdatedAt)
+	}
+
+	return nil
+}
+
+// DeleteTask removes a task from the store
+func (s *MemoryStore) DeleteTask(id int, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[id]
+	if !ok || task.DeletedAt != nil {
+		return nil
+	}
+	if version != 0 && task.Version != version {
+		return ErrVersionConflict
+	}
+
+	before := task
+	now := time.Now()
+	task.DeletedAt = &now
+	task.Version++
+	s.tasks[id] = task
+	s.events.publish(taskEvent(models.EventTaskDeleted, task))
+	s.recordAudit(models.AuditDelete, &before, &task)
+	for _, entry := range s.timeEntries {
+		if entry.TaskID == id && entry.StoppedAt == nil {
+			s.stopTimer(entry, now)
+		}
+	}
+	return nil
+}
+
+// PurgeTask permanently removes a task and its history, whether or not it is in the trash
+func (s *MemoryStore) PurgeTask(id int, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if task, ok := s.tasks[id]; ok && version != 0 && task.Version != version {
+		return ErrVersionConflict
+	}
+
+	s.purge(id)
+	return nil
+}
+
+// RestoreTask moves a task out of the trash
+func (s *MemoryStore) RestoreTask(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[id]
+	if !ok || task.DeletedAt == nil {
+		return ErrTaskNotFound
+	}
+
+	before := task
+	task.DeletedAt = nil
+	task.Version++
+	s.tasks[id] = task
+	s.events.publish(taskEvent(models.EventTaskUpdated, task))
+	s.recordAudit(models.AuditRestore, &before, &task)
+	return nil
+}
+
+// PurgeTrash permanently removes the tasks moved to the trash before cutoff
+func (s *MemoryStore) PurgeTrash(cutoff time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for id, task := range s.tasks {
+		if task.DeletedAt != nil && task.DeletedAt.Before(cutoff) {
+			s.purge(id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// purge removes a task with its history and dependencies, and turns its
+// subtasks into top-level tasks. The caller must hold the write lock.
+func (s *MemoryStore) purge(id int) {
+	task, ok := s.tasks[id]
+	if !ok {
+		return
+	}
+	s.events.publish(taskEvent(models.EventTaskDeleted, task))
+	s.recordAudit(models.AuditPurge, &task, nil)
+	delete(s.tasks, id)
+	delete(s.history, id)
+	for commentID, comment := range s.comments {
+		if comment.TaskID == id {
+			delete(s.comments, commentID)
+		}
+	}
+	for attachmentID, attachment := range s.attachments {
+		if attachment.TaskID == id {
+			delete(s.attachments, attachmentID)
+		}
+	}
+	for entryID, entry := range s.timeEntries {
+		if entry.TaskID == id {
+			delete(s.timeEntries, entryID)
+		}
+	}
+	for key := range s.reminders {
+		if key.taskID == id {
+			delete(s.reminders, key)
+		}
+	}
+
+	delete(s.blocks, id)
+	for _, blocked := range s.blocks {
+		delete(blocked, id)
+	}
+	for subtaskID, task := range s.tasks {
+		if task.ParentID != nil && *task.ParentID == id {
+			before := task
+			task.ParentID = nil
+			task.Version++
+			s.tasks[subtaskID] = task
+			s.events.publish(taskEvent(models.EventTaskUpdated, task))
+			s.recordAudit(models.AuditUpdate, &before, &task)
+		}
+	}
+}
+
+// recordStatusChange appends an entry to a task's status history.
+// The caller must hold the write lock.
+func (s *MemoryStore) recordStatusChange(taskID int, from, to models.Status, at time.Time) {
+	s.history[taskID] = append(s.history[taskID], models.StatusChange{
+		ID:     s.nextHistoryID,
+		TaskID: taskID,
+		From:   from,
+		To:     to,
+		At:     at,
+	})
+	s.nextHistoryID++
+}
+
+// GetStatusHistory returns every status change of a task, oldest first
+func (s *MemoryStore) GetStatusHistory(id int) ([]models.StatusChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if task, ok := s.tasks[id]; !ok || task.DeletedAt != nil {
+		return nil, ErrTaskNotFound
+	}
+
+	history := make([]models.StatusChange, len(s.history[id]))
+	copy(history, s.history[id])
+	return history, nil
+}
+
+// checkParent returns ErrParentNotFound unless parentID is nil or a task outside the trash.
+// The caller must hold the lock.
+func (s *MemoryStore) checkParent(parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	if parent, ok := s.tasks[*parentID]; !ok || parent.DeletedAt != nil {
+		return ErrParentNotFound
+	}
+	return nil
+}
+
+// parentsOf is a findPath step from a task to its parent. The caller must hold the lock.
+func (s *MemoryStore) parentsOf(id int) ([]int, error) {
+	if task, ok := s.tasks[id]; ok && task.ParentID != nil {
+		return []int{*task.ParentID}, nil
+	}
+	return nil, nil
+}
+
+// blockedBy is a findPath step from a task to the tasks it blocks. The caller must hold the lock.
+func (s *MemoryStore) blockedBy(id int) ([]int, error) {
+	var blocked []int
+	for blockedID := range s.blocks[id] {
+		blocked = append(blocked, blockedID)
+	}
+	sort.Ints(blocked)
+	return blocked, nil
+}
+
+// copyID returns a pointer to a copy of *id, so stored tasks don't share it with callers
+func copyID(id *int) *int {
+	if id == nil {
+		return nil
+	}
+	c := *id
+	return &c
+}
+
+// scheduleNextOccurrence creates the occurrence that follows a recurring task
+// completed at completedAt, unless the series already continues past it.
+// The caller must hold the lock.
+func (s *MemoryStore) scheduleNextOccurrence(task models.Task, completedAt time.Time) error {
+	if task.Recurrence == "" || task.SeriesID == nil {
+		return nil
+	}
+	for _, other := range s.tasks {
+		if sameID(other.SeriesID, *task.SeriesID) && other.ID > task.ID {
+			return nil
+		}
+	}
+
+	next, ok := models.NextOccurrence(task, completedAt)
+	if !ok {
+		return nil
+	}
+	// A parent that has gone to the trash isn't carried over
+	if s.checkParent(next.ParentID) != nil {
+		next.ParentID = nil
+	}
+
+	_, err := s.insertTask(next)
+	return err
+}
+
+// MarkOverdue records that an open task outside the trash was found past its due date at
+func (s *MemoryStore) MarkOverdue(id int, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[id]
+	if !ok || task.OverdueAt != nil || task.DeletedAt != nil || task.Status == models.StatusCompleted {
+		return nil
+	}
+	before := task
+	task.OverdueAt = &at
+	task.Version++
+	s.tasks[id] = task
+	s.events.publish(taskEvent(models.EventTaskUpdated, task))
+	s.recordAudit(models.AuditUpdate, &before, &task)
+	return nil
+}
+
+// Events returns the log of the changes made to tasks
+func (s *MemoryStore) Events() *EventLog {
+	return s.log
+}
+
+// recordAudit appends the entry for a change to a task by the store's actor.
+// The caller must hold the write lock.
+func (s *MemoryStore) recordAudit(action string, before, after *models.Task) {
+	// Tasks always encode as JSON, so there is no error to handle
+	entry, _ := taskAuditEntry(s.actor, action, before, after)
+	s.appendAudit(entry)
+}
+
+// recordCommentAudit appends the entry for a change to a comment by the store's actor.
+// The caller must hold the write lock.
+func (s *MemoryStore) recordCommentAudit(action string, before, after *models.Comment) {
+	// Comments always encode as JSON, so there is no error to handle
+	entry, _ := commentAuditEntry(s.actor, action, before, after)
+	s.appendAudit(entry)
+}
+
+// recordAttachmentAudit appends the entry for a change to an attachment by the store's actor.
+// The caller must hold the write lock.
+func (s *MemoryStore) recordAttachmentAudit(action string, before, after *models.Attachment) {
+	// Attachments always encode as JSON, so there is no error to handle
+	entry, _ := attachmentAuditEntry(s.actor, action, before, after)
+	s.appendAudit(entry)
+}
+
+// recordTimeEntryAudit appends the entry for a change to a time entry by the store's actor.
+// The caller must hold the write lock.
+func (s *MemoryStore) recordTimeEntryAudit(action string, before, after *models.TimeEntry) {
+	// Time entries always encode as JSON, so there is no error to handle
+	entry, _ := timeEntryAuditEntry(s.actor, action, before, after)
+	s.appendAudit(entry)
+}
+
+// appendAudit numbers entry and appends it to the audit log.
+// The caller must hold the write lock.
+func (s *MemoryStore) appendAudit(entry models.AuditEntry) {
+	entry.ID = s.nextAuditID
+	s.nextAuditID++
+	s.audit = append(s.audit, entry)
+}
+
+// ListAudit returns one page of the audit log entries matching filter, newest first
+func (s *MemoryStore) ListAudit(filter AuditFilter) (models.AuditPage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	page := models.AuditPage{Entries: []models.AuditEntry{}}
+	afterID, err := decodeAuditCursor(filter.Cursor)
+	if err != nil {
+		return page, err
+	}
+
+	for i := len(s.audit) - 1; i >= 0; i-- {
+		entry := s.audit[i]
+		switch {
+		case afterID != 0 && entry.ID >= afterID,
+			filter.Entity != "" && entry.Entity != filter.Entity,
+			filter.EntityID != 0 && entry.EntityID != filter.EntityID,
+			!filter.Since.IsZero() && entry.CreatedAt.Before(filter.Since),
+			!filter.Until.IsZero() && !entry.CreatedAt.Before(filter.Until):
+			continue
+		}
+		if filter.Limit > 0 && len(page.Entries) == filter.Limit {
+			page.NextCursor = encodeAuditCursor(page.Entries[filter.Limit-1].ID)
+			break
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+	return page, nil
+}
+
+// WithActor returns a store on the same data whose changes to tasks are
+// recorded in the audit log as made by actor
+func (s *MemoryStore) WithActor(actor Actor) TaskStore {
+	return &actorMemoryStore{MemoryStore: s, actor: actor}
+}
+
+// actorMemoryStore is a MemoryStore whose changes to tasks are audited as made
+// by actor. Each change runs in a transaction on a copy of the store, as
+// RunInTx's do, whose actor is set for its duration.
+type actorMemoryStore struct {
+	*MemoryStore
+	actor Actor
+}
+
+// RunInTx calls fn with a copy of the store acting as actor
+func (s *actorMemoryStore) RunInTx(fn func(store TaskStore) error) error {
+	return s.MemoryStore.RunInTx(func(store TaskStore) error {
+		store.(*MemoryStore).actor = s.actor
+		return fn(store)
+	})
+}
+
+// CreateTask adds a new task as actor
+func (s *actorMemoryStore) CreateTask(task models.Task) (id int64, err error) {
+	err = s.RunInTx(func(store TaskStore) error {
+		id, err = store.CreateTask(task)
+		return err
+	})
+	return id, err
+}
+
+// UpdateTask replaces the client-controlled fields of an existing task as actor
+func (s *actorMemoryStore) UpdateTask(id int, task models.Task) error {
+	return s.RunInTx(func(store TaskStore) error {
+		return store.UpdateTask(id, task)
+	})
+}
+
+// DeleteTask moves a task to the trash as actor
+func (s *actorMemoryStore) DeleteTask(id int, version int) error {
+	return s.RunInTx(func(store TaskStore) error {
+		return store.DeleteTask(id, version)
+	})
+}
+
+// PurgeTask permanently removes a task as actor
+func (s *actorMemoryStore) PurgeTask(id int, version int) error {
+	return s.RunInTx(func(store TaskStore) error {
+		return store.PurgeTask(id, version)
+	})
+}
+
+// RestoreTask moves a task out of the trash as actor
+func (s *actorMemoryStore) RestoreTask(id int) error {
+	return s.RunInTx(func(store TaskStore) error {
+		return store.RestoreTask(id)
+	})
+}
+
+// PurgeTrash permanently removes the tasks moved to the trash before cutoff as actor
+func (s *actorMemoryStore) PurgeTrash(cutoff time.Time) (purged int64, err error) {
+	err = s.RunInTx(func(store TaskStore) error {
+		purged, err = store.PurgeTrash(cutoff)
+		return err
+	})
+	return purged, err
+}
+
+// CreateComment adds a comment to a task as actor
+func (s *actorMemoryStore) CreateComment(comment models.Comment) (id int64, err error) {
+	err = s.RunInTx(func(store TaskStore) error {
+		id, err = store.CreateComment(comment)
+		return err
+	})
+	return id, err
+}
+
+// UpdateComment replaces the body of a comment as actor
+func (s *actorMemoryStore) UpdateComment(comment models.Comment) error {
+	return s.RunInTx(func(store TaskStore) error {
+		return store.UpdateComment(comment)
+	})
+}
+
+// DeleteComment removes a comment as actor
+func (s *actorMemoryStore) DeleteComment(taskID, id int) error {
+	return s.RunInTx(func(store TaskStore) error {
+		return store.DeleteComment(taskID, id)
+	})
+}
+
+// CreateAttachment records a file attached to a task as actor
+func (s *actorMemoryStore) CreateAttachment(attachment models.Attachment) (id int64, err error) {
+	err = s.RunInTx(func(store TaskStore) error {
+		id, err = store.CreateAttachment(attachment)
+		return err
+	})
+	return id, err
+}
+
+// DeleteAttachment removes an attachment as actor
+func (s *actorMemoryStore) DeleteAttachment(taskID, id int) error {
+	return s.RunInTx(func(store TaskStore) error {
+		return store.DeleteAttachment(taskID, id)
+	})
+}
+
+// CreateTimeEntry records time spent on a task, or starts a timer, as actor
+func (s *actorMemoryStore) CreateTimeEntry(entry models.TimeEntry) (id int64, err error) {
+	err = s.RunInTx(func(store TaskStore) error {
+		id, err = store.CreateTimeEntry(entry)
+		return err
+	})
+	return id, err
+}
+
+// StopTimer stops a running timer as actor
+func (s *actorMemoryStore) StopTimer(taskID int, trackedBy string, stoppedAt time.Time) (entry models.TimeEntry, err error) {
+	err = s.RunInTx(func(store TaskStore) error {
+		entry, err = store.StopTimer(taskID, trackedBy, stoppedAt)
+		return err
+	})
+	return entry, err
+}
+
+// DeleteTimeEntry removes a time entry as actor
+func (s *actorMemoryStore) DeleteTimeEntry(taskID, id int) error {
+	return s.RunInTx(func(store TaskStore) error {
+		return store.DeleteTimeEntry(taskID, id)
+	})
+}
+
+// MarkOverdue marks a task overdue as actor
+func (s *actorMemoryStore) MarkOverdue(id int, at time.Time) error {
+	return s.RunInTx(func(store TaskStore) error {
+		return store.MarkOverdue(id, at)
+	})
+}
+
+// ClaimReminder records that the reminder for a task, threshold and due date is
+// being sent, and reports whether it hadn't been already
+func (s *MemoryStore) ClaimReminder(taskID int, threshold string, dueDate time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := reminderKey{taskID: taskID, threshold: threshold, dueDate: dueDate.UnixNano()}
+	if s.reminders[key] {
+		return false, nil
+	}
+	s.reminders[key] = true
+	return true, nil
+}
+
+// GetSeries returns the occurrences of a task's recurring series that aren't in the trash, oldest first
+func (s *MemoryStore) GetSeries(id int) ([]models.Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	task, ok := s.tasks[id]
+	if !ok || task.DeletedAt != nil {
+		return nil, ErrTaskNotFound
+	}
+	if task.SeriesID == nil {
+		return nil, ErrNoSeries
+	}
+
+	series := []models.Task{}
+	for _, other := range s.tasks {
+		if sameID(other.SeriesID, *task.SeriesID) && other.DeletedAt == nil {
+			series = append(series, other)
+		}
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].ID < series[j].ID })
+	return series, nil
+}
+
+// GetSubtasks returns the subtasks of a task that aren't in the trash, oldest first
+func (s *MemoryStore) GetSubtasks(id int) ([]models.Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if task, ok := s.tasks[id]; !ok || task.DeletedAt != nil {
+		return nil, ErrTaskNotFound
+	}
+
+	subtasks := []models.Task{}
+	for _, task := range s.tasks {
+		if task.ParentID != nil && *task.ParentID == id && task.DeletedAt == nil {
+			subtasks = append(subtasks, task)
+		}
+	}
+	sort.Slice(subtasks, func(i, j int) bool { return subtasks[i].ID < subtasks[j].ID })
+	return subtasks, nil
+}
+
+// GetBlockers returns the tasks blocking a task that aren't in the trash, oldest first
+func (s *MemoryStore) GetBlockers(id int) ([]models.Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if task, ok := s.tasks[id]; !ok || task.DeletedAt != nil {
+		return nil, ErrTaskNotFound
+	}
+
+	blockers := []models.Task{}
+	for blockerID, blocked := range s.blocks {
+		if task := s.tasks[blockerID]; blocked[id] && task.DeletedAt == nil {
+			blockers = append(blockers, task)
+		}
+	}
+	sort.Slice(blockers, func(i, j int) bool { return blockers[i].ID < blockers[j].ID })
+	return blockers, nil
+}
+
+// AddDependency records that blockerID blocks blockedID
+func (s *MemoryStore) AddDependency(blockerID, blockedID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range []int{blockerID, blockedID} {
+		if task, ok := s.tasks[id]; !ok || task.DeletedAt != nil {
+			return ErrTaskNotFound
+		}
+	}
+	if err := checkCycle(blockerID, blockedID, s.blockedBy); err != nil {
+		return err
+	}
+
+	if s.blocks[blockerID] == nil {
+		s.blocks[blockerID] = make(map[int]bool)
+	}
+	s.blocks[blockerID][blockedID] = true
+	return nil
+}
+
+// RemoveDependency removes the dependency of blockedID on blockerID
+func (s *MemoryStore) RemoveDependency(blockerID, blockedID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.blocks[blockerID][blockedID] {
+		return ErrDependencyNotFound
+	}
+	delete(s.blocks[blockerID], blockedID)
+	return nil
+}
+
+// OpenDependencies returns the dependencies between open tasks outside the trash
+func (s *MemoryStore) OpenDependencies() ([]Dependency, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	open := func(id int) bool {
+		task := s.tasks[id]
+		return task.DeletedAt == nil && task.Status != models.StatusCompleted
+	}
+	dependencies := []Dependency{}
+	for blockerID, blocked := range s.blocks {
+		for blockedID := range blocked {
+			if open(blockerID) && open(blockedID) {
+				dependencies = append(dependencies, Dependency{BlockerID: blockerID, BlockedID: blockedID})
+			}
+		}
+	}
+	sort.Slice(dependencies, func(i, j int) bool {
+		a, b := dependencies[i], dependencies[j]
+		if a.BlockerID != b.BlockerID {
+			return a.BlockerID < b.BlockerID
+		}
+		return a.BlockedID < b.BlockedID
+	})
+	return dependencies, nil
+}
+
+// ListTags returns every tag used by a task outside the trash, most used first
+func (s *MemoryStore) ListTags() ([]models.TagCount, error) {
+	s.mu.RLock()
+	counts := make(map[string]int)
+	for _, task := range s.tasks {
+		if task.DeletedAt != nil {
+			continue
+		}
+		for _, tag := range task.Tags {
+			counts[tag]++
+		}
+	}
+	s.mu.RUnlock()
+
+	tags := []models.TagCount{}
+	for name, count := range counts {
+		tags = append(tags, models.TagCount{Name: name, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count == tags[j].Count {
+			return tags[i].Name < tags[j].Name
+		}
+		return tags[i].Count > tags[j].Count
+	})
+	return tags, nil
+}
+
+// checkUser returns ErrUserNotFound unless userID is nil or an existing user.
+// The caller must hold the lock.
+func (s *MemoryStore) checkUser(userID *int) error {
+	if userID == nil {
+		return nil
+	}
+	if _, ok := s.users[*userID]; !ok {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// CreateComment adds a comment to a task outside the trash
+func (s *MemoryStore) CreateComment(comment models.Comment) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if task, ok := s.tasks[comment.TaskID]; !ok || task.DeletedAt != nil {
+		return 0, ErrTaskNotFound
+	}
+	comment.ID = s.nextCommentID
+	comment.AuthorID = copyID(comment.AuthorID)
+	comment.CreatedAt = time.Now()
+	comment.EditedAt = nil
+	s.nextCommentID++
+	s.comments[comment.ID] = comment
+	s.recordCommentAudit(models.AuditCreate, nil, &comment)
+	return int64(comment.ID), nil
+}
+
+// GetComment returns a comment on a task outside the trash
+func (s *MemoryStore) GetComment(taskID, id int) (models.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.getComment(taskID, id)
+}
+
+// getComment returns a comment on a task outside the trash. The caller must hold the lock.
+func (s *MemoryStore) getComment(taskID, id int) (models.Comment, error) {
+	if task, ok := s.tasks[taskID]; !ok || task.DeletedAt != nil {
+		return models.Comment{}, ErrTaskNotFound
+	}
+	comment, ok := s.comments[id]
+	if !ok || comment.TaskID != taskID {
+		return models.Comment{}, ErrCommentNotFound
+	}
+	return comment, nil
+}
+
+// ListComments returns the comments on a task outside the trash, oldest first
+func (s *MemoryStore) ListComments(taskID int) ([]models.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if task, ok := s.tasks[taskID]; !ok || task.DeletedAt != nil {
+		return nil, ErrTaskNotFound
+	}
+	comments := []models.Comment{}
+	for _, comment := range s.comments {
+		if comment.TaskID == taskID {
+			comments = append(comments, comment)
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool { return comments[i].ID < comments[j].ID })
+	return comments, nil
+}
+
+// UpdateComment replaces the body of a comment
+func (s *MemoryStore) UpdateComment(comment models.Comment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, err := s.getComment(comment.TaskID, comment.ID)
+	if err != nil {
+		return err
+	}
+	before := existing
+	now := time.Now()
+	existing.Body = comment.Body
+	existing.EditedAt = &now
+	s.comments[existing.ID] = existing
+	s.recordCommentAudit(models.AuditUpdate, &before, &existing)
+	return nil
+}
+
+// DeleteComment removes a comment
+func (s *MemoryStore) DeleteComment(taskID, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comment, err := s.getComment(taskID, id)
+	if err != nil {
+		return err
+	}
+	delete(s.comments, id)
+	s.recordCommentAudit(models.AuditDelete, &comment, nil)
+	return nil
+}
+
+// CreateAttachment records a file attached to a task outside the trash
+func (s *MemoryStore) CreateAttachment(attachment models.Attachment) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if task, ok := s.tasks[attachment.TaskID]; !ok || task.DeletedAt != nil {
+		return 0, ErrTaskNotFound
+	}
+	attachment.ID = s.nextAttachID
+	attachment.CreatedAt = time.Now()
+	s.nextAttachID++
+	s.attachments[attachment.ID] = attachment
+	s.recordAttachmentAudit(models.AuditCreate, nil, &attachment)
+	return int64(attachment.ID), nil
+}
+
+// GetAttachment returns an attachment of a task outside the trash
+func (s *MemoryStore) GetAttachment(taskID, id int) (models.Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.getAttachment(taskID, id)
+}
+
+// getAttachment returns an attachment of a task outside the trash. The caller must hold the lock.
+func (s *MemoryStore) getAttachment(taskID, id int) (models.Attachment, error) {
+	if task, ok := s.tasks[taskID]; !ok || task.DeletedAt != nil {
+		return models.Attachment{}, ErrTaskNotFound
+	}
+	attachment, ok := s.attachments[id]
+	if !ok || attachment.TaskID != taskID {
+		return models.Attachment{}, ErrAttachmentNotFound
+	}
+	return attachment, nil
+}
+
+// ListAttachments returns the attachments of a task outside the trash, oldest first
+func (s *MemoryStore) ListAttachments(taskID int) ([]models.Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if task, ok := s.tasks[taskID]; !ok || task.DeletedAt != nil {
+		return nil, ErrTaskNotFound
+	}
+	attachments := []models.Attachment{}
+	for _, attachment := range s.attachments {
+		if attachment.TaskID == taskID {
+			attachments = append(attachments, attachment)
+		}
+	}
+	sort.Slice(attachments, func(i, j int) bool { return attachments[i].ID < attachments[j].ID })
+	return attachments, nil
+}
+
+// DeleteAttachment removes an attachment
+func (s *MemoryStore) DeleteAttachment(taskID, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attachment, err := s.getAttachment(taskID, id)
+	if err != nil {
+		return err
+	}
+	delete(s.attachments, id)
+	s.recordAttachmentAudit(models.AuditDelete, &attachment, nil)
+	return nil
+}
+
+// BlobInUse reports whether any attachment has the content with hash
+func (s *MemoryStore) BlobInUse(hash string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, attachment := range s.attachments {
+		if attachment.SHA256 == hash {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CreateTimeEntry records time spent on a task outside the trash, or starts a
+// timer for an entry without StoppedAt
+func (s *MemoryStore) CreateTimeEntry(entry models.TimeEntry) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if task, ok := s.tasks[entry.TaskID]; !ok || task.DeletedAt != nil {
+		return 0, ErrTaskNotFound
+	}
+	if _, err := s.runningTimer(entry.TrackedBy); entry.StoppedAt == nil && err == nil {
+		return 0, ErrTimerRunning
+	}
+	entry.ID = s.nextEntryID
+	entry.UserID = copyID(entry.UserID)
+	entry.Minutes = models.DurationMinutes(entry.Duration())
+	entry.CreatedAt = time.Now()
+	s.nextEntryID++
+	s.timeEntries[entry.ID] = entry
+	s.recordTimeEntryAudit(models.AuditCreate, nil, &entry)
+	return int64(entry.ID), nil
+}
+
+// StopTimer stops the timer trackedBy has running on a task
+func (s *MemoryStore) StopTimer(taskID int, trackedBy string, stoppedAt time.Time) (models.TimeEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	running, err := s.runningTimer(trackedBy)
+	if err != nil {
+		return running, err
+	}
+	if running.TaskID != taskID {
+		return models.TimeEntry{}, ErrTimerNotRunning
+	}
+	return s.stopTimer(running, stoppedAt), nil
+}
+
+// stopTimer stops a running entry at stoppedAt. The caller must hold the write lock.
+func (s *MemoryStore) stopTimer(running models.TimeEntry, stoppedAt time.Time) models.TimeEntry {
+	// A timer can't stop before it started, even if the clocks disagree
+	if stoppedAt.Before(running.StartedAt) {
+		stoppedAt = running.StartedAt
+	}
+	stopped := running
+	stopped.StoppedAt = &stoppedAt
+	stopped.Minutes = models.DurationMinutes(stopped.Duration())
+	s.timeEntries[stopped.ID] = stopped
+	s.recordTimeEntryAudit(models.AuditUpdate, &running, &stopped)
+	return stopped
+}
+
+// RunningTimer returns the entry of the timer trackedBy has running
+func (s *MemoryStore) RunningTimer(trackedBy string) (models.TimeEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.runningTimer(trackedBy)
+}
+
+// runningTimer returns the entry of the timer trackedBy has running. The caller must hold the lock.
+func (s *MemoryStore) runningTimer(trackedBy string) (models.TimeEntry, error) {
+	for _, entry := range s.timeEntries {
+		if entry.TrackedBy == trackedBy && entry.StoppedAt == nil {
+			return entry, nil
+		}
+	}
+	return models.TimeEntry{}, ErrTimerNotRunning
+}
+
+// GetTimeEntry returns a time entry of a task outside the trash
+func (s *MemoryStore) GetTimeEntry(taskID, id int) (models.TimeEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.getTimeEntry(taskID, id)
+}
+
+// getTimeEntry returns a time entry of a task outside the trash. The caller must hold the lock.
+func (s *MemoryStore) getTimeEntry(taskID, id int) (models.TimeEntry, error) {
+	if task, ok := s.tasks[taskID]; !ok || task.DeletedAt != nil {
+		return models.TimeEntry{}, ErrTaskNotFound
+	}
+	entry, ok := s.timeEntries[id]
+	if !ok || entry.TaskID != taskID {
+		return models.TimeEntry{}, ErrTimeEntryNotFound
+	}
+	return entry, nil
+}
+
+// ListTimeEntries returns the time entries of a task outside the trash, oldest first
+func (s *MemoryStore) ListTimeEntries(taskID int) ([]models.TimeEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if task, ok := s.tasks[taskID]; !ok || task.DeletedAt != nil {
+		return nil, ErrTaskNotFound
+	}
+	entries := []models.TimeEntry{}
+	for _, entry := range s.timeEntries {
+		if entry.TaskID == taskID {
+			entries = append(entries, entry)
+		}
+	}
+	sortTimeEntries(entries)
+	return entries, nil
+}
+
+// sortTimeEntries orders entries by start time, then ID
+func sortTimeEntries(entries []models.TimeEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].StartedAt.Equal(entries[j].StartedAt) {
+			return entries[i].StartedAt.Before(entries[j].StartedAt)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+}
+
+// DeleteTimeEntry removes a time entry
+func (s *MemoryStore) DeleteTimeEntry(taskID, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, err := s.getTimeEntry(taskID, id)
+	if err != nil {
+		return err
+	}
+	delete(s.timeEntries, id)
+	s.recordTimeEntryAudit(models.AuditDelete, &entry, nil)
+	return nil
+}
+
+// TimeReport totals the stopped time entries matching filter
+func (s *MemoryStore) TimeReport(filter TimeReportFilter) (models.TimeReport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matching []models.TimeEntry
+	for _, entry := range s.timeEntries {
+		if filter.matches(entry) {
+			matching = append(matching, entry)
+		}
+	}
+	sortTimeEntries(matching)
+
+	entries := make([]reportedEntry, len(matching))
+	for i, entry := range matching {
+		entries[i] = reportedEntry{entry: entry, task: s.tasks[entry.TaskID]}
+	}
+	return buildTimeReport(filter, entries), nil
+}
+
+// ClaimIdempotencyKey records a request with an idempotency key, unless its caller has used the key already
+func (s *MemoryStore) ClaimIdempotencyKey(key models.IdempotencyKey) (models.IdempotencyKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, claimed := range s.idempotency {
+		if !claimed.ExpiresAt.After(key.CreatedAt) {
+			delete(s.idempotency, id)
+		}
+	}
+	id := idempotencyID{caller: key.Caller, key: key.Key}
+	if existing, ok := s.idempotency[id]; ok {
+		return copyIdempotencyKey(existing), ErrIdempotencyKeyUsed
+	}
+
+	key.StatusCode = 0
+	key.Header = nil
+	key.Body = nil
+	key.CreatedAt = key.CreatedAt.UTC()
+	key.ExpiresAt = key.ExpiresAt.UTC()
+	s.idempotency[id] = key
+	return key, nil
+}
+
+// CompleteIdempotencyKey stores the response to a claimed key's request
+func (s *MemoryStore) CompleteIdempotencyKey(key models.IdempotencyKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := idempotencyID{caller: key.Caller, key: key.Key}
+	claimed, ok := s.idempotency[id]
+	if !ok {
+		return nil
+	}
+	completed := copyIdempotencyKey(key)
+	claimed.StatusCode = completed.StatusCode
+	claimed.Header = completed.Header
+	claimed.Body = completed.Body
+	s.idempotency[id] = claimed
+	return nil
+}
+
+// ReleaseIdempotencyKey removes a key whose request is still in progress
+func (s *MemoryStore) ReleaseIdempotencyKey(caller, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := idempotencyID{caller: caller, key: key}
+	if claimed, ok := s.idempotency[id]; ok && !claimed.Completed() {
+		delete(s.idempotency, id)
+	}
+	return nil
+}
+
+// copyIdempotencyKey copies a key's headers and body, so the store's copy can't be changed through it
+func copyIdempotencyKey(key models.IdempotencyKey) models.IdempotencyKey {
+	if key.Header != nil {
+		header := make(map[string]string, len(key.Header))
+		for name, value := range key.Header {
+			header[name] = value
+		}
+		key.Header = header
+	}
+	key.Body = append([]byte(nil), key.Body...)
+	return key
+}
+
+// checkProject returns ErrProjectNotFound unless projectID is nil or an existing project.
+// The caller must hold the lock.
+func (s *MemoryStore) checkProject(projectID *int) error {
+	if projectID == nil {
+		return nil
+	}
+	if _, ok := s.projects[*projectID]; !ok {
+		return ErrProjectNotFound
+	}
+	return nil
+}
+
+// lastPosition returns the highest position in a project's board column, leaving
+// out the task with ID except, or "" if the column is empty. The caller must hold the lock.
+func (s *MemoryStore) lastPosition(projectID int, status models.Status, except int) string {
+	last := ""
+	for _, task := range s.tasks {
+		if sameID(task.ProjectID, projectID) && task.Status == status && task.DeletedAt == nil &&
+			task.ID != except && task.Position > last {
+			last = task.Position
+		}
+	}
+	return last
+}
+
+// CreateProject adds a new project
+func (s *MemoryStore) CreateProject(project models.Project) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	project.ID = s.nextProjectID
+	project.Columns = copyColumns(project.Columns)
+	project.CreatedAt = time.Now()
+	s.nextProjectID++
+	s.projects[project.ID] = project
+	return int64(project.ID), nil
+}
+
+// GetProject retrieves a single project by ID
+func (s *MemoryStore) GetProject(id int) (models.Project, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	project, ok := s.projects[id]
+	if !ok {
+		return models.Project{}, ErrProjectNotFound
+	}
+	project.Columns = copyColumns(project.Columns)
+	return project, nil
+}
+
+// ListProjects retrieves every project, oldest first
+func (s *MemoryStore) ListProjects() ([]models.Project, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	projects := make([]models.Project, 0, len(s.projects))
+	for _, project := range s.projects {
+		project.Columns = copyColumns(project.Columns)
+		projects = append(projects, project)
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].ID < projects[j].ID })
+	return projects, nil
+}
+
+// UpdateProject replaces the name, description and columns of a project
+func (s *MemoryStore) UpdateProject(project models.Project) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.projects[project.ID]
+	if !ok {
+		return ErrProjectNotFound
+	}
+	existing.Name = project.Name
+	existing.Description = project.Description
+	existing.Columns = copyColumns(project.Columns)
+	s.projects[project.ID] = existing
+	return nil
+}
+
+// DeleteProject removes a project without tasks
+func (s *MemoryStore) DeleteProject(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.projects[id]; !ok {
+		return ErrProjectNotFound
+	}
+	for _, task := range s.tasks {
+		if sameID(task.ProjectID, id) {
+			return ErrProjectNotEmpty
+		}
+	}
+	delete(s.projects, id)
+	return nil
+}
+
+// ProjectTasks retrieves the tasks of a project outside the trash in board order
+func (s *MemoryStore) ProjectTasks(projectID int) ([]models.Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.projects[projectID]; !ok {
+		return nil, ErrProjectNotFound
+	}
+	tasks := []models.Task{}
+	for _, task := range s.tasks {
+		if sameID(task.ProjectID, projectID) && task.DeletedAt == nil {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].Position != tasks[j].Position {
+			return tasks[i].Position < tasks[j].Position
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+	return tasks, nil
+}
+
+// copyColumns returns a copy of columns, so stored projects don't share them with callers
+func copyColumns(columns []models.BoardColumn) []models.BoardColumn {
+	return append([]models.BoardColumn(nil), columns...)
+}
+
+// CreateUser adds a new user, unless another one has the same email
+func (s *MemoryStore) CreateUser(user models.User) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.users {
+		if existing.Email == user.Email {
+			return 0, ErrEmailTaken
+		}
+	}
+
+	user.ID = s.nextUserID
+	user.CreatedAt = time.Now()
+	s.nextUserID++
+	s.users[user.ID] = user
+	return int64(user.ID), nil
+}
+
+// GetUserByID retrieves a single user by ID
+func (s *MemoryStore) GetUserByID(id int) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return models.User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// ListUsers retrieves every user, oldest first
+func (s *MemoryStore) ListUsers() ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]models.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+// CreateAPIKey stores a new API key by its hash
+func (s *MemoryStore) CreateAPIKey(key models.APIKey) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkUser(key.UserID); err != nil {
+		return 0, err
+	}
+	for _, existing := range s.apiKeys {
+		if existing.KeyHash == key.KeyHash {
+			return 0, fmt.Errorf("api key hash %s already exists", key.KeyHash)
+		}
+	}
+
+	key.ID = s.nextAPIKeyID
+	key.UserID = copyID(key.UserID)
+	key.Scopes = append([]string{}, key.Scopes...)
+	key.CreatedAt = time.Now()
+	s.nextAPIKeyID++
+	s.apiKeys[key.ID] = key
+	return int64(key.ID), nil
+}
+
+// GetAPIKeyByHash retrieves the API key with the given hash
+func (s *MemoryStore) GetAPIKeyByHash(hash string) (models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.apiKeys {
+		if key.KeyHash == hash {
+			return key, nil
+		}
+	}
+	return models.APIKey{}, ErrAPIKeyNotFound
+}
+
+// ListAPIKeys retrieves every API key, oldest first
+func (s *MemoryStore) ListAPIKeys() ([]models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]models.APIKey, 0, len(s.apiKeys))
+	for _, key := range s.apiKeys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// DeleteAPIKey revokes an API key
+func (s *MemoryStore) DeleteAPIKey(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apiKeys[id]; !ok {
+		return ErrAPIKeyNotFound
+	}
+	delete(s.apiKeys, id)
+	return nil
+}
+
+// CreateWebhook stores a new webhook subscription
+func (s *MemoryStore) CreateWebhook(webhook models.Webhook) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook.ID = s.nextWebhookID
+	webhook.Events = append([]string{}, webhook.Events...)
+	webhook.CreatedAt = time.Now()
+	s.nextWebhookID++
+	s.webhooks[webhook.ID] = webhook
+	return int64(webhook.ID), nil
+}
+
+// GetWebhook retrieves a webhook by its ID
+func (s *MemoryStore) GetWebhook(id int) (models.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhook, ok := s.webhooks[id]
+	if !ok {
+		return models.Webhook{}, ErrWebhookNotFound
+	}
+	return webhook, nil
+}
+
+// ListWebhooks retrieves every webhook, oldest first
+func (s *MemoryStore) ListWebhooks() ([]models.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhooks := make([]models.Webhook, 0, len(s.webhooks))
+	for _, webhook := range s.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks, nil
+}
+
+// DeleteWebhook removes a webhook; its deliveries go with it
+func (s *MemoryStore) DeleteWebhook(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(s.webhooks, id)
+	for deliveryID, delivery := range s.deliveries {
+		if delivery.WebhookID == id {
+			delete(s.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+// EnqueueEvent queues a delivery of payload to every webhook subscribed to event
+func (s *MemoryStore) EnqueueEvent(event string, payload []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Queue in webhook order, as SQLiteStore does
+	ids := make([]int, 0, len(s.webhooks))
+	for id := range s.webhooks {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	now := time.Now()
+	for _, id := range ids {
+		webhook := s.webhooks[id]
+		if !webhook.Subscribes(event) {
+			continue
+		}
+		due := now
+		s.deliveries[s.nextDelivery] = models.WebhookDelivery{
+			ID:            s.nextDelivery,
+			WebhookID:     webhook.ID,
+			Event:         event,
+			Payload:       append([]byte{}, payload...),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: &due,
+			CreatedAt:     now,
+		}
+		s.nextDelivery++
+	}
+	return nil
+}
+
+// ListDeliveries retrieves a webhook's deliveries, newest first, optionally only those with status
+func (s *MemoryStore) ListDeliveries(webhookID int, status models.DeliveryStatus) ([]models.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.webhooks[webhookID]; !ok {
+		return nil, ErrWebhookNotFound
+	}
+	deliveries := []models.WebhookDelivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.WebhookID == webhookID && (status == "" || delivery.Status == status) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	return deliveries, nil
+}
+
+// DueDeliveries retrieves up to limit pending deliveries due by now, oldest first
+func (s *MemoryStore) DueDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deliveries := []models.WebhookDelivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.Status == models.DeliveryPending && delivery.NextAttemptAt != nil && !delivery.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		a, b := deliveries[i], deliveries[j]
+		if !a.NextAttemptAt.Equal(*b.NextAttemptAt) {
+			return a.NextAttemptAt.Before(*b.NextAttemptAt)
+		}
+		return a.ID < b.ID
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+// UpdateDelivery records the outcome of a delivery attempt
+func (s *MemoryStore) UpdateDelivery(delivery models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.deliveries[delivery.ID]
+	if !ok {
+		return nil
+	}
+	existing.Status = delivery.Status
+	existing.Attempts = delivery.Attempts
+	existing.NextAttemptAt = delivery.NextAttemptAt
+	existing.ResponseStatus = delivery.ResponseStatus
+	existing.LastError = delivery.LastError
+	existing.DeliveredAt = delivery.DeliveredAt
+	s.deliveries[delivery.ID] = existing
+	return nil
+}
+
+// RunInTx calls fn with a copy of the store and keeps the copy's changes only
+// if fn succeeds. The store is locked until fn returns, so transactions don't interleave.
+func (s *MemoryStore) RunInTx(fn func(store TaskStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	txStore := s.clone()
+	events := &txEvents{parent: s.events}
+	txStore.events = events
+	if err := fn(txStore); err != nil {
+		return err
+	}
+	events.commit()
+
+	s.tasks = txStore.tasks
+	s.nextID = txStore.nextID
+	s.history = txStore.history
+	s.nextHistoryID = txStore.nextHistoryID
+	s.blocks = txStore.blocks
+	s.users = txStore.users
+	s.nextUserID = txStore.nextUserID
+	s.projects = txStore.projects
+	s.nextProjectID = txStore.nextProjectID
+	s.apiKeys = txStore.apiKeys
+	s.nextAPIKeyID = txStore.nextAPIKeyID
+	s.reminders = txStore.reminders
+	s.webhooks = txStore.webhooks
+	s.nextWebhookID = txStore.nextWebhookID
+	s.deliveries = txStore.deliveries
+	s.nextDelivery = txStore.nextDelivery
+	s.comments = txStore.comments
+	s.nextCommentID = txStore.nextCommentID
+	s.attachments = txStore.attachments
+	s.nextAttachID = txStore.nextAttachID
+	s.timeEntries = txStore.timeEntries
+	s.nextEntryID = txStore.nextEntryID
+	s.idempotency = txStore.idempotency
+	s.audit = txStore.audit
+	s.nextAuditID = txStore.nextAuditID
+	return nil
+}
+
+// clone returns a copy of the store that can be changed independently.
+// The caller must hold the lock.
+func (s *MemoryStore) clone() *MemoryStore {
+	c := &MemoryStore{
+		tasks:         make(map[int]models.Task, len(s.tasks)),
+		nextID:        s.nextID,
+		history:       make(map[int][]models.StatusChange, len(s.history)),
+		nextHistoryID: s.nextHistoryID,
+		blocks:        make(map[int]map[int]bool, len(s.blocks)),
+		users:         make(map[int]models.User, len(s.users)),
+		nextUserID:    s.nextUserID,
+		projects:      make(map[int]models.Project, len(s.projects)),
+		nextProjectID: s.nextProjectID,
+		apiKeys:       make(map[int]models.APIKey, len(s.apiKeys)),
+		nextAPIKeyID:  s.nextAPIKeyID,
+		reminders:     make(map[reminderKey]bool, len(s.reminders)),
+		webhooks:      make(map[int]models.Webhook, len(s.webhooks)),
+		nextWebhookID: s.nextWebhookID,
+		deliveries:    make(map[int]models.WebhookDelivery, len(s.deliveries)),
+		nextDelivery:  s.nextDelivery,
+		comments:      make(map[int]models.Comment, len(s.comments)),
+		nextCommentID: s.nextCommentID,
+		attachments:   make(map[int]models.Attachment, len(s.attachments)),
+		nextAttachID:  s.nextAttachID,
+		timeEntries:   make(map[int]models.TimeEntry, len(s.timeEntries)),
+		nextEntryID:   s.nextEntryID,
+		idempotency:   make(map[idempotencyID]models.IdempotencyKey, len(s.idempotency)),
+		audit:         append([]models.AuditEntry(nil), s.audit...),
+		nextAuditID:   s.nextAuditID,
+		log:           s.log,
+		events:        s.events,
+		actor:         s.actor,
+	}
+	for id, webhook := range s.webhooks {
+		c.webhooks[id] = webhook
+	}
+	for id, project := range s.projects {
+		c.projects[id] = project
+	}
+	for id, comment := range s.comments {
+		c.comments[id] = comment
+	}
+	for id, attachment := range s.attachments {
+		c.attachments[id] = attachment
+	}
+	for id, entry := range s.timeEntries {
+		c.timeEntries[id] = entry
+	}
+	for id, key := range s.idempotency {
+		c.idempotency[id] = key
+	}
+	for id, delivery := range s.deliveries {
+		c.deliveries[id] = delivery
+	}
+	for key := range s.reminders {
+		c.reminders[key] = true
+	}
+	for id, user := range s.users {
+		c.users[id] = user
+	}
+	for id, key := range s.apiKeys {
+		c.apiKeys[id] = key
+	}
+	for id, task := range s.tasks {
+		c.tasks[id] = task
+	}
+	for id, changes := range s.history {
+		c.history[id] = append([]models.StatusChange(nil), changes...)
+	}
+	for blockerID, blocked := range s.blocks {
+		c.blocks[blockerID] = make(map[int]bool, len(blocked))
+		for blockedID := range blocked {
+			c.blocks[blockerID][blockedID] = true
+		}
+	}
+	return c
+}
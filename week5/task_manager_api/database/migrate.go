@@ -0,0 +1,319 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// migrationFiles holds the schema migrations, named NNNN_description.up.sql
+// and NNNN_description.down.sql. Applied migrations must never be edited;
+// add a new one instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// ErrChecksumMismatch is returned when an applied migration's SQL has changed since it ran
+var ErrChecksumMismatch = errors.New("applied migration has been modified")
+
+// ErrUnknownMigration is returned when the database has a migration applied that this build doesn't know about
+var ErrUnknownMigration = errors.New("database has an unknown migration applied")
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum identifies the exact SQL of the up step
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// MigrationStatus describes whether a migration has been applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool // applied, but the SQL no longer matches its checksum
+}
+
+// Migrator applies and rolls back migrations, recording them in the schema_migrations table
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator creates a Migrator for the migrations embedded in this package
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	return newMigrator(db, migrationFiles)
+}
+
+// newMigrator creates a Migrator for the migrations in fsys
+func newMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	createTable := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at DATETIME NOT NULL
+	);`
+	if _, err := db.Exec(createTable); err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// loadMigrations reads every migration in fsys, ordered by version
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	paths, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, p := range paths {
+		parts := migrationFileName.FindStringSubmatch(path.Base(p))
+		if parts == nil {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_description.up.sql", p)
+		}
+
+		version, _ := strconv.Atoi(parts[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = m
+		}
+		if m.Name != parts[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, parts[2])
+		}
+
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		if parts[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Latest returns the highest known migration version, or 0 if there are none
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status reports every known migration and whether it has been applied.
+// It returns ErrUnknownMigration alongside the statuses if the database
+// has a version applied that isn't in this build.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	rows, err := m.db.Query("SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type applied struct {
+		checksum string
+		at       time.Time
+	}
+	appliedVersions := map[int]applied{}
+	for rows.Next() {
+		var version int
+		var a applied
+		if err := rows.Scan(&version, &a.checksum, &a.at); err != nil {
+			return nil, err
+		}
+		appliedVersions[version] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+		if a, ok := appliedVersions[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = a.at
+			status.Modified = a.checksum != migration.Checksum()
+			delete(appliedVersions, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	if len(appliedVersions) > 0 {
+		var unknown []int
+		for version := range appliedVersions {
+			unknown = append(unknown, version)
+		}
+		sort.Ints(unknown)
+		return statuses, fmt.Errorf("%w: version %v", ErrUnknownMigration, unknown)
+	}
+	return statuses, nil
+}
+
+// Verify checks that every applied migration is known and unmodified
+func (m *Migrator) Verify() error {
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if status.Modified {
+			return fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, status.Version, status.Name)
+		}
+	}
+	return nil
+}
+
+// Current returns the highest applied version, or 0 if none have been applied
+func (m *Migrator) Current() (int, error) {
+	var version int
+	err := m.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up() error {
+	return m.To(m.Latest())
+}
+
+// Down rolls back the most recently applied migration
+func (m *Migrator) Down() error {
+	current, err := m.Current()
+	if err != nil {
+		return err
+	}
+
+	target := 0
+	for _, migration := range m.migrations {
+		if migration.Version < current {
+			target = migration.Version
+		}
+	}
+	return m.To(target)
+}
+
+// To migrates up or down until version is the highest applied migration.
+// Version 0 rolls back every migration.
+func (m *Migrator) To(version int) error {
+	if version != 0 && !m.known(version) {
+		return fmt.Errorf("no migration with version %d", version)
+	}
+	if err := m.Verify(); err != nil {
+		return err
+	}
+
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+
+	// Apply pending migrations up to the target in ascending order
+	for _, status := range statuses {
+		if !status.Applied && status.Version <= version {
+			if err := m.apply(status.Migration); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Roll back applied migrations above the target in descending order
+	for i := len(statuses) - 1; i >= 0; i-- {
+		if statuses[i].Applied && statuses[i].Version > version {
+			if err := m.rollback(statuses[i].Migration); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// known reports whether version is one of the embedded migrations
+func (m *Migrator) known(version int) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// apply runs a migration's up step and records it, in one transaction
+func (m *Migrator) apply(migration Migration) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(migration.Up); err != nil {
+		return fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+	}
+
+	_, err = tx.Exec("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+		migration.Version, migration.Name, migration.Checksum(), time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// rollback runs a migration's down step and removes its record, in one transaction
+func (m *Migrator) rollback(migration Migration) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(migration.Down); err != nil {
+		return fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,360 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"task_manager_api/models"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// testMigrations is a small migration set independent of the real schema
+var testMigrations = fstest.MapFS{
+	"migrations/0001_create_widgets.up.sql":   {Data: []byte("CREATE TABLE widgets (id INTEGER PRIMARY KEY);")},
+	"migrations/0001_create_widgets.down.sql": {Data: []byte("DROP TABLE widgets;")},
+	"migrations/0002_add_name.up.sql":         {Data: []byte("ALTER TABLE widgets ADD COLUMN name TEXT;")},
+	"migrations/0002_add_name.down.sql":       {Data: []byte("ALTER TABLE widgets DROP COLUMN name;")},
+	"migrations/0003_create_gadgets.up.sql":   {Data: []byte("CREATE TABLE gadgets (id INTEGER PRIMARY KEY);")},
+	"migrations/0003_create_gadgets.down.sql": {Data: []byte("DROP TABLE gadgets;")},
+}
+
+// setupMigrator opens an empty in-memory database with a Migrator for testMigrations
+func setupMigrator(t *testing.T) *Migrator {
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := newMigrator(db, testMigrations)
+	if err != nil {
+		t.Fatalf("newMigrator() error = %v", err)
+	}
+	return migrator
+}
+
+// tableExists reports whether the migrator's database has the named table
+func tableExists(t *testing.T, migrator *Migrator, name string) bool {
+	var count int
+	err := migrator.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to query sqlite_master: %v", err)
+	}
+	return count > 0
+}
+
+// TestMigratorUpDownTo tests moving between schema versions
+func TestMigratorUpDownTo(t *testing.T) {
+	migrator := setupMigrator(t)
+
+	// Test cases run in order against the same database
+	testCases := []struct {
+		name        string
+		run         func() error
+		wantVersion int
+		wantGadgets bool
+	}{
+		{name: "Up", run: migrator.Up, wantVersion: 3, wantGadgets: true},
+		{name: "Up Again Is A No-op", run: migrator.Up, wantVersion: 3, wantGadgets: true},
+		{name: "Down", run: migrator.Down, wantVersion: 2, wantGadgets: false},
+		{name: "To Earlier Version", run: func() error { return migrator.To(1) }, wantVersion: 1},
+		{name: "To Later Version", run: func() error { return migrator.To(3) }, wantVersion: 3, wantGadgets: true},
+		{name: "To Zero", run: func() error { return migrator.To(0) }, wantVersion: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.run(); err != nil {
+				t.Fatalf("migration error = %v", err)
+			}
+
+			version, err := migrator.Current()
+			if err != nil {
+				t.Fatalf("Current() error = %v", err)
+			}
+			if version != tc.wantVersion {
+				t.Errorf("Current() = %d, want %d", version, tc.wantVersion)
+			}
+			if got := tableExists(t, migrator, "gadgets"); got != tc.wantGadgets {
+				t.Errorf("gadgets table exists = %v, want %v", got, tc.wantGadgets)
+			}
+			if got := tableExists(t, migrator, "widgets"); got != (tc.wantVersion > 0) {
+				t.Errorf("widgets table exists = %v at version %d", got, tc.wantVersion)
+			}
+		})
+	}
+
+	if err := migrator.To(7); err == nil {
+		t.Error("To() with an unknown version should fail")
+	}
+}
+
+// TestMigratorStatus tests reporting which migrations are applied
+func TestMigratorStatus(t *testing.T) {
+	migrator := setupMigrator(t)
+
+	if err := migrator.To(2); err != nil {
+		t.Fatalf("To() error = %v", err)
+	}
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+
+	wantApplied := []bool{true, true, false}
+	if len(statuses) != len(wantApplied) {
+		t.Fatalf("Status() returned %d migrations, want %d", len(statuses), len(wantApplied))
+	}
+	for i, status := range statuses {
+		if status.Version != i+1 || status.Applied != wantApplied[i] || status.Modified {
+			t.Errorf("migration %d: version %d applied %v modified %v",
+				i, status.Version, status.Applied, status.Modified)
+		}
+		if status.Applied && status.AppliedAt.IsZero() {
+			t.Errorf("migration %d has no applied_at", status.Version)
+		}
+	}
+}
+
+// TestMigratorVerify tests that edited and unknown migrations are refused
+func TestMigratorVerify(t *testing.T) {
+	t.Run("Modified Migration", func(t *testing.T) {
+		migrator := setupMigrator(t)
+		if err := migrator.Up(); err != nil {
+			t.Fatalf("Up() error = %v", err)
+		}
+
+		// Simulate editing a migration after it was applied
+		if _, err := migrator.db.Exec("UPDATE schema_migrations SET checksum = 'edited' WHERE version = 2"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := migrator.Down(); !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("Down() error = %v, want ErrChecksumMismatch", err)
+		}
+		if version, _ := migrator.Current(); version != 3 {
+			t.Errorf("Down() changed the version to %d despite the mismatch", version)
+		}
+	})
+
+	t.Run("Unknown Migration", func(t *testing.T) {
+		migrator := setupMigrator(t)
+		if err := migrator.Up(); err != nil {
+			t.Fatalf("Up() error = %v", err)
+		}
+
+		// Simulate a database migrated by a newer build
+		_, err := migrator.db.Exec("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (4, 'future', 'x', CURRENT_TIMESTAMP)")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := migrator.Up(); !errors.Is(err, ErrUnknownMigration) {
+			t.Errorf("Up() error = %v, want ErrUnknownMigration", err)
+		}
+	})
+}
+
+// TestMigrationsAdoptExistingDatabase tests upgrading a tasks database created before migrations existed
+func TestMigrationsAdoptExistingDatabase(t *testing.T) {
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer db.Close()
+
+	// The schema and data written by the original InitDB
+	_, err = db.Exec(`CREATE TABLE tasks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title TEXT NOT NULL,
+		description TEXT,
+		status TEXT NOT NULL,
+		due_date DATETIME,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+	INSERT INTO tasks (title, description, status, due_date, created_at, updated_at)
+	VALUES ('Old task', '', 'pending', '0001-01-01 00:00:00+00:00', '2025-01-01 00:00:00+00:00', '2025-01-01 00:00:00+00:00');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	if err := migrator.Up(); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	// The old task survives and its zero due date becomes NULL
+	var title string
+	var dueDateIsNull bool
+	if err := db.QueryRow("SELECT title, due_date IS NULL FROM tasks").Scan(&title, &dueDateIsNull); err != nil {
+		t.Fatalf("Failed to read migrated task: %v", err)
+	}
+	if title != "Old task" || !dueDateIsNull {
+		t.Errorf("migrated task: title %q, due_date NULL %v", title, dueDateIsNull)
+	}
+}
+
+// TestMigrationsNormalizeStatuses tests mapping free-form statuses stored before
+// the workflow was enforced onto known statuses, and restoring them on rollback
+func TestMigrationsNormalizeStatuses(t *testing.T) {
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	if err := migrator.To(19); err != nil {
+		t.Fatalf("To(19) error = %v", err)
+	}
+
+	testCases := []struct {
+		legacy string
+		want   string
+	}{
+		{"pending", "pending"},
+		{"Completed", "completed"},
+		{" IN PROGRESS ", "in_progress"},
+		{"in-progress", "in_progress"},
+		{"done", "pending"},
+		{"", "pending"},
+	}
+	for _, tc := range testCases {
+		_, err := db.Exec("INSERT INTO tasks (title, status, created_at, updated_at) VALUES (?, ?, '2025-01-01 00:00:00+00:00', '2025-01-01 00:00:00+00:00')",
+			"Legacy "+tc.legacy, tc.legacy)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// statuses returns the status of every task, in the order they were added
+	statuses := func() []string {
+		rows, err := db.Query("SELECT status FROM tasks ORDER BY id")
+		if err != nil {
+			t.Fatalf("Failed to query statuses: %v", err)
+		}
+		defer rows.Close()
+		var statuses []string
+		for rows.Next() {
+			var status string
+			if err := rows.Scan(&status); err != nil {
+				t.Fatal(err)
+			}
+			statuses = append(statuses, status)
+		}
+		return statuses
+	}
+
+	if err := migrator.To(20); err != nil {
+		t.Fatalf("To(20) error = %v", err)
+	}
+	for i, got := range statuses() {
+		if got != testCases[i].want {
+			t.Errorf("status %q migrated to %q, want %q", testCases[i].legacy, got, testCases[i].want)
+		}
+	}
+
+	if err := migrator.To(19); err != nil {
+		t.Fatalf("To(19) error = %v", err)
+	}
+	for i, got := range statuses() {
+		if got != testCases[i].legacy {
+			t.Errorf("status %q rolled back to %q", testCases[i].legacy, got)
+		}
+	}
+	if tableExists(t, migrator, "legacy_task_statuses") {
+		t.Error("rollback left the legacy_task_statuses table")
+	}
+}
+
+// TestMigrationsUTCTimestamps tests that tasks stored with local offsets before
+// timestamps were kept in UTC sort, page and filter in time order with new tasks
+func TestMigrationsUTCTimestamps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	if err := migrator.To(20); err != nil {
+		t.Fatalf("To(20) error = %v", err)
+	}
+
+	// East was created and is due at 08:30 UTC, and West at 09:00:00.5 UTC
+	_, err = db.Exec(`INSERT INTO tasks (title, status, due_date, created_at, updated_at) VALUES
+		('East', 'pending', '2025-01-01 10:30:00+02:00', '2025-01-01 10:30:00+02:00', '2025-01-01 10:30:00+02:00'),
+		('West', 'pending', '2025-01-01 04:00:00.5-05:00', '2025-01-01 04:00:00.5-05:00', '2025-01-01 04:00:00.5-05:00');
+	INSERT INTO task_status_history (task_id, from_status, to_status, changed_at)
+	VALUES (1, NULL, 'pending', '2025-01-01 10:30:00+02:00');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	// A new task, created now, due in between the two
+	if _, err := store.CreateTask(models.Task{Title: "New", Status: models.StatusPending,
+		DueDate: time.Date(2025, 1, 1, 8, 45, 0, 0, time.UTC)}); err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+
+	var dueDate, changedAt string
+	if err := store.db.QueryRow("SELECT CAST(due_date AS TEXT) FROM tasks WHERE title = 'West'").Scan(&dueDate); err != nil || dueDate != "2025-01-01 09:00:00.5+00:00" {
+		t.Errorf("migrated due date = %s, %v, want 2025-01-01 09:00:00.5+00:00", dueDate, err)
+	}
+	if err := store.db.QueryRow("SELECT CAST(changed_at AS TEXT) FROM task_status_history WHERE task_id = 1").Scan(&changedAt); err != nil || changedAt != "2025-01-01 08:30:00+00:00" {
+		t.Errorf("migrated history = %s, %v, want 2025-01-01 08:30:00+00:00", changedAt, err)
+	}
+
+	testCases := []struct {
+		name   string
+		filter TaskFilter
+		want   []string // titles across every page, in order
+	}{
+		{"By Due Date", TaskFilter{Sort: SortDueDate, Order: OrderAsc}, []string{"East", "New", "West"}},
+		{"Due After", TaskFilter{Sort: SortDueDate, Order: OrderAsc, DueAfter: time.Date(2025, 1, 1, 8, 40, 0, 0, time.UTC)}, []string{"New", "West"}},
+		{"Due Before", TaskFilter{Sort: SortDueDate, Order: OrderAsc, DueBefore: time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)}, []string{"East", "New"}},
+		{"Paged By Creation", TaskFilter{Sort: SortCreatedAt, Order: OrderAsc, Limit: 1}, []string{"East", "West", "New"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var titles []string
+			filter := tc.filter
+			for {
+				page, err := store.ListTasks(filter)
+				if err != nil {
+					t.Fatalf("ListTasks() error = %v", err)
+				}
+				for _, task := range page.Tasks {
+					titles = append(titles, task.Title)
+				}
+				if page.NextCursor == "" || len(titles) > len(tc.want) {
+					break
+				}
+				filter.Cursor = page.NextCursor
+			}
+			if !reflect.DeepEqual(titles, tc.want) {
+				t.Errorf("ListTasks() = %v, want %v", titles, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+-- IF NOT EXISTS lets databases created before migrations adopt this baseline
+CREATE TABLE IF NOT EXISTS tasks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL,
+	description TEXT,
+	status TEXT NOT NULL,
+	due_date DATETIME,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
@@ -0,0 +1,2 @@
+-- Older versions stored a missing due date as Go's zero time instead of NULL
+UPDATE tasks SET due_date = NULL WHERE due_date LIKE '0001-01-01%';
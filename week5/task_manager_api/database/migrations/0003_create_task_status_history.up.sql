@@ -0,0 +1,13 @@
+CREATE TABLE task_status_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	from_status TEXT,
+	to_status TEXT NOT NULL,
+	changed_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_task_status_history_task_id ON task_status_history(task_id);
+
+-- Existing tasks start their history with the status they have now
+INSERT INTO task_status_history (task_id, from_status, to_status, changed_at)
+SELECT id, NULL, status, created_at FROM tasks;
@@ -0,0 +1,2 @@
+-- Existing tasks start at version 1, like newly created ones
+ALTER TABLE tasks ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
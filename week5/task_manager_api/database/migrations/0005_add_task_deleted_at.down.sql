@@ -0,0 +1,6 @@
+-- Trashed tasks would reappear as active ones, so remove them first
+DELETE FROM tasks WHERE deleted_at IS NOT NULL;
+
+DROP INDEX idx_tasks_deleted_at;
+
+ALTER TABLE tasks DROP COLUMN deleted_at;
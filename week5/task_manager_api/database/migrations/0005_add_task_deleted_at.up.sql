@@ -0,0 +1,4 @@
+-- Deleted tasks stay in the table with deleted_at set until they are purged
+ALTER TABLE tasks ADD COLUMN deleted_at DATETIME;
+
+CREATE INDEX idx_tasks_deleted_at ON tasks(deleted_at);
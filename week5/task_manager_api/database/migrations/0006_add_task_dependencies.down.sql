@@ -0,0 +1,7 @@
+DROP TABLE task_dependencies;
+
+DROP TRIGGER tasks_orphan_subtasks;
+
+DROP INDEX idx_tasks_parent_id;
+
+ALTER TABLE tasks DROP COLUMN parent_id;
@@ -0,0 +1,20 @@
+-- Subtasks point at their parent; top-level tasks have no parent
+ALTER TABLE tasks ADD COLUMN parent_id INTEGER;
+
+CREATE INDEX idx_tasks_parent_id ON tasks(parent_id);
+
+-- Subtasks of a purged task become top-level tasks
+CREATE TRIGGER tasks_orphan_subtasks AFTER DELETE ON tasks BEGIN
+	UPDATE tasks SET parent_id = NULL, version = version + 1 WHERE parent_id = old.id;
+END;
+
+-- blocker_id has to be completed before blocked_id can be
+CREATE TABLE task_dependencies (
+	blocker_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	blocked_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (blocker_id, blocked_id),
+	CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX idx_task_dependencies_blocked_id ON task_dependencies(blocked_id);
@@ -0,0 +1,7 @@
+DROP INDEX idx_tasks_assignee_id;
+DROP INDEX idx_tasks_created_by;
+
+ALTER TABLE tasks DROP COLUMN assignee_id;
+ALTER TABLE tasks DROP COLUMN created_by;
+
+DROP TABLE users;
@@ -0,0 +1,13 @@
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL UNIQUE,
+	created_at DATETIME NOT NULL
+);
+
+-- Tasks created before users existed have no owner or assignee
+ALTER TABLE tasks ADD COLUMN created_by INTEGER;
+ALTER TABLE tasks ADD COLUMN assignee_id INTEGER;
+
+CREATE INDEX idx_tasks_created_by ON tasks(created_by);
+CREATE INDEX idx_tasks_assignee_id ON tasks(assignee_id);
@@ -0,0 +1,4 @@
+DROP INDEX idx_tasks_series_id;
+
+ALTER TABLE tasks DROP COLUMN series_id;
+ALTER TABLE tasks DROP COLUMN recurrence;
@@ -0,0 +1,6 @@
+-- recurrence holds an RRULE, empty for tasks that don't repeat. Every
+-- occurrence of a recurring task points at the first one with series_id.
+ALTER TABLE tasks ADD COLUMN recurrence TEXT NOT NULL DEFAULT '';
+ALTER TABLE tasks ADD COLUMN series_id INTEGER;
+
+CREATE INDEX idx_tasks_series_id ON tasks(series_id);
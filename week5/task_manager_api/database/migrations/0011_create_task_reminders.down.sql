@@ -0,0 +1,3 @@
+DROP TABLE task_reminders;
+
+ALTER TABLE tasks DROP COLUMN overdue_at;
@@ -0,0 +1,11 @@
+-- overdue_at is set by the reminder scheduler when it finds an open task past its due date
+ALTER TABLE tasks ADD COLUMN overdue_at DATETIME;
+
+-- Each reminder sent, so it fires once per task, threshold and due date
+CREATE TABLE task_reminders (
+	task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	threshold TEXT NOT NULL,
+	due_date DATETIME NOT NULL,
+	sent_at DATETIME NOT NULL,
+	PRIMARY KEY (task_id, threshold, due_date)
+);
@@ -0,0 +1,13 @@
+-- Comments are removed with their task when it is purged. While the task is in
+-- the trash they are kept but hidden, and they come back when it is restored.
+CREATE TABLE task_comments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	body TEXT NOT NULL,
+	author TEXT NOT NULL,
+	author_id INTEGER,
+	created_at DATETIME NOT NULL,
+	edited_at DATETIME
+);
+
+CREATE INDEX idx_task_comments_task_id ON task_comments(task_id);
@@ -0,0 +1,15 @@
+-- Attachments are removed with their task when it is purged, and hidden while it
+-- is in the trash. Their content lives in the blob store under sha256.
+CREATE TABLE task_attachments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	filename TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	sha256 TEXT NOT NULL,
+	uploaded_by TEXT NOT NULL,
+	created_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_task_attachments_task_id ON task_attachments(task_id);
+CREATE INDEX idx_task_attachments_sha256 ON task_attachments(sha256);
@@ -0,0 +1,6 @@
+DROP INDEX idx_tasks_project_position;
+
+ALTER TABLE tasks DROP COLUMN position;
+ALTER TABLE tasks DROP COLUMN project_id;
+
+DROP TABLE projects;
@@ -0,0 +1,16 @@
+-- columns is the board's columns as a JSON array of {"name", "status"} objects
+CREATE TABLE projects (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	columns TEXT NOT NULL,
+	created_at DATETIME NOT NULL
+);
+
+-- position orders a project's tasks within their board column. It is a
+-- fractional index, compared as a string, so a task can move between two
+-- others without renumbering the rest. Tasks outside a project have none.
+ALTER TABLE tasks ADD COLUMN project_id INTEGER;
+ALTER TABLE tasks ADD COLUMN position TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_tasks_project_position ON tasks(project_id, status, position);
@@ -0,0 +1,3 @@
+DROP TABLE time_entries;
+
+ALTER TABLE tasks DROP COLUMN estimate_minutes;
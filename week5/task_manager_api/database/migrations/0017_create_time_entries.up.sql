@@ -0,0 +1,19 @@
+-- estimate_minutes is how long a task is expected to take; NULL until it is estimated
+ALTER TABLE tasks ADD COLUMN estimate_minutes INTEGER;
+
+-- A time entry is a running timer while stopped_at is NULL. tracked_by names
+-- the caller as the audit log does, and each can only have one timer running.
+CREATE TABLE time_entries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	tracked_by TEXT NOT NULL,
+	user_id INTEGER,
+	started_at DATETIME NOT NULL,
+	stopped_at DATETIME,
+	note TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_time_entries_task_id ON time_entries(task_id);
+CREATE INDEX idx_time_entries_started_at ON time_entries(started_at);
+CREATE UNIQUE INDEX idx_time_entries_running ON time_entries(tracked_by) WHERE stopped_at IS NULL;
@@ -0,0 +1,2 @@
+-- priority is one of low, medium, high or urgent; existing tasks are medium
+ALTER TABLE tasks ADD COLUMN priority TEXT NOT NULL DEFAULT 'medium';
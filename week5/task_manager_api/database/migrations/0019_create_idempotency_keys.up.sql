@@ -0,0 +1,17 @@
+-- The response to a request sent with an Idempotency-Key header, kept so that
+-- retries with the same key get it again until expires_at. status_code is 0
+-- while the request is in progress. header is a JSON object of the response
+-- headers to replay.
+CREATE TABLE idempotency_keys (
+	caller TEXT NOT NULL,
+	idempotency_key TEXT NOT NULL,
+	request_hash TEXT NOT NULL,
+	status_code INTEGER NOT NULL DEFAULT 0,
+	header TEXT NOT NULL DEFAULT '{}',
+	body BLOB,
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	PRIMARY KEY (caller, idempotency_key)
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
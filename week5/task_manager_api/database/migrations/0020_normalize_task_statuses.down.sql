@@ -0,0 +1,4 @@
+UPDATE tasks SET status = (SELECT status FROM legacy_task_statuses WHERE task_id = tasks.id)
+WHERE id IN (SELECT task_id FROM legacy_task_statuses);
+
+DROP TABLE legacy_task_statuses;
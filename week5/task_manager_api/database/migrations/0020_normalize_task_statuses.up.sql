@@ -0,0 +1,19 @@
+-- Statuses were free-form text before the workflow was enforced, and a task
+-- with an unknown status can't be updated. Keep each unknown value so rolling
+-- back can restore it, then map it to the known status it spells, ignoring
+-- case, surrounding spaces and spaces or dashes for underscores, or else to
+-- pending.
+CREATE TABLE legacy_task_statuses (
+	task_id INTEGER PRIMARY KEY REFERENCES tasks(id) ON DELETE CASCADE,
+	status TEXT NOT NULL
+);
+
+INSERT INTO legacy_task_statuses (task_id, status)
+SELECT id, status FROM tasks WHERE status NOT IN ('pending', 'in_progress', 'completed');
+
+UPDATE tasks SET status = CASE replace(replace(lower(trim(status)), ' ', '_'), '-', '_')
+	WHEN 'in_progress' THEN 'in_progress'
+	WHEN 'completed' THEN 'completed'
+	ELSE 'pending'
+END
+WHERE id IN (SELECT task_id FROM legacy_task_statuses);
@@ -0,0 +1,3 @@
+-- The UTC timestamps are the same times, and the old offsets aren't needed to
+-- read them, so rolling back leaves them as they are
+SELECT 1;
@@ -0,0 +1,20 @@
+-- Timestamps used to be stored with the server's local offset, and SQLite
+-- compares them as text, so tasks stored before timestamps were kept in UTC
+-- sort and filter out of order. Rewrite them in UTC in the form the driver
+-- stores times in, 2006-01-02 15:04:05.999999999+00:00, keeping the fraction
+-- of a second as it was.
+UPDATE tasks SET created_at = strftime('%Y-%m-%d %H:%M:%S', created_at) || substr(created_at, 20, length(created_at) - 25) || '+00:00'
+WHERE created_at NOT LIKE '%+00:00' AND strftime('%s', created_at) IS NOT NULL;
+
+UPDATE tasks SET updated_at = strftime('%Y-%m-%d %H:%M:%S', updated_at) || substr(updated_at, 20, length(updated_at) - 25) || '+00:00'
+WHERE updated_at NOT LIKE '%+00:00' AND strftime('%s', updated_at) IS NOT NULL;
+
+UPDATE tasks SET due_date = strftime('%Y-%m-%d %H:%M:%S', due_date) || substr(due_date, 20, length(due_date) - 25) || '+00:00'
+WHERE due_date NOT LIKE '%+00:00' AND strftime('%s', due_date) IS NOT NULL;
+
+UPDATE tasks SET deleted_at = strftime('%Y-%m-%d %H:%M:%S', deleted_at) || substr(deleted_at, 20, length(deleted_at) - 25) || '+00:00'
+WHERE deleted_at NOT LIKE '%+00:00' AND strftime('%s', deleted_at) IS NOT NULL;
+
+-- The history of existing tasks started at their created_at
+UPDATE task_status_history SET changed_at = strftime('%Y-%m-%d %H:%M:%S', changed_at) || substr(changed_at, 20, length(changed_at) - 25) || '+00:00'
+WHERE changed_at NOT LIKE '%+00:00' AND strftime('%s', changed_at) IS NOT NULL;
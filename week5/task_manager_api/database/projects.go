@@ -0,0 +1,33 @@
+package database
+
+import "task_manager_api/models"
+
+// taskPosition returns the position task is stored with. Tasks outside a
+// project have none. A task keeps the position it asks for, or with none,
+// the one it has if existing shows it staying in the same column; otherwise it
+// goes after last, the last position in its new column. existing is nil for a
+// task being created.
+func taskPosition(task models.Task, existing *models.Task, last func() (string, error)) (string, error) {
+	if task.ProjectID == nil {
+		return "", nil
+	}
+
+	sameColumn := existing != nil && existing.Position != "" &&
+		sameID(existing.ProjectID, *task.ProjectID) && existing.Status == task.Status
+	switch {
+	case task.Position == "" && sameColumn:
+		return existing.Position, nil
+	case task.Position != "" && (existing == nil || sameColumn || task.Position != existing.Position):
+		// A position carried over unchanged into another column is ignored
+		if !models.ValidPosition(task.Position) {
+			return "", models.ErrInvalidPosition
+		}
+		return task.Position, nil
+	}
+
+	lastPosition, err := last()
+	if err != nil {
+		return "", err
+	}
+	return models.PositionBetween(lastPosition, "")
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// StartTrashPurger permanently removes tasks that have been in the trash for
+// longer than retention, once straight away and then every interval, until
+// the returned stop function is called.
+func StartTrashPurger(store TaskStore, retention, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := store.PurgeTrash(time.Now().Add(-retention))
+			if err != nil {
+				log.Printf("Failed to purge trash: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d tasks from the trash", purged)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		wg.Wait()
+	}
+}
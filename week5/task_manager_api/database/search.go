@@ -0,0 +1,231 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidQuery is returned when a search query has no searchable words
+var ErrInvalidQuery = errors.New("invalid search query")
+
+// ErrSearchUnavailable is returned by SQLiteStore.Search when the SQLite
+// library was built without FTS5 (build with -tags sqlite_fts5)
+var ErrSearchUnavailable = errors.New("full-text search is not available")
+
+// Markers wrapped around matched words in search highlights
+const (
+	highlightStart = "<mark>"
+	highlightEnd   = "</mark>"
+	snippetWords   = 12
+)
+
+// searchTerm is one word or quoted phrase of a search query.
+// Every term must match for a task to be returned.
+type searchTerm struct {
+	words  []string // lower-cased words, in order
+	prefix bool     // the last word matches any word starting with it
+}
+
+// parseSearchQuery splits a query into terms. Quoted text is a phrase,
+// a trailing * makes a word a prefix match, and all other punctuation
+// separates words the same way the FTS tokenizer does.
+func parseSearchQuery(q string) ([]searchTerm, error) {
+	var terms []searchTerm
+
+	for i, part := range strings.Split(q, `"`) {
+		// Odd parts were inside quotes
+		if i%2 == 1 {
+			words := tokenize(part)
+			if len(words) > 0 {
+				terms = append(terms, searchTerm{words: spanWords(words)})
+			}
+			continue
+		}
+
+		for _, field := range strings.Fields(part) {
+			prefix := strings.HasSuffix(field, "*")
+			words := spanWords(tokenize(field))
+			for j, word := range words {
+				terms = append(terms, searchTerm{
+					words:  []string{word},
+					prefix: prefix && j == len(words)-1,
+				})
+			}
+		}
+	}
+
+	if len(terms) == 0 {
+		return nil, ErrInvalidQuery
+	}
+	return terms, nil
+}
+
+// ftsQuery renders terms in FTS MATCH syntax. Words contain only letters and
+// digits and are lower case, so they can never be read as FTS operators.
+func ftsQuery(terms []searchTerm) string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		part := strings.Join(term.words, " ")
+		if len(term.words) > 1 {
+			part = `"` + part + `"`
+		}
+		if term.prefix {
+			part += "*"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+// wordSpan is the position of a word within a piece of text
+type wordSpan struct {
+	start, end int
+	word       string // lower-cased
+}
+
+// tokenize splits text into runs of letters and digits
+func tokenize(text string) []wordSpan {
+	var spans []wordSpan
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		}
+		if !isWord && start >= 0 {
+			spans = append(spans, wordSpan{start, i, strings.ToLower(text[start:i])})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, wordSpan{start, len(text), strings.ToLower(text[start:])})
+	}
+	return spans
+}
+
+// spanWords returns just the words of a tokenized text
+func spanWords(spans []wordSpan) []string {
+	words := make([]string, len(spans))
+	for i, span := range spans {
+		words[i] = span.word
+	}
+	return words
+}
+
+// matchTerm returns the index of the first word of each match of term in spans
+func matchTerm(spans []wordSpan, term searchTerm) []int {
+	var matches []int
+	for i := 0; i+len(term.words) <= len(spans); i++ {
+		matched := true
+		for j, word := range term.words {
+			got := spans[i+j].word
+			last := j == len(term.words)-1
+			if got != word && !(last && term.prefix && strings.HasPrefix(got, word)) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// highlight wraps every word matched by terms in highlight markers and
+// HTML-escapes the rest of the text, so that the markers are the only markup
+// in it, whatever the text contains. When
+// maxWords is positive only a window of that many words around the first
+// match is returned, with an ellipsis marking any text cut off.
+func highlight(text string, terms []searchTerm, maxWords int) string {
+	spans := tokenize(text)
+
+	// Mark each word that is part of a match
+	marked := make([]bool, len(spans))
+	first := -1
+	for _, term := range terms {
+		for _, i := range matchTerm(spans, term) {
+			for j := range term.words {
+				marked[i+j] = true
+			}
+			if first < 0 || i < first {
+				first = i
+			}
+		}
+	}
+
+	// Choose the window of words to show
+	from, to := 0, len(spans)
+	if maxWords > 0 && len(spans) > maxWords {
+		if first > 0 {
+			from = first - maxWords/4
+			if from < 0 {
+				from = 0
+			}
+		}
+		to = from + maxWords
+		if to > len(spans) {
+			to = len(spans)
+			from = to - maxWords
+		}
+	}
+
+	var b strings.Builder
+	pos := 0
+	if from > 0 {
+		b.WriteString("…")
+		pos = spans[from].start
+	}
+	for i := from; i < to; i++ {
+		if !marked[i] {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:spans[i].start]))
+		b.WriteString(highlightStart)
+		b.WriteString(html.EscapeString(text[spans[i].start:spans[i].end]))
+		b.WriteString(highlightEnd)
+		pos = spans[i].end
+	}
+	if to < len(spans) {
+		b.WriteString(html.EscapeString(text[pos:spans[to-1].end]))
+		b.WriteString("…")
+	} else {
+		b.WriteString(html.EscapeString(text[pos:]))
+	}
+
+	return b.String()
+}
+
+// searchCursor is the position of the next page of search results
+type searchCursor struct {
+	Query  string `json:"q"`
+	Offset int    `json:"offset"`
+}
+
+// encodeSearchCursor turns a search position into the opaque string handed to clients
+func encodeSearchCursor(c searchCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeSearchCursor parses a search cursor and checks it belongs to query
+func decodeSearchCursor(value, query string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	var c searchCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.Query != query || c.Offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+
+	return c.Offset, nil
+}
@@ -0,0 +1,239 @@
+package database
+
+import (
+	"errors"
+	"task_manager_api/models"
+	"time"
+)
+
+// ErrTaskNotFound is returned when no task exists with the requested ID
+var ErrTaskNotFound = errors.New("task not found")
+
+// ErrVersionConflict is returned when a task was changed since the version the caller read
+var ErrVersionConflict = errors.New("task version conflict")
+
+// ErrUserNotFound is returned when no user exists with the requested ID
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrEmailTaken is returned when creating a user with the email of an existing one
+var ErrEmailTaken = errors.New("email already in use")
+
+// ErrNoSeries is returned when asking for the series of a task that has never recurred
+var ErrNoSeries = errors.New("task is not part of a recurring series")
+
+// ErrAPIKeyNotFound is returned when no API key exists with the requested ID or hash
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// ErrWebhookNotFound is returned when no webhook exists with the requested ID
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// ErrCommentNotFound is returned when a task has no comment with the requested ID
+var ErrCommentNotFound = errors.New("comment not found")
+
+// ErrAttachmentNotFound is returned when a task has no attachment with the requested ID
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// ErrProjectNotFound is returned when no project exists with the requested ID
+var ErrProjectNotFound = errors.New("project not found")
+
+// ErrProjectNotEmpty is returned when deleting a project that still has tasks, in the trash or not
+var ErrProjectNotEmpty = errors.New("project has tasks")
+
+// ErrTimeEntryNotFound is returned when a task has no time entry with the requested ID
+var ErrTimeEntryNotFound = errors.New("time entry not found")
+
+// ErrTimerRunning is returned when starting a timer for a caller who already has one running
+var ErrTimerRunning = errors.New("timer already running")
+
+// ErrTimerNotRunning is returned when stopping or looking up a timer that isn't running
+var ErrTimerNotRunning = errors.New("timer not running")
+
+// ErrIdempotencyKeyUsed is returned when claiming an idempotency key a caller has already used and that hasn't expired
+var ErrIdempotencyKeyUsed = errors.New("idempotency key already used")
+
+// TaskStore is the persistence layer used by the task handlers.
+// SQLiteStore and MemoryStore both implement it, so handlers and tests
+// can be wired to whichever backend they need.
+type TaskStore interface {
+	// CreateTask adds a new task and returns its ID. A parent must be an existing
+	// task outside the trash, otherwise CreateTask returns ErrParentNotFound, and an
+	// assignee must be an existing user, otherwise it returns ErrUserNotFound.
+	// A recurring task without a series ID starts a series of its own.
+	// A project must be an existing one, otherwise CreateTask returns ErrProjectNotFound;
+	// a task in a project without a position goes to the end of its board column.
+	CreateTask(task models.Task) (int64, error)
+	// GetAllTasks returns every task, newest first
+	GetAllTasks() ([]models.Task, error)
+	// ListTasks returns one page of the tasks matching filter
+	ListTasks(filter TaskFilter) (models.TaskPage, error)
+	// SearchTasks returns one page of the tasks matching a full-text query, most relevant first
+	SearchTasks(query string, limit int, cursor string) (models.SearchPage, error)
+	// GetTaskByID returns a single task that isn't in the trash, or ErrTaskNotFound
+	GetTaskByID(id int) (models.Task, error)
+	// GetTrashedTask returns a single task that is in the trash, or ErrTaskNotFound
+	GetTrashedTask(id int) (models.Task, error)
+	// UpdateTask replaces the title, description, status, due date, parent, tags, assignee and recurrence
+	// of an existing task, increments its version and records any status change. If task.Version is non-zero
+	// it must match the stored version, otherwise UpdateTask returns ErrVersionConflict.
+	// The parent and assignee follow the rules of CreateTask, and the parent must not be the
+	// task or one of its subtasks, otherwise UpdateTask returns a *CycleError. The creator never changes.
+	// Completing the latest occurrence of a recurring task creates the next one, as models.NextOccurrence describes.
+	// Changing the due date clears OverdueAt.
+	// The project and position follow the rules of CreateTask, except that a task staying in
+	// its column keeps its position unless given a new one, and one changing column without
+	// being given a new position goes to the end of its new column.
+	UpdateTask(id int, task models.Task) error
+	// DeleteTask moves a task to the trash, stopping any timers running on it; deleting a missing
+	// or trashed task is not an error. A non-zero version must match the stored version, otherwise DeleteTask returns ErrVersionConflict.
+	DeleteTask(id int, version int) error
+	// PurgeTask permanently removes a task, in the trash or not, with the same rules as DeleteTask.
+	// Its dependencies are removed with it and its subtasks become top-level tasks.
+	PurgeTask(id int, version int) error
+	// RestoreTask moves a task out of the trash, or returns ErrTaskNotFound if it isn't there
+	RestoreTask(id int) error
+	// PurgeTrash permanently removes the tasks moved to the trash before cutoff and returns how many
+	PurgeTrash(cutoff time.Time) (int64, error)
+	// GetStatusHistory returns every status change of a task, oldest first, or ErrTaskNotFound
+	GetStatusHistory(id int) ([]models.StatusChange, error)
+	// GetSubtasks returns the subtasks of a task that aren't in the trash, oldest first, or ErrTaskNotFound
+	GetSubtasks(id int) ([]models.Task, error)
+	// GetBlockers returns the tasks that block a task and aren't in the trash, oldest first, or ErrTaskNotFound
+	GetBlockers(id int) ([]models.Task, error)
+	// AddDependency records that blockerID blocks blockedID; adding it twice is not an error.
+	// Both tasks must exist outside the trash, otherwise AddDependency returns ErrTaskNotFound,
+	// and if blockedID already blocks blockerID, directly or not, it returns a *CycleError.
+	AddDependency(blockerID, blockedID int) error
+	// RemoveDependency removes a dependency added by AddDependency, or returns ErrDependencyNotFound
+	RemoveDependency(blockerID, blockedID int) error
+	// OpenDependencies returns every dependency between two tasks that are outside the
+	// trash and not completed, ordered by blocker and then blocked task
+	OpenDependencies() ([]Dependency, error)
+	// MarkOverdue sets the OverdueAt of a task that isn't completed or in the trash, unless it is set
+	// already, and increments its version. Missing tasks are not an error.
+	MarkOverdue(id int, at time.Time) error
+	// ClaimReminder records that the reminder for a task at threshold before dueDate is being sent.
+	// It returns true the first time and false after that, so each reminder fires once.
+	ClaimReminder(taskID int, threshold string, dueDate time.Time) (bool, error)
+	// GetSeries returns the occurrences of a task's recurring series that aren't in the trash,
+	// oldest first. It returns ErrTaskNotFound for a missing task and ErrNoSeries for one that never recurred.
+	GetSeries(id int) ([]models.Task, error)
+	// ListTags returns every tag used by a task outside the trash with the number of
+	// such tasks, most used first
+	ListTags() ([]models.TagCount, error)
+	// CreateComment adds a comment to a task and returns its ID. The task must exist
+	// outside the trash, otherwise CreateComment returns ErrTaskNotFound.
+	CreateComment(comment models.Comment) (int64, error)
+	// GetComment returns a comment on a task outside the trash, or ErrTaskNotFound or ErrCommentNotFound
+	GetComment(taskID, id int) (models.Comment, error)
+	// ListComments returns the comments on a task outside the trash, oldest first, or ErrTaskNotFound.
+	// The comments of a task in the trash are kept, but hidden until it is restored.
+	ListComments(taskID int) ([]models.Comment, error)
+	// UpdateComment replaces the body of a comment and sets its EditedAt, with the errors of GetComment
+	UpdateComment(comment models.Comment) error
+	// DeleteComment removes a comment, with the errors of GetComment
+	DeleteComment(taskID, id int) error
+	// CreateAttachment records a file attached to a task and returns its ID. The task must
+	// exist outside the trash, otherwise CreateAttachment returns ErrTaskNotFound.
+	CreateAttachment(attachment models.Attachment) (int64, error)
+	// GetAttachment returns an attachment of a task outside the trash, or ErrTaskNotFound or ErrAttachmentNotFound
+	GetAttachment(taskID, id int) (models.Attachment, error)
+	// ListAttachments returns the attachments of a task outside the trash, oldest first, or ErrTaskNotFound.
+	// Like comments, they are hidden while the task is in the trash and removed when it is purged.
+	ListAttachments(taskID int) ([]models.Attachment, error)
+	// DeleteAttachment removes an attachment, with the errors of GetAttachment
+	DeleteAttachment(taskID, id int) error
+	// BlobInUse reports whether any attachment, on a task in the trash or not, has the content with hash
+	BlobInUse(hash string) (bool, error)
+	// CreateProject adds a new project and returns its ID
+	CreateProject(project models.Project) (int64, error)
+	// GetProject returns a single project, or ErrProjectNotFound
+	GetProject(id int) (models.Project, error)
+	// ListProjects returns every project, oldest first
+	ListProjects() ([]models.Project, error)
+	// UpdateProject replaces the name, description and columns of a project, or returns ErrProjectNotFound
+	UpdateProject(project models.Project) error
+	// DeleteProject removes a project. It returns ErrProjectNotFound for a missing project
+	// and ErrProjectNotEmpty for one that still has tasks, in the trash or not.
+	DeleteProject(id int) error
+	// ProjectTasks returns the tasks of a project outside the trash in board order: by
+	// position, then ID. It returns ErrProjectNotFound for a missing project.
+	ProjectTasks(projectID int) ([]models.Task, error)
+	// CreateTimeEntry records time spent on a task outside the trash and returns its ID, or
+	// ErrTaskNotFound. An entry without StoppedAt starts a timer, which fails with
+	// ErrTimerRunning while entry.TrackedBy has another one running on any task.
+	CreateTimeEntry(entry models.TimeEntry) (int64, error)
+	// StopTimer stops the timer trackedBy has running on a task at stoppedAt and returns the
+	// stopped entry, or ErrTimerNotRunning if they have none running on that task
+	StopTimer(taskID int, trackedBy string, stoppedAt time.Time) (models.TimeEntry, error)
+	// RunningTimer returns the entry of the timer trackedBy has running, or ErrTimerNotRunning
+	RunningTimer(trackedBy string) (models.TimeEntry, error)
+	// GetTimeEntry returns a time entry of a task outside the trash, or ErrTaskNotFound or ErrTimeEntryNotFound
+	GetTimeEntry(taskID, id int) (models.TimeEntry, error)
+	// ListTimeEntries returns the time entries of a task outside the trash, oldest first, or
+	// ErrTaskNotFound. They are kept while the task is in the trash and removed when it is purged.
+	ListTimeEntries(taskID int) ([]models.TimeEntry, error)
+	// DeleteTimeEntry removes a time entry, running or not, with the errors of GetTimeEntry
+	DeleteTimeEntry(taskID, id int) error
+	// TimeReport totals the stopped time entries matching filter, including those on tasks in the trash
+	TimeReport(filter TimeReportFilter) (models.TimeReport, error)
+	// ClaimIdempotencyKey records that key.Caller is sending a request with key.Key, in progress
+	// until CompleteIdempotencyKey stores its response. If the caller has used the key before and
+	// it hasn't expired at key.CreatedAt, it returns the stored key and ErrIdempotencyKeyUsed.
+	// Keys that have expired are removed.
+	ClaimIdempotencyKey(key models.IdempotencyKey) (models.IdempotencyKey, error)
+	// CompleteIdempotencyKey stores the status, headers and body of the response to a claimed key's request
+	CompleteIdempotencyKey(key models.IdempotencyKey) error
+	// ReleaseIdempotencyKey removes a key whose request is still in progress, so it can be used again.
+	// Completed and missing keys are left alone.
+	ReleaseIdempotencyKey(caller, key string) error
+	// CreateUser adds a new user and returns its ID, or ErrEmailTaken
+	CreateUser(user models.User) (int64, error)
+	// GetUserByID returns a single user, or ErrUserNotFound
+	GetUserByID(id int) (models.User, error)
+	// ListUsers returns every user, oldest first
+	ListUsers() ([]models.User, error)
+	// CreateAPIKey stores an API key by its hash and returns its ID. A user must be an
+	// existing one, otherwise CreateAPIKey returns ErrUserNotFound.
+	CreateAPIKey(key models.APIKey) (int64, error)
+	// GetAPIKeyByHash returns the API key with the given hash, or ErrAPIKeyNotFound
+	GetAPIKeyByHash(hash string) (models.APIKey, error)
+	// ListAPIKeys returns every API key, oldest first
+	ListAPIKeys() ([]models.APIKey, error)
+	// DeleteAPIKey revokes an API key, or returns ErrAPIKeyNotFound
+	DeleteAPIKey(id int) error
+	// CreateWebhook stores a webhook subscription, secret included, and returns its ID
+	CreateWebhook(webhook models.Webhook) (int64, error)
+	// GetWebhook returns the webhook with the given ID, or ErrWebhookNotFound
+	GetWebhook(id int) (models.Webhook, error)
+	// ListWebhooks returns every webhook, oldest first
+	ListWebhooks() ([]models.Webhook, error)
+	// DeleteWebhook removes a webhook and its deliveries, or returns ErrWebhookNotFound
+	DeleteWebhook(id int) error
+	// EnqueueEvent queues a pending delivery of payload, due straight away, to every
+	// webhook subscribed to event
+	EnqueueEvent(event string, payload []byte) error
+	// ListDeliveries returns a webhook's deliveries, newest first, or ErrWebhookNotFound.
+	// A status other than "" returns only the deliveries with that status.
+	ListDeliveries(webhookID int, status models.DeliveryStatus) ([]models.WebhookDelivery, error)
+	// DueDeliveries returns up to limit pending deliveries whose next attempt is due
+	// at now, the longest overdue first
+	DueDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error)
+	// UpdateDelivery records the outcome of an attempt at a delivery: its status,
+	// attempts, next attempt, response status, last error and delivery time
+	UpdateDelivery(delivery models.WebhookDelivery) error
+	// Events returns the log of the changes the store makes to tasks. Every write
+	// that creates, changes or removes a task publishes an event once it commits,
+	// including the writes of RunInTx, which publishes them all if fn succeeds.
+	Events() *EventLog
+	// WithActor returns a store that works on the same data and records its changes
+	// to tasks in the audit log as made by actor. Every write that creates, changes or
+	// removes a task records an entry in the same transaction; writes through a store
+	// that has no actor are recorded as made by SystemActor.
+	WithActor(actor Actor) TaskStore
+	// ListAudit returns one page of the audit log entries matching filter, newest first.
+	// An invalid cursor returns ErrInvalidCursor.
+	ListAudit(filter AuditFilter) (models.AuditPage, error)
+	// RunInTx calls fn with a store whose changes are all kept if fn returns nil
+	// and all discarded if it returns an error. Calls can be nested.
+	RunInTx(fn func(store TaskStore) error) error
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"sort"
+	"strconv"
+	"task_manager_api/models"
+	"time"
+)
+
+// Ways of grouping a time report
+const (
+	GroupByTask   = "task"
+	GroupByDay    = "day" // the UTC day each entry started on
+	GroupByStatus = "status"
+)
+
+// TimeReportFilter selects the time entries TimeReport totals and how it groups them
+type TimeReportFilter struct {
+	From      time.Time // only entries started at or after this time; zero for no start
+	To        time.Time // only entries started strictly before this time; zero for no end
+	GroupBy   string    // one of the GroupBy* constants; defaults to GroupByTask
+	TrackedBy string    // only entries tracked by this caller; "" matches all
+}
+
+// matches reports whether a stopped entry falls within the filter
+func (f TimeReportFilter) matches(entry models.TimeEntry) bool {
+	return entry.StoppedAt != nil &&
+		(f.From.IsZero() || !entry.StartedAt.Before(f.From)) &&
+		(f.To.IsZero() || entry.StartedAt.Before(f.To)) &&
+		(f.TrackedBy == "" || entry.TrackedBy == f.TrackedBy)
+}
+
+// reportedEntry is a time entry with the task it was tracked on
+type reportedEntry struct {
+	entry models.TimeEntry
+	task  models.Task
+}
+
+// buildTimeReport totals entries into the groups filter asks for. Days come in
+// order; tasks and statuses come with the most time first. Each group's minutes
+// and the total are rounded once, from the exact durations.
+func buildTimeReport(filter TimeReportFilter, entries []reportedEntry) models.TimeReport {
+	if filter.GroupBy == "" {
+		filter.GroupBy = GroupByTask
+	}
+	report := models.TimeReport{GroupBy: filter.GroupBy, Groups: []models.TimeReportGroup{}}
+	if !filter.From.IsZero() {
+		from := filter.From.UTC()
+		report.From = &from
+	}
+	if !filter.To.IsZero() {
+		to := filter.To.UTC()
+		report.To = &to
+	}
+
+	indexes := map[string]int{}
+	var durations []time.Duration
+	var total time.Duration
+	for _, e := range entries {
+		var key string
+		switch filter.GroupBy {
+		case GroupByDay:
+			key = e.entry.StartedAt.UTC().Format("2006-01-02")
+		case GroupByStatus:
+			key = string(e.task.Status)
+		default:
+			key = strconv.Itoa(e.task.ID)
+		}
+		i, ok := indexes[key]
+		if !ok {
+			i = len(report.Groups)
+			indexes[key] = i
+			group := models.TimeReportGroup{Key: key}
+			if filter.GroupBy == GroupByTask {
+				group.TaskID, group.Title, group.Estimate = e.task.ID, e.task.Title, e.task.Estimate
+			}
+			report.Groups = append(report.Groups, group)
+			durations = append(durations, 0)
+		}
+		report.Groups[i].Entries++
+		durations[i] += e.entry.Duration()
+		total += e.entry.Duration()
+	}
+	for i := range report.Groups {
+		report.Groups[i].Minutes = models.DurationMinutes(durations[i])
+	}
+	report.TotalMinutes = models.DurationMinutes(total)
+
+	sort.SliceStable(report.Groups, func(i, j int) bool {
+		a, b := report.Groups[i], report.Groups[j]
+		if filter.GroupBy != GroupByDay && a.Minutes != b.Minutes {
+			return a.Minutes > b.Minutes
+		}
+		if a.TaskID != b.TaskID {
+			return a.TaskID < b.TaskID
+		}
+		return a.Key < b.Key
+	})
+	return report
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// transaction is a database transaction or, when the store is already
+// inside one, a savepoint within it. It satisfies querier.
+type transaction struct {
+	*sql.Tx
+	savepoint string // empty for a top-level transaction
+	done      bool
+}
+
+// begin starts a transaction, or a savepoint if the store is already in one
+func (s *SQLiteStore) begin() (*transaction, error) {
+	if s.tx == nil {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return nil, err
+		}
+		return &transaction{Tx: tx}, nil
+	}
+
+	s.savepoints++
+	name := fmt.Sprintf("sp%d", s.savepoints)
+	if _, err := s.tx.Exec("SAVEPOINT " + name); err != nil {
+		s.savepoints--
+		return nil, err
+	}
+	return &transaction{Tx: s.tx, savepoint: name}, nil
+}
+
+// Commit commits the transaction or releases the savepoint
+func (t *transaction) Commit() error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+
+	if t.savepoint == "" {
+		return t.Tx.Commit()
+	}
+	_, err := t.Exec("RELEASE SAVEPOINT " + t.savepoint)
+	return err
+}
+
+// Rollback undoes everything since begin. It does nothing after Commit,
+// so it can be deferred.
+func (t *transaction) Rollback() error {
+	if t.done {
+		return nil
+	}
+	t.done = true
+
+	if t.savepoint == "" {
+		return t.Tx.Rollback()
+	}
+	if _, err := t.Exec("ROLLBACK TO SAVEPOINT " + t.savepoint); err != nil {
+		return err
+	}
+	_, err := t.Exec("RELEASE SAVEPOINT " + t.savepoint)
+	return err
+}
+
+// RunInTx calls fn with a store whose reads and writes all happen in one
+// transaction, committed if fn returns nil and rolled back if it returns an
+// error. Calling RunInTx on that store again runs fn in a savepoint, so a
+// nested failure only undoes the nested writes.
+func (s *SQLiteStore) RunInTx(fn func(store TaskStore) error) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	events := &txEvents{parent: s.events}
+	txStore := &SQLiteStore{db: s.db, q: tx, tx: tx.Tx, fts: s.fts, savepoints: s.savepoints, log: s.log, events: events, actor: s.actor}
+	if err := fn(txStore); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	events.commit()
+	return nil
+}
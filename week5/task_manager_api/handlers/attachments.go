@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"task_manager_api/blobs"
+	"task_manager_api/database"
+	"task_manager_api/models"
+	"unicode"
+)
+
+// AttachmentLimits restricts the files that can be attached to tasks
+type AttachmentLimits struct {
+	MaxSize int64    // largest file accepted, in bytes
+	Types   []string // media types accepted, such as "application/pdf" or "image/*"
+}
+
+// DefaultAttachmentLimits accepts images, PDFs and plain text up to 10 MB
+var DefaultAttachmentLimits = AttachmentLimits{
+	MaxSize: 10 << 20,
+	Types:   []string{"image/*", "application/pdf", "text/plain"},
+}
+
+// multipartOverhead is how much of an upload besides the file itself is read,
+// for the multipart boundaries and headers
+const multipartOverhead = 64 << 10
+
+// sniffLength is how many bytes http.DetectContentType looks at
+const sniffLength = 512
+
+// WithAttachments enables the attachment endpoints, storing the files in
+// blobStore and accepting those within limits. Without it they respond with 501.
+func WithAttachments(blobStore *blobs.Store, limits AttachmentLimits) Option {
+	return func(h *TasksHandler) {
+		h.blobs = blobStore
+		h.attachmentLimits = limits
+	}
+}
+
+// allows reports whether the limits accept files of contentType
+func (l AttachmentLimits) allows(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range l.Types {
+		if allowed == mediaType || (strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(allowed, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// listAttachments retrieves the attachments of a task, oldest first
+func (h *TasksHandler) listAttachments(w http.ResponseWriter, r *http.Request, id int) {
+	attachments, err := h.store.ListAttachments(id)
+	if errors.Is(err, database.ErrTaskNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch attachments"})
+		return
+	}
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// uploadAttachment attaches the file sent as the "file" part of a
+// multipart/form-data request to a task. The file's type is detected from its
+// content rather than trusted from the client.
+func (h *TasksHandler) uploadAttachment(w http.ResponseWriter, r *http.Request, id int) {
+	if !h.authorizeTaskChangeByID(w, r, id) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.attachmentLimits.MaxSize+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Content-Type must be multipart/form-data"})
+		return
+	}
+	var part io.ReadCloser
+	var filename string
+	for {
+		p, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			h.writeUploadError(w, err)
+			return
+		}
+		if p.FormName() == "file" {
+			part, filename = p, p.FileName()
+			break
+		}
+		p.Close()
+	}
+	if part == nil {
+		writeFieldErrors(w, "Invalid attachment", fieldErrors{"file": "is required"})
+		return
+	}
+	defer part.Close()
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		h.writeUploadError(w, err)
+		return
+	}
+	head = head[:n]
+	if n == 0 {
+		writeFieldErrors(w, "Invalid attachment", fieldErrors{"file": "must not be empty"})
+		return
+	}
+	contentType := http.DetectContentType(head)
+	if !h.attachmentLimits.allows(contentType) {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Files of type " + contentType + " can't be attached"})
+		return
+	}
+
+	hash, size, err := h.blobs.Put(io.MultiReader(bytes.NewReader(head), part), h.attachmentLimits.MaxSize)
+	if err != nil {
+		h.writeUploadError(w, err)
+		return
+	}
+
+	attachment := models.Attachment{
+		TaskID:      id,
+		Filename:    sanitizeFilename(filename),
+		ContentType: contentType,
+		Size:        size,
+		SHA256:      hash,
+		UploadedBy:  requestActor(r).Name,
+	}
+	attachmentID, err := h.store.CreateAttachment(attachment)
+	if err != nil {
+		// The blob is left for the sweeper, which can't remove it while another upload is recording it
+		if errors.Is(err, database.ErrTaskNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create attachment"})
+		return
+	}
+
+	createdAttachment, err := h.store.GetAttachment(id, int(attachmentID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve created attachment"})
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createdAttachment)
+}
+
+// writeUploadError responds to a failure reading or storing an upload
+func (h *TasksHandler) writeUploadError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, blobs.ErrTooLarge) || errors.As(err, &maxBytesErr):
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Attachments must be at most " + strconv.FormatInt(h.attachmentLimits.MaxSize, 10) + " bytes"})
+	case errors.Is(err, io.ErrUnexpectedEOF) || strings.Contains(err.Error(), "multipart"):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid multipart body"})
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to store attachment"})
+	}
+}
+
+// downloadAttachment sends an attachment's content. Range requests are
+// supported, and the content's hash serves as its ETag.
+func (h *TasksHandler) downloadAttachment(w http.ResponseWriter, r *http.Request, id int, attachmentIDStr string) {
+	attachment, ok := h.findAttachment(w, id, attachmentIDStr)
+	if !ok {
+		return
+	}
+	file, err := h.blobs.Open(attachment.SHA256)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to open attachment"})
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", `"`+attachment.SHA256+`"`)
+	http.ServeContent(w, r, "", attachment.CreatedAt, file)
+}
+
+// deleteAttachment removes one of the caller's attachments. Its content is left
+// for the blob sweeper, which only removes it once no attachment refers to it;
+// deleting it here could race an upload of the same content.
+func (h *TasksHandler) deleteAttachment(w http.ResponseWriter, r *http.Request, id int, attachmentIDStr string) {
+	attachment, ok := h.findAttachment(w, id, attachmentIDStr)
+	if !ok || !h.authorizeTaskChangeByID(w, r, id) {
+		return
+	}
+	if attachment.UploadedBy != requestActor(r).Name {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Only the attachment's uploader can delete it"})
+		return
+	}
+
+	if err := h.store.DeleteAttachment(id, attachment.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete attachment"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Attachment deleted"})
+}
+
+// findAttachment looks up the attachment with the ID in attachmentIDStr on a
+// task, responding with 400 or 404 if it is invalid or doesn't exist
+func (h *TasksHandler) findAttachment(w http.ResponseWriter, id int, attachmentIDStr string) (models.Attachment, bool) {
+	attachmentID, err := strconv.Atoi(attachmentIDStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid attachment ID"})
+		return models.Attachment{}, false
+	}
+
+	attachment, err := h.store.GetAttachment(id, attachmentID)
+	switch {
+	case errors.Is(err, database.ErrTaskNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		return attachment, false
+	case errors.Is(err, database.ErrAttachmentNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Attachment not found"})
+		return attachment, false
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch attachment"})
+		return attachment, false
+	}
+	return attachment, true
+}
+
+// sanitizeFilename reduces an uploaded file's name to its base name without
+// control characters, so it is safe to echo back in Content-Disposition
+func sanitizeFilename(name string) string {
+	// Browsers on Windows send the full path
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	if len(name) > 255 {
+		name = strings.ToValidUTF8(name[:255], "")
+	}
+	return name
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"task_manager_api/auth"
+	"task_manager_api/database"
+	"task_manager_api/models"
+)
+
+// anonymousActor is recorded in the audit log as the actor of unauthenticated
+// requests, which the server only accepts with authentication turned off
+const anonymousActor = "anonymous"
+
+// requestActor returns the actor the changes made during r are audited as:
+// the authenticated caller's subject and the request's ID
+func requestActor(r *http.Request) database.Actor {
+	actor := database.Actor{Name: anonymousActor, RequestID: RequestIDFromContext(r.Context())}
+	if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+		actor.Name = principal.Subject
+	}
+	return actor
+}
+
+// AuditHandler serves the /audit endpoint using the TaskStore it was created with
+type AuditHandler struct {
+	store database.TaskStore
+}
+
+// NewAuditHandler creates an AuditHandler that reads the audit log through store
+func NewAuditHandler(store database.TaskStore) *AuditHandler {
+	return &AuditHandler{store: store}
+}
+
+// ServeHTTP lists audit log entries, newest first. entity and id select the
+// entries about an entity, since and until a time range, and limit and cursor page them.
+func (h *AuditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	query := r.URL.Query()
+	filter := database.AuditFilter{Entity: query.Get("entity"), Cursor: query.Get("cursor")}
+	errs := fieldErrors{}
+
+	if filter.Entity != "" && !validAuditEntity(filter.Entity) {
+		errs["entity"] = "must be one of " + strings.Join(models.AuditEntities, ", ")
+	}
+	if value := query.Get("id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			errs["id"] = "must be a positive integer"
+		} else if filter.Entity == "" {
+			errs["id"] = "requires entity"
+		}
+		filter.EntityID = id
+	}
+	if value := query.Get("since"); value != "" {
+		t, err := parseTime(value)
+		if err != nil {
+			errs["since"] = "must be an RFC 3339 timestamp or a YYYY-MM-DD date"
+		}
+		filter.Since = t
+	}
+	if value := query.Get("until"); value != "" {
+		t, err := parseTime(value)
+		if err != nil {
+			errs["until"] = "must be an RFC 3339 timestamp or a YYYY-MM-DD date"
+		}
+		filter.Until = t
+	}
+	filter.Limit = parseLimit(query, errs)
+	if len(errs) > 0 {
+		writeFieldErrors(w, invalidQuery, errs)
+		return
+	}
+
+	page, err := h.store.ListAudit(filter)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		writeFieldErrors(w, invalidQuery, fieldErrors{"cursor": "is invalid"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch audit log"})
+		return
+	}
+	json.NewEncoder(w).Encode(page)
+}
+
+// validAuditEntity reports whether the audit log records changes to entity
+func validAuditEntity(entity string) bool {
+	for _, known := range models.AuditEntities {
+		if entity == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"task_manager_api/database"
+	"task_manager_api/models"
+)
+
+// maxBulkOperations is the most operations one bulk request may contain
+const maxBulkOperations = 1000
+
+// Bulk request modes
+const (
+	bulkAtomic  = "atomic"  // all operations succeed or none are kept
+	bulkPartial = "partial" // each operation succeeds or fails on its own
+)
+
+// bulkRequest is the body of POST /tasks/bulk
+type bulkRequest struct {
+	Mode       string          `json:"mode"`
+	Operations []bulkOperation `json:"operations"`
+}
+
+// bulkOperation is one create, update, patch or delete in a bulk request
+type bulkOperation struct {
+	Op      string          `json:"op"`
+	ID      int             `json:"id"`
+	Version int             `json:"version"` // optional; the operation fails unless the task is at this version
+	Task    models.Task     `json:"task"`    // for create and update
+	Patch   json.RawMessage `json:"patch"`   // JSON Merge Patch, for patch
+	Purge   bool            `json:"purge"`   // delete permanently instead of moving to the trash
+}
+
+// bulkResult reports the outcome of one operation with the status code the
+// equivalent single request would have returned
+type bulkResult struct {
+	Index  int          `json:"index"`
+	Status int          `json:"status"`
+	Task   *models.Task `json:"task,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	Fields fieldErrors  `json:"fields,omitempty"`
+	// Details has what the single request's response would add to the error,
+	// such as the statuses allowed instead or the blockers of a task
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// errBulkOperationFailed rolls back the transaction of an operation that failed
+var errBulkOperationFailed = errors.New("bulk operation failed")
+
+// bulkTasks applies a list of operations in a single transaction
+func (h *TasksHandler) bulkTasks(w http.ResponseWriter, r *http.Request) {
+	var req bulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	// Validate the request as a whole before touching the database
+	errs := fieldErrors{}
+	if req.Mode == "" {
+		req.Mode = bulkAtomic
+	}
+	if req.Mode != bulkAtomic && req.Mode != bulkPartial {
+		errs["mode"] = "must be atomic or partial"
+	}
+	if len(req.Operations) == 0 {
+		errs["operations"] = "must not be empty"
+	} else if len(req.Operations) > maxBulkOperations {
+		errs["operations"] = fmt.Sprintf("must contain at most %d operations", maxBulkOperations)
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, "Invalid request body", errs)
+		return
+	}
+
+	results := make([]bulkResult, len(req.Operations))
+	failed := -1
+	err := h.store.RunInTx(func(tx database.TaskStore) error {
+		for i, op := range req.Operations {
+			if req.Mode == bulkAtomic {
+				// The first failure rolls back the whole transaction
+				results[i] = h.applyBulkOperation(r.Context(), tx, op)
+				results[i].Index = i
+				if results[i].Error != "" {
+					failed = i
+					return errBulkOperationFailed
+				}
+				continue
+			}
+
+			// Each operation gets a savepoint, so a failure only undoes its own writes
+			err := tx.RunInTx(func(savepoint database.TaskStore) error {
+				results[i] = h.applyBulkOperation(r.Context(), savepoint, op)
+				results[i].Index = i
+				if results[i].Error != "" {
+					return errBulkOperationFailed
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, errBulkOperationFailed) {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if failed >= 0 {
+		// Nothing was kept, so report every other operation as not applied
+		for i := range results {
+			if i == failed {
+				continue
+			}
+			results[i] = bulkResult{
+				Index:  i,
+				Status: http.StatusFailedDependency,
+				Error:  fmt.Sprintf("Not applied because operation %d failed", failed),
+			}
+		}
+		// A server error is reported as one, rather than as a problem with the request
+		status := http.StatusUnprocessableEntity
+		if results[failed].Status >= http.StatusInternalServerError {
+			status = http.StatusInternalServerError
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":   fmt.Sprintf("Operation %d failed; no changes were made", failed),
+			"results": results,
+		})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to apply bulk operations"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+}
+
+// applyBulkOperation applies one operation through store on behalf of the user
+// in ctx, validating and authorizing it the same way as the equivalent single request
+func (h *TasksHandler) applyBulkOperation(ctx context.Context, store database.TaskStore, op bulkOperation) bulkResult {
+	if op.Op == "create" {
+		task, terr := newTask(ctx, op.Task)
+		if terr != nil {
+			return terr.result()
+		}
+		createdTask, err := storeNewTask(store, task)
+		if err != nil {
+			return storeTaskError(err, "Failed to create task").result()
+		}
+		return bulkResult{Status: http.StatusCreated, Task: &createdTask}
+	}
+
+	// Every other operation acts on an existing task
+	if op.Op != "update" && op.Op != "patch" && op.Op != "delete" {
+		return bulkResult{Status: http.StatusBadRequest, Error: "op must be create, update, patch or delete"}
+	}
+	existingTask, err := store.GetTaskByID(op.ID)
+	if err != nil && op.Op == "delete" && op.Purge {
+		existingTask, err = store.GetTrashedTask(op.ID)
+	}
+	if err != nil {
+		return bulkResult{Status: http.StatusNotFound, Error: "Task not found"}
+	}
+	if status, message := taskChangeDenied(ctx, existingTask); status != 0 {
+		return bulkResult{Status: status, Error: message}
+	}
+	// A stale version is the conflict the store reports for a change made meanwhile
+	if op.Version != 0 && op.Version != existingTask.Version {
+		return storeTaskError(database.ErrVersionConflict, "").result()
+	}
+
+	if op.Op == "delete" {
+		if err := storeTaskDeletion(store, existingTask, existingTask.Version, op.Purge); err != nil {
+			return storeTaskError(err, "Failed to delete task").result()
+		}
+		return bulkResult{Status: http.StatusOK}
+	}
+
+	task := op.Task
+	if op.Op == "patch" {
+		var patch interface{}
+		if err := json.Unmarshal(op.Patch, &patch); err != nil {
+			return bulkResult{Status: http.StatusBadRequest, Error: "Invalid patch"}
+		}
+
+		var doc map[string]interface{}
+		data, _ := json.Marshal(existingTask)
+		json.Unmarshal(data, &doc)
+
+		var errs fieldErrors
+		if task, errs = taskFromPatch(data, mergePatch(doc, patch)); len(errs) > 0 {
+			return bulkResult{Status: http.StatusBadRequest, Error: "Invalid patch", Fields: errs}
+		}
+	}
+
+	if terr := h.checkTaskChange(store, existingTask, task); terr != nil {
+		return terr.result()
+	}
+
+	task.Version = existingTask.Version
+	updatedTask, err := storeTaskUpdate(store, existingTask, task)
+	if err != nil {
+		return storeTaskError(err, "Failed to update task").result()
+	}
+	return bulkResult{Status: http.StatusOK, Task: &updatedTask}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"task_manager_api/database"
+	"task_manager_api/models"
+	"unicode/utf8"
+)
+
+// listComments retrieves the comments on a task, oldest first
+func (h *TasksHandler) listComments(w http.ResponseWriter, r *http.Request, id int) {
+	comments, err := h.store.ListComments(id)
+	if errors.Is(err, database.ErrTaskNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch comments"})
+		return
+	}
+	json.NewEncoder(w).Encode(comments)
+}
+
+// createComment adds a comment to a task, written by the caller. Anyone who
+// can see a task can comment on it.
+func (h *TasksHandler) createComment(w http.ResponseWriter, r *http.Request, id int) {
+	body, ok := decodeCommentBody(w, r)
+	if !ok {
+		return
+	}
+
+	comment := models.Comment{TaskID: id, Body: body, Author: requestActor(r).Name}
+	if userID, ok := UserIDFromContext(r.Context()); ok {
+		comment.AuthorID = &userID
+	}
+	commentID, err := h.store.CreateComment(comment)
+	if errors.Is(err, database.ErrTaskNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create comment"})
+		return
+	}
+
+	createdComment, err := h.store.GetComment(id, int(commentID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve created comment"})
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createdComment)
+}
+
+// getComment retrieves a single comment on a task
+func (h *TasksHandler) getComment(w http.ResponseWriter, r *http.Request, id int, commentIDStr string) {
+	comment, ok := h.findComment(w, id, commentIDStr)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(comment)
+}
+
+// updateComment replaces the body of one of the caller's comments
+func (h *TasksHandler) updateComment(w http.ResponseWriter, r *http.Request, id int, commentIDStr string) {
+	comment, ok := h.findComment(w, id, commentIDStr)
+	if !ok || !authorizeCommentChange(w, r, comment) {
+		return
+	}
+	body, ok := decodeCommentBody(w, r)
+	if !ok {
+		return
+	}
+
+	comment.Body = body
+	if err := h.store.UpdateComment(comment); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update comment"})
+		return
+	}
+
+	updatedComment, err := h.store.GetComment(id, comment.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve updated comment"})
+		return
+	}
+	json.NewEncoder(w).Encode(updatedComment)
+}
+
+// deleteComment removes one of the caller's comments
+func (h *TasksHandler) deleteComment(w http.ResponseWriter, r *http.Request, id int, commentIDStr string) {
+	comment, ok := h.findComment(w, id, commentIDStr)
+	if !ok || !authorizeCommentChange(w, r, comment) {
+		return
+	}
+
+	if err := h.store.DeleteComment(id, comment.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete comment"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Comment deleted"})
+}
+
+// decodeCommentBody reads the markdown body of a comment from the request,
+// responding with 400 if it is missing or too long
+func decodeCommentBody(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var request struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return "", false
+	}
+
+	switch {
+	case strings.TrimSpace(request.Body) == "":
+		writeFieldErrors(w, "Invalid comment", fieldErrors{"body": "is required"})
+		return "", false
+	case utf8.RuneCountInString(request.Body) > models.MaxCommentLength:
+		writeFieldErrors(w, "Invalid comment", fieldErrors{"body": "must be at most " + strconv.Itoa(models.MaxCommentLength) + " characters"})
+		return "", false
+	}
+	return request.Body, true
+}
+
+// authorizeCommentChange responds with 403 and returns false unless the caller
+// wrote comment; only its author may edit or delete a comment
+func authorizeCommentChange(w http.ResponseWriter, r *http.Request, comment models.Comment) bool {
+	if comment.Author == requestActor(r).Name {
+		return true
+	}
+
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{"error": "Only the comment's author can change it"})
+	return false
+}
+
+// findComment looks up the comment with the ID in commentIDStr on a task,
+// responding with 400 or 404 if it is invalid or doesn't exist
+func (h *TasksHandler) findComment(w http.ResponseWriter, id int, commentIDStr string) (models.Comment, bool) {
+	commentID, err := strconv.Atoi(commentIDStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid comment ID"})
+		return models.Comment{}, false
+	}
+
+	comment, err := h.store.GetComment(id, commentID)
+	switch {
+	case errors.Is(err, database.ErrTaskNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		return comment, false
+	case errors.Is(err, database.ErrCommentNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Comment not found"})
+		return comment, false
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch comment"})
+		return comment, false
+	}
+	return comment, true
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"task_manager_api/database"
+	"task_manager_api/models"
+)
+
+// parentNotFound explains a parent_id the store rejected
+const parentNotFound = "must be the ID of a task that isn't in the trash"
+
+// getSubtasks lists the subtasks of a task, oldest first
+func (h *TasksHandler) getSubtasks(w http.ResponseWriter, r *http.Request, id int) {
+	subtasks, err := h.store.GetSubtasks(id)
+	if errors.Is(err, database.ErrTaskNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch subtasks"})
+		return
+	}
+	json.NewEncoder(w).Encode(subtasks)
+}
+
+// getBlockers lists the tasks that have to be completed before a task can be
+func (h *TasksHandler) getBlockers(w http.ResponseWriter, r *http.Request, id int) {
+	blockers, err := h.store.GetBlockers(id)
+	if errors.Is(err, database.ErrTaskNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch blockers"})
+		return
+	}
+	json.NewEncoder(w).Encode(blockers)
+}
+
+// addBlocker makes the task in the request body a blocker of a task and
+// responds with the task's blockers
+func (h *TasksHandler) addBlocker(w http.ResponseWriter, r *http.Request, id int) {
+	if !h.authorizeTaskChangeByID(w, r, id) {
+		return
+	}
+
+	var body struct {
+		BlockerID int `json:"blocker_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if body.BlockerID == 0 {
+		writeFieldErrors(w, "Invalid request body", fieldErrors{"blocker_id": "is required"})
+		return
+	}
+
+	err := h.store.AddDependency(body.BlockerID, id)
+	var cycle *database.CycleError
+	switch {
+	case errors.As(err, &cycle):
+		cycleError("Dependency would create a cycle; each task in the cycle blocks the next", cycle).write(w)
+		return
+	case errors.Is(err, database.ErrTaskNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to add blocker"})
+		return
+	}
+
+	blockers, err := h.store.GetBlockers(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch blockers"})
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(blockers)
+}
+
+// removeBlocker removes the dependency of a task on one of its blockers
+func (h *TasksHandler) removeBlocker(w http.ResponseWriter, r *http.Request, id int, blockerIDStr string) {
+	blockerID, err := strconv.Atoi(blockerIDStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid blocker ID"})
+		return
+	}
+	if !h.authorizeTaskChangeByID(w, r, id) {
+		return
+	}
+
+	err = h.store.RemoveDependency(blockerID, id)
+	if errors.Is(err, database.ErrDependencyNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Dependency not found"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to remove blocker"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Blocker removed"})
+}
+
+// completionBlockers returns the IDs of the blockers and subtasks that keep an
+// update from completing a task: those that aren't completed themselves.
+// Both are empty unless the update moves the task to completed.
+func completionBlockers(store database.TaskStore, existingTask, task models.Task) (blockers, subtasks []int, err error) {
+	if task.Status != models.StatusCompleted || existingTask.Status == models.StatusCompleted {
+		return nil, nil, nil
+	}
+
+	blockerTasks, err := store.GetBlockers(existingTask.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, blocker := range blockerTasks {
+		if blocker.Status != models.StatusCompleted {
+			blockers = append(blockers, blocker.ID)
+		}
+	}
+
+	subtaskTasks, err := store.GetSubtasks(existingTask.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, subtask := range subtaskTasks {
+		if subtask.Status != models.StatusCompleted {
+			subtasks = append(subtasks, subtask.ID)
+		}
+	}
+
+	return blockers, subtasks, nil
+}
+
+// blockedCompletion is the 422 error with the IDs of the open blockers and
+// incomplete subtasks that keep a task from being completed
+func blockedCompletion(blockers, subtasks []int) *taskError {
+	if blockers == nil {
+		blockers = []int{}
+	}
+	if subtasks == nil {
+		subtasks = []int{}
+	}
+	return &taskError{
+		status:  http.StatusUnprocessableEntity,
+		message: "Task cannot be completed while it has open blockers or incomplete subtasks",
+		details: map[string]interface{}{"blockers": blockers, "subtasks": subtasks},
+	}
+}
+
+// cycleError is the 422 error with the IDs of the tasks around the cycle
+func cycleError(message string, cycle *database.CycleError) *taskError {
+	return &taskError{
+		status:  http.StatusUnprocessableEntity,
+		message: message,
+		details: map[string]interface{}{"cycle": cycle.Path},
+	}
+}
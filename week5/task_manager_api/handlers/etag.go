@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"task_manager_api/models"
+)
+
+// taskETag returns the entity tag of a task's current version
+func taskETag(task models.Task) string {
+	return `"` + strconv.Itoa(task.Version) + `"`
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists etag.
+// If-None-Match uses weak comparison, so weak allows W/ tags to match.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch enforces the request's If-Match header against the task's current version.
+// It responds with 412 and returns false if the precondition fails.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, task models.Task) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" || etagMatches(header, taskETag(task), false) {
+		return true
+	}
+
+	w.Header().Set("ETag", taskETag(task))
+	w.WriteHeader(http.StatusPreconditionFailed)
+	json.NewEncoder(w).Encode(map[string]string{"error": "Task has been modified; fetch it again and retry"})
+	return false
+}
+
+// writeVersionConflict responds to a task that changed between reading and writing it.
+// Requests with If-Match get 412 like any other failed precondition; others get 409.
+func writeVersionConflict(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("If-Match") != "" {
+		w.WriteHeader(http.StatusPreconditionFailed)
+	} else {
+		w.WriteHeader(http.StatusConflict)
+	}
+	json.NewEncoder(w).Encode(map[string]string{"error": "Task has been modified; fetch it again and retry"})
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"task_manager_api/database"
+	"time"
+)
+
+// eventHeartbeat is how often an idle event stream sends a comment, so proxies keep it open
+var eventHeartbeat = 15 * time.Second
+
+// eventRetry is how long clients wait before reconnecting to a dropped stream, in milliseconds
+const eventRetry = 3000
+
+// streamEvents streams task changes as Server-Sent Events until the client
+// disconnects. A client resuming with Last-Event-ID first gets the events it
+// missed; if the log no longer has them it gets a "reset" event, meaning it
+// should fetch the tasks again. The status, tag and tag_mode parameters of
+// GET /tasks filter the events by their task.
+func (h *TasksHandler) streamEvents(w http.ResponseWriter, r *http.Request) {
+	query, errs := parseTaskFilter(r.URL.Query())
+	lastID := h.store.Events().LastID()
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	if value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id < 0 {
+			errs["Last-Event-ID"] = "must be the ID of an event"
+		}
+		lastID = id
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, invalidQuery, errs)
+		return
+	}
+	filter := database.EventFilter{Statuses: query.Statuses, Tags: query.Tags, TagMode: query.TagMode}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Streaming is not supported"})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetry)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		events, changed, ok := h.store.Events().Since(lastID)
+		if !ok {
+			// Skip to the latest event; the client reloads instead of replaying
+			if len(events) > 0 {
+				lastID = events[len(events)-1].ID
+			} else {
+				lastID = h.store.Events().LastID()
+			}
+			fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {}\n\n", lastID)
+			events = nil
+		}
+		for _, event := range events {
+			lastID = event.ID
+			if !filter.Matches(event) {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Event, data)
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
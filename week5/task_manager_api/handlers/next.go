@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"task_manager_api/models"
+	"time"
+)
+
+// defaultNextLimit is how many tasks GET /tasks/next suggests without a limit
+const defaultNextLimit = 10
+
+// nextTasks ranks the tasks matching the same filters as GET /tasks by how
+// pressing they are, highest score first, with the breakdown of each score.
+// Without a status filter every task that isn't completed is ranked. sort,
+// order and cursor are ignored, and limit caps how many tasks are returned.
+func (h *TasksHandler) nextTasks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	query.Del("sort")
+	query.Del("order")
+	query.Del("cursor")
+	filter, errs := parseTaskFilter(query)
+	if len(errs) > 0 {
+		writeFieldErrors(w, invalidQuery, errs)
+		return
+	}
+	limit := filter.Limit
+	if query.Get("limit") == "" {
+		limit = defaultNextLimit
+	}
+	if len(filter.Statuses) == 0 {
+		for _, status := range models.Statuses {
+			if status != models.StatusCompleted {
+				filter.Statuses = append(filter.Statuses, status)
+			}
+		}
+	}
+
+	// Every candidate has to be scored before the best can be picked
+	var tasks []models.Task
+	filter.Limit = exportPageSize
+	for {
+		page, err := h.store.ListTasks(filter)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch tasks"})
+			return
+		}
+		tasks = append(tasks, page.Tasks...)
+		if page.NextCursor == "" {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+
+	dependencies, err := h.store.OpenDependencies()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch dependencies"})
+		return
+	}
+	blocks := map[int]int{}
+	blockedBy := map[int]int{}
+	for _, dependency := range dependencies {
+		blocks[dependency.BlockerID]++
+		blockedBy[dependency.BlockedID]++
+	}
+
+	now := time.Now().UTC()
+	ranked := make([]models.RankedTask, len(tasks))
+	for i, task := range tasks {
+		ranked[i] = models.ScoreTask(task, blocks[task.ID], blockedBy[task.ID], h.weights, now)
+	}
+	models.SortRankedTasks(ranked)
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"weights": h.weights, "tasks": ranked})
+}
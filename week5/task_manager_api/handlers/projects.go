@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"task_manager_api/database"
+	"task_manager_api/models"
+)
+
+// projectNotFound explains a project_id the store rejected
+const projectNotFound = "must be the ID of an existing project"
+
+// invalidPosition explains a position that isn't one; clients should only send positions the API gave them
+const invalidPosition = "must be a position given to a task on a board"
+
+// ProjectsHandler serves the /projects endpoints using the TaskStore it was created with
+type ProjectsHandler struct {
+	store database.TaskStore
+}
+
+// NewProjectsHandler creates a ProjectsHandler that reads and writes projects through store
+func NewProjectsHandler(store database.TaskStore) *ProjectsHandler {
+	return &ProjectsHandler{store: store}
+}
+
+// ServeHTTP handles all requests to the /projects endpoint
+func (h *ProjectsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Paths are /projects, /projects/{id}, /projects/{id}/board and /projects/{id}/tasks
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/projects"), "/"), "/")
+	switch {
+	case parts[0] == "" && r.Method == http.MethodGet:
+		h.listProjects(w, r)
+	case parts[0] == "" && r.Method == http.MethodPost:
+		h.createProject(w, r)
+	case len(parts) == 1 && parts[0] != "" && r.Method == http.MethodGet:
+		h.getProject(w, r, parts[0])
+	case len(parts) == 1 && parts[0] != "" && r.Method == http.MethodPut:
+		h.updateProject(w, r, parts[0])
+	case len(parts) == 1 && parts[0] != "" && r.Method == http.MethodDelete:
+		h.deleteProject(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "board" && r.Method == http.MethodGet:
+		h.getBoard(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "tasks" && r.Method == http.MethodGet:
+		h.getProjectTasks(w, r, parts[0])
+	case len(parts) > 2 || (len(parts) == 2 && parts[1] != "board" && parts[1] != "tasks"):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Not found"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+	}
+}
+
+// listProjects retrieves every project, oldest first
+func (h *ProjectsHandler) listProjects(w http.ResponseWriter, r *http.Request) {
+	projects, err := h.store.ListProjects()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch projects"})
+		return
+	}
+	json.NewEncoder(w).Encode(projects)
+}
+
+// createProject adds a new project, with a column per status unless the request lists its columns
+func (h *ProjectsHandler) createProject(w http.ResponseWriter, r *http.Request) {
+	project, ok := decodeProject(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := h.store.CreateProject(project)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create project"})
+		return
+	}
+
+	createdProject, err := h.store.GetProject(int(id))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve created project"})
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createdProject)
+}
+
+// getProject retrieves a single project by ID
+func (h *ProjectsHandler) getProject(w http.ResponseWriter, r *http.Request, idStr string) {
+	project, ok := h.findProject(w, idStr)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(project)
+}
+
+// updateProject replaces a project's name, description and columns. Its tasks
+// keep their statuses and positions; those whose status loses its column are
+// left off the board until it gets one again.
+func (h *ProjectsHandler) updateProject(w http.ResponseWriter, r *http.Request, idStr string) {
+	existingProject, ok := h.findProject(w, idStr)
+	if !ok {
+		return
+	}
+	project, ok := decodeProject(w, r)
+	if !ok {
+		return
+	}
+
+	project.ID = existingProject.ID
+	if err := h.store.UpdateProject(project); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update project"})
+		return
+	}
+
+	updatedProject, err := h.store.GetProject(project.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve updated project"})
+		return
+	}
+	json.NewEncoder(w).Encode(updatedProject)
+}
+
+// deleteProject removes a project that has no tasks left, in the trash or not
+func (h *ProjectsHandler) deleteProject(w http.ResponseWriter, r *http.Request, idStr string) {
+	project, ok := h.findProject(w, idStr)
+	if !ok {
+		return
+	}
+
+	err := h.store.DeleteProject(project.ID)
+	if errors.Is(err, database.ErrProjectNotEmpty) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "The project still has tasks; move or purge them first"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete project"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Project deleted"})
+}
+
+// getBoard retrieves a project's tasks grouped into its columns, each in board order
+func (h *ProjectsHandler) getBoard(w http.ResponseWriter, r *http.Request, idStr string) {
+	project, ok := h.findProject(w, idStr)
+	if !ok {
+		return
+	}
+
+	tasks, err := h.store.ProjectTasks(project.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch tasks"})
+		return
+	}
+	json.NewEncoder(w).Encode(models.NewBoard(project, tasks))
+}
+
+// getProjectTasks retrieves one page of a project's tasks, accepting the same
+// query parameters as GET /tasks
+func (h *ProjectsHandler) getProjectTasks(w http.ResponseWriter, r *http.Request, idStr string) {
+	project, ok := h.findProject(w, idStr)
+	if !ok {
+		return
+	}
+
+	writeTaskList(w, r, h.store, func(filter *database.TaskFilter) {
+		filter.ProjectID = project.ID
+	})
+}
+
+// decodeProject reads a project from the request, responding with 400 if it is
+// invalid. A project without columns gets the default ones.
+func decodeProject(w http.ResponseWriter, r *http.Request) (models.Project, bool) {
+	var project models.Project
+	if err := json.NewDecoder(r.Body).Decode(&project); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return project, false
+	}
+
+	project.Name = strings.TrimSpace(project.Name)
+	if len(project.Columns) == 0 {
+		project.Columns = models.DefaultColumns()
+	}
+
+	errs := fieldErrors{}
+	if project.Name == "" {
+		errs["name"] = "is required"
+	}
+	seen := map[models.Status]bool{}
+	for i := range project.Columns {
+		column := &project.Columns[i]
+		column.Name = strings.TrimSpace(column.Name)
+		switch {
+		case column.Name == "":
+			errs["columns"] = "must each have a name"
+		case !column.Status.Valid():
+			errs["columns"] = "must each have a status, one of " + statusList()
+		case seen[column.Status]:
+			errs["columns"] = "must each have a different status"
+		}
+		seen[column.Status] = true
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, "Invalid project", errs)
+		return project, false
+	}
+	return project, true
+}
+
+// findProject looks up the project with the ID in the path, responding with 400 or 404 if there is none
+func (h *ProjectsHandler) findProject(w http.ResponseWriter, idStr string) (models.Project, bool) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid project ID"})
+		return models.Project{}, false
+	}
+
+	project, err := h.store.GetProject(id)
+	if errors.Is(err, database.ErrProjectNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Project not found"})
+		return project, false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch project"})
+		return project, false
+	}
+	return project, true
+}
+
+// moveTask places a task on its project's board: in the column for status, if
+// given, right after the task after_id or right before before_id, or at the end
+// of the column with neither. Only the moved task changes. Moving it to another
+// column changes its status, which has to follow the workflow like any other.
+func (h *TasksHandler) moveTask(w http.ResponseWriter, r *http.Request, id int) {
+	var request struct {
+		Status   models.Status `json:"status"`
+		AfterID  *int          `json:"after_id"`
+		BeforeID *int          `json:"before_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+	errs := fieldErrors{}
+	if request.Status != "" && !request.Status.Valid() {
+		errs["status"] = "must be one of " + statusList()
+	}
+	if request.AfterID != nil && request.BeforeID != nil {
+		errs["before_id"] = "cannot be given with after_id"
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, "Invalid move", errs)
+		return
+	}
+
+	existingTask, err := h.store.GetTaskByID(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		return
+	}
+	if !authorizeTaskChange(w, r, existingTask) || !checkIfMatch(w, r, existingTask) {
+		return
+	}
+	if existingTask.ProjectID == nil {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task is not in a project; set its project_id first"})
+		return
+	}
+
+	task := existingTask
+	if request.Status != "" {
+		task.Status = request.Status
+	}
+	tasks, err := h.store.ProjectTasks(*task.ProjectID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch tasks"})
+		return
+	}
+	var column []models.Task
+	for _, other := range tasks {
+		if other.Status == task.Status && other.ID != id {
+			column = append(column, other)
+		}
+	}
+
+	position, errs := columnPosition(column, request.AfterID, request.BeforeID)
+	if len(errs) > 0 {
+		writeFieldErrors(w, "Invalid move", errs)
+		return
+	}
+	if position == "" {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to position task"})
+		return
+	}
+	task.Position = position
+	h.replaceTask(w, r, existingTask, task)
+}
+
+// columnPosition returns the position that places a task in column, whose
+// tasks are in board order, right after the task afterID, right before the
+// task beforeID, or at the end with neither. It returns "" if positions have
+// run out, which takes an absurd number of moves to the same end.
+func columnPosition(column []models.Task, afterID, beforeID *int) (string, fieldErrors) {
+	index := len(column)
+	if afterID != nil || beforeID != nil {
+		field, neighbor, offset := "after_id", afterID, 1
+		if beforeID != nil {
+			field, neighbor, offset = "before_id", beforeID, 0
+		}
+		index = -1
+		for i, task := range column {
+			if task.ID == *neighbor {
+				index = i + offset
+			}
+		}
+		if index < 0 {
+			return "", fieldErrors{field: "must be another task in the column the task moves to"}
+		}
+	}
+
+	// Tasks with the same position sort by ID, and there's no room between them,
+	// so the new position goes between the previous task and the first one after it
+	before, after := "", ""
+	if index > 0 {
+		before = column[index-1].Position
+	}
+	for _, task := range column[index:] {
+		if task.Position > before {
+			after = task.Position
+			break
+		}
+	}
+	position, err := models.PositionBetween(before, after)
+	if err != nil {
+		return "", nil
+	}
+	return position, nil
+}
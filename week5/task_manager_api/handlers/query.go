@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"task_manager_api/database"
+	"task_manager_api/models"
+	"time"
+)
+
+// Page size limits for list endpoints
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// fieldErrors maps a request field to an explanation of what is wrong with it
+type fieldErrors map[string]string
+
+// writeFieldErrors responds with 400, a summary message and the explanation for each invalid field
+func writeFieldErrors(w http.ResponseWriter, message string, errs fieldErrors) {
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  message,
+		"fields": errs,
+	})
+}
+
+// invalidQuery is the summary message for invalid query parameters
+const invalidQuery = "Invalid query parameters"
+
+// statusList returns the valid statuses as a comma-separated list
+func statusList() string {
+	names := make([]string, len(models.Statuses))
+	for i, status := range models.Statuses {
+		names[i] = string(status)
+	}
+	return strings.Join(names, ", ")
+}
+
+// priorityList names every priority, for validation messages
+func priorityList() string {
+	names := make([]string, len(models.Priorities))
+	for i, priority := range models.Priorities {
+		names[i] = string(priority)
+	}
+	return strings.Join(names, ", ")
+}
+
+// invalidTags explains the rules validTags enforces
+var invalidTags = fmt.Sprintf("each tag must be 1 to %d characters without commas", models.MaxTagLength)
+
+// validTags reports whether every tag is valid once normalized
+func validTags(tags []string) bool {
+	for _, tag := range models.NormalizeTags(tags) {
+		if !models.ValidTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTime accepts either a full RFC 3339 timestamp or a plain date
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// parseTaskFilter reads the list query parameters into a TaskFilter,
+// collecting an explanation for every parameter that is invalid
+func parseTaskFilter(query url.Values) (database.TaskFilter, fieldErrors) {
+	filter := database.TaskFilter{
+		Sort:   query.Get("sort"),
+		Order:  query.Get("order"),
+		Cursor: query.Get("cursor"),
+	}
+	errs := fieldErrors{}
+
+	for _, value := range query["status"] {
+		status := models.Status(value)
+		if !status.Valid() {
+			errs["status"] = "must be one of " + statusList()
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+
+	if value := query.Get("due_before"); value != "" {
+		t, err := parseTime(value)
+		if err != nil {
+			errs["due_before"] = "must be an RFC 3339 timestamp or a YYYY-MM-DD date"
+		}
+		filter.DueBefore = t
+	}
+
+	if value := query.Get("due_after"); value != "" {
+		t, err := parseTime(value)
+		if err != nil {
+			errs["due_after"] = "must be an RFC 3339 timestamp or a YYYY-MM-DD date"
+		}
+		filter.DueAfter = t
+	}
+
+	filter.Tags = query["tag"]
+	if !validTags(filter.Tags) {
+		errs["tag"] = invalidTags
+	}
+
+	filter.TagMode = query.Get("tag_mode")
+	switch filter.TagMode {
+	case "", database.TagModeAll, database.TagModeAny:
+	default:
+		errs["tag_mode"] = "must be all or any"
+	}
+
+	switch filter.Sort {
+	case "", database.SortCreatedAt, database.SortUpdatedAt, database.SortDueDate, database.SortTitle, database.SortDeletedAt:
+	default:
+		errs["sort"] = "must be one of created_at, updated_at, due_date, title, deleted_at"
+	}
+
+	switch filter.Order {
+	case "", database.OrderAsc, database.OrderDesc:
+	default:
+		errs["order"] = "must be asc or desc"
+	}
+
+	filter.Limit = parseLimit(query, errs)
+
+	return filter, errs
+}
+
+// parseLimit reads the page size, defaulting to defaultPageLimit
+func parseLimit(query url.Values, errs fieldErrors) int {
+	value := query.Get("limit")
+	if value == "" {
+		return defaultPageLimit
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		errs["limit"] = "must be an integer between 1 and " + strconv.Itoa(maxPageLimit)
+	}
+	return limit
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"task_manager_api/database"
+	"task_manager_api/models"
+)
+
+// seriesFields are the fields a patch can change across a whole series;
+// status and due date belong to each occurrence
+var seriesFields = map[string]bool{"title": true, "description": true, "recurrence": true, "tags": true, "assignee_id": true}
+
+// validRecurrence explains why a task's recurrence rule is invalid, or returns "" if it is valid
+func validRecurrence(rule string) string {
+	if _, err := models.NormalizeRecurrence(rule); err != nil {
+		return "must be an RRULE using FREQ, INTERVAL, BYDAY, BYMONTHDAY, COUNT and UNTIL: " + err.Error()
+	}
+	return ""
+}
+
+// getSeries lists the occurrences of a task's recurring series, oldest first
+func (h *TasksHandler) getSeries(w http.ResponseWriter, r *http.Request, id int) {
+	series, ok := h.findSeries(w, id)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(series)
+}
+
+// patchSeries applies a JSON Merge Patch of seriesFields to every occurrence
+// of a task's series that isn't completed, and responds with the series
+func (h *TasksHandler) patchSeries(w http.ResponseWriter, r *http.Request, id int) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mergePatchType {
+		w.Header().Set("Accept-Patch", mergePatchType)
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Content-Type must be " + mergePatchType})
+		return
+	}
+
+	var patch map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+	errs := fieldErrors{}
+	for key := range patch {
+		if !seriesFields[key] {
+			errs[key] = "can't be changed for a whole series"
+		}
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, "Invalid patch", errs)
+		return
+	}
+
+	h.updateSeries(w, r, id, patch)
+}
+
+// stopSeries clears the recurrence of every occurrence of a task's series that
+// isn't completed, so completing them creates no more, and responds with the series
+func (h *TasksHandler) stopSeries(w http.ResponseWriter, r *http.Request, id int) {
+	h.updateSeries(w, r, id, map[string]interface{}{"recurrence": ""})
+}
+
+// updateSeries applies a merge patch to the open occurrences of a task's series in
+// one transaction. Every occurrence must pass the checks a PATCH of it alone would.
+func (h *TasksHandler) updateSeries(w http.ResponseWriter, r *http.Request, id int, patch map[string]interface{}) {
+	series, ok := h.findSeries(w, id)
+	if !ok {
+		return
+	}
+
+	// Check every change before writing any
+	updates := map[int]models.Task{}
+	for _, occurrence := range series {
+		if occurrence.Status == models.StatusCompleted {
+			continue
+		}
+		if !authorizeTaskChange(w, r, occurrence) {
+			return
+		}
+
+		var doc map[string]interface{}
+		data, _ := json.Marshal(occurrence)
+		json.Unmarshal(data, &doc)
+
+		task, errs := taskFromPatch(data, mergePatch(doc, patch))
+		if len(errs) == 0 {
+			errs = validateTask(task)
+		}
+		if len(errs) > 0 {
+			writeFieldErrors(w, "Invalid patch", errs)
+			return
+		}
+		task.Version = occurrence.Version
+		updates[occurrence.ID] = task
+	}
+
+	err := h.store.RunInTx(func(store database.TaskStore) error {
+		for _, occurrence := range series {
+			if task, ok := updates[occurrence.ID]; ok {
+				if _, err := storeTaskUpdate(store, occurrence, task); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, database.ErrVersionConflict) || errors.Is(err, database.ErrTaskNotFound) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "The series has been modified; fetch it again and retry"})
+		return
+	}
+	if errors.Is(err, database.ErrUserNotFound) {
+		writeFieldErrors(w, "Invalid patch", fieldErrors{"assignee_id": assigneeNotFound})
+		return
+	}
+	if errors.Is(err, database.ErrProjectNotFound) {
+		writeFieldErrors(w, "Invalid patch", fieldErrors{"project_id": projectNotFound})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update series"})
+		return
+	}
+
+	h.getSeries(w, r, id)
+}
+
+// findSeries looks up the series of a task, responding with 404 if there is no such task or series
+func (h *TasksHandler) findSeries(w http.ResponseWriter, id int) ([]models.Task, bool) {
+	series, err := h.store.GetSeries(id)
+	if errors.Is(err, database.ErrTaskNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		return nil, false
+	}
+	if errors.Is(err, database.ErrNoSeries) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task is not part of a recurring series"})
+		return nil, false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch series"})
+		return nil, false
+	}
+	return series, true
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"task_manager_api/database"
+)
+
+// reportGroupings are the values group_by accepts
+var reportGroupings = []string{database.GroupByTask, database.GroupByDay, database.GroupByStatus}
+
+// ReportsHandler serves the /reports endpoints using the TaskStore it was created with
+type ReportsHandler struct {
+	store database.TaskStore
+}
+
+// NewReportsHandler creates a ReportsHandler that reads time entries through store
+func NewReportsHandler(store database.TaskStore) *ReportsHandler {
+	return &ReportsHandler{store: store}
+}
+
+// ServeHTTP routes /reports/time to the time report
+func (h *ReportsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.URL.Path != "/reports/time" {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Not found"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+		return
+	}
+	h.timeReport(w, r)
+}
+
+// timeReport totals the time tracked on tasks. from and to select the entries
+// started in a time range, group_by totals them per task, day or status, and
+// tracked_by selects one caller's entries. Running timers aren't counted.
+func (h *ReportsHandler) timeReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := database.TimeReportFilter{GroupBy: query.Get("group_by"), TrackedBy: query.Get("tracked_by")}
+	errs := fieldErrors{}
+
+	if value := query.Get("from"); value != "" {
+		t, err := parseTime(value)
+		if err != nil {
+			errs["from"] = "must be an RFC 3339 timestamp or a YYYY-MM-DD date"
+		}
+		filter.From = t
+	}
+	if value := query.Get("to"); value != "" {
+		t, err := parseTime(value)
+		if err != nil {
+			errs["to"] = "must be an RFC 3339 timestamp or a YYYY-MM-DD date"
+		} else if !filter.From.IsZero() && !t.After(filter.From) {
+			errs["to"] = "must be after from"
+		}
+		filter.To = t
+	}
+	if filter.GroupBy == "" {
+		filter.GroupBy = database.GroupByTask
+	}
+	if !validGrouping(filter.GroupBy) {
+		errs["group_by"] = "must be one of " + strings.Join(reportGroupings, ", ")
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, invalidQuery, errs)
+		return
+	}
+
+	report, err := h.store.TimeReport(filter)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to build time report"})
+		return
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// validGrouping reports whether a time report can be grouped by groupBy
+func validGrouping(groupBy string) bool {
+	for _, known := range reportGroupings {
+		if groupBy == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader carries the ID of a request. A client may choose it; otherwise
+// one is generated. Either way it is echoed in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the longest request ID a client may choose
+const maxRequestIDLength = 128
+
+// contextKey is the type of the request context keys set by this package
+type contextKey int
+
+// requestIDKey holds the ID of a request
+const requestIDKey contextKey = iota
+
+// RequestID gives every request an ID before calling next, so its changes can
+// be traced in the audit log and the logs of whoever sent it
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// RequestIDFromContext returns the ID RequestID gave the request, or "" if it didn't run
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// validRequestID reports whether a client-chosen request ID is short printable ASCII
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit ID in hex
+func newRequestID() string {
+	b := make([]byte, 16)
+	// Unlike a secret, an ID only needs to be unlikely to repeat, so a failed read isn't fatal
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"task_manager_api/database"
+)
+
+// TagsHandler serves the /tags endpoint using the TaskStore it was created with
+type TagsHandler struct {
+	store database.TaskStore
+}
+
+// NewTagsHandler creates a TagsHandler that reads tags through store
+func NewTagsHandler(store database.TaskStore) *TagsHandler {
+	return &TagsHandler{store: store}
+}
+
+// ServeHTTP lists every tag in use with the number of tasks that have it
+func (h *TagsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	tags, err := h.store.ListTags()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch tags"})
+		return
+	}
+	json.NewEncoder(w).Encode(tags)
+}
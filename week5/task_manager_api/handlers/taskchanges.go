@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"task_manager_api/database"
+	"task_manager_api/models"
+	"time"
+)
+
+// taskError explains why a task can't be created or changed: the status code and
+// message to respond with, the invalid fields if any, and other details a client
+// can act on, such as the statuses the task may move to instead
+type taskError struct {
+	status  int
+	message string
+	fields  fieldErrors
+	details map[string]interface{}
+}
+
+// invalidTask is the error for a task with invalid fields
+func invalidTask(errs fieldErrors) *taskError {
+	return &taskError{status: http.StatusBadRequest, message: "Invalid task", fields: errs}
+}
+
+// write responds with the error, its details as members of the response body
+func (e *taskError) write(w http.ResponseWriter) {
+	body := map[string]interface{}{"error": e.message}
+	if e.fields != nil {
+		body["fields"] = e.fields
+	}
+	for name, value := range e.details {
+		body[name] = value
+	}
+	w.WriteHeader(e.status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// result reports the error as the outcome of a bulk operation
+func (e *taskError) result() bulkResult {
+	return bulkResult{Status: e.status, Error: e.message, Fields: e.fields, Details: e.details}
+}
+
+// storeTaskError explains an error from storing a new or changed task. Errors the
+// client can't fix are reported with failed as the message.
+func storeTaskError(err error, failed string) *taskError {
+	var cycle *database.CycleError
+	switch {
+	case errors.Is(err, database.ErrParentNotFound):
+		return invalidTask(fieldErrors{"parent_id": parentNotFound})
+	case errors.Is(err, database.ErrUserNotFound):
+		return invalidTask(fieldErrors{"assignee_id": assigneeNotFound})
+	case errors.Is(err, database.ErrProjectNotFound):
+		return invalidTask(fieldErrors{"project_id": projectNotFound})
+	case errors.As(err, &cycle):
+		return cycleError("A task cannot be a subtask of itself or of its own subtasks", cycle)
+	case errors.Is(err, database.ErrVersionConflict):
+		return &taskError{status: http.StatusConflict, message: "Task has been modified; fetch it again and retry"}
+	case errors.Is(err, database.ErrTaskNotFound):
+		return &taskError{status: http.StatusNotFound, message: "Task not found"}
+	}
+	return &taskError{status: http.StatusInternalServerError, message: failed}
+}
+
+// newTask prepares a task sent by the user in ctx to be created: it fills in the
+// default status and checks every field, then makes the user its owner and the
+// task the start of its own series if it recurs. Anonymous callers create tasks
+// anyone can change.
+func newTask(ctx context.Context, task models.Task) (models.Task, *taskError) {
+	if task.Status == "" {
+		task.Status = models.StatusPending
+	}
+	if errs := validateTask(task); len(errs) > 0 {
+		return task, invalidTask(errs)
+	}
+
+	now := time.Now()
+	task.CreatedAt = now
+	task.UpdatedAt = now
+	task.SeriesID = nil
+	task.CreatedBy = nil
+	if userID, ok := UserIDFromContext(ctx); ok {
+		task.CreatedBy = &userID
+	}
+	return task, nil
+}
+
+// checkTaskChange explains why existingTask can't be replaced by task: an invalid
+// field, a status change the workflow doesn't allow, or completing the task while
+// it has open blockers or incomplete subtasks
+func (h *TasksHandler) checkTaskChange(store database.TaskStore, existingTask, task models.Task) *taskError {
+	if errs := validateTask(task); len(errs) > 0 {
+		return invalidTask(errs)
+	}
+
+	// Status changes must follow the workflow
+	if !h.workflow.CanTransition(existingTask.Status, task.Status) {
+		return illegalTransition(h.workflow, existingTask.Status, task.Status)
+	}
+
+	// Completing a task has to wait for its blockers and subtasks
+	blockers, subtasks, err := completionBlockers(store, existingTask, task)
+	if err != nil {
+		return &taskError{status: http.StatusInternalServerError, message: "Failed to check task dependencies"}
+	}
+	if len(blockers) > 0 || len(subtasks) > 0 {
+		return blockedCompletion(blockers, subtasks)
+	}
+	return nil
+}
+
+// storeNewTask creates task through store, which should be a transaction, and
+// queues task.created for it. It returns the task as stored.
+func storeNewTask(store database.TaskStore, task models.Task) (models.Task, error) {
+	id, err := store.CreateTask(task)
+	if err != nil {
+		return models.Task{}, err
+	}
+	createdTask, err := store.GetTaskByID(int(id))
+	if err != nil {
+		return models.Task{}, err
+	}
+	if err := emitTaskEvent(store, models.EventTaskCreated, createdTask); err != nil {
+		return models.Task{}, err
+	}
+	return createdTask, nil
+}
+
+// storeTaskDeletion moves task to the trash, or removes it for good if purge is
+// set, through store, which should be a transaction, and queues task.deleted for
+// it. A non-zero version must be the task's current one.
+func storeTaskDeletion(store database.TaskStore, task models.Task, version int, purge bool) error {
+	remove := store.DeleteTask
+	if purge {
+		remove = store.PurgeTask
+	}
+	if err := remove(task.ID, version); err != nil {
+		return err
+	}
+	return emitTaskEvent(store, models.EventTaskDeleted, task)
+}
+
+// storeTaskUpdate stores task in place of existingTask through store, which
+// should be a transaction, and queues the events for the change: the update
+// itself and task.created for the next occurrence that completing a recurring
+// task creates. It returns the task as stored.
+func storeTaskUpdate(store database.TaskStore, existingTask, task models.Task) (models.Task, error) {
+	// An occurrence already in the series wasn't created by this update
+	completing := task.Status == models.StatusCompleted && existingTask.Status != models.StatusCompleted
+	earlier := map[int]bool{}
+	if completing {
+		series, err := store.GetSeries(existingTask.ID)
+		if err != nil && !errors.Is(err, database.ErrNoSeries) {
+			return models.Task{}, err
+		}
+		for _, occurrence := range series {
+			earlier[occurrence.ID] = true
+		}
+	}
+
+	if err := store.UpdateTask(existingTask.ID, task); err != nil {
+		return models.Task{}, err
+	}
+	updatedTask, err := store.GetTaskByID(existingTask.ID)
+	if err != nil {
+		return models.Task{}, err
+	}
+	if err := emitTaskEvent(store, updateEvent(existingTask, updatedTask), updatedTask); err != nil {
+		return models.Task{}, err
+	}
+	if !completing {
+		return updatedTask, nil
+	}
+
+	series, err := store.GetSeries(existingTask.ID)
+	if errors.Is(err, database.ErrNoSeries) {
+		return updatedTask, nil
+	}
+	if err != nil {
+		return models.Task{}, err
+	}
+	for _, occurrence := range series {
+		if occurrence.ID == existingTask.ID || earlier[occurrence.ID] {
+			continue
+		}
+		if err := emitTaskEvent(store, models.EventTaskCreated, occurrence); err != nil {
+			return models.Task{}, err
+		}
+	}
+	return updatedTask, nil
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"task_manager_api/database"
+	"task_manager_api/models"
+	"task_manager_api/taskfile"
+)
+
+// Limits on imports, which are applied in a single transaction
+const (
+	maxImportSize = 10 << 20 // bytes
+	maxImportRows = 10000
+)
+
+// exportPageSize is how many tasks an export fetches at a time
+const exportPageSize = 500
+
+// invalidFormat explains the formats tasks can be exported and imported in
+var invalidFormat = "must be one of " + strings.Join(taskfile.Formats, ", ")
+
+// importError reports a row of an import file that wasn't imported
+type importError struct {
+	Line   int         `json:"line"`
+	Error  string      `json:"error"`
+	Fields fieldErrors `json:"fields,omitempty"`
+}
+
+// errImportRowFailed rolls back the savepoint of a row that couldn't be created
+var errImportRowFailed = errors.New("import row failed")
+
+// exportTasks streams every task matching the same filters as GET /tasks as a
+// file of the format in the format query parameter. limit and cursor are ignored.
+func (h *TasksHandler) exportTasks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	query.Del("limit")
+	query.Del("cursor")
+	filter, errs := parseTaskFilter(query)
+	if !taskfile.Valid(format) {
+		errs["format"] = invalidFormat
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, invalidQuery, errs)
+		return
+	}
+	filter.Limit = exportPageSize
+
+	// Fetch the first page before responding, so a failure can still be reported
+	page, err := h.store.ListTasks(filter)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch tasks"})
+		return
+	}
+
+	w.Header().Set("Content-Type", taskfile.ContentType(format))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "tasks." + format}))
+	writer, _ := taskfile.NewWriter(w, format)
+	flusher, _ := w.(http.Flusher)
+	for {
+		for _, task := range page.Tasks {
+			if err := writer.Write(task); err != nil {
+				// The client has gone away
+				return
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		filter.Cursor = page.NextCursor
+		if page, err = h.store.ListTasks(filter); err != nil {
+			// The status has been sent, so cut the response short for the
+			// client to see the export is incomplete
+			panic(http.ErrAbortHandler)
+		}
+	}
+	writer.Close()
+}
+
+// importTasks creates a task from every valid row of a file, whose format is
+// given by the format query parameter or else the Content-Type. The valid rows
+// are created in one transaction, and every other row is reported with its line.
+func (h *TasksHandler) importTasks(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		format = taskfile.FormatOf(mediaType)
+		if format == "" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Content-Type must be text/csv, application/x-ndjson or text/calendar, or set the format parameter"})
+			return
+		}
+	}
+	if !taskfile.Valid(format) {
+		writeFieldErrors(w, invalidQuery, fieldErrors{"format": invalidFormat})
+		return
+	}
+
+	rows, err := taskfile.Read(http.MaxBytesReader(w, r.Body, maxImportSize), format)
+	var syntaxErr *taskfile.SyntaxError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &syntaxErr):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": "Invalid " + format + " file: " + syntaxErr.Message, "line": syntaxErr.Line})
+		return
+	case errors.As(err, &maxBytesErr):
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("Import files must be at most %d bytes", maxImportSize)})
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to read request body"})
+		return
+	}
+	if len(rows) == 0 {
+		writeFieldErrors(w, "Invalid import", fieldErrors{"file": "contains no tasks"})
+		return
+	}
+	if len(rows) > maxImportRows {
+		writeFieldErrors(w, "Invalid import", fieldErrors{"file": fmt.Sprintf("must contain at most %d tasks", maxImportRows)})
+		return
+	}
+
+	failures := []importError{}
+	ids := []int{}
+	err = h.store.RunInTx(func(tx database.TaskStore) error {
+		for _, row := range rows {
+			task, errs := h.importedTask(r, row)
+			if len(errs) > 0 {
+				failures = append(failures, importError{Line: row.Line, Error: "Invalid task", Fields: errs})
+				continue
+			}
+
+			// Each row gets a savepoint, so a row the store rejects leaves no trace
+			err := tx.RunInTx(func(savepoint database.TaskStore) error {
+				id, err := savepoint.CreateTask(task)
+				var field, message string
+				switch {
+				case errors.Is(err, database.ErrParentNotFound):
+					field, message = "parent_id", parentNotFound
+				case errors.Is(err, database.ErrUserNotFound):
+					field, message = "assignee_id", assigneeNotFound
+				case errors.Is(err, database.ErrProjectNotFound):
+					field, message = "project_id", projectNotFound
+				case err != nil:
+					return err
+				}
+				if field != "" {
+					failures = append(failures, importError{Line: row.Line, Error: "Invalid task", Fields: fieldErrors{field: message}})
+					return errImportRowFailed
+				}
+
+				created, err := savepoint.GetTaskByID(int(id))
+				if err != nil {
+					return err
+				}
+				if err := emitTaskEvent(savepoint, models.EventTaskCreated, created); err != nil {
+					return err
+				}
+				ids = append(ids, created.ID)
+				return nil
+			})
+			if err != nil && !errors.Is(err, errImportRowFailed) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to import tasks"})
+		return
+	}
+
+	if len(ids) == 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": "No tasks were imported", "imported": 0, "ids": ids, "errors": failures})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"imported": len(ids), "ids": ids, "errors": failures})
+}
+
+// importedTask turns a row of an import file into a new task owned by the
+// caller, explaining every field that is missing or invalid. Fields the
+// server sets, such as the ID and timestamps, are ignored.
+func (h *TasksHandler) importedTask(r *http.Request, row taskfile.Row) (models.Task, fieldErrors) {
+	if message, ok := row.Errors["row"]; ok {
+		// None of the row's fields could be read
+		return models.Task{}, fieldErrors{"row": message}
+	}
+
+	imported := row.Task
+	task := models.Task{
+		Title:       imported.Title,
+		Description: imported.Description,
+		Status:      imported.Status,
+		DueDate:     imported.DueDate,
+		ParentID:    imported.ParentID,
+		Tags:        imported.Tags,
+		AssigneeID:  imported.AssigneeID,
+		Recurrence:  imported.Recurrence,
+		ProjectID:   imported.ProjectID,
+		Position:    imported.Position,
+		Estimate:    imported.Estimate,
+		Priority:    imported.Priority,
+	}
+	if task.Status == "" {
+		task.Status = models.StatusPending
+	}
+	if userID, ok := UserIDFromContext(r.Context()); ok {
+		task.CreatedBy = &userID
+	}
+
+	errs := validateTask(task)
+	// Fields that couldn't be read at all explain more than validation can
+	for field, message := range row.Errors {
+		errs[field] = message
+	}
+	return task, errs
+}
@@ -2,51 +2,338 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"mime"
 	"net/http"
+	"reflect"
 	"strconv"
 	"strings"
+	"task_manager_api/blobs"
 	"task_manager_api/database"
 	"task_manager_api/models"
 	"time"
 )
 
-// TasksHandler handles all requests to the /tasks endpoint
-func TasksHandler(w http.ResponseWriter, r *http.Request) {
+// TasksHandler serves the /tasks endpoints using the TaskStore it was created with
+type TasksHandler struct {
+	store    database.TaskStore
+	workflow models.Workflow
+	weights  models.ScoreWeights // how GET /tasks/next scores tasks
+
+	blobs            *blobs.Store // nil unless attachments are enabled
+	attachmentLimits AttachmentLimits
+
+	idempotencyTTL time.Duration // how long an Idempotency-Key is remembered
+}
+
+// Option configures a TasksHandler
+type Option func(*TasksHandler)
+
+// WithWorkflow replaces the default status workflow
+func WithWorkflow(workflow models.Workflow) Option {
+	return func(h *TasksHandler) {
+		h.workflow = workflow
+	}
+}
+
+// WithScoreWeights replaces the default weights GET /tasks/next scores tasks with
+func WithScoreWeights(weights models.ScoreWeights) Option {
+	return func(h *TasksHandler) {
+		h.weights = weights
+	}
+}
+
+// NewTasksHandler creates a TasksHandler that reads and writes tasks through store
+func NewTasksHandler(store database.TaskStore, options ...Option) *TasksHandler {
+	h := &TasksHandler{
+		store:    store,
+		workflow: models.DefaultWorkflow(),
+		weights:  models.DefaultScoreWeights(),
+
+		idempotencyTTL: DefaultIdempotencyTTL,
+	}
+	for _, option := range options {
+		option(h)
+	}
+	return h
+}
+
+// ServeHTTP handles all requests to the /tasks endpoint
+func (h *TasksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	// The request's changes are audited as made by its caller
+	h = h.actingFor(r)
+
+	// Requests for /tasks/{id}/{action} go to the task's sub-resources
+	if id, action, subID, ok := splitTaskPath(r.URL.Path); ok {
+		h.serveTaskAction(w, r, id, action, subID)
+		return
+	}
+
 	// Route based on HTTP method and path
 	switch r.Method {
 	case http.MethodGet:
 		if r.URL.Path == "/tasks" {
-			getAllTasks(w, r)
+			h.getAllTasks(w, r)
+		} else if r.URL.Path == "/tasks/search" {
+			h.searchTasks(w, r)
+		} else if r.URL.Path == "/tasks/trash" {
+			h.getTrash(w, r)
+		} else if r.URL.Path == "/tasks/events" {
+			h.streamEvents(w, r)
+		} else if r.URL.Path == "/tasks/export" {
+			h.exportTasks(w, r)
+		} else if r.URL.Path == "/tasks/next" {
+			h.nextTasks(w, r)
 		} else {
-			getTaskByID(w, r)
+			h.getTaskByID(w, r)
 		}
 	case http.MethodPost:
-		createTask(w, r)
+		if r.URL.Path == "/tasks/bulk" {
+			h.bulkTasks(w, r)
+		} else if r.URL.Path == "/tasks/import" {
+			h.importTasks(w, r)
+		} else {
+			h.idempotent(w, r, h.createTask)
+		}
 	case http.MethodPut:
-		updateTask(w, r)
+		h.updateTask(w, r)
+	case http.MethodPatch:
+		h.patchTask(w, r)
 	case http.MethodDelete:
-		deleteTask(w, r)
+		h.deleteTask(w, r)
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
 	}
 }
 
-// getAllTasks retrieves all tasks
-func getAllTasks(w http.ResponseWriter, r *http.Request) {
-	tasks, err := database.GetAllTasks()
+// actingFor returns a copy of the handler whose store records its changes in
+// the audit log as made by the caller of r
+func (h *TasksHandler) actingFor(r *http.Request) *TasksHandler {
+	handler := *h
+	handler.store = h.store.WithActor(requestActor(r))
+	return &handler
+}
+
+// splitTaskPath splits "/tasks/{id}/{action}" into its ID and action, and
+// "/tasks/{id}/{action}/{subID}" into its ID, action and the sub-resource's ID
+func splitTaskPath(path string) (id, action, subID string, ok bool) {
+	if !strings.HasPrefix(path, "/tasks/") {
+		return "", "", "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "/tasks/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[1] == "" {
+		return "", "", "", false
+	}
+	if len(parts) == 3 {
+		if parts[2] == "" {
+			return "", "", "", false
+		}
+		subID = parts[2]
+	}
+	return parts[0], parts[1], subID, true
+}
+
+// serveTaskAction routes requests for a single task's sub-resources
+func (h *TasksHandler) serveTaskAction(w http.ResponseWriter, r *http.Request, idStr, action, subID string) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid task ID"})
+		return
+	}
+
+	// Each action supports a fixed set of methods; "{id}" stands for a sub-resource's ID
+	methods := map[string][]string{
+		"history":           {http.MethodGet},
+		"reopen":            {http.MethodPost},
+		"restore":           {http.MethodPost},
+		"subtasks":          {http.MethodGet},
+		"blockers":          {http.MethodGet, http.MethodPost},
+		"blockers/{id}":     {http.MethodDelete},
+		"series":            {http.MethodGet, http.MethodPatch, http.MethodDelete},
+		"comments":          {http.MethodGet, http.MethodPost},
+		"comments/{id}":     {http.MethodGet, http.MethodPut, http.MethodDelete},
+		"attachments":       {http.MethodGet, http.MethodPost},
+		"attachments/{id}":  {http.MethodGet, http.MethodDelete},
+		"move":              {http.MethodPost},
+		"timer/start":       {http.MethodPost},
+		"timer/stop":        {http.MethodPost},
+		"time-entries":      {http.MethodGet, http.MethodPost},
+		"time-entries/{id}": {http.MethodGet, http.MethodDelete},
+	}
+	route := action
+	if action == "timer" {
+		// The timer's actions are fixed words rather than IDs
+		route += "/" + subID
+	} else if subID != "" {
+		route += "/{id}"
+	}
+	allowed, found := methods[route]
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Not found"})
+		return
+	}
+	if !containsMethod(allowed, r.Method) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+		return
+	}
+	if strings.HasPrefix(route, "attachments") && h.blobs == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Attachments are not enabled"})
+		return
+	}
+
+	switch {
+	case route == "history":
+		h.getStatusHistory(w, r, id)
+	case route == "reopen":
+		h.reopenTask(w, r, id)
+	case route == "restore":
+		h.restoreTask(w, r, id)
+	case route == "subtasks":
+		h.getSubtasks(w, r, id)
+	case route == "blockers" && r.Method == http.MethodGet:
+		h.getBlockers(w, r, id)
+	case route == "blockers":
+		h.addBlocker(w, r, id)
+	case route == "blockers/{id}":
+		h.removeBlocker(w, r, id, subID)
+	case route == "series" && r.Method == http.MethodGet:
+		h.getSeries(w, r, id)
+	case route == "series" && r.Method == http.MethodPatch:
+		h.patchSeries(w, r, id)
+	case route == "series":
+		h.stopSeries(w, r, id)
+	case route == "comments" && r.Method == http.MethodGet:
+		h.listComments(w, r, id)
+	case route == "comments":
+		h.createComment(w, r, id)
+	case route == "comments/{id}" && r.Method == http.MethodGet:
+		h.getComment(w, r, id, subID)
+	case route == "comments/{id}" && r.Method == http.MethodPut:
+		h.updateComment(w, r, id, subID)
+	case route == "comments/{id}":
+		h.deleteComment(w, r, id, subID)
+	case route == "attachments" && r.Method == http.MethodGet:
+		h.listAttachments(w, r, id)
+	case route == "attachments":
+		h.uploadAttachment(w, r, id)
+	case route == "attachments/{id}" && r.Method == http.MethodGet:
+		h.downloadAttachment(w, r, id, subID)
+	case route == "attachments/{id}":
+		h.deleteAttachment(w, r, id, subID)
+	case route == "move":
+		h.moveTask(w, r, id)
+	case route == "timer/start":
+		h.startTimer(w, r, id)
+	case route == "timer/stop":
+		h.stopTimer(w, r, id)
+	case route == "time-entries" && r.Method == http.MethodGet:
+		h.listTimeEntries(w, r, id)
+	case route == "time-entries":
+		h.addTimeEntry(w, r, id)
+	case route == "time-entries/{id}" && r.Method == http.MethodGet:
+		h.getTimeEntry(w, r, id, subID)
+	case route == "time-entries/{id}":
+		h.deleteTimeEntry(w, r, id, subID)
+	}
+}
+
+// containsMethod reports whether methods includes method
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// getAllTasks retrieves one page of tasks, filtered and sorted by the query parameters
+func (h *TasksHandler) getAllTasks(w http.ResponseWriter, r *http.Request) {
+	h.listTasks(w, r, false)
+}
+
+// getTrash retrieves one page of the tasks in the trash, most recently deleted first by default
+func (h *TasksHandler) getTrash(w http.ResponseWriter, r *http.Request) {
+	h.listTasks(w, r, true)
+}
+
+// listTasks retrieves one page of either active or trashed tasks
+func (h *TasksHandler) listTasks(w http.ResponseWriter, r *http.Request, trashed bool) {
+	writeTaskList(w, r, h.store, func(filter *database.TaskFilter) {
+		filter.Trashed = trashed
+		if trashed && filter.Sort == "" {
+			filter.Sort = database.SortDeletedAt
+		}
+	})
+}
+
+// writeTaskList responds with one page of the tasks matching the query
+// parameters, after adjust has narrowed the filter they describe
+func writeTaskList(w http.ResponseWriter, r *http.Request, store database.TaskStore, adjust func(filter *database.TaskFilter)) {
+	filter, errs := parseTaskFilter(r.URL.Query())
+	if len(errs) > 0 {
+		writeFieldErrors(w, invalidQuery, errs)
+		return
+	}
+	adjust(&filter)
+
+	page, err := store.ListTasks(filter)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		writeFieldErrors(w, invalidQuery, fieldErrors{"cursor": "is invalid or was issued for a different sort"})
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch tasks"})
 		return
 	}
-	json.NewEncoder(w).Encode(tasks)
+	json.NewEncoder(w).Encode(page)
+}
+
+// searchTasks runs a full-text search over task titles and descriptions
+func (h *TasksHandler) searchTasks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	errs := fieldErrors{}
+
+	q := query.Get("q")
+	if q == "" {
+		errs["q"] = "is required"
+	}
+	limit := parseLimit(query, errs)
+	if len(errs) > 0 {
+		writeFieldErrors(w, invalidQuery, errs)
+		return
+	}
+
+	page, err := h.store.SearchTasks(q, limit, query.Get("cursor"))
+	switch {
+	case errors.Is(err, database.ErrInvalidQuery):
+		writeFieldErrors(w, invalidQuery, fieldErrors{"q": "must contain at least one letter or digit"})
+		return
+	case errors.Is(err, database.ErrInvalidCursor):
+		writeFieldErrors(w, invalidQuery, fieldErrors{"cursor": "is invalid or was issued for a different query"})
+		return
+	case errors.Is(err, database.ErrSearchUnavailable):
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Full-text search is not enabled on this server"})
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to search tasks"})
+		return
+	}
+	json.NewEncoder(w).Encode(page)
 }
 
 // getTaskByID retrieves a single task by ID
-func getTaskByID(w http.ResponseWriter, r *http.Request) {
+func (h *TasksHandler) getTaskByID(w http.ResponseWriter, r *http.Request) {
 	// Extract ID from URL path
 	idStr := strings.TrimPrefix(r.URL.Path, "/tasks/")
 	id, err := strconv.Atoi(idStr)
@@ -56,17 +343,24 @@ func getTaskByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	task, err := database.GetTaskByID(id)
+	task, err := h.store.GetTaskByID(id)
 	if err != nil {
 		w.WriteHeader(http.StatusNotFound)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
 		return
 	}
+
+	// Clients that already have this version don't need it again
+	w.Header().Set("ETag", taskETag(task))
+	if header := r.Header.Get("If-None-Match"); header != "" && etagMatches(header, taskETag(task), true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	json.NewEncoder(w).Encode(task)
 }
 
 // createTask adds a new task
-func createTask(w http.ResponseWriter, r *http.Request) {
+func (h *TasksHandler) createTask(w http.ResponseWriter, r *http.Request) {
 	var task models.Task
 	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -81,30 +375,32 @@ func createTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set default values if not provided
-	if task.Status == "" {
-		task.Status = "pending"
+	// Set default values and check every field
+	task, terr := newTask(r.Context(), task)
+	if terr != nil {
+		terr.write(w)
+		return
 	}
-	
-	// Set timestamps
-	now := time.Now()
-	task.CreatedAt = now
-	task.UpdatedAt = now
 
-	id, err := database.CreateTask(task)
+	// The task and its event are kept together or not at all
+	var createdTask models.Task
+	err := h.store.RunInTx(func(store database.TaskStore) error {
+		var err error
+		createdTask, err = storeNewTask(store, task)
+		return err
+	})
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create task"})
+		storeTaskError(err, "Failed to create task").write(w)
 		return
 	}
 
-	task.ID = int(id)
+	w.Header().Set("ETag", taskETag(createdTask))
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(task)
+	json.NewEncoder(w).Encode(createdTask)
 }
 
-// updateTask updates an existing task
-func updateTask(w http.ResponseWriter, r *http.Request) {
+// updateTask replaces an existing task with the one in the request body
+func (h *TasksHandler) updateTask(w http.ResponseWriter, r *http.Request) {
 	// Extract ID from URL path
 	idStr := strings.TrimPrefix(r.URL.Path, "/tasks/")
 	id, err := strconv.Atoi(idStr)
@@ -121,28 +417,199 @@ func updateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update the task
-	err = database.UpdateTask(id, task)
+	existingTask, err := h.store.GetTaskByID(id)
 	if err != nil {
 		w.WriteHeader(http.StatusNotFound)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
 		return
 	}
+	if !authorizeTaskChange(w, r, existingTask) || !checkIfMatch(w, r, existingTask) {
+		return
+	}
+
+	h.replaceTask(w, r, existingTask, task)
+}
+
+// patchTask applies a JSON Merge Patch or JSON Patch to an existing task
+func (h *TasksHandler) patchTask(w http.ResponseWriter, r *http.Request) {
+	// Extract ID from URL path
+	idStr := strings.TrimPrefix(r.URL.Path, "/tasks/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid task ID"})
+		return
+	}
 
-	// Get the updated task to return
-	updatedTask, err := database.GetTaskByID(id)
+	// The media type selects the patch format
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mergePatchType && mediaType != jsonPatchType {
+		w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Content-Type must be " + mergePatchType + " or " + jsonPatchType})
+		return
+	}
+
+	existingTask, err := h.store.GetTaskByID(id)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve updated task"})
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		return
+	}
+	if !authorizeTaskChange(w, r, existingTask) || !checkIfMatch(w, r, existingTask) {
+		return
+	}
+
+	// Patches apply to the task's JSON representation
+	var doc map[string]interface{}
+	data, _ := json.Marshal(existingTask)
+	json.Unmarshal(data, &doc)
+
+	var patched interface{}
+	if mediaType == mergePatchType {
+		var patch interface{}
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+			return
+		}
+		patched = mergePatch(doc, patch)
+	} else {
+		var operations []patchOperation
+		if err := json.NewDecoder(r.Body).Decode(&operations); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+			return
+		}
+		patched, err = jsonPatch(doc, operations)
+		switch {
+		case errors.Is(err, errInvalidPatch):
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		case errors.Is(err, errPatchTestFailed):
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	task, fieldErrs := taskFromPatch(data, patched)
+	if len(fieldErrs) > 0 {
+		writeFieldErrors(w, "Invalid patch", fieldErrs)
 		return
 	}
 
+	h.replaceTask(w, r, existingTask, task)
+}
+
+// taskFromPatch converts a patched task document back into a Task.
+// original is the JSON of the task before patching; read-only fields must keep their values,
+// and can't be removed unless they were null.
+func taskFromPatch(original []byte, patched interface{}) (models.Task, fieldErrors) {
+	var task models.Task
+	errs := fieldErrors{}
+
+	patchedObject, ok := patched.(map[string]interface{})
+	if !ok {
+		errs["/"] = "must be an object"
+		return task, errs
+	}
+
+	var originalObject map[string]interface{}
+	json.Unmarshal(original, &originalObject)
+
+	writable := map[string]bool{"title": true, "description": true, "status": true, "due_date": true, "parent_id": true, "tags": true, "assignee_id": true, "recurrence": true, "estimate_minutes": true, "priority": true, "project_id": true, "position": true}
+	for key := range patchedObject {
+		if _, known := originalObject[key]; !known {
+			errs[key] = "unknown field"
+		}
+	}
+	// A read-only field set to null by a merge patch or removed by a JSON Patch is
+	// missing from the patched document, which would reset it to its zero value
+	for key, value := range originalObject {
+		patchedValue, present := patchedObject[key]
+		if writable[key] {
+			continue
+		}
+		if present && !reflect.DeepEqual(patchedValue, value) || !present && value != nil {
+			errs[key] = "is read-only"
+		}
+	}
+	if len(errs) > 0 {
+		return task, errs
+	}
+
+	data, _ := json.Marshal(patchedObject)
+	if err := json.Unmarshal(data, &task); err != nil {
+		errs["/"] = err.Error()
+	}
+	return task, errs
+}
+
+// replaceTask validates task and stores it in place of existingTask, provided
+// existingTask is still the current version
+func (h *TasksHandler) replaceTask(w http.ResponseWriter, r *http.Request, existingTask, task models.Task) {
+	if terr := h.checkTaskChange(h.store, existingTask, task); terr != nil {
+		terr.write(w)
+		return
+	}
+
+	// Update the task, unless another request changed it since it was read
+	task.Version = existingTask.Version
+	var updatedTask models.Task
+	err := h.store.RunInTx(func(store database.TaskStore) error {
+		var err error
+		updatedTask, err = storeTaskUpdate(store, existingTask, task)
+		return err
+	})
+	if errors.Is(err, database.ErrVersionConflict) {
+		writeVersionConflict(w, r)
+		return
+	}
+	if err != nil {
+		storeTaskError(err, "Failed to update task").write(w)
+		return
+	}
+
+	w.Header().Set("ETag", taskETag(updatedTask))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(updatedTask)
 }
 
-// deleteTask removes a task
-func deleteTask(w http.ResponseWriter, r *http.Request) {
+// validateTask explains every field of a complete task that is missing or invalid
+func validateTask(task models.Task) fieldErrors {
+	errs := fieldErrors{}
+	if task.Title == "" {
+		errs["title"] = "is required"
+	}
+	if !task.Status.Valid() {
+		errs["status"] = "must be one of " + statusList()
+	}
+	if !validTags(task.Tags) {
+		errs["tags"] = invalidTags
+	}
+	if message := validRecurrence(task.Recurrence); message != "" {
+		errs["recurrence"] = message
+	}
+	if task.Position != "" && !models.ValidPosition(task.Position) {
+		errs["position"] = invalidPosition
+	}
+	if !validEstimate(task.Estimate) {
+		errs["estimate_minutes"] = invalidEstimate
+	}
+	if task.Priority != "" && !task.Priority.Valid() {
+		errs["priority"] = "must be one of " + priorityList()
+	}
+	return errs
+}
+
+// deleteTask moves a task to the trash, or removes it for good with ?purge=true
+func (h *TasksHandler) deleteTask(w http.ResponseWriter, r *http.Request) {
 	// Extract ID from URL path
 	idStr := strings.TrimPrefix(r.URL.Path, "/tasks/")
 	id, err := strconv.Atoi(idStr)
@@ -152,16 +619,44 @@ func deleteTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if task exists
-	_, err = database.GetTaskByID(id)
+	purge := false
+	if value := r.URL.Query().Get("purge"); value != "" {
+		if purge, err = strconv.ParseBool(value); err != nil {
+			writeFieldErrors(w, invalidQuery, fieldErrors{"purge": "must be true or false"})
+			return
+		}
+	}
+
+	// Check if task exists; tasks in the trash can only be purged
+	task, err := h.store.GetTaskByID(id)
+	if err != nil && purge {
+		task, err = h.store.GetTrashedTask(id)
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusNotFound)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
 		return
 	}
+	if !authorizeTaskChange(w, r, task) || !checkIfMatch(w, r, task) {
+		return
+	}
 
-	// Delete the task
-	err = database.DeleteTask(id)
+	// Delete the task; with If-Match, only the version the client saw
+	version := 0
+	if r.Header.Get("If-Match") != "" {
+		version = task.Version
+	}
+	message := "Task moved to trash"
+	if purge {
+		message = "Task deleted permanently"
+	}
+	err = h.store.RunInTx(func(store database.TaskStore) error {
+		return storeTaskDeletion(store, task, version, purge)
+	})
+	if errors.Is(err, database.ErrVersionConflict) {
+		writeVersionConflict(w, r)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete task"})
@@ -169,5 +664,108 @@ func deleteTask(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Task deleted successfully"})
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// restoreTask moves a task out of the trash
+func (h *TasksHandler) restoreTask(w http.ResponseWriter, r *http.Request, id int) {
+	task, err := h.store.GetTrashedTask(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found in trash"})
+		return
+	}
+	if !authorizeTaskChange(w, r, task) || !checkIfMatch(w, r, task) {
+		return
+	}
+
+	var restoredTask models.Task
+	err = h.store.RunInTx(func(store database.TaskStore) error {
+		if err := store.RestoreTask(id); err != nil {
+			return err
+		}
+		var err error
+		if restoredTask, err = store.GetTaskByID(id); err != nil {
+			return err
+		}
+		return emitTaskEvent(store, models.EventTaskUpdated, restoredTask)
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to restore task"})
+		return
+	}
+	w.Header().Set("ETag", taskETag(restoredTask))
+	json.NewEncoder(w).Encode(restoredTask)
+}
+
+// illegalTransition is the 422 error for a status change the workflow doesn't
+// allow, with the statuses the task may move to instead
+func illegalTransition(workflow models.Workflow, from, to models.Status) *taskError {
+	details := map[string]interface{}{"allowed": workflow.Allowed(from)}
+	if _, ok := workflow.ReopenTarget(from); ok {
+		details["hint"] = "Use POST /tasks/{id}/reopen to reopen this task"
+	}
+	return &taskError{
+		status:  http.StatusUnprocessableEntity,
+		message: "Cannot change status from " + string(from) + " to " + string(to),
+		details: details,
+	}
+}
+
+// reopenTask moves a task out of a status that can only be left by reopening it
+func (h *TasksHandler) reopenTask(w http.ResponseWriter, r *http.Request, id int) {
+	task, err := h.store.GetTaskByID(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		return
+	}
+
+	if !authorizeTaskChange(w, r, task) || !checkIfMatch(w, r, task) {
+		return
+	}
+
+	target, ok := h.workflow.ReopenTarget(task.Status)
+	if !ok {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Tasks with status " + string(task.Status) + " cannot be reopened"})
+		return
+	}
+
+	reopened := task
+	reopened.Status = target
+	var reopenedTask models.Task
+	err = h.store.RunInTx(func(store database.TaskStore) error {
+		var err error
+		reopenedTask, err = storeTaskUpdate(store, task, reopened)
+		return err
+	})
+	if errors.Is(err, database.ErrVersionConflict) {
+		writeVersionConflict(w, r)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to reopen task"})
+		return
+	}
+	w.Header().Set("ETag", taskETag(reopenedTask))
+	json.NewEncoder(w).Encode(reopenedTask)
+}
+
+// getStatusHistory lists every status change of a task, oldest first
+func (h *TasksHandler) getStatusHistory(w http.ResponseWriter, r *http.Request, id int) {
+	history, err := h.store.GetStatusHistory(id)
+	if errors.Is(err, database.ErrTaskNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch status history"})
+		return
+	}
+	json.NewEncoder(w).Encode(history)
 }
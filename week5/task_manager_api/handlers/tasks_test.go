@@ -1,26 +1,36 @@
 package handlers
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"math"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"task_manager_api/auth"
+	"task_manager_api/blobs"
 	"task_manager_api/database"
 	"task_manager_api/models"
 	"testing"
 	"time"
 	"strconv"
+	"strings"
 )
 
 // setupTest initializes the test environment
-func setupTest(t *testing.T) {
-	// Use an in-memory SQLite database for testing
-	database.InitDB(":memory:")
+func setupTest(t *testing.T) (*TasksHandler, database.TaskStore) {
+	// Use a fresh in-memory store so tests don't share state
+	store := database.NewMemoryStore()
+	return NewTasksHandler(store), store
 }
 
 // TestGetAllTasks tests the getAllTasks handler
 func TestGetAllTasks(t *testing.T) {
-	setupTest(t)
+	handler, store := setupTest(t)
 
 	// Create some test tasks
 	tasks := []models.Task{
@@ -37,7 +47,7 @@ func TestGetAllTasks(t *testing.T) {
 	}
 
 	for _, task := range tasks {
-		_, err := database.CreateTask(task)
+		_, err := store.CreateTask(task)
 		if err != nil {
 			t.Fatalf("Failed to create test task: %v", err)
 		}
@@ -51,7 +61,6 @@ func TestGetAllTasks(t *testing.T) {
 
 	// Create a ResponseRecorder to record the response
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(TasksHandler)
 
 	// Call the handler
 	handler.ServeHTTP(rr, req)
@@ -63,22 +72,262 @@ func TestGetAllTasks(t *testing.T) {
 	}
 
 	// Check the response body
-	var gotTasks []models.Task
-	err = json.Unmarshal(rr.Body.Bytes(), &gotTasks)
+	var page models.TaskPage
+	err = json.Unmarshal(rr.Body.Bytes(), &page)
 	if err != nil {
 		t.Fatalf("Failed to unmarshal response: %v", err)
 	}
 
 	// Verify we got the expected number of tasks
-	if len(gotTasks) != len(tasks) {
+	if len(page.Tasks) != len(tasks) {
 		t.Errorf("handler returned unexpected number of tasks: got %d want %d",
-			len(gotTasks), len(tasks))
+			len(page.Tasks), len(tasks))
+	}
+	if page.Total != len(tasks) {
+		t.Errorf("handler returned wrong total: got %d want %d", page.Total, len(tasks))
+	}
+}
+
+// TestGetAllTasksQuery tests filtering, sorting and pagination on the getAllTasks handler
+func TestGetAllTasksQuery(t *testing.T) {
+	handler, store := setupTest(t)
+
+	// Create tasks due on consecutive days
+	base := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	statuses := []models.Status{"pending", "in_progress", "pending", "completed", "pending"}
+	for i, status := range statuses {
+		_, err := store.CreateTask(models.Task{
+			Title:   "Task " + strconv.Itoa(i),
+			Status:  status,
+			DueDate: base.AddDate(0, 0, i),
+		})
+		if err != nil {
+			t.Fatalf("Failed to create test task: %v", err)
+		}
+	}
+
+	// Test cases
+	testCases := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantTitles []string
+		wantTotal  int
+		wantField  string
+	}{
+		{
+			name:       "Filter By Status",
+			query:      "?status=pending&sort=due_date&order=asc",
+			wantStatus: http.StatusOK,
+			wantTitles: []string{"Task 0", "Task 2", "Task 4"},
+			wantTotal:  3,
+		},
+		{
+			name:       "Due Date Window",
+			query:      "?due_after=2030-01-01&due_before=2030-01-04&sort=due_date&order=desc",
+			wantStatus: http.StatusOK,
+			wantTitles: []string{"Task 2", "Task 1"},
+			wantTotal:  2,
+		},
+		{
+			name:       "Limit",
+			query:      "?sort=title&order=asc&limit=2",
+			wantStatus: http.StatusOK,
+			wantTitles: []string{"Task 0", "Task 1"},
+			wantTotal:  5,
+		},
+		{
+			name:       "Invalid Limit",
+			query:      "?limit=0",
+			wantStatus: http.StatusBadRequest,
+			wantField:  "limit",
+		},
+		{
+			name:       "Invalid Sort",
+			query:      "?sort=priority",
+			wantStatus: http.StatusBadRequest,
+			wantField:  "sort",
+		},
+		{
+			name:       "Invalid Date",
+			query:      "?due_before=tomorrow",
+			wantStatus: http.StatusBadRequest,
+			wantField:  "due_before",
+		},
+		{
+			name:       "Invalid Cursor",
+			query:      "?cursor=not-a-cursor",
+			wantStatus: http.StatusBadRequest,
+			wantField:  "cursor",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/tasks"+tc.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			// Check the status code
+			if status := rr.Code; status != tc.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v",
+					status, tc.wantStatus)
+			}
+
+			// Errors should name the offending parameter
+			if tc.wantField != "" {
+				var body struct {
+					Fields map[string]string `json:"fields"`
+				}
+				if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if body.Fields[tc.wantField] == "" {
+					t.Errorf("expected an explanation for %q, got %v", tc.wantField, body.Fields)
+				}
+				return
+			}
+
+			var page models.TaskPage
+			if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if page.Total != tc.wantTotal {
+				t.Errorf("got total %d want %d", page.Total, tc.wantTotal)
+			}
+			if len(page.Tasks) != len(tc.wantTitles) {
+				t.Fatalf("got %d tasks want %d", len(page.Tasks), len(tc.wantTitles))
+			}
+			for i, title := range tc.wantTitles {
+				if page.Tasks[i].Title != title {
+					t.Errorf("task %d: got title %q want %q", i, page.Tasks[i].Title, title)
+				}
+			}
+		})
+	}
+
+	// Walk every page and check each task is returned exactly once
+	t.Run("Cursor Pagination", func(t *testing.T) {
+		seen := map[int]bool{}
+		url := "/tasks?sort=due_date&order=asc&limit=2"
+		for pages := 0; url != ""; pages++ {
+			if pages > len(statuses) {
+				t.Fatal("pagination did not terminate")
+			}
+
+			req, _ := http.NewRequest("GET", url, nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v", rr.Code)
+			}
+
+			var page models.TaskPage
+			if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			for _, task := range page.Tasks {
+				if seen[task.ID] {
+					t.Errorf("task %d returned twice", task.ID)
+				}
+				seen[task.ID] = true
+			}
+
+			url = ""
+			if page.NextCursor != "" {
+				url = "/tasks?sort=due_date&order=asc&limit=2&cursor=" + page.NextCursor
+			}
+		}
+
+		if len(seen) != len(statuses) {
+			t.Errorf("saw %d tasks across all pages, want %d", len(seen), len(statuses))
+		}
+	})
+}
+
+// TestSearchTasks tests the searchTasks handler
+func TestSearchTasks(t *testing.T) {
+	handler, store := setupTest(t)
+
+	for _, title := range []string{"Write release notes", "Deploy release", "Plan sprint"} {
+		if _, err := store.CreateTask(models.Task{Title: title}); err != nil {
+			t.Fatalf("Failed to create test task: %v", err)
+		}
+	}
+
+	// Test cases
+	testCases := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantTotal  int
+	}{
+		{
+			name:       "Matches",
+			query:      "?q=release",
+			wantStatus: http.StatusOK,
+			wantTotal:  2,
+		},
+		{
+			name:       "No Matches",
+			query:      "?q=retrospective",
+			wantStatus: http.StatusOK,
+			wantTotal:  0,
+		},
+		{
+			name:       "Missing Query",
+			query:      "",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Only Punctuation",
+			query:      "?q=%21%21",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Invalid Limit",
+			query:      "?q=release&limit=-1",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/tasks/search"+tc.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			// Check the status code
+			if status := rr.Code; status != tc.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v",
+					status, tc.wantStatus)
+			}
+
+			if tc.wantStatus == http.StatusOK {
+				var page models.SearchPage
+				if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if page.Total != tc.wantTotal || len(page.Tasks) != tc.wantTotal {
+					t.Errorf("got %d of %d results, want %d", len(page.Tasks), page.Total, tc.wantTotal)
+				}
+			}
+		})
 	}
 }
 
 // TestCreateTask tests the createTask handler
 func TestCreateTask(t *testing.T) {
-	setupTest(t)
+	handler, _ := setupTest(t)
 
 	// Test cases
 	testCases := []struct {
@@ -123,7 +372,6 @@ func TestCreateTask(t *testing.T) {
 
 			// Create a ResponseRecorder to record the response
 			rr := httptest.NewRecorder()
-			handler := http.HandlerFunc(TasksHandler)
 
 			// Call the handler
 			handler.ServeHTTP(rr, req)
@@ -157,7 +405,7 @@ func TestCreateTask(t *testing.T) {
 
 // TestGetTaskByID tests the getTaskByID handler
 func TestGetTaskByID(t *testing.T) {
-	setupTest(t)
+	handler, store := setupTest(t)
 
 	// Create a test task
 	task := models.Task{
@@ -166,7 +414,7 @@ func TestGetTaskByID(t *testing.T) {
 		Status:      "pending",
 	}
 
-	id, err := database.CreateTask(task)
+	id, err := store.CreateTask(task)
 	if err != nil {
 		t.Fatalf("Failed to create test task: %v", err)
 	}
@@ -205,7 +453,6 @@ func TestGetTaskByID(t *testing.T) {
 
 			// Create a ResponseRecorder to record the response
 			rr := httptest.NewRecorder()
-			handler := http.HandlerFunc(TasksHandler)
 
 			// Call the handler
 			handler.ServeHTTP(rr, req)
@@ -240,7 +487,7 @@ func TestGetTaskByID(t *testing.T) {
 
 // TestUpdateTask tests the updateTask handler
 func TestUpdateTask(t *testing.T) {
-	setupTest(t)
+	handler, store := setupTest(t)
 
 	// Create a test task
 	task := models.Task{
@@ -249,7 +496,7 @@ func TestUpdateTask(t *testing.T) {
 		Status:      "pending",
 	}
 
-	id, err := database.CreateTask(task)
+	id, err := store.CreateTask(task)
 	if err != nil {
 		t.Fatalf("Failed to create test task: %v", err)
 	}
@@ -266,7 +513,8 @@ func TestUpdateTask(t *testing.T) {
 			name:   "Update Title",
 			taskID: "/tasks/" + strId,
 			updateTask: models.Task{
-				Title: "Updated Title",
+				Title:  "Updated Title",
+				Status: "pending",
 			},
 			wantStatus: http.StatusOK,
 		},
@@ -274,10 +522,37 @@ func TestUpdateTask(t *testing.T) {
 			name:   "Update Status",
 			taskID: "/tasks/" + strId,
 			updateTask: models.Task{
+				Title:  "Updated Title",
 				Status: "completed",
 			},
 			wantStatus: http.StatusOK,
 		},
+		{
+			name:   "Missing Title",
+			taskID: "/tasks/" + strId,
+			updateTask: models.Task{
+				Status: "completed",
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "Completed Task Back To Pending",
+			taskID: "/tasks/" + strId,
+			updateTask: models.Task{
+				Title:  "Updated Title",
+				Status: "pending",
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "Unknown Status",
+			taskID: "/tasks/" + strId,
+			updateTask: models.Task{
+				Title:  "Updated Title",
+				Status: "archived",
+			},
+			wantStatus: http.StatusBadRequest,
+		},
 		{
 			name:   "Non-existent Task",
 			taskID: "/tasks/9999",
@@ -313,7 +588,6 @@ func TestUpdateTask(t *testing.T) {
 
 			// Create a ResponseRecorder to record the response
 			rr := httptest.NewRecorder()
-			handler := http.HandlerFunc(TasksHandler)
 
 			// Call the handler
 			handler.ServeHTTP(rr, req)
@@ -346,9 +620,1854 @@ func TestUpdateTask(t *testing.T) {
 	}
 }
 
+// TestPatchTask tests the patchTask handler with both patch formats
+func TestPatchTask(t *testing.T) {
+	dueDate := time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)
+	projectID := 1
+
+	testCases := []struct {
+		name        string
+		contentType string
+		patch       string
+		wantStatus  int
+		wantTask    models.Task // checked when the patch succeeds
+	}{
+		{
+			name:        "Merge Patch Updates Given Fields",
+			contentType: "application/merge-patch+json",
+			patch:       `{"title":"Patched Title","status":"in_progress"}`,
+			wantStatus:  http.StatusOK,
+			wantTask:    models.Task{Title: "Patched Title", Description: "Original Description", Status: "in_progress", DueDate: dueDate},
+		},
+		{
+			name:        "Merge Patch Null Clears Fields",
+			contentType: "application/merge-patch+json; charset=utf-8",
+			patch:       `{"description":null,"due_date":null}`,
+			wantStatus:  http.StatusOK,
+			wantTask:    models.Task{Title: "Original Title", Status: "pending"},
+		},
+		{
+			name:        "Merge Patch Cannot Clear Title",
+			contentType: "application/merge-patch+json",
+			patch:       `{"title":null}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "Merge Patch Read-only Field",
+			contentType: "application/merge-patch+json",
+			patch:       `{"id":42}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "Merge Patch Cannot Null Read-only Field",
+			contentType: "application/merge-patch+json",
+			patch:       `{"created_at":null}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "Merge Patch Null Read-only Field That Is Null",
+			contentType: "application/merge-patch+json",
+			patch:       `{"series_id":null}`,
+			wantStatus:  http.StatusOK,
+			wantTask:    models.Task{Title: "Original Title", Description: "Original Description", Status: "pending", DueDate: dueDate},
+		},
+		{
+			name:        "Merge Patch Moves To Project",
+			contentType: "application/merge-patch+json",
+			patch:       `{"project_id":1}`,
+			wantStatus:  http.StatusOK,
+			wantTask:    models.Task{Title: "Original Title", Description: "Original Description", Status: "pending", DueDate: dueDate, ProjectID: &projectID, Position: models.FirstPosition},
+		},
+		{
+			name:        "Merge Patch Sets Position",
+			contentType: "application/merge-patch+json",
+			patch:       `{"project_id":1,"position":"a5"}`,
+			wantStatus:  http.StatusOK,
+			wantTask:    models.Task{Title: "Original Title", Description: "Original Description", Status: "pending", DueDate: dueDate, ProjectID: &projectID, Position: "a5"},
+		},
+		{
+			name:        "Merge Patch Invalid Position",
+			contentType: "application/merge-patch+json",
+			patch:       `{"project_id":1,"position":"a50"}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "Merge Patch Unknown Project",
+			contentType: "application/merge-patch+json",
+			patch:       `{"project_id":9}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "Merge Patch Unknown Field",
+			contentType: "application/merge-patch+json",
+			patch:       `{"urgency":"high"}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "JSON Patch",
+			contentType: "application/json-patch+json",
+			patch: `[
+				{"op":"test","path":"/status","value":"pending"},
+				{"op":"replace","path":"/title","value":"Patched Title"},
+				{"op":"remove","path":"/due_date"},
+				{"op":"copy","from":"/title","path":"/description"}
+			]`,
+			wantStatus: http.StatusOK,
+			wantTask:   models.Task{Title: "Patched Title", Description: "Patched Title", Status: "pending"},
+		},
+		{
+			name:        "JSON Patch Moves To Project",
+			contentType: "application/json-patch+json",
+			patch:       `[{"op":"replace","path":"/project_id","value":1},{"op":"replace","path":"/position","value":"Zz"}]`,
+			wantStatus:  http.StatusOK,
+			wantTask:    models.Task{Title: "Original Title", Description: "Original Description", Status: "pending", DueDate: dueDate, ProjectID: &projectID, Position: "Zz"},
+		},
+		{
+			name:        "JSON Patch Failed Test",
+			contentType: "application/json-patch+json",
+			patch:       `[{"op":"test","path":"/status","value":"completed"},{"op":"remove","path":"/description"}]`,
+			wantStatus:  http.StatusConflict,
+		},
+		{
+			name:        "JSON Patch Missing Path",
+			contentType: "application/json-patch+json",
+			patch:       `[{"op":"replace","path":"/owner","value":"me"}]`,
+			wantStatus:  http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "JSON Patch Cannot Remove Read-only Field",
+			contentType: "application/json-patch+json",
+			patch:       `[{"op":"remove","path":"/version"}]`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "JSON Patch Unknown Operation",
+			contentType: "application/json-patch+json",
+			patch:       `[{"op":"rename","path":"/title","value":"x"}]`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "Unsupported Content Type",
+			contentType: "application/json",
+			patch:       `{"title":"Patched Title"}`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Each case patches a fresh task, with a project 1 to move it to
+			handler, store := setupTest(t)
+			if _, err := store.CreateProject(models.Project{Name: "Launch", Columns: models.DefaultColumns()}); err != nil {
+				t.Fatalf("Failed to create test project: %v", err)
+			}
+			id, err := store.CreateTask(models.Task{
+				Title:       "Original Title",
+				Description: "Original Description",
+				Status:      "pending",
+				DueDate:     dueDate,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create test task: %v", err)
+			}
+
+			req, err := http.NewRequest("PATCH", "/tasks/"+strconv.FormatInt(id, 10), bytes.NewBufferString(tc.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", tc.contentType)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, tc.wantStatus, rr.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			// The stored task matches the patched one
+			task, err := store.GetTaskByID(int(id))
+			if err != nil {
+				t.Fatalf("Failed to get patched task: %v", err)
+			}
+			if task.Title != tc.wantTask.Title || task.Description != tc.wantTask.Description ||
+				task.Status != tc.wantTask.Status || !task.DueDate.Equal(tc.wantTask.DueDate) ||
+				!reflect.DeepEqual(task.ProjectID, tc.wantTask.ProjectID) || task.Position != tc.wantTask.Position {
+				t.Errorf("patched task = %+v, want %+v", task, tc.wantTask)
+			}
+		})
+	}
+}
+
+// TestConditionalRequests tests ETags with If-Match and If-None-Match
+func TestConditionalRequests(t *testing.T) {
+	handler, store := setupTest(t)
+
+	id, err := store.CreateTask(models.Task{Title: "Conditional Task", Status: "pending"})
+	if err != nil {
+		t.Fatalf("Failed to create test task: %v", err)
+	}
+	taskURL := "/tasks/" + strconv.FormatInt(id, 10)
+
+	// Steps run in order against the same task
+	steps := []struct {
+		name       string
+		method     string
+		header     string
+		value      string
+		body       string
+		wantStatus int
+		wantETag   string
+	}{
+		{"Get", "GET", "", "", "", http.StatusOK, `"1"`},
+		{"Get Not Modified", "GET", "If-None-Match", `"1"`, "", http.StatusNotModified, `"1"`},
+		{"Get Weak Not Modified", "GET", "If-None-Match", `"7", W/"1"`, "", http.StatusNotModified, `"1"`},
+		{"Get Modified", "GET", "If-None-Match", `"0"`, "", http.StatusOK, `"1"`},
+		{"Put Stale", "PUT", "If-Match", `"2"`, `{"title":"Lost","status":"pending"}`, http.StatusPreconditionFailed, `"1"`},
+		{"Put Current", "PUT", "If-Match", `"1"`, `{"title":"Replaced","status":"pending"}`, http.StatusOK, `"2"`},
+		{"Patch Stale", "PATCH", "If-Match", `"1"`, `{"title":"Lost"}`, http.StatusPreconditionFailed, `"2"`},
+		{"Patch Any", "PATCH", "If-Match", `*`, `{"title":"Patched"}`, http.StatusOK, `"3"`},
+		{"Delete Stale", "DELETE", "If-Match", `"2"`, "", http.StatusPreconditionFailed, `"3"`},
+		{"Delete Current", "DELETE", "If-Match", `"1", "3"`, "", http.StatusOK, ""},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req, err := http.NewRequest(step.method, taskURL, bytes.NewBufferString(step.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if step.header != "" {
+				req.Header.Set(step.header, step.value)
+			}
+			if step.method == "PATCH" {
+				req.Header.Set("Content-Type", "application/merge-patch+json")
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != step.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, step.wantStatus, rr.Body.String())
+			}
+			if etag := rr.Header().Get("ETag"); etag != step.wantETag {
+				t.Errorf("ETag = %s, want %s", etag, step.wantETag)
+			}
+			if rr.Code == http.StatusNotModified && rr.Body.Len() != 0 {
+				t.Errorf("304 response has a body: %s", rr.Body.String())
+			}
+		})
+	}
+
+	// Deleting with a list that includes the current version removed the task
+	if _, err := store.GetTaskByID(int(id)); err == nil {
+		t.Error("task still exists after deleting its current version")
+	}
+}
+
+// TestBulkTasks tests the bulkTasks handler in both modes
+func TestBulkTasks(t *testing.T) {
+	// Each case runs against a store holding a pending task 1 and a completed task 2
+	testCases := []struct {
+		name        string
+		body        string
+		wantStatus  int
+		wantResults []int // status code of each operation
+		wantTaskIDs []int // tasks in the store afterwards
+	}{
+		{
+			name: "Atomic Success",
+			body: `{"mode":"atomic","operations":[
+				{"op":"create","task":{"title":"Imported"}},
+				{"op":"patch","id":1,"patch":{"status":"completed"}},
+				{"op":"delete","id":2}
+			]}`,
+			wantStatus:  http.StatusOK,
+			wantResults: []int{http.StatusCreated, http.StatusOK, http.StatusOK},
+			wantTaskIDs: []int{1, 3},
+		},
+		{
+			name: "Atomic Failure Rolls Back",
+			body: `{"operations":[
+				{"op":"create","task":{"title":"Imported"}},
+				{"op":"update","id":2,"task":{"title":"Reopened","status":"pending"}},
+				{"op":"delete","id":1}
+			]}`,
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantResults: []int{http.StatusFailedDependency, http.StatusUnprocessableEntity, http.StatusFailedDependency},
+			wantTaskIDs: []int{1, 2},
+		},
+		{
+			name: "Partial Keeps Successes",
+			body: `{"mode":"partial","operations":[
+				{"op":"create","task":{"title":""}},
+				{"op":"create","task":{"title":"Imported"}},
+				{"op":"delete","id":99},
+				{"op":"update","id":1,"version":5,"task":{"title":"Stale","status":"pending"}},
+				{"op":"delete","id":2,"version":1}
+			]}`,
+			wantStatus:  http.StatusOK,
+			wantResults: []int{http.StatusBadRequest, http.StatusCreated, http.StatusNotFound, http.StatusConflict, http.StatusOK},
+			wantTaskIDs: []int{1, 3},
+		},
+		{
+			name: "Stale Versions Conflict",
+			body: `{"mode":"partial","operations":[
+				{"op":"update","id":1,"version":2,"task":{"title":"Stale","status":"pending"}},
+				{"op":"patch","id":1,"version":2,"patch":{"title":"Stale"}},
+				{"op":"delete","id":2,"version":2},
+				{"op":"patch","id":1,"version":1,"patch":{"title":"Current"}},
+				{"op":"patch","id":1,"version":1,"patch":{"title":"Now stale"}}
+			]}`,
+			wantStatus:  http.StatusOK,
+			wantResults: []int{http.StatusConflict, http.StatusConflict, http.StatusConflict, http.StatusOK, http.StatusConflict},
+			wantTaskIDs: []int{1, 2},
+		},
+		{
+			name: "Atomic Stale Version",
+			body: `{"operations":[
+				{"op":"create","task":{"title":"Imported"}},
+				{"op":"delete","id":2,"version":2}
+			]}`,
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantResults: []int{http.StatusFailedDependency, http.StatusConflict},
+			wantTaskIDs: []int{1, 2},
+		},
+		{
+			name: "Patch Cannot Null Read-only Field",
+			body: `{"mode":"partial","operations":[
+				{"op":"patch","id":1,"patch":{"created_at":null}},
+				{"op":"patch","id":1,"patch":{"title":"Renamed"}}
+			]}`,
+			wantStatus:  http.StatusOK,
+			wantResults: []int{http.StatusBadRequest, http.StatusOK},
+			wantTaskIDs: []int{1, 2},
+		},
+		{
+			name:        "Unknown Mode",
+			body:        `{"mode":"best_effort","operations":[{"op":"delete","id":1}]}`,
+			wantStatus:  http.StatusBadRequest,
+			wantTaskIDs: []int{1, 2},
+		},
+		{
+			name:        "No Operations",
+			body:        `{"mode":"atomic","operations":[]}`,
+			wantStatus:  http.StatusBadRequest,
+			wantTaskIDs: []int{1, 2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler, store := setupTest(t)
+			store.CreateTask(models.Task{Title: "Pending", Status: "pending"})
+			store.CreateTask(models.Task{Title: "Completed", Status: "completed"})
+
+			req, err := http.NewRequest("POST", "/tasks/bulk", bytes.NewBufferString(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, tc.wantStatus, rr.Body.String())
+			}
+
+			var response struct {
+				Results []struct {
+					Index  int    `json:"index"`
+					Status int    `json:"status"`
+					Error  string `json:"error"`
+				} `json:"results"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if len(response.Results) != len(tc.wantResults) {
+				t.Fatalf("got %d results, want %d", len(response.Results), len(tc.wantResults))
+			}
+			for i, result := range response.Results {
+				if result.Index != i || result.Status != tc.wantResults[i] {
+					t.Errorf("result %d = index %d status %d (%s), want status %d",
+						i, result.Index, result.Status, result.Error, tc.wantResults[i])
+				}
+			}
+
+			tasks, err := store.GetAllTasks()
+			if err != nil {
+				t.Fatalf("Failed to list tasks: %v", err)
+			}
+			ids := map[int]bool{}
+			for _, task := range tasks {
+				ids[task.ID] = true
+			}
+			if len(ids) != len(tc.wantTaskIDs) {
+				t.Errorf("store has tasks %v, want %v", ids, tc.wantTaskIDs)
+			}
+			for _, id := range tc.wantTaskIDs {
+				if !ids[id] {
+					t.Errorf("store has tasks %v, want %v", ids, tc.wantTaskIDs)
+				}
+			}
+		})
+	}
+}
+
+// TestTrashEndpoints tests soft deletion, the trash listing, restoring and purging
+func TestTrashEndpoints(t *testing.T) {
+	handler, store := setupTest(t)
+	store.CreateTask(models.Task{Title: "Task 1", Status: "pending"})
+	store.CreateTask(models.Task{Title: "Task 2", Status: "pending"})
+
+	// Steps run in order against the same store
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantTrash  int // tasks in the trash afterwards
+	}{
+		{"Delete", "DELETE", "/tasks/1", http.StatusOK, 1},
+		{"Deleted Task Is Hidden", "GET", "/tasks/1", http.StatusNotFound, 1},
+		{"Delete Again", "DELETE", "/tasks/1", http.StatusNotFound, 1},
+		{"Restore", "POST", "/tasks/1/restore", http.StatusOK, 0},
+		{"Restore Active Task", "POST", "/tasks/1/restore", http.StatusNotFound, 0},
+		{"Restored Task Is Visible", "GET", "/tasks/1", http.StatusOK, 0},
+		{"Purge Active Task", "DELETE", "/tasks/2?purge=true", http.StatusOK, 0},
+		{"Trash Then Purge", "DELETE", "/tasks/1", http.StatusOK, 1},
+		{"Purge From Trash", "DELETE", "/tasks/1?purge=true", http.StatusOK, 0},
+		{"Invalid Purge", "DELETE", "/tasks/1?purge=maybe", http.StatusBadRequest, 0},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req, err := http.NewRequest(step.method, step.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != step.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, step.wantStatus, rr.Body.String())
+			}
+
+			// Check the trash listing
+			req, err = http.NewRequest("GET", "/tasks/trash", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			var page models.TaskPage
+			if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+				t.Fatalf("Failed to unmarshal trash: %v", err)
+			}
+			if page.Total != step.wantTrash {
+				t.Errorf("trash has %d tasks, want %d", page.Total, step.wantTrash)
+			}
+			for _, task := range page.Tasks {
+				if task.DeletedAt == nil {
+					t.Errorf("task %d in the trash has no deleted_at", task.ID)
+				}
+			}
+		})
+	}
+
+	// Both tasks are gone for good
+	tasks, _ := store.GetAllTasks()
+	if len(tasks) != 0 {
+		t.Errorf("store still has %d active tasks", len(tasks))
+	}
+}
+
+// TestDependencyEndpoints tests subtasks, blockers and the rule that a task
+// can't be completed before them
+func TestDependencyEndpoints(t *testing.T) {
+	handler, store := setupTest(t)
+	store.CreateTask(models.Task{Title: "Release", Status: "pending"})
+	store.CreateTask(models.Task{Title: "Write notes", Status: "pending"})
+	store.CreateTask(models.Task{Title: "Tag build", Status: "pending"})
+
+	// Steps run in order against the same store
+	steps := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantBody    string // a substring of the response body
+	}{
+		{"Add Subtask", "PATCH", "/tasks/2", mergePatchType, `{"parent_id": 1}`, http.StatusOK, `"parent_id":1`},
+		{"Missing Parent", "PATCH", "/tasks/3", mergePatchType, `{"parent_id": 99}`, http.StatusBadRequest, "parent_id"},
+		{"Parent Cycle", "PATCH", "/tasks/1", mergePatchType, `{"parent_id": 2}`, http.StatusUnprocessableEntity, `"cycle":[1,2,1]`},
+		{"List Subtasks", "GET", "/tasks/1/subtasks", "", "", http.StatusOK, `"title":"Write notes"`},
+		{"Add Blocker", "POST", "/tasks/1/blockers", "application/json", `{"blocker_id": 3}`, http.StatusCreated, `"title":"Tag build"`},
+		{"Missing Blocker", "POST", "/tasks/1/blockers", "application/json", `{"blocker_id": 99}`, http.StatusNotFound, "Task not found"},
+		{"Dependency Cycle", "POST", "/tasks/3/blockers", "application/json", `{"blocker_id": 1}`, http.StatusUnprocessableEntity, `"cycle":[1,3,1]`},
+		{"List Blockers", "GET", "/tasks/1/blockers", "", "", http.StatusOK, `"id":3`},
+		{"Complete While Blocked", "PATCH", "/tasks/1", mergePatchType, `{"status": "completed"}`, http.StatusUnprocessableEntity, `"blockers":[3],"error"`},
+		{"Complete Blocker", "PATCH", "/tasks/3", mergePatchType, `{"status": "completed"}`, http.StatusOK, `"status":"completed"`},
+		{"Complete With Open Subtask", "PATCH", "/tasks/1", mergePatchType, `{"status": "completed"}`, http.StatusUnprocessableEntity, `"subtasks":[2]`},
+		{"Complete Subtask", "PATCH", "/tasks/2", mergePatchType, `{"status": "completed"}`, http.StatusOK, `"status":"completed"`},
+		{"Complete", "PATCH", "/tasks/1", mergePatchType, `{"status": "completed"}`, http.StatusOK, `"status":"completed"`},
+		{"Remove Blocker", "DELETE", "/tasks/1/blockers/3", "", "", http.StatusOK, "Blocker removed"},
+		{"Remove Missing Blocker", "DELETE", "/tasks/1/blockers/3", "", "", http.StatusNotFound, "Dependency not found"},
+		{"Wrong Method", "PUT", "/tasks/1/blockers", "", "", http.StatusMethodNotAllowed, "Method not allowed"},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req, err := http.NewRequest(step.method, step.path, bytes.NewBufferString(step.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if step.contentType != "" {
+				req.Header.Set("Content-Type", step.contentType)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != step.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, step.wantStatus, rr.Body.String())
+			}
+			if !bytes.Contains(rr.Body.Bytes(), []byte(step.wantBody)) {
+				t.Errorf("response body %s does not contain %s", rr.Body.String(), step.wantBody)
+			}
+		})
+	}
+}
+
+// TestTags tests tag validation, tag filters and the /tags endpoint
+func TestTags(t *testing.T) {
+	handler, store := setupTest(t)
+	store.CreateTask(models.Task{Title: "Task 1", Status: "pending", Tags: []string{"backend", "sprint-1"}})
+	store.CreateTask(models.Task{Title: "Task 2", Status: "pending", Tags: []string{"backend"}})
+	store.CreateTask(models.Task{Title: "Task 3", Status: "pending", Tags: []string{"frontend"}})
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantTotal  int
+	}{
+		{"One Tag", "/tasks?tag=backend", http.StatusOK, 2},
+		{"All Tags", "/tasks?tag=backend&tag=sprint-1", http.StatusOK, 1},
+		{"Any Tag", "/tasks?tag=sprint-1&tag=frontend&tag_mode=any", http.StatusOK, 2},
+		{"Case Insensitive", "/tasks?tag=BACKEND", http.StatusOK, 2},
+		{"Invalid Mode", "/tasks?tag=backend&tag_mode=some", http.StatusBadRequest, 0},
+		{"Empty Tag", "/tasks?tag=", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var page models.TaskPage
+			if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if page.Total != tt.wantTotal {
+				t.Errorf("got %d tasks, want %d", page.Total, tt.wantTotal)
+			}
+		})
+	}
+
+	t.Run("Invalid Tag On Create", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/tasks", bytes.NewBufferString(`{"title": "Tagged", "tags": ["a,b"]}`))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("List Tags", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/tags", nil)
+		rr := httptest.NewRecorder()
+		NewTagsHandler(store).ServeHTTP(rr, req)
+
+		var tags []models.TagCount
+		if err := json.Unmarshal(rr.Body.Bytes(), &tags); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		want := []models.TagCount{{Name: "backend", Count: 2}, {Name: "frontend", Count: 1}, {Name: "sprint-1", Count: 1}}
+		if len(tags) != len(want) {
+			t.Fatalf("got tags %+v, want %+v", tags, want)
+		}
+		for i := range want {
+			if tags[i] != want[i] {
+				t.Errorf("tags[%d] = %+v, want %+v", i, tags[i], want[i])
+			}
+		}
+	})
+}
+
+// TestOwnership tests that only a task's owner or assignee can change it
+func TestOwnership(t *testing.T) {
+	handler, store := setupTest(t)
+	for _, email := range []string{"owner@example.com", "assignee@example.com", "other@example.com"} {
+		store.CreateUser(models.User{Name: "User", Email: email})
+	}
+	users := NewUsersHandler(store)
+
+	// Steps run in order against the same store
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		userID     int // user the caller acts as, or 0 for none
+		body       string
+		wantStatus int
+		wantBody   string // a substring of the response body
+	}{
+		{"Create As Owner", "POST", "/tasks", 1, `{"title": "Owned", "created_by": 3}`, http.StatusCreated, `"created_by":1`},
+		{"Caller Without User", "PATCH", "/tasks/1", 0, `{"title": "Renamed"}`, http.StatusForbidden, "owner or assignee"},
+		{"Other User Update", "PATCH", "/tasks/1", 2, `{"title": "Renamed"}`, http.StatusForbidden, "owner or assignee"},
+		{"Other User Adds Blocker", "POST", "/tasks/1/blockers", 2, `{"blocker_id": 99}`, http.StatusForbidden, "owner or assignee"},
+		{"Other User Removes Blocker", "DELETE", "/tasks/1/blockers/99", 2, "", http.StatusForbidden, "owner or assignee"},
+		{"Other User Starts Timer", "POST", "/tasks/1/timer/start", 2, "", http.StatusForbidden, "owner or assignee"},
+		{"Other User Stops Timer", "POST", "/tasks/1/timer/stop", 2, "", http.StatusForbidden, "owner or assignee"},
+		{"Other User Tracks Time", "POST", "/tasks/1/time-entries", 2, `{"started_at": "2025-03-02T09:00:00Z", "minutes": 30}`, http.StatusForbidden, "owner or assignee"},
+		{"Owner Tracks Time", "POST", "/tasks/1/time-entries", 1, `{"started_at": "2025-03-02T09:00:00Z", "minutes": 30}`, http.StatusCreated, `"minutes":30`},
+		{"Other User Deletes Time Entry", "DELETE", "/tasks/1/time-entries/1", 2, "", http.StatusForbidden, "owner or assignee"},
+		{"Missing Assignee", "PATCH", "/tasks/1", 1, `{"assignee_id": 99}`, http.StatusBadRequest, "assignee_id"},
+		{"Owner Assigns", "PATCH", "/tasks/1", 1, `{"assignee_id": 2}`, http.StatusOK, `"assignee_id":2`},
+		{"Assignee Update", "PATCH", "/tasks/1", 2, `{"title": "Renamed"}`, http.StatusOK, `"title":"Renamed"`},
+		{"Creator Is Read-Only", "PATCH", "/tasks/1", 2, `{"created_by": 2}`, http.StatusBadRequest, "read-only"},
+		{"Other User Delete", "DELETE", "/tasks/1", 3, "", http.StatusForbidden, "owner or assignee"},
+		{"Assigned Tasks", "GET", "/users/2/tasks", 0, "", http.StatusOK, `"total":1`},
+		{"Other User's Tasks", "GET", "/users/3/tasks", 0, "", http.StatusOK, `"total":0`},
+		{"Missing User's Tasks", "GET", "/users/99/tasks", 0, "", http.StatusNotFound, "User not found"},
+		{"Create User", "POST", "/users", 0, `{"name": "Dee", "email": "Dee@Example.com"}`, http.StatusCreated, `"email":"dee@example.com"`},
+		{"Duplicate Email", "POST", "/users", 0, `{"name": "Dee", "email": "dee@example.com"}`, http.StatusConflict, "already exists"},
+		{"Invalid Email", "POST", "/users", 0, `{"name": "Dee", "email": "dee"}`, http.StatusBadRequest, "email"},
+		{"Owner Delete", "DELETE", "/tasks/1", 1, "", http.StatusOK, "Task moved to trash"},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req, err := http.NewRequest(step.method, step.path, bytes.NewBufferString(step.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if step.method == "PATCH" {
+				req.Header.Set("Content-Type", mergePatchType)
+			}
+			req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{
+				UserID: step.userID,
+				Scopes: []string{auth.ScopeRead, auth.ScopeWrite},
+			}))
+			rr := httptest.NewRecorder()
+			if strings.HasPrefix(step.path, "/users") {
+				users.ServeHTTP(rr, req)
+			} else {
+				handler.ServeHTTP(rr, req)
+			}
+
+			if rr.Code != step.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, step.wantStatus, rr.Body.String())
+			}
+			if !bytes.Contains(rr.Body.Bytes(), []byte(step.wantBody)) {
+				t.Errorf("response body %s does not contain %s", rr.Body.String(), step.wantBody)
+			}
+		})
+	}
+}
+
+// TestOwnershipWithoutAuth tests that nobody's changes are checked when
+// authentication is disabled and requests have no principal
+func TestOwnershipWithoutAuth(t *testing.T) {
+	handler, store := setupTest(t)
+	store.CreateUser(models.User{Name: "Assignee", Email: "assignee@example.com"})
+
+	// Steps run in order against the same store, without a principal
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"Create Assigned", "POST", "/tasks", `{"title": "Assigned", "assignee_id": 1}`, http.StatusCreated},
+		{"Replace", "PUT", "/tasks/1", `{"title": "Replaced", "status": "pending", "assignee_id": 1}`, http.StatusOK},
+		{"Patch", "PATCH", "/tasks/1", `{"status": "completed"}`, http.StatusOK},
+		{"Reopen", "POST", "/tasks/1/reopen", "", http.StatusOK},
+		{"Add Blocker", "POST", "/tasks", `{"title": "Blocker"}`, http.StatusCreated},
+		{"Block", "POST", "/tasks/1/blockers", `{"blocker_id": 2}`, http.StatusCreated},
+		{"Track Time", "POST", "/tasks/1/time-entries", `{"started_at": "2025-03-02T09:00:00Z", "minutes": 30}`, http.StatusCreated},
+		{"Bulk", "POST", "/tasks/bulk", `{"operations": [{"op": "patch", "id": 1, "patch": {"title": "Bulk"}}]}`, http.StatusOK},
+		{"Delete", "DELETE", "/tasks/1", "", http.StatusOK},
+		{"Restore", "POST", "/tasks/1/restore", "", http.StatusOK},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req, err := http.NewRequest(step.method, step.path, bytes.NewBufferString(step.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if step.method == "PATCH" {
+				req.Header.Set("Content-Type", mergePatchType)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != step.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, step.wantStatus, rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestRecurrenceEndpoints tests recurring tasks and the /tasks/{id}/series endpoints
+func TestRecurrenceEndpoints(t *testing.T) {
+	handler, store := setupTest(t)
+	store.CreateTask(models.Task{Title: "One-off", Status: "pending"})
+
+	// Steps run in order against the same store
+	steps := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantBody    string // a substring of the response body
+	}{
+		{"Invalid Rule", "POST", "/tasks", "application/json", `{"title": "Chore", "recurrence": "FREQ=HOURLY"}`, http.StatusBadRequest, "recurrence"},
+		{"Create Recurring", "POST", "/tasks", "application/json", `{"title": "Chore", "due_date": "2026-03-02T09:00:00Z", "recurrence": "rrule:freq=weekly;count=3", "series_id": 1}`, http.StatusCreated, `"recurrence":"FREQ=WEEKLY;COUNT=3","series_id":2`},
+		{"Complete", "PATCH", "/tasks/2", mergePatchType, `{"status": "completed"}`, http.StatusOK, `"status":"completed"`},
+		{"Next Occurrence", "GET", "/tasks/3", "", "", http.StatusOK, `"due_date":"2026-03-09T09:00:00Z"`},
+		{"List Series", "GET", "/tasks/2/series", "", "", http.StatusOK, `"recurrence":"FREQ=WEEKLY;COUNT=2","series_id":2`},
+		{"Not A Series", "GET", "/tasks/1/series", "", "", http.StatusNotFound, "not part of a recurring series"},
+		{"Series ID Is Read-Only", "PATCH", "/tasks/3", mergePatchType, `{"series_id": 1}`, http.StatusBadRequest, "read-only"},
+		{"Edit Series Status", "PATCH", "/tasks/3/series", mergePatchType, `{"status": "completed"}`, http.StatusBadRequest, "whole series"},
+		{"Edit Series Rule", "PATCH", "/tasks/3/series", mergePatchType, `{"recurrence": "FREQ=DAILY;BYDAY=XX"}`, http.StatusBadRequest, "recurrence"},
+		{"Edit Series", "PATCH", "/tasks/3/series", mergePatchType, `{"title": "Weekly chore"}`, http.StatusOK, `"title":"Chore","description"`},
+		{"Open Occurrence Edited", "GET", "/tasks/3", "", "", http.StatusOK, `"title":"Weekly chore"`},
+		{"Stop Series", "DELETE", "/tasks/2/series", "", "", http.StatusOK, `"recurrence":"","series_id":2`},
+		{"Complete Stopped", "PATCH", "/tasks/3", mergePatchType, `{"status": "completed"}`, http.StatusOK, `"status":"completed"`},
+		{"No Further Occurrence", "GET", "/tasks/4", "", "", http.StatusNotFound, "Task not found"},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req, err := http.NewRequest(step.method, step.path, bytes.NewBufferString(step.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if step.contentType != "" {
+				req.Header.Set("Content-Type", step.contentType)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != step.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, step.wantStatus, rr.Body.String())
+			}
+			if !bytes.Contains(rr.Body.Bytes(), []byte(step.wantBody)) {
+				t.Errorf("response body %s does not contain %s", rr.Body.String(), step.wantBody)
+			}
+		})
+	}
+}
+
+// TestWebhookEndpoints tests managing webhooks and the events task changes queue for them
+func TestWebhookEndpoints(t *testing.T) {
+	tasks, store := setupTest(t)
+	hooks := NewWebhooksHandler(store)
+
+	// Steps run in order against the same store
+	steps := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantBody    string // a substring of the response body
+	}{
+		{"Invalid URL", "POST", "/webhooks", "application/json", `{"url": "ftp://example.com"}`, http.StatusBadRequest, "url"},
+		{"Unknown Event", "POST", "/webhooks", "application/json", `{"url": "https://example.com/hook", "events": ["task.renamed"]}`, http.StatusBadRequest, "events"},
+		{"Short Secret", "POST", "/webhooks", "application/json", `{"url": "https://example.com/hook", "secret": "abc"}`, http.StatusBadRequest, "secret"},
+		{"Create Filtered", "POST", "/webhooks", "application/json", `{"url": "https://example.com/done", "events": ["task.completed"], "secret": "0123456789abcdef"}`, http.StatusCreated, `"secret":"0123456789abcdef"`},
+		{"Create All Events", "POST", "/webhooks", "application/json", `{"url": "https://example.com/all"}`, http.StatusCreated, `"events":["*"],"secret":"whsec_`},
+		{"Secret Hidden", "GET", "/webhooks/1", "", "", http.StatusOK, `"events":["task.completed"],"created_at"`},
+		{"Create Task", "POST", "/tasks", "application/json", `{"title": "Ship it"}`, http.StatusCreated, `"id":1`},
+		{"Complete Task", "PATCH", "/tasks/1", mergePatchType, `{"status": "completed"}`, http.StatusOK, `"status":"completed"`},
+		{"Delete Task", "DELETE", "/tasks/1", "", "", http.StatusOK, "trash"},
+		{"Filtered Deliveries", "GET", "/webhooks/1/deliveries", "", "", http.StatusOK, `"event":"task.completed","payload":{"event":"task.completed"`},
+		{"Pending Deliveries", "GET", "/webhooks/2/deliveries?status=pending", "", "", http.StatusOK, `"event":"task.deleted"`},
+		{"Dead Letters", "GET", "/webhooks/2/deliveries?status=dead", "", "", http.StatusOK, `[]`},
+		{"Invalid Status", "GET", "/webhooks/2/deliveries?status=lost", "", "", http.StatusBadRequest, "status"},
+		{"Unknown Webhook", "GET", "/webhooks/9/deliveries", "", "", http.StatusNotFound, "Webhook not found"},
+		{"Delete Webhook", "DELETE", "/webhooks/2", "", "", http.StatusOK, "Webhook deleted"},
+		{"Deleted Webhook", "GET", "/webhooks/2", "", "", http.StatusNotFound, "Webhook not found"},
+		{"Create Creations Only", "POST", "/webhooks", "application/json", `{"url": "https://example.com/new", "events": ["task.created"]}`, http.StatusCreated, `"id":3`},
+		{"Create Recurring", "POST", "/tasks", "application/json", `{"title": "Water plants", "due_date": "2026-03-02T09:00:00Z", "recurrence": "FREQ=WEEKLY"}`, http.StatusCreated, `"id":2`},
+		{"Complete Occurrence", "PATCH", "/tasks/2", mergePatchType, `{"status": "completed"}`, http.StatusOK, `"status":"completed"`},
+		{"Reopen Occurrence", "POST", "/tasks/2/reopen", "", "", http.StatusOK, `"status":"pending"`},
+		{"Complete Again", "PATCH", "/tasks/2", mergePatchType, `{"status": "completed"}`, http.StatusOK, `"status":"completed"`},
+		{"Next Occurrence Delivered", "GET", "/webhooks/3/deliveries", "", "", http.StatusOK, `"event":"task.created","payload":{"event":"task.created","occurred_at"`},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req, err := http.NewRequest(step.method, step.path, bytes.NewBufferString(step.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if step.contentType != "" {
+				req.Header.Set("Content-Type", step.contentType)
+			}
+			rr := httptest.NewRecorder()
+			if strings.HasPrefix(step.path, "/webhooks") {
+				hooks.ServeHTTP(rr, req)
+			} else {
+				tasks.ServeHTTP(rr, req)
+			}
+
+			if rr.Code != step.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, step.wantStatus, rr.Body.String())
+			}
+			if !bytes.Contains(rr.Body.Bytes(), []byte(step.wantBody)) {
+				t.Errorf("response body %s does not contain %s", rr.Body.String(), step.wantBody)
+			}
+		})
+	}
+
+	// The filtered webhook only got the three completions
+	deliveries, err := store.ListDeliveries(1, "")
+	if err != nil || len(deliveries) != 3 {
+		t.Errorf("ListDeliveries(1) = %+v, %v, want three deliveries", deliveries, err)
+	}
+	// The recurring task and the one occurrence completing it created were announced once each
+	deliveries, err = store.ListDeliveries(3, "")
+	if err != nil || len(deliveries) != 2 {
+		t.Errorf("ListDeliveries(3) = %+v, %v, want two deliveries", deliveries, err)
+	}
+}
+
+// unqueuedStore is a store whose event queue is down, in and out of transactions
+type unqueuedStore struct {
+	database.TaskStore
+}
+
+func (s unqueuedStore) EnqueueEvent(event string, payload []byte) error {
+	return errors.New("queue is down")
+}
+
+func (s unqueuedStore) WithActor(actor database.Actor) database.TaskStore {
+	return unqueuedStore{s.TaskStore.WithActor(actor)}
+}
+
+func (s unqueuedStore) RunInTx(fn func(store database.TaskStore) error) error {
+	return s.TaskStore.RunInTx(func(tx database.TaskStore) error {
+		return fn(unqueuedStore{tx})
+	})
+}
+
+// TestEventQueueFailure tests that a change whose event can't be queued isn't kept,
+// and that the failure is reported as a server error
+func TestEventQueueFailure(t *testing.T) {
+	store := database.NewMemoryStore()
+	if _, err := store.CreateTask(models.Task{Title: "Existing", Status: models.StatusPending}); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewTasksHandler(unqueuedStore{store})
+
+	steps := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+	}{
+		{"Create", "POST", "/tasks", "application/json", `{"title": "New"}`},
+		{"Update", "PUT", "/tasks/1", "application/json", `{"title": "Renamed", "status": "pending"}`},
+		{"Patch", "PATCH", "/tasks/1", mergePatchType, `{"status": "completed"}`},
+		{"Delete", "DELETE", "/tasks/1", "", ""},
+		{"Atomic Bulk", "POST", "/tasks/bulk", "application/json", `{"operations": [{"op": "patch", "id": 1, "patch": {"title": "Renamed"}}]}`},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req, _ := http.NewRequest(step.method, step.path, bytes.NewBufferString(step.body))
+			if step.contentType != "" {
+				req.Header.Set("Content-Type", step.contentType)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != http.StatusInternalServerError {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, http.StatusInternalServerError, rr.Body.String())
+			}
+		})
+	}
+
+	tasks, err := store.GetAllTasks()
+	if err != nil || len(tasks) != 1 || tasks[0].Title != "Existing" || tasks[0].Status != models.StatusPending {
+		t.Errorf("GetAllTasks() = %+v, %v, want only the unchanged existing task", tasks, err)
+	}
+}
+
+// TestEventStream tests streaming, resuming and filtering task events
+func TestEventStream(t *testing.T) {
+	handler, store := setupTest(t)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	store.CreateTask(models.Task{Title: "One", Status: models.StatusPending})
+	store.CreateTask(models.Task{Title: "Two", Status: models.StatusCompleted})
+	store.CreateTask(models.Task{Title: "Three", Status: models.StatusPending})
+
+	// connect opens a stream and returns a function reading its next event
+	connect := func(t *testing.T, path, lastEventID string) func() map[string]string {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		t.Cleanup(cancel)
+		req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+path, nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("stream returned status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+
+		reader := bufio.NewReader(resp.Body)
+		return func() map[string]string {
+			event := map[string]string{}
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					t.Fatalf("reading stream: %v", err)
+				}
+				line = strings.TrimSuffix(line, "\n")
+				if line == "" && event["event"] != "" {
+					return event
+				}
+				if field, value, ok := strings.Cut(line, ": "); ok && field != "" {
+					event[field] = value
+				}
+			}
+		}
+	}
+
+	t.Run("Resume With Filter", func(t *testing.T) {
+		next := connect(t, "/tasks/events?status=pending", "1")
+		if event := next(); event["id"] != "3" || event["event"] != models.EventTaskCreated || !strings.Contains(event["data"], `"title":"Three"`) {
+			t.Errorf("first event = %v, want task 3 created as event 3", event)
+		}
+
+		// Live events follow; completed tasks' don't match
+		store.CreateTask(models.Task{Title: "Four", Status: models.StatusCompleted})
+		store.DeleteTask(1, 0)
+		if event := next(); event["id"] != "5" || event["event"] != models.EventTaskDeleted || !strings.Contains(event["data"], `"deleted_at"`) {
+			t.Errorf("live event = %v, want task 1 deleted as event 5", event)
+		}
+	})
+
+	t.Run("Lost Events Reset", func(t *testing.T) {
+		next := connect(t, "/tasks/events", "99")
+		if event := next(); event["event"] != "reset" || event["id"] != "5" {
+			t.Errorf("first event = %v, want a reset to event 5", event)
+		}
+	})
+
+	t.Run("Invalid Last-Event-ID", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/tasks/events?last_event_id=abc", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "Last-Event-ID") {
+			t.Errorf("handler returned %v %s, want a 400 naming Last-Event-ID", rr.Code, rr.Body.String())
+		}
+	})
+}
+
+// TestAuditEndpoint tests that task changes are audited with their caller and request
+func TestAuditEndpoint(t *testing.T) {
+	tasks, store := setupTest(t)
+	handler := RequestID(tasks)
+	audit := NewAuditHandler(store)
+
+	// Steps run in order against the same store; requestID is sent as X-Request-ID if set
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		requestID  string
+		body       string
+		wantStatus int
+		wantBody   string // a substring of the response body
+	}{
+		{"Create Task", "POST", "/tasks", "create-1", `{"title": "Audit me"}`, http.StatusCreated, `"id":1`},
+		{"Rename Task", "PATCH", "/tasks/1", "", `{"title": "Audited"}`, http.StatusOK, `"title":"Audited"`},
+		{"Delete Task", "DELETE", "/tasks/1", "", "", http.StatusOK, "trash"},
+		{"Task Log", "GET", "/audit?entity=task&id=1", "", "", http.StatusOK,
+			`"action":"update","actor":"apikey:ci",`},
+		{"Create Entry", "GET", "/audit?entity=task&id=1&until=2999-01-01", "", "", http.StatusOK,
+			`"action":"create","actor":"apikey:ci","request_id":"create-1","changes":{`},
+		{"Changes", "GET", "/audit?entity=task&id=1&limit=1&cursor=eyJpZCI6M30", "", "", http.StatusOK,
+			`"changes":{"title":{"before":"Audit me","after":"Audited"}`},
+		{"Paged", "GET", "/audit?limit=2", "", "", http.StatusOK, `"next_cursor":"eyJpZCI6Mn0"`},
+		{"Empty Range", "GET", "/audit?since=2999-01-01", "", "", http.StatusOK, `"entries":[]`},
+		{"Unknown Entity", "GET", "/audit?entity=widget", "", "", http.StatusBadRequest, "entity"},
+		{"ID Without Entity", "GET", "/audit?id=1", "", "", http.StatusBadRequest, "requires entity"},
+		{"Invalid Since", "GET", "/audit?since=yesterday", "", "", http.StatusBadRequest, "since"},
+		{"Invalid Cursor", "GET", "/audit?cursor=bogus", "", "", http.StatusBadRequest, "cursor"},
+		{"Wrong Method", "POST", "/audit", "", "", http.StatusMethodNotAllowed, "Method not allowed"},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req, err := http.NewRequest(step.method, step.path, bytes.NewBufferString(step.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if step.method == "PATCH" {
+				req.Header.Set("Content-Type", mergePatchType)
+			}
+			if step.requestID != "" {
+				req.Header.Set(RequestIDHeader, step.requestID)
+			}
+			req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{
+				Subject: "apikey:ci",
+				Scopes:  []string{auth.ScopeRead, auth.ScopeWrite},
+			}))
+			rr := httptest.NewRecorder()
+			if strings.HasPrefix(step.path, "/audit") {
+				audit.ServeHTTP(rr, req)
+			} else {
+				handler.ServeHTTP(rr, req)
+				if id := rr.Header().Get(RequestIDHeader); id == "" || (step.requestID != "" && id != step.requestID) {
+					t.Errorf("response has request ID %q, want %q or a generated one", id, step.requestID)
+				}
+			}
+
+			if rr.Code != step.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, step.wantStatus, rr.Body.String())
+			}
+			if !bytes.Contains(rr.Body.Bytes(), []byte(step.wantBody)) {
+				t.Errorf("response body %s does not contain %s", rr.Body.String(), step.wantBody)
+			}
+		})
+	}
+
+	// Each request got its own generated ID
+	page, _ := store.ListAudit(database.AuditFilter{})
+	if len(page.Entries) != 3 || page.Entries[0].RequestID == "" || page.Entries[0].RequestID == page.Entries[1].RequestID {
+		t.Errorf("ListAudit() = %+v, want three entries with distinct request IDs", page.Entries)
+	}
+}
+
+// TestCommentEndpoints tests commenting on tasks and changing comments
+func TestCommentEndpoints(t *testing.T) {
+	handler, store := setupTest(t)
+	store.CreateTask(models.Task{Title: "Discuss me", Status: models.StatusPending})
+
+	// Steps run in order against the same store, as the caller with subject "apikey:<caller>"
+	steps := []struct {
+		name       string
+		caller     string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string // a substring of the response body
+	}{
+		{"Empty List", "alice", "GET", "/tasks/1/comments", "", http.StatusOK, `[]`},
+		{"Create", "alice", "POST", "/tasks/1/comments", `{"body": "Looks **good**"}`, http.StatusCreated,
+			`"id":1,"task_id":1,"body":"Looks **good**","author":"apikey:alice","author_id":null,`},
+		{"Reply", "bob", "POST", "/tasks/1/comments", `{"body": "Agreed"}`, http.StatusCreated, `"author":"apikey:bob"`},
+		{"Blank Body", "bob", "POST", "/tasks/1/comments", `{"body": "  "}`, http.StatusBadRequest, "body"},
+		{"Too Long", "bob", "POST", "/tasks/1/comments", `{"body": "` + strings.Repeat("a", models.MaxCommentLength+1) + `"}`, http.StatusBadRequest, "at most"},
+		{"Missing Task", "bob", "POST", "/tasks/9/comments", `{"body": "Hello?"}`, http.StatusNotFound, "Task not found"},
+		{"List", "bob", "GET", "/tasks/1/comments", "", http.StatusOK, `"body":"Agreed"`},
+		{"Get", "bob", "GET", "/tasks/1/comments/1", "", http.StatusOK, `"edited_at":null`},
+		{"Edit Someone Else's", "bob", "PUT", "/tasks/1/comments/1", `{"body": "Hijacked"}`, http.StatusForbidden, "author"},
+		{"Edit", "alice", "PUT", "/tasks/1/comments/1", `{"body": "Looks *great*"}`, http.StatusOK, `"body":"Looks *great*"`},
+		{"Delete Someone Else's", "alice", "DELETE", "/tasks/1/comments/2", "", http.StatusForbidden, "author"},
+		{"Delete", "bob", "DELETE", "/tasks/1/comments/2", "", http.StatusOK, "Comment deleted"},
+		{"Deleted", "bob", "GET", "/tasks/1/comments/2", "", http.StatusNotFound, "Comment not found"},
+		{"Invalid ID", "bob", "GET", "/tasks/1/comments/abc", "", http.StatusBadRequest, "Invalid comment ID"},
+		{"Wrong Method", "bob", "PATCH", "/tasks/1/comments/1", "", http.StatusMethodNotAllowed, "Method not allowed"},
+		{"Trash Task", "alice", "DELETE", "/tasks/1", "", http.StatusOK, "trash"},
+		{"Hidden In Trash", "alice", "GET", "/tasks/1/comments", "", http.StatusNotFound, "Task not found"},
+		{"Restore Task", "alice", "POST", "/tasks/1/restore", "", http.StatusOK, `"id":1`},
+		{"Back With Task", "alice", "GET", "/tasks/1/comments", "", http.StatusOK, `"body":"Looks *great*"`},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req, err := http.NewRequest(step.method, step.path, bytes.NewBufferString(step.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{
+				Subject: "apikey:" + step.caller,
+				Scopes:  []string{auth.ScopeRead, auth.ScopeWrite},
+			}))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != step.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, step.wantStatus, rr.Body.String())
+			}
+			if !bytes.Contains(rr.Body.Bytes(), []byte(step.wantBody)) {
+				t.Errorf("response body %s does not contain %s", rr.Body.String(), step.wantBody)
+			}
+		})
+	}
+}
+
+// multipartFile returns a multipart/form-data body with content as the file
+// field named field, and its Content-Type
+func multipartFile(t *testing.T, field, filename, content string) (string, string) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	writer.Close()
+	return body.String(), writer.FormDataContentType()
+}
+
+func TestAttachmentEndpoints(t *testing.T) {
+	store := database.NewMemoryStore()
+	blobStore, err := blobs.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("blobs.NewStore() error = %v", err)
+	}
+	handler := NewTasksHandler(store, WithAttachments(blobStore, AttachmentLimits{MaxSize: 64, Types: []string{"text/*"}}))
+	store.CreateTask(models.Task{Title: "Attach to me", Status: models.StatusPending})
+	store.CreateUser(models.User{Name: "Owner", Email: "owner@example.com"})
+	owner := 1
+	store.CreateTask(models.Task{Title: "Someone else's", Status: models.StatusPending, CreatedBy: &owner})
+
+	notes, notesType := multipartFile(t, "file", `C:\Users\alice\notes.txt`, "Meeting notes")
+	copied, copiedType := multipartFile(t, "file", "copy.txt", "Meeting notes")
+	image, imageType := multipartFile(t, "file", "pixel.png", "\x89PNG\r\n\x1a\n")
+	large, largeType := multipartFile(t, "file", "large.txt", strings.Repeat("a", 65))
+	empty, emptyType := multipartFile(t, "file", "empty.txt", "")
+	wrongField, wrongFieldType := multipartFile(t, "upload", "notes.txt", "Meeting notes")
+
+	// Steps run in order against the same store, as the caller with subject "apikey:<caller>"
+	steps := []struct {
+		name        string
+		caller      string
+		method      string
+		path        string
+		body        string
+		contentType string
+		rangeHeader string
+		wantStatus  int
+		wantBody    string // a substring of the response body
+	}{
+		{"Empty List", "alice", "GET", "/tasks/1/attachments", "", "", "", http.StatusOK, `[]`},
+		{"Upload", "alice", "POST", "/tasks/1/attachments", notes, notesType, "", http.StatusCreated,
+			`"id":1,"task_id":1,"filename":"notes.txt","content_type":"text/plain; charset=utf-8","size":13,`},
+		{"Upload Same Content", "bob", "POST", "/tasks/1/attachments", copied, copiedType, "", http.StatusCreated, `"uploaded_by":"apikey:bob"`},
+		{"Disallowed Type", "bob", "POST", "/tasks/1/attachments", image, imageType, "", http.StatusUnsupportedMediaType, "image/png"},
+		{"Too Large", "bob", "POST", "/tasks/1/attachments", large, largeType, "", http.StatusRequestEntityTooLarge, "at most 64 bytes"},
+		{"Empty File", "bob", "POST", "/tasks/1/attachments", empty, emptyType, "", http.StatusBadRequest, "must not be empty"},
+		{"Missing File", "bob", "POST", "/tasks/1/attachments", wrongField, wrongFieldType, "", http.StatusBadRequest, "is required"},
+		{"Not Multipart", "bob", "POST", "/tasks/1/attachments", `{"file": "notes"}`, "application/json", "", http.StatusUnsupportedMediaType, "multipart/form-data"},
+		{"Missing Task", "bob", "POST", "/tasks/9/attachments", notes, notesType, "", http.StatusNotFound, "Task not found"},
+		{"Upload To Someone Else's Task", "bob", "POST", "/tasks/2/attachments", notes, notesType, "", http.StatusForbidden, "owner or assignee"},
+		{"List", "bob", "GET", "/tasks/1/attachments", "", "", "", http.StatusOK, `"filename":"copy.txt"`},
+		{"Download", "bob", "GET", "/tasks/1/attachments/1", "", "", "", http.StatusOK, "Meeting notes"},
+		{"Download Range", "bob", "GET", "/tasks/1/attachments/1", "", "", "bytes=8-12", http.StatusPartialContent, "notes"},
+		{"Delete Someone Else's", "bob", "DELETE", "/tasks/1/attachments/1", "", "", "", http.StatusForbidden, "uploader"},
+		{"Delete", "alice", "DELETE", "/tasks/1/attachments/1", "", "", "", http.StatusOK, "Attachment deleted"},
+		{"Deleted", "alice", "GET", "/tasks/1/attachments/1", "", "", "", http.StatusNotFound, "Attachment not found"},
+		{"Shared Content Kept", "bob", "GET", "/tasks/1/attachments/2", "", "", "", http.StatusOK, "Meeting notes"},
+		{"Invalid ID", "bob", "GET", "/tasks/1/attachments/abc", "", "", "", http.StatusBadRequest, "Invalid attachment ID"},
+		{"Wrong Method", "bob", "PUT", "/tasks/1/attachments/2", "", "", "", http.StatusMethodNotAllowed, "Method not allowed"},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req, err := http.NewRequest(step.method, step.path, bytes.NewBufferString(step.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if step.contentType != "" {
+				req.Header.Set("Content-Type", step.contentType)
+			}
+			if step.rangeHeader != "" {
+				req.Header.Set("Range", step.rangeHeader)
+			}
+			req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{
+				Subject: "apikey:" + step.caller,
+				Scopes:  []string{auth.ScopeRead, auth.ScopeWrite},
+			}))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != step.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, step.wantStatus, rr.Body.String())
+			}
+			if !bytes.Contains(rr.Body.Bytes(), []byte(step.wantBody)) {
+				t.Errorf("response body %s does not contain %s", rr.Body.String(), step.wantBody)
+			}
+		})
+	}
+
+	// Deleting the last attachment with some content leaves it for the sweeper to remove
+	attachment, _ := store.GetAttachment(1, 2)
+	req := httptest.NewRequest("DELETE", "/tasks/1/attachments/2", nil)
+	req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Subject: "apikey:bob", Scopes: []string{auth.ScopeWrite}}))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if file, err := blobStore.Open(attachment.SHA256); err != nil {
+		t.Errorf("blob of the last deleted attachment before a sweep: Open() error = %v", err)
+	} else {
+		file.Close()
+	}
+	if removed, err := blobStore.Sweep(store.BlobInUse, time.Now().Add(time.Hour)); err != nil || removed != 1 {
+		t.Errorf("Sweep() after deleting the last attachment = %d, %v, want its blob removed", removed, err)
+	}
+
+	// Only the task's owner or assignee can remove an attachment from it, even their own
+	id, _ := store.CreateAttachment(models.Attachment{TaskID: 2, Filename: "notes.txt", ContentType: "text/plain", Size: 13,
+		SHA256: attachment.SHA256, UploadedBy: "apikey:bob"})
+	req = httptest.NewRequest("DELETE", "/tasks/2/attachments/"+strconv.FormatInt(id, 10), nil)
+	req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Subject: "apikey:bob", Scopes: []string{auth.ScopeWrite}}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("deleting an attachment of someone else's task: got status %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	// Without a blob store the endpoints are disabled
+	rr = httptest.NewRecorder()
+	NewTasksHandler(store).ServeHTTP(rr, httptest.NewRequest("GET", "/tasks/1/attachments", nil))
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("attachments without a blob store: got status %v want %v", rr.Code, http.StatusNotImplemented)
+	}
+}
+
+func TestProjectEndpoints(t *testing.T) {
+	tasks, store := setupTest(t)
+	projects := NewProjectsHandler(store)
+	mux := http.NewServeMux()
+	mux.Handle("/tasks", tasks)
+	mux.Handle("/tasks/", tasks)
+	mux.Handle("/projects", projects)
+	mux.Handle("/projects/", projects)
+
+	// Steps run in order against the same store
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string // a substring of the response body
+	}{
+		{"Create Project", "POST", "/projects", `{"name": " Launch "}`, http.StatusCreated,
+			`"name":"Launch","description":"","columns":[{"name":"To do","status":"pending"},{"name":"In progress","status":"in_progress"},{"name":"Done","status":"completed"}]`},
+		{"Invalid Project", "POST", "/projects", `{"name": "", "columns": [{"name": "A", "status": "pending"}, {"name": "B", "status": "pending"}]}`,
+			http.StatusBadRequest, "different status"},
+		{"List Projects", "GET", "/projects", "", http.StatusOK, `"name":"Launch"`},
+		{"First Task", "POST", "/tasks", `{"title": "First", "project_id": 1}`, http.StatusCreated, `"project_id":1,"position":"a0"`},
+		{"Second Task", "POST", "/tasks", `{"title": "Second", "project_id": 1}`, http.StatusCreated, `"position":"a1"`},
+		{"Third Task", "POST", "/tasks", `{"title": "Third", "project_id": 1}`, http.StatusCreated, `"position":"a2"`},
+		{"Loose Task", "POST", "/tasks", `{"title": "Loose"}`, http.StatusCreated, `"project_id":null,"position":""`},
+		{"Missing Project", "POST", "/tasks", `{"title": "Lost", "project_id": 9}`, http.StatusBadRequest, "project_id"},
+		{"Invalid Position", "POST", "/tasks", `{"title": "Odd", "project_id": 1, "position": "a0 "}`, http.StatusBadRequest, "position"},
+		{"Move To Top", "POST", "/tasks/3/move", `{"before_id": 1}`, http.StatusOK, `"status":"pending"`},
+		{"Move To Column", "POST", "/tasks/1/move", `{"status": "in_progress"}`, http.StatusOK, `"status":"in_progress","due_date"`},
+		{"Neighbor In Other Column", "POST", "/tasks/2/move", `{"after_id": 1}`, http.StatusBadRequest, "after_id"},
+		{"Both Neighbors", "POST", "/tasks/2/move", `{"after_id": 3, "before_id": 3}`, http.StatusBadRequest, "before_id"},
+		{"Move Past Neighbor", "POST", "/tasks/2/move", `{"before_id": 3}`, http.StatusOK, `"id":2`},
+		{"Complete", "POST", "/tasks/1/move", `{"status": "completed"}`, http.StatusOK, `"status":"completed"`},
+		{"Against Workflow", "POST", "/tasks/1/move", `{"status": "pending"}`, http.StatusUnprocessableEntity, "Cannot change status"},
+		{"Not In Project", "POST", "/tasks/4/move", `{}`, http.StatusConflict, "not in a project"},
+		{"Missing Task", "POST", "/tasks/9/move", `{}`, http.StatusNotFound, "Task not found"},
+		{"Patch Out Of Project", "PATCH", "/tasks/2", `{"project_id": null}`, http.StatusOK, `"project_id":null,"position":""`},
+		{"Patch Invalid Position", "PATCH", "/tasks/2", `{"project_id": 1, "position": "a0 "}`, http.StatusBadRequest, `"position":"must be a position`},
+		{"Patch Back Into Place", "PATCH", "/tasks/2", `[{"op": "replace", "path": "/project_id", "value": 1}, {"op": "replace", "path": "/position", "value": "Zy"}]`,
+			http.StatusOK, `"project_id":1,"position":"Zy"`},
+		{"Project Tasks", "GET", "/projects/1/tasks?status=pending", "", http.StatusOK, `"title":"Third"`},
+		{"Delete Project With Tasks", "DELETE", "/projects/1", "", http.StatusConflict, "still has tasks"},
+		{"Rename Project", "PUT", "/projects/1", `{"name": "Launch v2"}`, http.StatusOK, `"name":"Launch v2"`},
+		{"Missing Board", "GET", "/projects/9/board", "", http.StatusNotFound, "Project not found"},
+		{"Invalid Project ID", "GET", "/projects/abc", "", http.StatusBadRequest, "Invalid project ID"},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req, err := http.NewRequest(step.method, step.path, bytes.NewBufferString(step.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if step.method == "PATCH" && strings.HasPrefix(step.body, "[") {
+				req.Header.Set("Content-Type", "application/json-patch+json")
+			} else if step.method == "PATCH" {
+				req.Header.Set("Content-Type", "application/merge-patch+json")
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != step.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, step.wantStatus, rr.Body.String())
+			}
+			if !bytes.Contains(rr.Body.Bytes(), []byte(step.wantBody)) {
+				t.Errorf("response body %s does not contain %s", rr.Body.String(), step.wantBody)
+			}
+		})
+	}
+
+	// The last patch put task 2 back in the project, ahead of task 3 as before
+	if task, _ := store.GetTaskByID(2); task.ProjectID == nil || *task.ProjectID != 1 || task.Position != "Zy" {
+		t.Errorf("project_id and position after patching = %v, %q, want 1, Zy", task.ProjectID, task.Position)
+	}
+
+	// The board lists every column, each in board order
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/projects/1/board", nil))
+	var board models.Board
+	if err := json.NewDecoder(rr.Body).Decode(&board); err != nil {
+		t.Fatalf("Failed to decode board: %v", err)
+	}
+	var got [][]int
+	for _, column := range board.Columns {
+		ids := []int{}
+		for _, task := range column.Tasks {
+			ids = append(ids, task.ID)
+		}
+		got = append(got, ids)
+	}
+	if want := [][]int{{2, 3}, {}, {1}}; !reflect.DeepEqual(got, want) || board.Project.Name != "Launch v2" {
+		t.Errorf("board columns = %v for project %q, want %v", got, board.Project.Name, want)
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	handler, store := setupTest(t)
+
+	csvFile := "title,status,due_date,tags\n" +
+		"Buy milk,pending,2026-03-02,\"home,errands\"\n" +
+		",pending,,\n" +
+		"Bad status,later,,\n"
+	jsonlFile := `{"title": "From JSON", "status": "completed", "id": 42}` + "\n" +
+		`{"title": "Orphan", "parent_id": 99}` + "\n"
+	icsFile := "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY:From a calendar\r\nDUE:20260310T120000Z\r\nSTATUS:IN-PROCESS\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+
+	// Steps run in order against the same store
+	steps := []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		contentType string
+		wantStatus  int
+		wantBody    string // a substring of the response body
+	}{
+		{"Import CSV", "POST", "/tasks/import?format=csv", csvFile, "", http.StatusOK,
+			`"errors":[{"line":3,"error":"Invalid task","fields":{"title":"is required"}},{"line":4,"error":"Invalid task","fields":{"status":`},
+		{"Import JSON Lines", "POST", "/tasks/import", jsonlFile, "application/x-ndjson", http.StatusOK,
+			`{"errors":[{"line":2,"error":"Invalid task","fields":{"parent_id":"must be the ID of a task that isn't in the trash"}}],"ids":[2],"imported":1}`},
+		{"Import iCalendar", "POST", "/tasks/import", icsFile, "text/calendar; charset=utf-8", http.StatusOK, `"ids":[3],"imported":1`},
+		{"Nothing Valid", "POST", "/tasks/import?format=csv", "title\n\"\"\n", "", http.StatusUnprocessableEntity, "No tasks were imported"},
+		{"No Tasks", "POST", "/tasks/import?format=jsonl", "\n", "", http.StatusBadRequest, "contains no tasks"},
+		{"Malformed File", "POST", "/tasks/import?format=csv", "description\nx\n", "", http.StatusBadRequest, `"line":1`},
+		{"Unknown Content-Type", "POST", "/tasks/import", csvFile, "application/json", http.StatusUnsupportedMediaType, "Content-Type"},
+		{"Unknown Format", "POST", "/tasks/import?format=xlsx", csvFile, "", http.StatusBadRequest, `"format":"must be one of csv, jsonl, ics"`},
+		{"Export CSV", "GET", "/tasks/export?format=csv&sort=title&order=asc", "", "", http.StatusOK,
+			"id,title,description,status,priority,due_date,tags,recurrence,parent_id,assignee_id,project_id,position,estimate_minutes,created_at,updated_at\n" +
+				"1,Buy milk,,pending,medium,2026-03-02T00:00:00Z,\"errands,home\""},
+		{"Export JSON Lines", "GET", "/tasks/export?format=jsonl&status=completed", "", "", http.StatusOK, `"title":"From JSON"`},
+		{"Export iCalendar", "GET", "/tasks/export?format=ics&status=in_progress", "", "", http.StatusOK,
+			"BEGIN:VTODO\r\nUID:task-3@task_manager_api\r\n"},
+		{"Export Missing Format", "GET", "/tasks/export", "", "", http.StatusBadRequest, `"format"`},
+		{"Export Invalid Filter", "GET", "/tasks/export?format=csv&status=later", "", "", http.StatusBadRequest, `"status"`},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req, err := http.NewRequest(step.method, step.path, bytes.NewBufferString(step.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if step.contentType != "" {
+				req.Header.Set("Content-Type", step.contentType)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != step.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, step.wantStatus, rr.Body.String())
+			}
+			if !bytes.Contains(rr.Body.Bytes(), []byte(step.wantBody)) {
+				t.Errorf("response body %s does not contain %s", rr.Body.String(), step.wantBody)
+			}
+		})
+	}
+
+	// An export pages through every matching task
+	for i := 0; i < exportPageSize; i++ {
+		store.CreateTask(models.Task{Title: "Task " + strconv.Itoa(i), Status: models.StatusPending})
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/tasks/export?format=jsonl", nil))
+	if got := strings.Count(rr.Body.String(), "\n"); got != exportPageSize+3 {
+		t.Errorf("export of %d tasks has %d lines", exportPageSize+3, got)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Errorf("export Content-Type = %q, want application/x-ndjson", contentType)
+	}
+}
+
+func TestTimeTracking(t *testing.T) {
+	tasks, store := setupTest(t)
+	mux := http.NewServeMux()
+	mux.Handle("/tasks", tasks)
+	mux.Handle("/tasks/", tasks)
+	mux.Handle("/reports/", NewReportsHandler(store))
+	store.CreateTask(models.Task{Title: "Write report", Status: models.StatusPending})
+	store.CreateTask(models.Task{Title: "Review report", Status: models.StatusCompleted})
+
+	// Steps run in order against the same store, as the caller with subject "apikey:<caller>"
+	steps := []struct {
+		name       string
+		caller     string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string // a substring of the response body
+	}{
+		{"Estimate", "alice", "POST", "/tasks", `{"title": "Estimated", "estimate_minutes": 90}`, http.StatusCreated, `"estimate_minutes":90`},
+		{"Invalid Estimate", "alice", "POST", "/tasks", `{"title": "Odd", "estimate_minutes": 0}`, http.StatusBadRequest, `"estimate_minutes":"must be a positive number of minutes"`},
+		{"Re-estimate", "alice", "PATCH", "/tasks/3", `{"estimate_minutes": 120}`, http.StatusOK, `"estimate_minutes":120`},
+		{"Start", "alice", "POST", "/tasks/1/timer/start", `{"note": "drafting"}`, http.StatusCreated,
+			`"id":1,"task_id":1,"tracked_by":"apikey:alice","user_id":null`},
+		{"Start Again", "alice", "POST", "/tasks/2/timer/start", "", http.StatusConflict, `"running":{"id":1,`},
+		{"Start As Someone Else", "bob", "POST", "/tasks/2/timer/start", "", http.StatusCreated, `"tracked_by":"apikey:bob"`},
+		{"Stop Someone Else's", "bob", "POST", "/tasks/1/timer/stop", "", http.StatusConflict, "no timer running"},
+		{"Stop", "alice", "POST", "/tasks/1/timer/stop", "", http.StatusOK, `"note":"drafting"`},
+		{"Stop Missing Task", "alice", "POST", "/tasks/9/timer/stop", "", http.StatusNotFound, "Task not found"},
+		{"Unknown Timer Action", "alice", "POST", "/tasks/1/timer/pause", "", http.StatusNotFound, "Not found"},
+		{"Manual Entry", "alice", "POST", "/tasks/1/time-entries",
+			`{"started_at": "2025-03-02T09:00:00Z", "stopped_at": "2025-03-02T10:30:00Z"}`, http.StatusCreated, `"minutes":90`},
+		{"Manual Minutes", "bob", "POST", "/tasks/2/time-entries",
+			`{"started_at": "2025-03-03T09:00:00Z", "minutes": 45, "note": "review"}`, http.StatusCreated, `"stopped_at":"2025-03-03T09:45:00Z","minutes":45`},
+		{"Missing End", "alice", "POST", "/tasks/1/time-entries", `{"started_at": "2025-03-02T09:00:00Z"}`, http.StatusBadRequest, `"stopped_at"`},
+		{"Both Ends", "alice", "POST", "/tasks/1/time-entries",
+			`{"started_at": "2025-03-02T09:00:00Z", "stopped_at": "2025-03-02T10:00:00Z", "minutes": 60}`, http.StatusBadRequest, `"minutes"`},
+		{"Backwards", "alice", "POST", "/tasks/1/time-entries",
+			`{"started_at": "2025-03-02T09:00:00Z", "stopped_at": "2025-03-02T08:00:00Z"}`, http.StatusBadRequest, "must be after started_at"},
+		{"Future", "alice", "POST", "/tasks/1/time-entries",
+			`{"started_at": "2099-03-02T09:00:00Z", "minutes": 30}`, http.StatusBadRequest, "must not be in the future"},
+		{"Missing Task", "alice", "POST", "/tasks/9/time-entries", `{"started_at": "2025-03-02T09:00:00Z", "minutes": 5}`, http.StatusNotFound, "Task not found"},
+		{"List", "alice", "GET", "/tasks/1/time-entries", "", http.StatusOK, `"started_at":"2025-03-02T09:00:00Z"`},
+		{"Get", "alice", "GET", "/tasks/2/time-entries/4", "", http.StatusOK, `"note":"review"`},
+		{"Get From Other Task", "alice", "GET", "/tasks/1/time-entries/4", "", http.StatusNotFound, "Time entry not found"},
+		{"Delete Someone Else's", "alice", "DELETE", "/tasks/2/time-entries/4", "", http.StatusForbidden, "tracked"},
+		{"Report By Task", "alice", "GET", "/reports/time?from=2025-03-01&to=2025-03-04", "", http.StatusOK,
+			`"group_by":"task","total_minutes":135,"groups":[{"key":"1","task_id":1,"title":"Write report","minutes":90,"entries":1},{"key":"2","task_id":2,"title":"Review report","minutes":45,"entries":1}]`},
+		{"Report By Day", "alice", "GET", "/reports/time?from=2025-03-01&to=2025-03-04&group_by=day", "", http.StatusOK,
+			`"groups":[{"key":"2025-03-02","minutes":90,"entries":1},{"key":"2025-03-03","minutes":45,"entries":1}]`},
+		{"Report By Status", "alice", "GET", "/reports/time?from=2025-03-01&to=2025-03-04&group_by=status&tracked_by=apikey:bob", "", http.StatusOK,
+			`"total_minutes":45,"groups":[{"key":"completed","minutes":45,"entries":1}]`},
+		{"Invalid Grouping", "alice", "GET", "/reports/time?group_by=week", "", http.StatusBadRequest, `"group_by":"must be one of task, day, status"`},
+		{"Backwards Range", "alice", "GET", "/reports/time?from=2025-03-04&to=2025-03-01", "", http.StatusBadRequest, `"to":"must be after from"`},
+		{"Unknown Report", "alice", "GET", "/reports/money", "", http.StatusNotFound, "Not found"},
+		{"Delete", "bob", "DELETE", "/tasks/2/time-entries/4", "", http.StatusOK, "Time entry deleted"},
+		{"Deleted", "bob", "GET", "/tasks/2/time-entries/4", "", http.StatusNotFound, "Time entry not found"},
+		{"Invalid ID", "bob", "GET", "/tasks/2/time-entries/abc", "", http.StatusBadRequest, "Invalid time entry ID"},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req, err := http.NewRequest(step.method, step.path, bytes.NewBufferString(step.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if step.method == "PATCH" {
+				req.Header.Set("Content-Type", "application/merge-patch+json")
+			}
+			req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{
+				Subject: "apikey:" + step.caller,
+				Scopes:  []string{auth.ScopeRead, auth.ScopeWrite},
+			}))
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != step.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, step.wantStatus, rr.Body.String())
+			}
+			if !bytes.Contains(rr.Body.Bytes(), []byte(step.wantBody)) {
+				t.Errorf("response body %s does not contain %s", rr.Body.String(), step.wantBody)
+			}
+		})
+	}
+
+	// Deleting a task stops the timers running on it
+	store.DeleteTask(2, 0)
+	if _, err := store.RunningTimer("apikey:bob"); !errors.Is(err, database.ErrTimerNotRunning) {
+		t.Errorf("RunningTimer() after deleting its task: error = %v, want ErrTimerNotRunning", err)
+	}
+}
+
+func TestNextTasks(t *testing.T) {
+	handler, store := setupTest(t)
+	now := time.Now().UTC()
+	for _, task := range []models.Task{
+		{Title: "Someday", Status: models.StatusPending, Priority: models.PriorityLow},
+		{Title: "Urgent fix", Status: models.StatusInProgress, Priority: models.PriorityUrgent},
+		{Title: "Report", Status: models.StatusPending, DueDate: now.Add(36 * time.Hour)},
+		{Title: "Design", Status: models.StatusPending, Priority: models.PriorityHigh},
+		{Title: "Build", Status: models.StatusPending, Priority: models.PriorityHigh},
+		{Title: "Shipped", Status: models.StatusCompleted, Priority: models.PriorityUrgent},
+	} {
+		if _, err := store.CreateTask(task); err != nil {
+			t.Fatalf("Failed to create test task: %v", err)
+		}
+	}
+	store.AddDependency(4, 5)
+
+	next := func(t *testing.T, handler *TasksHandler, path string) ([]int, []models.RankedTask) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s: got status %v want %v, body %s", path, rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var body struct {
+			Weights models.ScoreWeights `json:"weights"`
+			Tasks   []models.RankedTask `json:"tasks"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		ids := []int{}
+		for _, ranked := range body.Tasks {
+			ids = append(ids, ranked.Task.ID)
+		}
+		return ids, body.Tasks
+	}
+
+	t.Run("Default Weights", func(t *testing.T) {
+		ids, ranked := next(t, handler, "/tasks/next")
+		if want := []int{3, 2, 4, 5, 1}; !reflect.DeepEqual(ids, want) {
+			t.Fatalf("ranked tasks = %v, want %v", ids, want)
+		}
+		report, build := ranked[0].Breakdown, ranked[3].Breakdown
+		if report.Priority.Points != 1.333 || report.Due.Reason != "due in 1 day" || report.Blocking.Reason != "blocks no open tasks" {
+			t.Errorf("Report breakdown = %+v", report)
+		}
+		if build.Blocking.Value != -1 || build.Blocking.Points != -2 || build.Blocking.Reason != "blocked by 1 open task" {
+			t.Errorf("Build blocking = %+v, want -1 for being blocked", build.Blocking)
+		}
+		if ranked[2].Breakdown.Blocking.Reason != "blocks 1 open task" || ranked[2].Score != 3.334 {
+			t.Errorf("Design = %+v, want a score of 3.334 for its priority and the task it blocks", ranked[2])
+		}
+		sum := 0.0
+		for _, factor := range []models.ScoreFactor{report.Priority, report.Due, report.Blocking, report.Age} {
+			sum += factor.Points
+		}
+		if math.Abs(sum-ranked[0].Score) > 1e-9 {
+			t.Errorf("Report breakdown adds up to %v, but the score is %v", sum, ranked[0].Score)
+		}
+	})
+
+	t.Run("Filtered And Limited", func(t *testing.T) {
+		if ids, _ := next(t, handler, "/tasks/next?status=pending&limit=2"); !reflect.DeepEqual(ids, []int{3, 4}) {
+			t.Errorf("ranked pending tasks = %v, want [3 4]", ids)
+		}
+		if ids, _ := next(t, handler, "/tasks/next?status=completed"); !reflect.DeepEqual(ids, []int{6}) {
+			t.Errorf("ranked completed tasks = %v, want [6]", ids)
+		}
+	})
+
+	t.Run("Custom Weights", func(t *testing.T) {
+		priorityOnly := NewTasksHandler(store, WithScoreWeights(models.ScoreWeights{Priority: 1}))
+		if ids, _ := next(t, priorityOnly, "/tasks/next"); !reflect.DeepEqual(ids, []int{2, 4, 5, 3, 1}) {
+			t.Errorf("ranked tasks by priority only = %v, want [2 4 5 3 1]", ids)
+		}
+	})
+
+	t.Run("Invalid Filter", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/tasks/next?status=later&limit=0", nil))
+		if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `"limit"`) {
+			t.Errorf("got status %v and body %s, want 400 explaining status and limit", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Invalid Priority", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", "/tasks", strings.NewReader(`{"title": "Odd", "priority": "whenever"}`)))
+		if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `"priority":"must be one of low, medium, high, urgent"`) {
+			t.Errorf("got status %v and body %s, want 400 explaining priority", rr.Code, rr.Body.String())
+		}
+	})
+}
+
+// TestIdempotencyKey tests replaying, rejecting and waiting on reused Idempotency-Keys
+func TestIdempotencyKey(t *testing.T) {
+	handler, store := setupTest(t)
+	// A request with the key "busy" is still being handled
+	busy := httptest.NewRequest("POST", "/tasks", nil)
+	store.ClaimIdempotencyKey(models.IdempotencyKey{Caller: "apikey:alice", Key: "busy", RequestHash: requestHash(busy, []byte(`{"title": "Buy milk"}`)),
+		CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)})
+
+	// Steps run in order against the same store, as the caller with subject "apikey:<caller>"
+	steps := []struct {
+		name         string
+		caller       string
+		key          string // the Idempotency-Key header, if any
+		body         string
+		wantStatus   int
+		wantBody     string // a substring of the response body
+		wantReplayed bool
+	}{
+		{"First Request", "alice", "phone-1", `{"title": "Buy milk"}`, http.StatusCreated, `"id":1,"title":"Buy milk"`, false},
+		{"Retry", "alice", "phone-1", `{"title": "Buy milk"}`, http.StatusCreated, `"id":1,"title":"Buy milk"`, true},
+		{"Different Body", "alice", "phone-1", `{"title": "Buy bread"}`, http.StatusUnprocessableEntity, "already used for a different request", false},
+		{"Other Caller", "bob", "phone-1", `{"title": "Buy milk"}`, http.StatusCreated, `"id":2,"title":"Buy milk"`, false},
+		{"Invalid Request", "alice", "phone-2", `{"description": "No title"}`, http.StatusBadRequest, "Title is required", false},
+		{"Retry Invalid Request", "alice", "phone-2", `{"description": "No title"}`, http.StatusBadRequest, "Title is required", true},
+		{"In Progress", "alice", "busy", `{"title": "Buy milk"}`, http.StatusConflict, "still in progress", false},
+		{"Invalid Key", "alice", "caf\u00e9", `{"title": "Buy milk"}`, http.StatusBadRequest, "Idempotency-Key must be", false},
+		{"Without Key", "alice", "", `{"title": "Buy milk"}`, http.StatusCreated, `"id":3,"title":"Buy milk"`, false},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/tasks", bytes.NewBufferString(step.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if step.key != "" {
+				req.Header.Set(IdempotencyKeyHeader, step.key)
+			}
+			req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{
+				Subject: "apikey:" + step.caller,
+				Scopes:  []string{auth.ScopeRead, auth.ScopeWrite},
+			}))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != step.wantStatus {
+				t.Errorf("status = %d, want %d, body %s", rr.Code, step.wantStatus, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), step.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", rr.Body.String(), step.wantBody)
+			}
+			if replayed := rr.Header().Get(IdempotentReplayedHeader) == "true"; replayed != step.wantReplayed {
+				t.Errorf("%s = %q, want replayed %v", IdempotentReplayedHeader, rr.Header().Get(IdempotentReplayedHeader), step.wantReplayed)
+			}
+			if step.wantReplayed && (rr.Header().Get("Content-Type") != "application/json" || step.wantStatus == http.StatusCreated && rr.Header().Get("ETag") == "") {
+				t.Errorf("replayed headers = %v, want the Content-Type and ETag of the first response", rr.Header())
+			}
+		})
+	}
+
+	if tasks, _ := store.GetAllTasks(); len(tasks) != 3 {
+		t.Errorf("tasks created = %d, want 3", len(tasks))
+	}
+}
+
+// TestIdempotencyKeyPanic tests that a request that panics releases its key for retries
+func TestIdempotencyKeyPanic(t *testing.T) {
+	handler, store := setupTest(t)
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest("POST", "/tasks", strings.NewReader(`{"title": "Buy milk"}`))
+		req.Header.Set(IdempotencyKeyHeader, "phone-1")
+		return req
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("idempotent() swallowed the panic")
+			}
+		}()
+		handler.idempotent(httptest.NewRecorder(), newRequest(), func(w http.ResponseWriter, r *http.Request) {
+			panic("lost the database")
+		})
+	}()
+
+	// The retry is handled again rather than waiting on the key
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest())
+	if rr.Code != http.StatusCreated || rr.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Errorf("retry after a panic = %d %s, want a new 201", rr.Code, rr.Body.String())
+	}
+	if tasks, _ := store.GetAllTasks(); len(tasks) != 1 {
+		t.Errorf("tasks created = %d, want 1", len(tasks))
+	}
+}
+
+// TestStatusWorkflow tests reopening tasks and reading their status history
+func TestStatusWorkflow(t *testing.T) {
+	handler, store := setupTest(t)
+
+	id, err := store.CreateTask(models.Task{Title: "Workflow Task", Status: "pending"})
+	if err != nil {
+		t.Fatalf("Failed to create test task: %v", err)
+	}
+	taskURL := "/tasks/" + strconv.FormatInt(id, 10)
+
+	// Steps run in order against the same task
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"Start", "PATCH", taskURL, `{"status":"in_progress"}`, http.StatusOK},
+		{"Complete", "PATCH", taskURL, `{"status":"completed"}`, http.StatusOK},
+		{"Reopen", "POST", taskURL + "/reopen", "", http.StatusOK},
+		{"Reopen Pending Task", "POST", taskURL + "/reopen", "", http.StatusUnprocessableEntity},
+		{"Reopen Non-existent Task", "POST", "/tasks/9999/reopen", "", http.StatusNotFound},
+		{"History Wrong Method", "POST", taskURL + "/history", "", http.StatusMethodNotAllowed},
+		{"Unknown Action", "GET", taskURL + "/archive", "", http.StatusNotFound},
+		{"History Non-existent Task", "GET", "/tasks/9999/history", "", http.StatusNotFound},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req, err := http.NewRequest(step.method, step.path, bytes.NewBufferString(step.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/merge-patch+json")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != step.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s",
+					rr.Code, step.wantStatus, rr.Body.String())
+			}
+		})
+	}
+
+	// The history records every change, starting with creation
+	req, err := http.NewRequest("GET", taskURL+"/history", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var history []models.StatusChange
+	if err := json.Unmarshal(rr.Body.Bytes(), &history); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	want := []models.StatusChange{
+		{From: "", To: models.StatusPending},
+		{From: models.StatusPending, To: models.StatusInProgress},
+		{From: models.StatusInProgress, To: models.StatusCompleted},
+		{From: models.StatusCompleted, To: models.StatusPending},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("history has %d entries, want %d: %+v", len(history), len(want), history)
+	}
+	for i, change := range history {
+		if change.From != want[i].From || change.To != want[i].To {
+			t.Errorf("history[%d] = %s -> %s, want %s -> %s", i, change.From, change.To, want[i].From, want[i].To)
+		}
+	}
+}
+
+// TestCustomWorkflow tests that a configured workflow replaces the default rules
+func TestCustomWorkflow(t *testing.T) {
+	store := database.NewMemoryStore()
+
+	// Tasks must be started before they can be completed, and completed tasks reopen as in progress
+	handler := NewTasksHandler(store, WithWorkflow(models.Workflow{
+		Transitions: map[models.Status][]models.Status{
+			models.StatusPending:    {models.StatusInProgress},
+			models.StatusInProgress: {models.StatusCompleted},
+		},
+		Reopen: map[models.Status]models.Status{
+			models.StatusCompleted: models.StatusInProgress,
+		},
+	}))
+
+	id, err := store.CreateTask(models.Task{Title: "Custom Workflow Task", Status: "pending"})
+	if err != nil {
+		t.Fatalf("Failed to create test task: %v", err)
+	}
+	taskURL := "/tasks/" + strconv.FormatInt(id, 10)
+
+	// Skipping in_progress is not allowed
+	req, _ := http.NewRequest("PATCH", taskURL, bytes.NewBufferString(`{"status":"completed"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnprocessableEntity)
+	}
+
+	var body struct {
+		Allowed []models.Status `json:"allowed"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if len(body.Allowed) != 1 || body.Allowed[0] != models.StatusInProgress {
+		t.Errorf("allowed = %v, want [in_progress]", body.Allowed)
+	}
+
+	// Reopening uses the configured target
+	store.UpdateTask(int(id), models.Task{Title: "Custom Workflow Task", Status: models.StatusCompleted})
+	req, _ = http.NewRequest("POST", taskURL+"/reopen", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var task models.Task
+	json.Unmarshal(rr.Body.Bytes(), &task)
+	if rr.Code != http.StatusOK || task.Status != models.StatusInProgress {
+		t.Errorf("reopen: got status code %v and task status %q, want 200 and in_progress", rr.Code, task.Status)
+	}
+}
+
 // TestDeleteTask tests the deleteTask handler
 func TestDeleteTask(t *testing.T) {
-	setupTest(t)
+	handler, store := setupTest(t)
 
 	// Create a test task
 	task := models.Task{
@@ -356,7 +2475,7 @@ func TestDeleteTask(t *testing.T) {
 		Status: "pending",
 	}
 
-	id, err := database.CreateTask(task)
+	id, err := store.CreateTask(task)
 	if err != nil {
 		t.Fatalf("Failed to create test task: %v", err)
 	}
@@ -395,7 +2514,6 @@ func TestDeleteTask(t *testing.T) {
 
 			// Create a ResponseRecorder to record the response
 			rr := httptest.NewRecorder()
-			handler := http.HandlerFunc(TasksHandler)
 
 			// Call the handler
 			handler.ServeHTTP(rr, req)
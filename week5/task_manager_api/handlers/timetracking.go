@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"task_manager_api/database"
+	"task_manager_api/models"
+	"time"
+	"unicode/utf8"
+)
+
+// timerRequest is the optional body of POST /tasks/{id}/timer/start
+type timerRequest struct {
+	Note string `json:"note"`
+}
+
+// timeEntryRequest is the body of POST /tasks/{id}/time-entries. The entry ends
+// at stopped_at, or the given number of minutes after started_at.
+type timeEntryRequest struct {
+	StartedAt time.Time  `json:"started_at"`
+	StoppedAt *time.Time `json:"stopped_at"`
+	Minutes   int        `json:"minutes"`
+	Note      string     `json:"note"`
+}
+
+// invalidEstimate explains the rule estimates follow
+const invalidEstimate = "must be a positive number of minutes"
+
+// validEstimate reports whether a task's estimate is unset or positive
+func validEstimate(estimate *int) bool {
+	return estimate == nil || *estimate > 0
+}
+
+// startTimer starts a timer on a task for the caller, who can only have one
+// running at a time
+func (h *TasksHandler) startTimer(w http.ResponseWriter, r *http.Request, id int) {
+	if !h.authorizeTaskChangeByID(w, r, id) {
+		return
+	}
+
+	var req timerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if utf8.RuneCountInString(req.Note) > models.MaxTimeEntryNoteLength {
+		writeFieldErrors(w, "Invalid time entry", fieldErrors{"note": fmt.Sprintf("must be at most %d characters", models.MaxTimeEntryNoteLength)})
+		return
+	}
+
+	actor := requestActor(r)
+	if running, err := h.store.RunningTimer(actor.Name); err == nil {
+		writeTimerRunning(w, running)
+		return
+	} else if !errors.Is(err, database.ErrTimerNotRunning) {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to check running timers"})
+		return
+	}
+
+	entry := models.TimeEntry{TaskID: id, TrackedBy: actor.Name, StartedAt: time.Now().UTC(), Note: req.Note}
+	if userID, ok := UserIDFromContext(r.Context()); ok {
+		entry.UserID = &userID
+	}
+	h.createTimeEntry(w, entry)
+}
+
+// writeTimerRunning responds with 409 and the entry of the caller's running timer
+func writeTimerRunning(w http.ResponseWriter, running models.TimeEntry) {
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":   fmt.Sprintf("A timer is already running on task %d; stop it first", running.TaskID),
+		"running": running,
+	})
+}
+
+// stopTimer stops the caller's timer on a task
+func (h *TasksHandler) stopTimer(w http.ResponseWriter, r *http.Request, id int) {
+	if !h.authorizeTaskChangeByID(w, r, id) {
+		return
+	}
+
+	entry, err := h.store.StopTimer(id, requestActor(r).Name, time.Now().UTC())
+	if errors.Is(err, database.ErrTimerNotRunning) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "You have no timer running on this task"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to stop timer"})
+		return
+	}
+	json.NewEncoder(w).Encode(entry)
+}
+
+// listTimeEntries retrieves the time entries of a task, earliest first
+func (h *TasksHandler) listTimeEntries(w http.ResponseWriter, r *http.Request, id int) {
+	entries, err := h.store.ListTimeEntries(id)
+	if errors.Is(err, database.ErrTaskNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch time entries"})
+		return
+	}
+	json.NewEncoder(w).Encode(entries)
+}
+
+// addTimeEntry records time the caller spent on a task without a timer
+func (h *TasksHandler) addTimeEntry(w http.ResponseWriter, r *http.Request, id int) {
+	if !h.authorizeTaskChangeByID(w, r, id) {
+		return
+	}
+
+	var req timeEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	errs := fieldErrors{}
+	stoppedAt := req.StoppedAt
+	switch {
+	case req.StartedAt.IsZero():
+		errs["started_at"] = "is required"
+	case stoppedAt != nil && req.Minutes != 0:
+		errs["minutes"] = "can't be given with stopped_at"
+	case stoppedAt == nil && req.Minutes == 0:
+		errs["stopped_at"] = "or minutes is required"
+	case stoppedAt == nil && req.Minutes < 0:
+		errs["minutes"] = "must be positive"
+	case stoppedAt == nil:
+		end := req.StartedAt.Add(time.Duration(req.Minutes) * time.Minute)
+		stoppedAt = &end
+	case !stoppedAt.After(req.StartedAt):
+		errs["stopped_at"] = "must be after started_at"
+	}
+	if stoppedAt != nil && stoppedAt.After(time.Now()) {
+		errs["stopped_at"] = "must not be in the future"
+	}
+	if utf8.RuneCountInString(req.Note) > models.MaxTimeEntryNoteLength {
+		errs["note"] = fmt.Sprintf("must be at most %d characters", models.MaxTimeEntryNoteLength)
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, "Invalid time entry", errs)
+		return
+	}
+
+	entry := models.TimeEntry{
+		TaskID:    id,
+		TrackedBy: requestActor(r).Name,
+		StartedAt: req.StartedAt.UTC(),
+		StoppedAt: stoppedAt,
+		Note:      req.Note,
+	}
+	if userID, ok := UserIDFromContext(r.Context()); ok {
+		entry.UserID = &userID
+	}
+	h.createTimeEntry(w, entry)
+}
+
+// createTimeEntry stores a new time entry or timer and responds with it
+func (h *TasksHandler) createTimeEntry(w http.ResponseWriter, entry models.TimeEntry) {
+	entryID, err := h.store.CreateTimeEntry(entry)
+	if errors.Is(err, database.ErrTaskNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		return
+	}
+	if errors.Is(err, database.ErrTimerRunning) {
+		// Another request started one since the check
+		if running, err := h.store.RunningTimer(entry.TrackedBy); err == nil {
+			writeTimerRunning(w, running)
+			return
+		}
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create time entry"})
+		return
+	}
+
+	created, err := h.store.GetTimeEntry(entry.TaskID, int(entryID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve created time entry"})
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// getTimeEntry retrieves a single time entry of a task
+func (h *TasksHandler) getTimeEntry(w http.ResponseWriter, r *http.Request, id int, entryIDStr string) {
+	entry, ok := h.findTimeEntry(w, id, entryIDStr)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(entry)
+}
+
+// deleteTimeEntry removes one of the caller's time entries, stopping its timer if it is running
+func (h *TasksHandler) deleteTimeEntry(w http.ResponseWriter, r *http.Request, id int, entryIDStr string) {
+	entry, ok := h.findTimeEntry(w, id, entryIDStr)
+	if !ok || !h.authorizeTaskChangeByID(w, r, id) {
+		return
+	}
+	if entry.TrackedBy != requestActor(r).Name {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Only the caller who tracked the time can delete it"})
+		return
+	}
+
+	if err := h.store.DeleteTimeEntry(id, entry.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete time entry"})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Time entry deleted"})
+}
+
+// findTimeEntry looks up the time entry with the ID in entryIDStr on a task,
+// responding with 400 or 404 if it is invalid or doesn't exist
+func (h *TasksHandler) findTimeEntry(w http.ResponseWriter, id int, entryIDStr string) (models.TimeEntry, bool) {
+	entryID, err := strconv.Atoi(entryIDStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid time entry ID"})
+		return models.TimeEntry{}, false
+	}
+
+	entry, err := h.store.GetTimeEntry(id, entryID)
+	switch {
+	case errors.Is(err, database.ErrTaskNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		return entry, false
+	case errors.Is(err, database.ErrTimeEntryNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Time entry not found"})
+		return entry, false
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch time entry"})
+		return entry, false
+	}
+	return entry, true
+}
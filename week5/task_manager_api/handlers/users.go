@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"task_manager_api/auth"
+	"task_manager_api/database"
+	"task_manager_api/models"
+)
+
+// assigneeNotFound explains an assignee_id the store rejected
+const assigneeNotFound = "must be the ID of an existing user"
+
+// UserIDFromContext returns the ID of the user the authenticated caller acts
+// as, if it acts as one
+func UserIDFromContext(ctx context.Context) (int, bool) {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok || principal.UserID == 0 {
+		return 0, false
+	}
+	return principal.UserID, true
+}
+
+// taskChangeDenied returns the status code and message refusing the caller a
+// change to task, or 0 if the caller may make it. Anyone may change a task with
+// neither an owner nor an assignee; otherwise only they may. Requests only lack
+// a principal when authentication is disabled, and then nobody is checked.
+func taskChangeDenied(ctx context.Context, task models.Task) (int, string) {
+	if task.CreatedBy == nil && task.AssigneeID == nil {
+		return 0, ""
+	}
+
+	if _, ok := auth.PrincipalFromContext(ctx); !ok {
+		return 0, ""
+	}
+	userID, _ := UserIDFromContext(ctx)
+	if !sameUser(task.CreatedBy, userID) && !sameUser(task.AssigneeID, userID) {
+		return http.StatusForbidden, "Only the task's owner or assignee can change it"
+	}
+	return 0, ""
+}
+
+// authorizeTaskChange responds with 403 and returns false unless the
+// caller may change task
+func authorizeTaskChange(w http.ResponseWriter, r *http.Request, task models.Task) bool {
+	status, message := taskChangeDenied(r.Context(), task)
+	if status == 0 {
+		return true
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+	return false
+}
+
+// authorizeTaskChangeByID looks up a task outside the trash and returns true if
+// the caller may change it, otherwise responding with 404, 500 or 403
+func (h *TasksHandler) authorizeTaskChangeByID(w http.ResponseWriter, r *http.Request, id int) bool {
+	task, err := h.store.GetTaskByID(id)
+	if errors.Is(err, database.ErrTaskNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		return false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch task"})
+		return false
+	}
+	return authorizeTaskChange(w, r, task)
+}
+
+// sameUser reports whether a nullable user ID refers to id
+func sameUser(userID *int, id int) bool {
+	return userID != nil && *userID == id
+}
+
+// UsersHandler serves the /users endpoints using the TaskStore it was created with
+type UsersHandler struct {
+	store database.TaskStore
+}
+
+// NewUsersHandler creates a UsersHandler that reads and writes users through store
+func NewUsersHandler(store database.TaskStore) *UsersHandler {
+	return &UsersHandler{store: store}
+}
+
+// ServeHTTP handles all requests to the /users endpoint
+func (h *UsersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Paths are /users, /users/{id} and /users/{id}/tasks
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/users"), "/"), "/")
+	switch {
+	case parts[0] == "" && r.Method == http.MethodGet:
+		h.listUsers(w, r)
+	case parts[0] == "" && r.Method == http.MethodPost:
+		h.createUser(w, r)
+	case len(parts) == 1 && parts[0] != "" && r.Method == http.MethodGet:
+		h.getUser(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "tasks" && r.Method == http.MethodGet:
+		h.getUserTasks(w, r, parts[0])
+	case len(parts) > 2 || (len(parts) == 2 && parts[1] != "tasks"):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Not found"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+	}
+}
+
+// listUsers retrieves every user, oldest first
+func (h *UsersHandler) listUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.store.ListUsers()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch users"})
+		return
+	}
+	json.NewEncoder(w).Encode(users)
+}
+
+// createUser adds a new user
+func (h *UsersHandler) createUser(w http.ResponseWriter, r *http.Request) {
+	var user models.User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	// Emails are compared case-insensitively, so store them lowercased
+	user.Name = strings.TrimSpace(user.Name)
+	user.Email = strings.ToLower(strings.TrimSpace(user.Email))
+
+	errs := fieldErrors{}
+	if user.Name == "" {
+		errs["name"] = "is required"
+	}
+	if address, err := mail.ParseAddress(user.Email); err != nil || address.Address != user.Email {
+		errs["email"] = "must be an email address"
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, "Invalid user", errs)
+		return
+	}
+
+	id, err := h.store.CreateUser(user)
+	if errors.Is(err, database.ErrEmailTaken) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "A user with this email already exists"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create user"})
+		return
+	}
+
+	createdUser, err := h.store.GetUserByID(int(id))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve created user"})
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createdUser)
+}
+
+// getUser retrieves a single user by ID
+func (h *UsersHandler) getUser(w http.ResponseWriter, r *http.Request, idStr string) {
+	user, ok := h.findUser(w, idStr)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(user)
+}
+
+// getUserTasks retrieves one page of the tasks a user created or is assigned,
+// accepting the same query parameters as GET /tasks
+func (h *UsersHandler) getUserTasks(w http.ResponseWriter, r *http.Request, idStr string) {
+	user, ok := h.findUser(w, idStr)
+	if !ok {
+		return
+	}
+
+	writeTaskList(w, r, h.store, func(filter *database.TaskFilter) {
+		filter.UserID = user.ID
+	})
+}
+
+// findUser looks up the user with the ID in the path, responding with 400 or 404 if there is none
+func (h *UsersHandler) findUser(w http.ResponseWriter, idStr string) (models.User, bool) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid user ID"})
+		return models.User{}, false
+	}
+
+	user, err := h.store.GetUserByID(id)
+	if errors.Is(err, database.ErrUserNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+		return user, false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch user"})
+		return user, false
+	}
+	return user, true
+}
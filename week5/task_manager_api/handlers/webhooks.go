@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"task_manager_api/database"
+	"task_manager_api/models"
+	"task_manager_api/webhooks"
+	"time"
+)
+
+// minWebhookSecretLength is the shortest signing secret a client may choose
+const minWebhookSecretLength = 16
+
+// emitTaskEvent queues event about task for the webhooks subscribed to it.
+// store should be the transaction making the change, so the event is queued
+// exactly when the change is kept.
+func emitTaskEvent(store database.TaskStore, event string, task models.Task) error {
+	payload, err := json.Marshal(models.WebhookEvent{Event: event, OccurredAt: time.Now().UTC(), Task: task})
+	if err != nil {
+		return err
+	}
+	return store.EnqueueEvent(event, payload)
+}
+
+// updateEvent is the event for a change from before to after: completing a
+// task is task.completed, any other change task.updated
+func updateEvent(before, after models.Task) string {
+	if after.Status == models.StatusCompleted && before.Status != models.StatusCompleted {
+		return models.EventTaskCompleted
+	}
+	return models.EventTaskUpdated
+}
+
+// WebhooksHandler serves the /webhooks endpoints using the TaskStore it was created with
+type WebhooksHandler struct {
+	store database.TaskStore
+}
+
+// NewWebhooksHandler creates a WebhooksHandler that reads and writes webhooks through store
+func NewWebhooksHandler(store database.TaskStore) *WebhooksHandler {
+	return &WebhooksHandler{store: store}
+}
+
+// ServeHTTP handles all requests to the /webhooks endpoint
+func (h *WebhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Paths are /webhooks, /webhooks/{id} and /webhooks/{id}/deliveries
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/webhooks"), "/"), "/")
+	switch {
+	case parts[0] == "" && r.Method == http.MethodGet:
+		h.listWebhooks(w, r)
+	case parts[0] == "" && r.Method == http.MethodPost:
+		h.createWebhook(w, r)
+	case len(parts) == 1 && parts[0] != "" && r.Method == http.MethodGet:
+		h.getWebhook(w, r, parts[0])
+	case len(parts) == 1 && parts[0] != "" && r.Method == http.MethodDelete:
+		h.deleteWebhook(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "deliveries" && r.Method == http.MethodGet:
+		h.listDeliveries(w, r, parts[0])
+	case len(parts) > 2 || (len(parts) == 2 && parts[1] != "deliveries"):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Not found"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+	}
+}
+
+// listWebhooks retrieves every webhook, oldest first, without their secrets
+func (h *WebhooksHandler) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	list, err := h.store.ListWebhooks()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch webhooks"})
+		return
+	}
+	for i := range list {
+		list[i].Secret = ""
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+// createWebhook adds a subscription. It responds with the signing secret,
+// generating one if the client didn't choose it; it isn't shown again.
+func (h *WebhooksHandler) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var webhook models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	errs := fieldErrors{}
+	if target, err := url.Parse(webhook.URL); err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		errs["url"] = "must be an absolute http or https URL"
+	}
+	if len(webhook.Events) == 0 {
+		webhook.Events = []string{models.EventAll}
+	}
+	for _, event := range webhook.Events {
+		if !validEvent(event) {
+			errs["events"] = "must list events from " + strings.Join(models.WebhookEvents, ", ") + ", or " + models.EventAll + " for all"
+		}
+	}
+	if webhook.Secret != "" && len(webhook.Secret) < minWebhookSecretLength {
+		errs["secret"] = "must be at least " + strconv.Itoa(minWebhookSecretLength) + " characters"
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, "Invalid webhook", errs)
+		return
+	}
+
+	if webhook.Secret == "" {
+		secret, err := webhooks.GenerateSecret()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create webhook"})
+			return
+		}
+		webhook.Secret = secret
+	}
+
+	id, err := h.store.CreateWebhook(webhook)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create webhook"})
+		return
+	}
+
+	createdWebhook, err := h.store.GetWebhook(int(id))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve created webhook"})
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createdWebhook)
+}
+
+// validEvent reports whether a webhook can subscribe to event
+func validEvent(event string) bool {
+	if event == models.EventAll {
+		return true
+	}
+	for _, known := range models.WebhookEvents {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+// getWebhook retrieves a webhook without its secret
+func (h *WebhooksHandler) getWebhook(w http.ResponseWriter, r *http.Request, idStr string) {
+	webhook, ok := h.findWebhook(w, idStr)
+	if !ok {
+		return
+	}
+	webhook.Secret = ""
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// deleteWebhook removes a webhook and its queued deliveries
+func (h *WebhooksHandler) deleteWebhook(w http.ResponseWriter, r *http.Request, idStr string) {
+	webhook, ok := h.findWebhook(w, idStr)
+	if !ok {
+		return
+	}
+
+	err := h.store.DeleteWebhook(webhook.ID)
+	if errors.Is(err, database.ErrWebhookNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Webhook not found"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete webhook"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Webhook deleted"})
+}
+
+// listDeliveries retrieves a webhook's deliveries, newest first. ?status=dead lists
+// the ones that ran out of attempts.
+func (h *WebhooksHandler) listDeliveries(w http.ResponseWriter, r *http.Request, idStr string) {
+	webhook, ok := h.findWebhook(w, idStr)
+	if !ok {
+		return
+	}
+
+	status := models.DeliveryStatus(r.URL.Query().Get("status"))
+	if status != "" && status != models.DeliveryPending && status != models.DeliveryDelivered && status != models.DeliveryDead {
+		writeFieldErrors(w, invalidQuery, fieldErrors{"status": "must be pending, delivered or dead"})
+		return
+	}
+
+	deliveries, err := h.store.ListDeliveries(webhook.ID, status)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch deliveries"})
+		return
+	}
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// findWebhook looks up the webhook with the ID in idStr, responding with 400 or
+// 404 if it is invalid or doesn't exist
+func (h *WebhooksHandler) findWebhook(w http.ResponseWriter, idStr string) (models.Webhook, bool) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid webhook ID"})
+		return models.Webhook{}, false
+	}
+
+	webhook, err := h.store.GetWebhook(id)
+	if errors.Is(err, database.ErrWebhookNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Webhook not found"})
+		return webhook, false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch webhook"})
+		return webhook, false
+	}
+	return webhook, true
+}
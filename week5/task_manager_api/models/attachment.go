@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Attachment is a file attached to a task. Its content is stored once per
+// distinct SHA-256 hash, however many attachments share it.
+type Attachment struct {
+	ID          int       `json:"id"`
+	TaskID      int       `json:"task_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"` // detected from the content, not taken from the upload
+	Size        int64     `json:"size"`         // in bytes
+	SHA256      string    `json:"sha256"`       // hex hash of the content
+	UploadedBy  string    `json:"uploaded_by"`  // the caller who uploaded it, as the audit log names them
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// Entities recorded in the audit log
+const (
+	AuditEntityTask       = "task"
+	AuditEntityComment    = "comment"
+	AuditEntityAttachment = "attachment"
+	AuditEntityTimeEntry  = "time_entry"
+)
+
+// AuditEntities lists every entity recorded in the audit log
+var AuditEntities = []string{AuditEntityTask, AuditEntityComment, AuditEntityAttachment, AuditEntityTimeEntry}
+
+// Audited actions. A task's next occurrence is a create, and detaching the
+// subtasks of a purged task is an update.
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete" // moved to the trash
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// AuditEntry records one change to an entity: who made it, during which
+// request, and the fields it changed
+type AuditEntry struct {
+	ID        int                    `json:"id"`
+	Entity    string                 `json:"entity"`
+	EntityID  int                    `json:"entity_id"`
+	Action    string                 `json:"action"`
+	Actor     string                 `json:"actor"`
+	RequestID string                 `json:"request_id,omitempty"`
+	Changes   map[string]FieldChange `json:"changes"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// FieldChange is the JSON value of a field before and after a change; null
+// when the field was unset
+type FieldChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// AuditPage is one page of audit entries, newest first
+type AuditPage struct {
+	Entries    []AuditEntry `json:"entries"`
+	NextCursor string       `json:"next_cursor,omitempty"` // empty on the last page
+}
+
+// Diff compares the JSON encodings of before and after field by field and
+// returns the fields that differ. A nil before or after, as for an entity
+// being created or purged, has every field null.
+func Diff(before, after interface{}) (map[string]FieldChange, error) {
+	beforeFields, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]FieldChange{}
+	for name := range beforeFields {
+		if _, ok := afterFields[name]; !ok {
+			afterFields[name] = json.RawMessage("null")
+		}
+	}
+	for name, value := range afterFields {
+		old, ok := beforeFields[name]
+		if !ok {
+			old = json.RawMessage("null")
+		}
+		if !bytes.Equal(old, value) {
+			changes[name] = FieldChange{Before: old, After: value}
+		}
+	}
+	return changes, nil
+}
+
+// jsonFields encodes v and splits the resulting object into its fields
+func jsonFields(v interface{}) (map[string]json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		fields = map[string]json.RawMessage{}
+	}
+	return fields, nil
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// MaxCommentLength is the longest comment body, in characters
+const MaxCommentLength = 10000
+
+// Comment is a note on a task. Bodies are markdown, stored and returned as
+// written; rendering them is up to the client.
+type Comment struct {
+	ID        int        `json:"id"`
+	TaskID    int        `json:"task_id"`
+	Body      string     `json:"body"`
+	Author    string     `json:"author"`    // the caller who wrote it, as the audit log names them
+	AuthorID  *int       `json:"author_id"` // the user who wrote it, if the caller acted as one
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at"` // when the body was last changed; null if it never was
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Task lifecycle events. The event stream reports completions as
+// task.updated; webhooks can subscribe to task.completed.
+const (
+	EventTaskCreated   = "task.created"
+	EventTaskUpdated   = "task.updated"
+	EventTaskCompleted = "task.completed"
+	EventTaskDeleted   = "task.deleted"
+)
+
+// TaskEvent is a change to a task recorded in the event log, with the task as
+// it was after the change; a deleted task as it was when it was deleted
+type TaskEvent struct {
+	ID         int64     `json:"id"` // increases with every event; restarts when the server does
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Task       Task      `json:"task"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// IdempotencyKey records a request sent with an Idempotency-Key header, so that
+// retries of it get its response instead of repeating what it did
+type IdempotencyKey struct {
+	Caller      string            `json:"caller"`       // who sent the request, named as in the audit log; each caller has its own keys
+	Key         string            `json:"key"`          // the header's value
+	RequestHash string            `json:"request_hash"` // identifies the request the key was first used with
+	StatusCode  int               `json:"status_code"`  // the response's status; 0 while the request is in progress
+	Header      map[string]string `json:"header"`       // the response headers replayed with the body
+	Body        []byte            `json:"body"`
+	CreatedAt   time.Time         `json:"created_at"`
+	ExpiresAt   time.Time         `json:"expires_at"` // when the key can be used for another request
+}
+
+// Completed reports whether the response to the key's request has been stored
+func (k IdempotencyKey) Completed() bool {
+	return k.StatusCode != 0
+}
@@ -0,0 +1,28 @@
+package models
+
+// TaskPage is one page of a task listing
+type TaskPage struct {
+	Tasks      []Task `json:"tasks"`
+	NextCursor string `json:"next_cursor,omitempty"` // empty on the last page
+	Total      int    `json:"total"`                 // number of tasks matching the filter across all pages
+}
+
+// SearchResult is a task matched by a full-text search
+type SearchResult struct {
+	Task
+	Score      float64          `json:"score"` // higher is more relevant
+	Highlights SearchHighlights `json:"highlights"`
+}
+
+// SearchHighlights holds the matched text with matches wrapped in <mark> tags
+type SearchHighlights struct {
+	Title       string `json:"title"`
+	Description string `json:"description"` // a short snippet around the first match
+}
+
+// SearchPage is one page of search results, in order of relevance
+type SearchPage struct {
+	Tasks      []SearchResult `json:"tasks"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	Total      int            `json:"total"`
+}
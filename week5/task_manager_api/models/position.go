@@ -0,0 +1,214 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// positionDigits are the digits of a position, in ascending order. Their byte
+// order matches, so positions compare correctly as plain strings, in SQL too.
+const positionDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// FirstPosition is the position given to the only item in a list
+const FirstPosition = "a0"
+
+// smallestInteger is the lowest integer part, below which no position can go
+const smallestInteger = "A00000000000000000000000000"
+
+// ErrInvalidPosition is returned by PositionBetween for bounds that aren't
+// valid positions or aren't in order
+var ErrInvalidPosition = errors.New("invalid position")
+
+// errPositionOverflow is returned when positions run out of integer parts in
+// one direction, which takes around 62^25 moves to the same end of a list
+var errPositionOverflow = errors.New("position out of range")
+
+// ValidPosition reports whether p is a position. A position is an integer
+// part, whose first character ('a'-'z' upwards, 'A'-'Z' downwards) gives its
+// length, followed by an optional fraction not ending in the lowest digit.
+func ValidPosition(p string) bool {
+	integer, ok := integerPart(p)
+	if !ok || integer == smallestInteger {
+		return false
+	}
+	for i := 1; i < len(p); i++ {
+		if strings.IndexByte(positionDigits, p[i]) < 0 {
+			return false
+		}
+	}
+	return !strings.HasSuffix(p[len(integer):], positionDigits[:1])
+}
+
+// PositionBetween returns a position that sorts after before and ahead of
+// after, so an item can be placed between two others without renumbering the
+// rest. An empty before means the start, and an empty after the end. Placing
+// items at either end keeps positions short: they step through the integer
+// parts, and only placing one between two others adds fraction digits.
+func PositionBetween(before, after string) (string, error) {
+	if (before != "" && !ValidPosition(before)) || (after != "" && !ValidPosition(after)) {
+		return "", ErrInvalidPosition
+	}
+	if before != "" && after != "" && before >= after {
+		return "", ErrInvalidPosition
+	}
+
+	switch {
+	case before == "" && after == "":
+		return FirstPosition, nil
+	case before == "":
+		integer, _ := integerPart(after)
+		if integer == smallestInteger {
+			return integer + midpoint("", after[len(integer):]), nil
+		}
+		if integer < after {
+			// after has a fraction, so its integer part alone sorts first
+			return integer, nil
+		}
+		return decrementInteger(integer)
+	case after == "":
+		integer, _ := integerPart(before)
+		next, err := incrementInteger(integer)
+		if err != nil {
+			return integer + midpoint(before[len(integer):], ""), nil
+		}
+		return next, nil
+	}
+
+	beforeInteger, _ := integerPart(before)
+	afterInteger, _ := integerPart(after)
+	if beforeInteger == afterInteger {
+		return beforeInteger + midpoint(before[len(beforeInteger):], after[len(afterInteger):]), nil
+	}
+	next, err := incrementInteger(beforeInteger)
+	if err != nil {
+		return "", err
+	}
+	if next < after {
+		return next, nil
+	}
+	return beforeInteger + midpoint(before[len(beforeInteger):], ""), nil
+}
+
+// integerPart returns the integer part at the start of p, or false if p doesn't start with one
+func integerPart(p string) (string, bool) {
+	if p == "" {
+		return "", false
+	}
+	var length int
+	switch head := p[0]; {
+	case head >= 'a' && head <= 'z':
+		length = int(head-'a') + 2
+	case head >= 'A' && head <= 'Z':
+		length = int('Z'-head) + 2
+	default:
+		return "", false
+	}
+	if length > len(p) {
+		return "", false
+	}
+	return p[:length], true
+}
+
+// incrementInteger returns the integer part following x
+func incrementInteger(x string) (string, error) {
+	head, digits := x[0], []byte(x[1:])
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := strings.IndexByte(positionDigits, digits[i]) + 1
+		if d < len(positionDigits) {
+			digits[i] = positionDigits[d]
+			return string(head) + string(digits), nil
+		}
+		digits[i] = positionDigits[0]
+	}
+
+	// Every digit carried: move to the next length
+	switch head {
+	case 'Z':
+		return FirstPosition, nil
+	case 'z':
+		return "", errPositionOverflow
+	}
+	head++
+	if head > 'a' {
+		digits = append(digits, positionDigits[0])
+	} else {
+		digits = digits[1:]
+	}
+	return string(head) + string(digits), nil
+}
+
+// decrementInteger returns the integer part preceding x
+func decrementInteger(x string) (string, error) {
+	highest := positionDigits[len(positionDigits)-1]
+	head, digits := x[0], []byte(x[1:])
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := strings.IndexByte(positionDigits, digits[i]) - 1
+		if d >= 0 {
+			digits[i] = positionDigits[d]
+			return string(head) + string(digits), nil
+		}
+		digits[i] = highest
+	}
+
+	// Every digit borrowed: move to the previous length
+	switch head {
+	case 'a':
+		return "Z" + string(highest), nil
+	case 'A':
+		return "", errPositionOverflow
+	}
+	head--
+	if head < 'Z' {
+		digits = append(digits, highest)
+	} else {
+		digits = digits[1:]
+	}
+	return string(head) + string(digits), nil
+}
+
+// midpoint returns the shortest fraction strictly between a and b, read as the
+// digits after a radix point. An empty b stands for one.
+func midpoint(a, b string) string {
+	if b != "" {
+		// Keep the common prefix, reading missing digits of a as zeros
+		n := 0
+		for n < len(b) && digitAt(a, n) == strings.IndexByte(positionDigits, b[n]) {
+			n++
+		}
+		if n > 0 {
+			return b[:n] + midpoint(tail(a, n), b[n:])
+		}
+	}
+
+	low := digitAt(a, 0)
+	high := len(positionDigits)
+	if b != "" {
+		high = strings.IndexByte(positionDigits, b[0])
+	}
+	if high-low > 1 {
+		mid := (low + high + 1) / 2
+		return positionDigits[mid : mid+1]
+	}
+	// The first digits are consecutive: b's first digit alone is between them
+	// if b has more, otherwise extend a
+	if len(b) > 1 {
+		return b[:1]
+	}
+	return positionDigits[low:low+1] + midpoint(tail(a, 1), "")
+}
+
+// digitAt returns the value of p's digit i, or 0 past its end
+func digitAt(p string, i int) int {
+	if i >= len(p) {
+		return 0
+	}
+	return strings.IndexByte(positionDigits, p[i])
+}
+
+// tail returns p without its first n digits
+func tail(p string, n int) string {
+	if n >= len(p) {
+		return ""
+	}
+	return p[n:]
+}
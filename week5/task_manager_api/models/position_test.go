@@ -0,0 +1,102 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestPositionBetween tests placing a position at either end of a list and between two others
+func TestPositionBetween(t *testing.T) {
+	testCases := []struct {
+		name   string
+		before string
+		after  string
+		want   string
+	}{
+		{"Empty List", "", "", "a0"},
+		{"Append", "a0", "", "a1"},
+		{"Append Past A Digit", "a9", "", "aA"},
+		{"Append To A Longer Integer", "az", "", "b00"},
+		{"Append Back Up To Zero", "Zz", "", "a0"},
+		{"Append After A Fraction", "a0V", "", "a1"},
+		{"Prepend", "", "a0", "Zz"},
+		{"Prepend To A Shorter Integer", "", "Z0", "Yzz"},
+		{"Prepend Before A Fraction", "", "a0V", "a0"},
+		{"Adjacent", "a0", "a1", "a0V"},
+		{"Gap Between Integers", "a0", "a3", "a1"},
+		{"Adjacent Fractions", "a0V", "a0W", "a0VV"},
+		{"Fraction And Next Integer", "a0V", "a1", "a0l"},
+		{"Before A Fraction", "a0", "a0V", "a0G"},
+		{"Before A Long Fraction", "a0", "a01", "a00V"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := PositionBetween(tc.before, tc.after)
+			if err != nil {
+				t.Fatalf("PositionBetween(%q, %q) error = %v", tc.before, tc.after, err)
+			}
+			if got != tc.want {
+				t.Errorf("PositionBetween(%q, %q) = %q, want %q", tc.before, tc.after, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestPositionBetweenSameGap tests inserting into the same gap over and over, in
+// front of the last inserted position and behind it
+func TestPositionBetweenSameGap(t *testing.T) {
+	testCases := []struct {
+		name    string
+		inFront bool
+	}{
+		{"Behind The Last Insert", false},
+		{"In Front Of The Last Insert", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			lo, hi := "a0", "a1"
+			for i := 0; i < 200; i++ {
+				got, err := PositionBetween(lo, hi)
+				if err != nil {
+					t.Fatalf("insert %d: PositionBetween(%q, %q) error = %v", i, lo, hi, err)
+				}
+				if !ValidPosition(got) || got <= lo || got >= hi {
+					t.Fatalf("insert %d: PositionBetween(%q, %q) = %q, want a valid position between them", i, lo, hi, got)
+				}
+				if tc.inFront {
+					hi = got
+				} else {
+					lo = got
+				}
+			}
+		})
+	}
+}
+
+// TestPositionBetweenInvalid tests that bounds which aren't positions or aren't in order are refused
+func TestPositionBetweenInvalid(t *testing.T) {
+	testCases := []struct {
+		name   string
+		before string
+		after  string
+	}{
+		{"Equal Bounds", "a0", "a0"},
+		{"Reversed Bounds", "a1", "a0"},
+		{"Trailing Zero", "a00", ""},
+		{"Short Integer", "", "b0"},
+		{"Bad Head", "!0", ""},
+		{"Bad Digit", "a0", "a1-"},
+		{"Smallest Integer", "A00000000000000000000000000", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := PositionBetween(tc.before, tc.after)
+			if !errors.Is(err, ErrInvalidPosition) {
+				t.Errorf("PositionBetween(%q, %q) = %q, %v, want ErrInvalidPosition", tc.before, tc.after, got, err)
+			}
+		})
+	}
+}
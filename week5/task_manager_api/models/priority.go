@@ -0,0 +1,31 @@
+package models
+
+// Priority is how important a task is relative to the others
+type Priority string
+
+// Task priorities, from least to most important
+const (
+	PriorityLow    Priority = "low"
+	PriorityMedium Priority = "medium"
+	PriorityHigh   Priority = "high"
+	PriorityUrgent Priority = "urgent"
+)
+
+// Priorities lists every valid priority, from least to most important
+var Priorities = []Priority{PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent}
+
+// Valid reports whether p is one of the known priorities
+func (p Priority) Valid() bool {
+	return p.Rank() >= 0
+}
+
+// Rank returns p's index in Priorities, so more important priorities rank
+// higher, or -1 if p isn't a known priority
+func (p Priority) Rank() int {
+	for i, priority := range Priorities {
+		if p == priority {
+			return i
+		}
+	}
+	return -1
+}
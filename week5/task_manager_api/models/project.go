@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Project groups tasks onto a kanban board
+type Project struct {
+	ID          int           `json:"id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Columns     []BoardColumn `json:"columns"` // the board's columns, left to right
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+// BoardColumn is a column of a project's board, holding the project's tasks with its status
+type BoardColumn struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+}
+
+// DefaultColumns gives a board one column per status
+func DefaultColumns() []BoardColumn {
+	return []BoardColumn{
+		{Name: "To do", Status: StatusPending},
+		{Name: "In progress", Status: StatusInProgress},
+		{Name: "Done", Status: StatusCompleted},
+	}
+}
+
+// Board is a project's tasks grouped into its columns
+type Board struct {
+	Project Project            `json:"project"`
+	Columns []BoardColumnTasks `json:"columns"`
+}
+
+// BoardColumnTasks is a board column with its tasks, in board order
+type BoardColumnTasks struct {
+	BoardColumn
+	Tasks []Task `json:"tasks"`
+}
+
+// NewBoard groups tasks, already in board order, into project's columns.
+// Tasks whose status has no column are left off the board.
+func NewBoard(project Project, tasks []Task) Board {
+	board := Board{Project: project, Columns: make([]BoardColumnTasks, len(project.Columns))}
+	for i, column := range project.Columns {
+		board.Columns[i] = BoardColumnTasks{BoardColumn: column, Tasks: []Task{}}
+		for _, task := range tasks {
+			if task.Status == column.Status {
+				board.Columns[i].Tasks = append(board.Columns[i].Tasks, task)
+			}
+		}
+	}
+	return board
+}
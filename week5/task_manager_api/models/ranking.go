@@ -0,0 +1,182 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Horizons of the due and age factors: a task due within DueHorizon scores more
+// the sooner it is due, and a task's age counts in full once it is AgeHorizon old
+const (
+	DueHorizon = 14 * 24 * time.Hour
+	AgeHorizon = 30 * 24 * time.Hour
+)
+
+// maxBlockedTasks is how many open tasks a task has to block for its blocking factor to reach 1
+const maxBlockedTasks = 3
+
+// ScoreWeights says how much each factor counts towards a task's score
+type ScoreWeights struct {
+	Priority float64 `json:"priority"`
+	Due      float64 `json:"due"`
+	Blocking float64 `json:"blocking"`
+	Age      float64 `json:"age"`
+}
+
+// DefaultScoreWeights favours priority, then due dates, then unblocking other
+// tasks, and lets age break the rest of the ties
+func DefaultScoreWeights() ScoreWeights {
+	return ScoreWeights{Priority: 4, Due: 3, Blocking: 2, Age: 1}
+}
+
+// ParseScoreWeights parses a comma-separated list of factor=weight pairs such
+// as "priority=4,due=3". Factors that aren't listed keep their default weight.
+func ParseScoreWeights(list string) (ScoreWeights, error) {
+	weights := DefaultScoreWeights()
+	factors := map[string]*float64{
+		"priority": &weights.Priority,
+		"due":      &weights.Due,
+		"blocking": &weights.Blocking,
+		"age":      &weights.Age,
+	}
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(field, "=")
+		weight, found := factors[strings.TrimSpace(name)]
+		if !ok || !found {
+			return weights, fmt.Errorf("score weights: %q isn't factor=weight with a factor of priority, due, blocking or age", field)
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || w < 0 || math.IsInf(w, 0) || math.IsNaN(w) {
+			return weights, fmt.Errorf("score weights: the weight of %s must be a non-negative number", name)
+		}
+		*weight = w
+	}
+	if weights.Priority+weights.Due+weights.Blocking+weights.Age == 0 {
+		return weights, errors.New("score weights: at least one weight must be positive")
+	}
+	return weights, nil
+}
+
+// ScoreFactor is what one factor adds to a task's score
+type ScoreFactor struct {
+	Value  float64 `json:"value"`  // between -1 and 1
+	Weight float64 `json:"weight"` // the factor's weight
+	Points float64 `json:"points"` // Value times Weight
+	Reason string  `json:"reason"` // why the factor has its value
+}
+
+// ScoreBreakdown shows how a task's score adds up
+type ScoreBreakdown struct {
+	Priority ScoreFactor `json:"priority"`
+	Due      ScoreFactor `json:"due"`
+	Blocking ScoreFactor `json:"blocking"`
+	Age      ScoreFactor `json:"age"`
+}
+
+// RankedTask is a task with the score that ranks it against others
+type RankedTask struct {
+	Task      Task           `json:"task"`
+	Score     float64        `json:"score"`
+	Breakdown ScoreBreakdown `json:"breakdown"`
+}
+
+// ScoreTask scores how pressing task is at now. blocks is how many open tasks it
+// blocks and blockedBy how many open tasks block it. The factors are:
+//   - priority: 0 for low up to 1 for urgent
+//   - due: 1 once overdue, falling to 0 for tasks due DueHorizon or more from now, or never
+//   - blocking: -1 while blocked, otherwise up to 1 for blocking maxBlockedTasks or more
+//   - age: from 0 for a new task up to 1 for one AgeHorizon old
+func ScoreTask(task Task, blocks, blockedBy int, weights ScoreWeights, now time.Time) RankedTask {
+	var breakdown ScoreBreakdown
+
+	priority := task.Priority
+	if !priority.Valid() {
+		priority = PriorityMedium
+	}
+	breakdown.Priority = scoreFactor(float64(priority.Rank())/float64(len(Priorities)-1), weights.Priority, string(priority)+" priority")
+
+	switch until := task.DueDate.Sub(now); {
+	case task.DueDate.IsZero():
+		breakdown.Due = scoreFactor(0, weights.Due, "no due date")
+	case until <= 0:
+		breakdown.Due = scoreFactor(1, weights.Due, "overdue by "+describeDuration(-until))
+	default:
+		breakdown.Due = scoreFactor(math.Max(0, 1-float64(until)/float64(DueHorizon)), weights.Due, "due in "+describeDuration(until))
+	}
+
+	if blockedBy > 0 {
+		breakdown.Blocking = scoreFactor(-1, weights.Blocking, "blocked by "+countTasks(blockedBy))
+	} else {
+		breakdown.Blocking = scoreFactor(math.Min(float64(blocks), maxBlockedTasks)/maxBlockedTasks, weights.Blocking, "blocks "+countTasks(blocks))
+	}
+
+	age := now.Sub(task.CreatedAt)
+	if age < 0 {
+		age = 0
+	}
+	breakdown.Age = scoreFactor(math.Min(1, float64(age)/float64(AgeHorizon)), weights.Age, "created "+describeDuration(age)+" ago")
+
+	score := breakdown.Priority.Points + breakdown.Due.Points + breakdown.Blocking.Points + breakdown.Age.Points
+	return RankedTask{Task: task, Score: roundScore(score), Breakdown: breakdown}
+}
+
+// SortRankedTasks orders tasks by score, highest first, then by due date,
+// soonest first with undated tasks last, then by ID
+func SortRankedTasks(tasks []RankedTask) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, b := tasks[i], tasks[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if !a.Task.DueDate.Equal(b.Task.DueDate) {
+			return !a.Task.DueDate.IsZero() && (b.Task.DueDate.IsZero() || a.Task.DueDate.Before(b.Task.DueDate))
+		}
+		return a.Task.ID < b.Task.ID
+	})
+}
+
+// scoreFactor weighs a factor's value. The points are rounded before they are
+// added up, so the breakdown adds up to the score.
+func scoreFactor(value, weight float64, reason string) ScoreFactor {
+	return ScoreFactor{Value: roundScore(value), Weight: weight, Points: roundScore(value * weight), Reason: reason}
+}
+
+// roundScore rounds x to three decimal places
+func roundScore(x float64) float64 {
+	return math.Round(x*1000) / 1000
+}
+
+// countTasks describes a number of open tasks
+func countTasks(n int) string {
+	switch n {
+	case 0:
+		return "no open tasks"
+	case 1:
+		return "1 open task"
+	}
+	return strconv.Itoa(n) + " open tasks"
+}
+
+// describeDuration describes d in whole days, or in hours when it is shorter than a day
+func describeDuration(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return strconv.Itoa(int(d/(24*time.Hour))) + " days"
+	case d >= 24*time.Hour:
+		return "1 day"
+	case d >= 2*time.Hour:
+		return strconv.Itoa(int(d/time.Hour)) + " hours"
+	case d >= time.Hour:
+		return "1 hour"
+	}
+	return "less than an hour"
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScoreWeights(t *testing.T) {
+	testCases := []struct {
+		name    string
+		list    string
+		want    ScoreWeights
+		wantErr bool
+	}{
+		{"Empty", "", DefaultScoreWeights(), false},
+		{"Some Factors", "due=4, priority=2", ScoreWeights{Priority: 2, Due: 4, Blocking: 2, Age: 1}, false},
+		{"Fractional", "age=0.5", ScoreWeights{Priority: 4, Due: 3, Blocking: 2, Age: 0.5}, false},
+		{"Unknown Factor", "urgency=2", ScoreWeights{}, true},
+		{"Missing Weight", "due", ScoreWeights{}, true},
+		{"Negative", "due=-1", ScoreWeights{}, true},
+		{"Infinite", "due=Inf", ScoreWeights{}, true},
+		{"Not A Number", "priority=NaN", ScoreWeights{}, true},
+		{"All Zero", "priority=0,due=0,blocking=0,age=0", ScoreWeights{}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseScoreWeights(tc.list)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ParseScoreWeights(%q) error = %v, want error %v", tc.list, err, tc.wantErr)
+			}
+			if !tc.wantErr && got != tc.want {
+				t.Errorf("ParseScoreWeights(%q) = %+v, want %+v", tc.list, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestScoreTask(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	weights := DefaultScoreWeights()
+
+	urgent := ScoreTask(Task{ID: 1, Priority: PriorityUrgent, DueDate: now.Add(-time.Hour), CreatedAt: now.Add(-AgeHorizon)}, 3, 0, weights, now)
+	if urgent.Score != 10 {
+		t.Errorf("ScoreTask() of an overdue urgent task blocking 3 = %v, want the sum of the weights", urgent.Score)
+	}
+	blocked := ScoreTask(Task{ID: 2, Priority: PriorityLow, CreatedAt: now}, 0, 1, weights, now)
+	if blocked.Score != -2 || blocked.Breakdown.Blocking.Reason != "blocked by 1 open task" {
+		t.Errorf("ScoreTask() of a new blocked low priority task = %+v, want -2", blocked)
+	}
+
+	ranked := []RankedTask{blocked, urgent}
+	SortRankedTasks(ranked)
+	if ranked[0].Task.ID != 1 {
+		t.Errorf("SortRankedTasks() = %+v, want the urgent task first", ranked)
+	}
+}
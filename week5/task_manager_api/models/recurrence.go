@@ -0,0 +1,314 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is the period a recurrence repeats over
+type Frequency string
+
+// The frequencies a recurrence can have
+const (
+	FrequencyDaily   Frequency = "DAILY"
+	FrequencyWeekly  Frequency = "WEEKLY"
+	FrequencyMonthly Frequency = "MONTHLY"
+	FrequencyYearly  Frequency = "YEARLY"
+)
+
+// untilLayout formats UNTIL as a UTC date-time; untilDateLayout is the date-only form
+const (
+	untilLayout     = "20060102T150405Z"
+	untilDateLayout = "20060102"
+)
+
+// maxRecurrencePeriods bounds the search for the next occurrence, so rules that
+// can never match again, like BYMONTHDAY=31 every 12 months from February, end
+// the series instead of looping forever
+const maxRecurrencePeriods = 1000
+
+// weekdayCodes maps RRULE weekday codes to weekdays
+var weekdayCodes = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// Recurrence is a task's repeat schedule: the subset of an iCalendar (RFC 5545)
+// RRULE made of FREQ, INTERVAL, BYDAY, BYMONTHDAY, COUNT and UNTIL
+type Recurrence struct {
+	Frequency  Frequency
+	Interval   int            // periods between occurrences, at least 1
+	ByDay      []time.Weekday // weekdays occurrences fall on; any if empty
+	ByMonthDay []int          // days of the month occurrences fall on, negative from the end; any if empty
+	Count      int            // occurrences left, the current one included; 0 for no limit
+	Until      time.Time      // latest time an occurrence can fall on; zero for no limit
+}
+
+// ParseRecurrence parses an RRULE such as "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=10".
+// An "RRULE:" prefix is allowed and case is ignored. BYDAY takes plain
+// weekdays, without the ordinals of "1MO", and isn't allowed with YEARLY;
+// BYMONTHDAY is only allowed with DAILY and MONTHLY.
+func ParseRecurrence(rule string) (Recurrence, error) {
+	r := Recurrence{Interval: 1}
+
+	rule = strings.ToUpper(strings.TrimSpace(rule))
+	rule = strings.TrimPrefix(rule, "RRULE:")
+	seen := map[string]bool{}
+	for _, part := range strings.Split(rule, ";") {
+		key, value, found := strings.Cut(part, "=")
+		if !found || value == "" {
+			return r, fmt.Errorf("%q is not a KEY=VALUE pair", part)
+		}
+		if seen[key] {
+			return r, fmt.Errorf("%s appears more than once", key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "FREQ":
+			r.Frequency = Frequency(value)
+			if r.Frequency != FrequencyDaily && r.Frequency != FrequencyWeekly &&
+				r.Frequency != FrequencyMonthly && r.Frequency != FrequencyYearly {
+				return r, fmt.Errorf("FREQ must be DAILY, WEEKLY, MONTHLY or YEARLY")
+			}
+		case "INTERVAL":
+			r.Interval, err = positiveInt(key, value)
+		case "COUNT":
+			r.Count, err = positiveInt(key, value)
+		case "UNTIL":
+			r.Until, err = parseUntil(value)
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				day, ok := weekdayCodes[code]
+				if !ok {
+					return r, fmt.Errorf("BYDAY values must be MO, TU, WE, TH, FR, SA or SU")
+				}
+				r.ByDay = append(r.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				day, convErr := strconv.Atoi(v)
+				if convErr != nil || day == 0 || day < -31 || day > 31 {
+					return r, fmt.Errorf("BYMONTHDAY values must be between 1 and 31 or -31 and -1")
+				}
+				r.ByMonthDay = append(r.ByMonthDay, day)
+			}
+		default:
+			return r, fmt.Errorf("%s is not supported", key)
+		}
+		if err != nil {
+			return r, err
+		}
+	}
+
+	switch {
+	case r.Frequency == "":
+		return r, errors.New("FREQ is required")
+	case r.Count != 0 && !r.Until.IsZero():
+		return r, errors.New("COUNT and UNTIL can't both be set")
+	case len(r.ByDay) > 0 && r.Frequency == FrequencyYearly:
+		return r, errors.New("BYDAY can't be used with FREQ=YEARLY")
+	case len(r.ByMonthDay) > 0 && (r.Frequency == FrequencyWeekly || r.Frequency == FrequencyYearly):
+		return r, errors.New("BYMONTHDAY can only be used with FREQ=DAILY or FREQ=MONTHLY")
+	}
+	return r, nil
+}
+
+// positiveInt parses the value of an RRULE part that must be a positive integer
+func positiveInt(key, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer", key)
+	}
+	return n, nil
+}
+
+// parseUntil parses an UNTIL value. A date on its own lasts until the end of that day in UTC.
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.Parse(untilLayout, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(untilDateLayout, value); err == nil {
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, errors.New("UNTIL must be a date like 20261231 or a UTC time like 20261231T170000Z")
+}
+
+// String returns the rule in canonical form, which parses back to the same recurrence
+func (r Recurrence) String() string {
+	parts := []string{"FREQ=" + string(r.Frequency)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			codes[i] = strings.ToUpper(day.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayout))
+	}
+	return strings.Join(parts, ";")
+}
+
+// NormalizeRecurrence parses rule and returns it in canonical form. The empty rule,
+// meaning a task doesn't recur, stays empty.
+func NormalizeRecurrence(rule string) (string, error) {
+	if strings.TrimSpace(rule) == "" {
+		return "", nil
+	}
+	r, err := ParseRecurrence(rule)
+	if err != nil {
+		return "", err
+	}
+	return r.String(), nil
+}
+
+// Next returns the first occurrence after from, keeping from's time of day,
+// or false if there is none before UNTIL. from is taken as the start of the
+// series, so periods are counted from it.
+func (r Recurrence) Next(from time.Time) (time.Time, bool) {
+	for period := 0; period < maxRecurrencePeriods; period++ {
+		for _, day := range r.candidates(from, period) {
+			if !day.After(from) {
+				continue
+			}
+			if !r.Until.IsZero() && day.After(r.Until) {
+				return time.Time{}, false
+			}
+			return day, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// candidates returns the days in the period-th period after the one holding
+// from that match the rule, in order
+func (r Recurrence) candidates(from time.Time, period int) []time.Time {
+	step := period * r.Interval
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, from.Hour(), from.Minute(), from.Second(), from.Nanosecond(), from.Location())
+	}
+
+	var days []time.Time
+	switch r.Frequency {
+	case FrequencyDaily:
+		day := from.AddDate(0, 0, step)
+		if r.matchesWeekday(day) && r.matchesMonthDay(day) {
+			days = append(days, day)
+		}
+	case FrequencyWeekly:
+		// Weeks start on Monday, as RRULE's default WKST=MO has them
+		weekStart := from.AddDate(0, 0, -((int(from.Weekday())+6)%7)+7*step)
+		for i := 0; i < 7; i++ {
+			day := weekStart.AddDate(0, 0, i)
+			if r.matchesWeekday(day) && (len(r.ByDay) > 0 || day.Weekday() == from.Weekday()) {
+				days = append(days, day)
+			}
+		}
+	case FrequencyMonthly:
+		first := at(from.Year(), from.Month()+time.Month(step), 1)
+		for day := first; day.Month() == first.Month(); day = day.AddDate(0, 0, 1) {
+			if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+				if day.Day() == from.Day() {
+					days = append(days, day)
+				}
+			} else if r.matchesWeekday(day) && r.matchesMonthDay(day) {
+				days = append(days, day)
+			}
+		}
+	case FrequencyYearly:
+		// Dates that don't exist that year, like February 29, are skipped
+		day := at(from.Year()+step, from.Month(), from.Day())
+		if day.Day() == from.Day() {
+			days = append(days, day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+// matchesWeekday reports whether day falls on one of BYDAY's weekdays, or BYDAY is empty
+func (r Recurrence) matchesWeekday(day time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, weekday := range r.ByDay {
+		if day.Weekday() == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMonthDay reports whether day is one of BYMONTHDAY's days, or BYMONTHDAY is empty
+func (r Recurrence) matchesMonthDay(day time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	daysInMonth := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+	for _, monthDay := range r.ByMonthDay {
+		if monthDay == day.Day() || monthDay < 0 && daysInMonth+monthDay+1 == day.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+// NextOccurrence returns the task that follows task in its series once it is
+// completed at completedAt, or false if the series ends with it. The next task
+// is pending, keeps task's details and is due at the rule's next occurrence
+// after task's due date, or after completedAt if task had none. Its rule
+// counts one fewer occurrence when the rule has a COUNT.
+func NextOccurrence(task Task, completedAt time.Time) (Task, bool) {
+	rule, err := ParseRecurrence(task.Recurrence)
+	if err != nil || rule.Count == 1 {
+		return Task{}, false
+	}
+
+	from := task.DueDate
+	if from.IsZero() {
+		from = completedAt
+	}
+	due, ok := rule.Next(from)
+	if !ok {
+		return Task{}, false
+	}
+	if rule.Count > 1 {
+		rule.Count--
+	}
+
+	next := Task{
+		Title:       task.Title,
+		Description: task.Description,
+		Status:      StatusPending,
+		DueDate:     due,
+		ParentID:    task.ParentID,
+		Tags:        task.Tags,
+		CreatedBy:   task.CreatedBy,
+		AssigneeID:  task.AssigneeID,
+		Recurrence:  rule.String(),
+		SeriesID:    task.SeriesID,
+		ProjectID:   task.ProjectID,
+		Estimate:    task.Estimate,
+		Priority:    task.Priority,
+	}
+	return next, true
+}
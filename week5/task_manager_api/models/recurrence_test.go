@@ -0,0 +1,143 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// TestNormalizeRecurrence tests parsing rules and writing them back in canonical form
+func TestNormalizeRecurrence(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rule    string
+		want    string
+		wantErr bool
+	}{
+		{"Empty", "", "", false},
+		{"Prefix And Case", "rrule:freq=weekly;byday=mo,th;count=10", "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=10", false},
+		{"Default Interval", "FREQ=DAILY;INTERVAL=1", "FREQ=DAILY", false},
+		{"Interval", "INTERVAL=2;FREQ=WEEKLY", "FREQ=WEEKLY;INTERVAL=2", false},
+		{"Last Day Of Month", "FREQ=MONTHLY;BYMONTHDAY=-1", "FREQ=MONTHLY;BYMONTHDAY=-1", false},
+		{"Until Date", "FREQ=DAILY;UNTIL=20261231", "FREQ=DAILY;UNTIL=20261231T235959Z", false},
+		{"Until Time", "FREQ=DAILY;UNTIL=20261231T170000Z", "FREQ=DAILY;UNTIL=20261231T170000Z", false},
+		{"Missing Frequency", "INTERVAL=2", "", true},
+		{"Unknown Frequency", "FREQ=HOURLY", "", true},
+		{"Zero Interval", "FREQ=DAILY;INTERVAL=0", "", true},
+		{"Zero Count", "FREQ=DAILY;COUNT=0", "", true},
+		{"Count And Until", "FREQ=DAILY;COUNT=2;UNTIL=20261231", "", true},
+		{"Invalid Until", "FREQ=DAILY;UNTIL=tomorrow", "", true},
+		{"Ordinal Weekday", "FREQ=MONTHLY;BYDAY=1MO", "", true},
+		{"Weekdays Every Year", "FREQ=YEARLY;BYDAY=MO", "", true},
+		{"Month Day Every Week", "FREQ=WEEKLY;BYMONTHDAY=1", "", true},
+		{"Month Day Out Of Range", "FREQ=MONTHLY;BYMONTHDAY=32", "", true},
+		{"Repeated Part", "FREQ=DAILY;FREQ=WEEKLY", "", true},
+		{"Unsupported Part", "FREQ=WEEKLY;WKST=SU", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NormalizeRecurrence(tc.rule)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("NormalizeRecurrence(%q) error = %v, want error %v", tc.rule, err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("NormalizeRecurrence(%q) = %q, want %q", tc.rule, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestRecurrenceNext tests finding the occurrence that follows another
+func TestRecurrenceNext(t *testing.T) {
+	// day returns 09:00 UTC on a date; 2026-03-02 is a Monday
+	day := func(year int, month time.Month, date int) time.Time {
+		return time.Date(year, month, date, 9, 0, 0, 0, time.UTC)
+	}
+
+	testCases := []struct {
+		name   string
+		rule   string
+		from   time.Time
+		want   time.Time
+		wantOK bool
+	}{
+		{"Daily", "FREQ=DAILY", day(2026, 3, 2), day(2026, 3, 3), true},
+		{"Every Third Day", "FREQ=DAILY;INTERVAL=3", day(2026, 3, 2), day(2026, 3, 5), true},
+		{"Weekdays Over A Weekend", "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR", day(2026, 3, 6), day(2026, 3, 9), true},
+		{"Weekly", "FREQ=WEEKLY", day(2026, 3, 2), day(2026, 3, 9), true},
+		{"Later In The Week", "FREQ=WEEKLY;BYDAY=MO,TH", day(2026, 3, 2), day(2026, 3, 5), true},
+		{"Into The Next Week", "FREQ=WEEKLY;BYDAY=MO,TH", day(2026, 3, 5), day(2026, 3, 9), true},
+		{"Fortnightly Within The Week", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", day(2026, 3, 2), day(2026, 3, 6), true},
+		{"Fortnightly Skips A Week", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", day(2026, 3, 6), day(2026, 3, 16), true},
+		{"Monthly", "FREQ=MONTHLY", day(2026, 3, 15), day(2026, 4, 15), true},
+		{"Quarterly Skips February", "FREQ=MONTHLY;INTERVAL=3", day(2026, 11, 30), day(2027, 5, 30), true},
+		{"Monthly On The 31st Skips Short Months", "FREQ=MONTHLY", day(2026, 1, 31), day(2026, 3, 31), true},
+		{"Last Day Of February", "FREQ=MONTHLY;BYMONTHDAY=-1", day(2026, 1, 31), day(2026, 2, 28), true},
+		{"Last Day Of A Leap February", "FREQ=MONTHLY;BYMONTHDAY=-1", day(2028, 1, 31), day(2028, 2, 29), true},
+		{"Month Days", "FREQ=MONTHLY;BYMONTHDAY=1,15", day(2026, 3, 1), day(2026, 3, 15), true},
+		{"Mondays Of Each Month", "FREQ=MONTHLY;BYDAY=MO", day(2026, 3, 30), day(2026, 4, 6), true},
+		{"Yearly", "FREQ=YEARLY", day(2026, 3, 2), day(2027, 3, 2), true},
+		{"Leap Day", "FREQ=YEARLY", day(2028, 2, 29), day(2032, 2, 29), true},
+		{"Before Until Date", "FREQ=DAILY;UNTIL=20260303", day(2026, 3, 2), day(2026, 3, 3), true},
+		{"After Until Date", "FREQ=DAILY;UNTIL=20260303", day(2026, 3, 3), time.Time{}, false},
+		{"After Until Time", "FREQ=WEEKLY;UNTIL=20260309T080000Z", day(2026, 3, 2), time.Time{}, false},
+		{"Never Matches Again", "FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=31", day(2026, 2, 10), time.Time{}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, err := ParseRecurrence(tc.rule)
+			if err != nil {
+				t.Fatalf("ParseRecurrence(%q) error = %v", tc.rule, err)
+			}
+			got, ok := rule.Next(tc.from)
+			if ok != tc.wantOK || !got.Equal(tc.want) {
+				t.Errorf("Next(%v) of %s = %v, %v, want %v, %v", tc.from, tc.rule, got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+// TestNextOccurrence tests creating the task that follows a completed occurrence
+func TestNextOccurrence(t *testing.T) {
+	due := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	completedAt := time.Date(2026, 3, 4, 17, 30, 0, 0, time.UTC)
+	seriesID := 1
+
+	testCases := []struct {
+		name     string
+		task     Task
+		wantDue  time.Time
+		wantRule string
+		wantOK   bool
+	}{
+		{"Counts Down", Task{Recurrence: "FREQ=WEEKLY;COUNT=3", DueDate: due}, due.AddDate(0, 0, 7), "FREQ=WEEKLY;COUNT=2", true},
+		{"Last Of Count", Task{Recurrence: "FREQ=WEEKLY;COUNT=1", DueDate: due}, time.Time{}, "", false},
+		{"Keeps Until", Task{Recurrence: "FREQ=DAILY;UNTIL=20260303", DueDate: due}, due.AddDate(0, 0, 1), "FREQ=DAILY;UNTIL=20260303T235959Z", true},
+		{"Past Until", Task{Recurrence: "FREQ=DAILY;UNTIL=20260302", DueDate: due}, time.Time{}, "", false},
+		{"No Due Date", Task{Recurrence: "FREQ=DAILY"}, completedAt.AddDate(0, 0, 1), "FREQ=DAILY", true},
+		{"Invalid Rule", Task{Recurrence: "FREQ=HOURLY", DueDate: due}, time.Time{}, "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.task.Title = "Water plants"
+			tc.task.Status = StatusCompleted
+			tc.task.SeriesID = &seriesID
+
+			next, ok := NextOccurrence(tc.task, completedAt)
+			if ok != tc.wantOK {
+				t.Fatalf("NextOccurrence() ok = %v, want %v", ok, tc.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if !next.DueDate.Equal(tc.wantDue) || next.Recurrence != tc.wantRule {
+				t.Errorf("NextOccurrence() = due %v rule %q, want due %v rule %q", next.DueDate, next.Recurrence, tc.wantDue, tc.wantRule)
+			}
+			if next.Title != "Water plants" || next.Status != StatusPending || next.SeriesID != &seriesID {
+				t.Errorf("NextOccurrence() = %+v, want a pending copy in the same series", next)
+			}
+		})
+	}
+}
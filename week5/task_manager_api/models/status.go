@@ -0,0 +1,119 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Status is the state of a task in its workflow
+type Status string
+
+// Task statuses
+const (
+	StatusPending    Status = "pending"
+	StatusInProgress Status = "in_progress"
+	StatusCompleted  Status = "completed"
+)
+
+// Statuses lists every valid status
+var Statuses = []Status{StatusPending, StatusInProgress, StatusCompleted}
+
+// Valid reports whether s is one of the known statuses
+func (s Status) Valid() bool {
+	for _, status := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Workflow defines which status changes a task may make
+type Workflow struct {
+	// Transitions lists, for each status, the statuses an update may move it to
+	Transitions map[Status][]Status `json:"transitions"`
+	// Reopen maps statuses that can only be left by an explicit reopen
+	// to the status reopening moves the task to
+	Reopen map[Status]Status `json:"reopen"`
+}
+
+// DefaultWorkflow lets pending and in-progress tasks move freely, while a
+// completed task has to be reopened, which moves it back to pending
+func DefaultWorkflow() Workflow {
+	return Workflow{
+		Transitions: map[Status][]Status{
+			StatusPending:    {StatusInProgress, StatusCompleted},
+			StatusInProgress: {StatusPending, StatusCompleted},
+			StatusCompleted:  {},
+		},
+		Reopen: map[Status]Status{
+			StatusCompleted: StatusPending,
+		},
+	}
+}
+
+// LoadWorkflow reads a Workflow from JSON and validates it
+func LoadWorkflow(r io.Reader) (Workflow, error) {
+	var w Workflow
+	if err := json.NewDecoder(r).Decode(&w); err != nil {
+		return w, err
+	}
+	return w, w.Validate()
+}
+
+// Validate checks that the workflow only refers to known statuses
+func (w Workflow) Validate() error {
+	for from, targets := range w.Transitions {
+		if !from.Valid() {
+			return fmt.Errorf("workflow: unknown status %q", from)
+		}
+		for _, to := range targets {
+			if !to.Valid() {
+				return fmt.Errorf("workflow: unknown status %q in transitions from %q", to, from)
+			}
+		}
+	}
+	for from, to := range w.Reopen {
+		if !from.Valid() || !to.Valid() {
+			return fmt.Errorf("workflow: unknown status in reopen %q -> %q", from, to)
+		}
+	}
+	return nil
+}
+
+// Allowed returns the statuses an update may move a task in status from to
+func (w Workflow) Allowed(from Status) []Status {
+	return append([]Status{}, w.Transitions[from]...)
+}
+
+// CanTransition reports whether an update may change a task's status from one value to another.
+// Keeping the same status is always allowed.
+func (w Workflow) CanTransition(from, to Status) bool {
+	if from == to {
+		return true
+	}
+	for _, allowed := range w.Transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ReopenTarget returns the status a task in status from moves to when reopened,
+// and false if tasks in that status cannot be reopened
+func (w Workflow) ReopenTarget(from Status) (Status, bool) {
+	to, ok := w.Reopen[from]
+	return to, ok
+}
+
+// StatusChange is one entry in a task's status history
+type StatusChange struct {
+	ID     int       `json:"id"`
+	TaskID int       `json:"task_id"`
+	From   Status    `json:"from,omitempty"` // empty for the status a task was created with
+	To     Status    `json:"to"`
+	At     time.Time `json:"at"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// MaxTagLength is the longest tag name allowed, in characters
+const MaxTagLength = 50
+
+// TagCount is a tag and the number of tasks outside the trash that have it
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// NormalizeTags trims and lowercases tags, drops duplicates and sorts them,
+// so that "Backend" and " backend" are the same tag. It never returns nil.
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// ValidTag reports whether a normalized tag can be stored: it must be
+// non-empty, at most MaxTagLength characters and free of commas
+func ValidTag(tag string) bool {
+	length := len([]rune(tag))
+	return length > 0 && length <= MaxTagLength && !strings.Contains(tag, ",")
+}
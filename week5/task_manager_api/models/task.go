@@ -4,11 +4,24 @@ import "time"
 
 // Task represents a task in our task manager application
 type Task struct {
-	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Status      string    `json:"status"` // "pending", "in_progress", "completed"
-	DueDate     time.Time `json:"due_date"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      Status     `json:"status"`
+	DueDate     time.Time  `json:"due_date"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Version     int        `json:"version"`              // incremented by every update
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"` // set while the task is in the trash
+	ParentID    *int       `json:"parent_id"`            // the task this is a subtask of, if any
+	Tags        []string   `json:"tags"`                 // normalized with NormalizeTags
+	CreatedBy   *int       `json:"created_by"`           // the user who created the task, who owns it
+	AssigneeID  *int       `json:"assignee_id"`          // the user the task is assigned to, if any
+	Recurrence  string     `json:"recurrence"`           // an RRULE in canonical form, empty unless the task repeats
+	SeriesID    *int       `json:"series_id"`            // the first task of the recurring series this belongs to
+	OverdueAt   *time.Time `json:"overdue_at,omitempty"` // when the task was found open past its due date
+	ProjectID   *int       `json:"project_id"`           // the project whose board the task is on, if any
+	Position    string     `json:"position"`             // orders the task within its board column; see PositionBetween
+	Estimate    *int       `json:"estimate_minutes"`     // how many minutes the task is expected to take, if estimated
+	Priority    Priority   `json:"priority"`             // how important the task is; medium unless set
 }
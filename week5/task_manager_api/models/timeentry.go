@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// MaxTimeEntryNoteLength is the longest note on a time entry, in characters
+const MaxTimeEntryNoteLength = 1000
+
+// TimeEntry is a stretch of time spent on a task. An entry without StoppedAt
+// is a running timer; each caller can have only one running at a time.
+type TimeEntry struct {
+	ID        int        `json:"id"`
+	TaskID    int        `json:"task_id"`
+	TrackedBy string     `json:"tracked_by"` // the caller who spent the time, as the audit log names them
+	UserID    *int       `json:"user_id"`    // the user who spent the time, if the caller acted as one
+	StartedAt time.Time  `json:"started_at"`
+	StoppedAt *time.Time `json:"stopped_at"` // null while the timer is running
+	Minutes   int        `json:"minutes"`    // the entry's duration rounded to the minute; 0 while running
+	Note      string     `json:"note"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Duration returns how long the entry lasted, or 0 while its timer is running
+func (e TimeEntry) Duration() time.Duration {
+	if e.StoppedAt == nil {
+		return 0
+	}
+	return e.StoppedAt.Sub(e.StartedAt)
+}
+
+// DurationMinutes rounds a duration to the nearest minute
+func DurationMinutes(d time.Duration) int {
+	return int(d.Round(time.Minute) / time.Minute)
+}
+
+// TimeReport totals the time tracked in a period, split into groups
+type TimeReport struct {
+	From         *time.Time        `json:"from"` // null when the period has no start
+	To           *time.Time        `json:"to"`   // null when the period has no end
+	GroupBy      string            `json:"group_by"`
+	TotalMinutes int               `json:"total_minutes"`
+	Groups       []TimeReportGroup `json:"groups"`
+}
+
+// TimeReportGroup is the time tracked on one task, on one day or on tasks with one status
+type TimeReportGroup struct {
+	Key      string `json:"key"`                        // the task's ID, the day as YYYY-MM-DD or the status
+	TaskID   int    `json:"task_id,omitempty"`          // the task, when grouped by task
+	Title    string `json:"title,omitempty"`            // the task's title, when grouped by task
+	Estimate *int   `json:"estimate_minutes,omitempty"` // the task's estimate, when grouped by task
+	Minutes  int    `json:"minutes"`
+	Entries  int    `json:"entries"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// User is a person who creates and is assigned tasks
+type User struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
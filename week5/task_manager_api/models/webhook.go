@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventAll subscribes a webhook to every event
+const EventAll = "*"
+
+// WebhookEvents lists every event a webhook can subscribe to
+var WebhookEvents = []string{EventTaskCreated, EventTaskUpdated, EventTaskCompleted, EventTaskDeleted}
+
+// Webhook is a subscription that has task events POSTed to a URL. Deliveries
+// are signed with the secret, which is only shown when the webhook is created.
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Subscribes reports whether the webhook wants event
+func (w Webhook) Subscribes(event string) bool {
+	for _, e := range w.Events {
+		if e == event || e == EventAll {
+			return true
+		}
+	}
+	return false
+}
+
+// DeliveryStatus is where a webhook delivery is in its lifecycle
+type DeliveryStatus string
+
+// Delivery statuses. Pending deliveries are retried until they succeed or run
+// out of attempts and become dead.
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryDead      DeliveryStatus = "dead"
+)
+
+// WebhookEvent is the body POSTed to a webhook
+type WebhookEvent struct {
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Task       Task      `json:"task"`
+}
+
+// WebhookDelivery is one event queued for one webhook, with the outcome of its latest attempt
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	ResponseStatus int             `json:"response_status,omitempty"` // HTTP status of the latest attempt
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
@@ -0,0 +1,108 @@
+package reminders
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// webhookTimeout bounds each delivery attempt of a webhook notifier
+const webhookTimeout = 10 * time.Second
+
+// webhookAttempts is how many times a webhook notifier tries to deliver a reminder
+const webhookAttempts = 3
+
+// LogNotifier writes reminders to the standard logger
+func LogNotifier() Notifier {
+	return NotifierFunc(func(ctx context.Context, reminder Reminder) error {
+		if reminder.Threshold == ThresholdOverdue {
+			log.Printf("Reminder: task %d %q was due at %s and is overdue",
+				reminder.TaskID, reminder.Title, reminder.DueDate.Format(time.RFC3339))
+		} else {
+			log.Printf("Reminder: task %d %q is due within %s, at %s",
+				reminder.TaskID, reminder.Title, reminder.Threshold, reminder.DueDate.Format(time.RFC3339))
+		}
+		return nil
+	})
+}
+
+// WebhookNotifier POSTs each reminder as JSON to url. Failed deliveries,
+// including responses other than 2xx, are retried a couple of times.
+func WebhookNotifier(url string) Notifier {
+	client := &http.Client{Timeout: webhookTimeout}
+	return NotifierFunc(func(ctx context.Context, reminder Reminder) error {
+		body, err := json.Marshal(reminder)
+		if err != nil {
+			return err
+		}
+
+		for attempt := 1; ; attempt++ {
+			err = post(ctx, client, url, body)
+			if err == nil || attempt == webhookAttempts {
+				return err
+			}
+			select {
+			case <-time.After(time.Duration(attempt) * time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+}
+
+// post delivers one webhook request
+func post(ctx context.Context, client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// SpoolNotifier writes each reminder as a JSON file in dir, creating it if
+// needed, for another process to pick up. Files appear complete: they are
+// written under a hidden temporary name and then renamed.
+func SpoolNotifier(dir string) (Notifier, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return NotifierFunc(func(ctx context.Context, reminder Reminder) error {
+		data, err := json.Marshal(reminder)
+		if err != nil {
+			return err
+		}
+
+		tmp, err := os.CreateTemp(dir, ".reminder-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		if _, err := tmp.Write(append(data, '\n')); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+
+		name := fmt.Sprintf("%s-task%d-%s.json", reminder.FiredAt.UTC().Format("20060102T150405.000000000Z"),
+			reminder.TaskID, reminder.Threshold)
+		return os.Rename(tmp.Name(), filepath.Join(dir, name))
+	}), nil
+}
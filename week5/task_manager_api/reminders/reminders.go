@@ -0,0 +1,210 @@
+// Package reminders finds tasks approaching or past their due date, marks the
+// late ones overdue and sends reminders about them to notifiers.
+package reminders
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"task_manager_api/database"
+	"task_manager_api/models"
+	"time"
+)
+
+// ThresholdOverdue is the threshold of reminders sent once a task is past its due date
+const ThresholdOverdue = "overdue"
+
+// Reminder is the event sent to notifiers when a task reaches a threshold
+type Reminder struct {
+	TaskID     int       `json:"task_id"`
+	Title      string    `json:"title"`
+	DueDate    time.Time `json:"due_date"`
+	Threshold  string    `json:"threshold"` // ThresholdOverdue, or the lead time before the due date such as "24h"
+	AssigneeID *int      `json:"assignee_id"`
+	CreatedBy  *int      `json:"created_by"`
+	FiredAt    time.Time `json:"fired_at"`
+}
+
+// Notifier delivers reminders
+type Notifier interface {
+	Notify(ctx context.Context, reminder Reminder) error
+}
+
+// NotifierFunc adapts a function to a Notifier
+type NotifierFunc func(ctx context.Context, reminder Reminder) error
+
+// Notify calls f
+func (f NotifierFunc) Notify(ctx context.Context, reminder Reminder) error {
+	return f(ctx, reminder)
+}
+
+// Scheduler sends each task's reminders once: one when it comes within each
+// lead time of its due date, and one when it is overdue
+type Scheduler struct {
+	store     database.TaskStore
+	leadTimes []time.Duration // longest first
+	notifiers []Notifier
+}
+
+// NewScheduler returns a scheduler for the tasks in store that sends reminders
+// to notifiers. Lead times that aren't positive are ignored.
+func NewScheduler(store database.TaskStore, leadTimes []time.Duration, notifiers ...Notifier) *Scheduler {
+	s := &Scheduler{store: store, notifiers: notifiers}
+	for _, lead := range leadTimes {
+		if lead > 0 {
+			s.leadTimes = append(s.leadTimes, lead)
+		}
+	}
+	sort.Slice(s.leadTimes, func(i, j int) bool { return s.leadTimes[i] > s.leadTimes[j] })
+	return s
+}
+
+// ParseLeadTimes parses a comma-separated list of durations such as "24h,1h"
+func ParseLeadTimes(list string) ([]time.Duration, error) {
+	var leadTimes []time.Duration
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		lead, err := time.ParseDuration(field)
+		if err != nil {
+			return nil, err
+		}
+		if lead <= 0 {
+			return nil, errors.New("lead times must be positive")
+		}
+		leadTimes = append(leadTimes, lead)
+	}
+	return leadTimes, nil
+}
+
+// Threshold names a lead time the way reminders report it, such as "24h" or "1h30m"
+func Threshold(lead time.Duration) string {
+	name := lead.String()
+	if strings.HasSuffix(name, "m0s") {
+		name = strings.TrimSuffix(name, "0s")
+	}
+	if strings.HasSuffix(name, "h0m") {
+		name = strings.TrimSuffix(name, "0m")
+	}
+	return name
+}
+
+// Run checks every open task once at now. A task that reached several
+// thresholds since the last run, such as one created already late, only gets
+// the reminder for the most urgent one; the others are recorded as sent.
+// Overdue tasks are marked with their OverdueAt.
+func (s *Scheduler) Run(ctx context.Context, now time.Time) error {
+	horizon := now.Add(time.Nanosecond)
+	if len(s.leadTimes) > 0 {
+		horizon = now.Add(s.leadTimes[0] + time.Nanosecond)
+	}
+	page, err := s.store.ListTasks(database.TaskFilter{
+		Statuses:  []models.Status{models.StatusPending, models.StatusInProgress},
+		DueBefore: horizon,
+		Sort:      database.SortDueDate,
+		Order:     database.OrderAsc,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, task := range page.Tasks {
+		if err := s.check(ctx, task, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check sends the reminder for the most urgent threshold task has newly reached
+func (s *Scheduler) check(ctx context.Context, task models.Task, now time.Time) error {
+	overdue := now.After(task.DueDate)
+	if overdue && task.OverdueAt == nil {
+		if err := s.store.MarkOverdue(task.ID, now); err != nil {
+			return err
+		}
+	}
+
+	// Thresholds from the most urgent to the least
+	var reached []string
+	if overdue {
+		reached = append(reached, ThresholdOverdue)
+	}
+	for i := len(s.leadTimes) - 1; i >= 0; i-- {
+		if !now.Before(task.DueDate.Add(-s.leadTimes[i])) {
+			reached = append(reached, Threshold(s.leadTimes[i]))
+		}
+	}
+
+	send := true
+	for _, threshold := range reached {
+		claimed, err := s.store.ClaimReminder(task.ID, threshold, task.DueDate)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			// Less urgent reminders were claimed along with this one
+			break
+		}
+		if send {
+			s.notify(ctx, Reminder{
+				TaskID:     task.ID,
+				Title:      task.Title,
+				DueDate:    task.DueDate,
+				Threshold:  threshold,
+				AssigneeID: task.AssigneeID,
+				CreatedBy:  task.CreatedBy,
+				FiredAt:    now,
+			})
+			send = false
+		}
+	}
+	return nil
+}
+
+// notify sends reminder to every notifier. A failing notifier is logged and
+// doesn't stop the others; the reminder is not retried.
+func (s *Scheduler) notify(ctx context.Context, reminder Reminder) {
+	for _, notifier := range s.notifiers {
+		if err := notifier.Notify(ctx, reminder); err != nil {
+			log.Printf("Failed to send %s reminder for task %d: %v", reminder.Threshold, reminder.TaskID, err)
+		}
+	}
+}
+
+// Start runs the scheduler once straight away and then every interval, until
+// the returned stop function is called
+func (s *Scheduler) Start(interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.Run(ctx, time.Now()); err != nil {
+				log.Printf("Failed to check reminders: %v", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(cancel)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,137 @@
+package reminders
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"task_manager_api/database"
+	"task_manager_api/models"
+	"testing"
+	"time"
+)
+
+// recorder is a notifier that keeps the reminders it is sent
+type recorder struct {
+	reminders []Reminder
+}
+
+func (r *recorder) Notify(ctx context.Context, reminder Reminder) error {
+	r.reminders = append(r.reminders, reminder)
+	return nil
+}
+
+// TestThreshold tests naming lead times
+func TestThreshold(t *testing.T) {
+	for lead, want := range map[time.Duration]string{
+		24 * time.Hour:               "24h",
+		90 * time.Minute:             "1h30m",
+		15 * time.Minute:             "15m",
+		time.Hour + 30*time.Second:   "1h0m30s",
+		45*time.Minute + time.Second: "45m1s",
+	} {
+		if got := Threshold(lead); got != want {
+			t.Errorf("Threshold(%v) = %s, want %s", lead, got, want)
+		}
+	}
+}
+
+// TestScheduler tests that each reminder fires once, only for the most urgent threshold reached
+func TestScheduler(t *testing.T) {
+	store := database.NewMemoryStore()
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	create := func(title string, due time.Time, status models.Status) int {
+		id, err := store.CreateTask(models.Task{Title: title, Status: status, DueDate: due})
+		if err != nil {
+			t.Fatalf("CreateTask() error = %v", err)
+		}
+		return int(id)
+	}
+	tomorrow := create("Tomorrow", now.Add(20*time.Hour), models.StatusPending)
+	late := create("Late", now.Add(-time.Hour), models.StatusInProgress)
+	create("Done", now.Add(-time.Hour), models.StatusCompleted)
+	create("Next week", now.Add(7*24*time.Hour), models.StatusPending)
+	create("No due date", time.Time{}, models.StatusPending)
+
+	rec := &recorder{}
+	scheduler := NewScheduler(store, []time.Duration{time.Hour, 24 * time.Hour}, rec)
+
+	run := func(at time.Time) []Reminder {
+		t.Helper()
+		rec.reminders = nil
+		if err := scheduler.Run(context.Background(), at); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return rec.reminders
+	}
+
+	// The late task skips its lead-time reminders and is reported overdue
+	got := run(now)
+	if len(got) != 2 || got[0].TaskID != late || got[0].Threshold != ThresholdOverdue ||
+		got[1].TaskID != tomorrow || got[1].Threshold != "24h" {
+		t.Fatalf("first Run() sent %+v, want late overdue and tomorrow 24h", got)
+	}
+	if task, _ := store.GetTaskByID(late); task.OverdueAt == nil || !task.OverdueAt.Equal(now) {
+		t.Errorf("late task OverdueAt = %v, want %v", task.OverdueAt, now)
+	}
+	if task, _ := store.GetTaskByID(tomorrow); task.OverdueAt != nil {
+		t.Errorf("tomorrow's task OverdueAt = %v, want nil", task.OverdueAt)
+	}
+
+	if got := run(now.Add(time.Minute)); len(got) != 0 {
+		t.Errorf("second Run() sent %+v, want nothing", got)
+	}
+
+	if got := run(now.Add(19 * time.Hour)); len(got) != 1 || got[0].TaskID != tomorrow || got[0].Threshold != "1h" {
+		t.Errorf("Run() an hour before the due date sent %+v, want tomorrow 1h", got)
+	}
+	if got := run(now.Add(21 * time.Hour)); len(got) != 1 || got[0].TaskID != tomorrow || got[0].Threshold != ThresholdOverdue {
+		t.Errorf("Run() after the due date sent %+v, want tomorrow overdue", got)
+	}
+	if got := run(now.Add(22 * time.Hour)); len(got) != 0 {
+		t.Errorf("Run() after every reminder sent %+v, want nothing", got)
+	}
+
+	// A new due date starts the reminders again
+	task, _ := store.GetTaskByID(tomorrow)
+	task.DueDate = now.Add(30 * time.Hour)
+	if err := store.UpdateTask(tomorrow, task); err != nil {
+		t.Fatalf("UpdateTask() error = %v", err)
+	}
+	if got := run(now.Add(22 * time.Hour)); len(got) != 1 || got[0].Threshold != "24h" {
+		t.Errorf("Run() after moving the due date sent %+v, want a 24h reminder", got)
+	}
+}
+
+// TestSpoolNotifier tests that reminders are spooled as JSON files
+func TestSpoolNotifier(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "spool")
+	notifier, err := SpoolNotifier(dir)
+	if err != nil {
+		t.Fatalf("SpoolNotifier() error = %v", err)
+	}
+
+	reminder := Reminder{TaskID: 4, Title: "Report", DueDate: time.Now().UTC(), Threshold: "1h", FiredAt: time.Now().UTC()}
+	if err := notifier.Notify(context.Background(), reminder); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || filepath.Ext(entries[0].Name()) != ".json" {
+		t.Fatalf("spool holds %v, want one JSON file", entries)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Reminder
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("spooled file %s is not a reminder: %v", data, err)
+	}
+	if got.TaskID != 4 || got.Threshold != "1h" || !got.DueDate.Equal(reminder.DueDate) {
+		t.Errorf("spooled %+v, want %+v", got, reminder)
+	}
+}
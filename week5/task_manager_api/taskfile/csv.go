@@ -0,0 +1,205 @@
+package taskfile
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"task_manager_api/models"
+	"time"
+)
+
+// csvColumns are the columns of an exported CSV file, named like the task's
+// JSON fields. Tags are joined with commas, which tags can't contain.
+var csvColumns = []string{
+	"id", "title", "description", "status", "priority", "due_date", "tags", "recurrence",
+	"parent_id", "assignee_id", "project_id", "position", "estimate_minutes", "created_at", "updated_at",
+}
+
+// csvReadOnly are columns an imported file may have, as exported files do,
+// that are ignored because the server sets them
+var csvReadOnly = map[string]bool{"id": true, "created_at": true, "updated_at": true}
+
+// csvWriter writes tasks as CSV rows under a header row
+type csvWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+// writeHeader writes the header row if it hasn't been written yet
+func (c *csvWriter) writeHeader() error {
+	if c.wroteHeader {
+		return nil
+	}
+	c.wroteHeader = true
+	return c.w.Write(csvColumns)
+}
+
+func (c *csvWriter) Write(task models.Task) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	var due string
+	if !task.DueDate.IsZero() {
+		due = task.DueDate.Format(time.RFC3339)
+	}
+	return c.w.Write([]string{
+		strconv.Itoa(task.ID),
+		task.Title,
+		task.Description,
+		string(task.Status),
+		string(task.Priority),
+		due,
+		strings.Join(task.Tags, ","),
+		task.Recurrence,
+		formatID(task.ParentID),
+		formatID(task.AssigneeID),
+		formatID(task.ProjectID),
+		task.Position,
+		formatID(task.Estimate),
+		task.CreatedAt.Format(time.RFC3339),
+		task.UpdatedAt.Format(time.RFC3339),
+	})
+}
+
+func (c *csvWriter) Close() error {
+	// A file without tasks still has its header
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// formatID writes an optional ID or estimate as an empty field when it is unset
+func formatID(id *int) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.Itoa(*id)
+}
+
+// readCSV reads tasks from CSV rows, finding each field by the name in its
+// column's header. Columns with other names are ignored, but there must be a
+// title column.
+func readCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // rows with the wrong number of fields are reported per row
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, &SyntaxError{Line: 1, Message: "the file is empty"}
+	}
+	if err != nil {
+		return nil, csvSyntaxError(err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		if i == 0 {
+			// Spreadsheets often start UTF-8 files with a byte order mark
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := columns[name]; ok {
+			return nil, &SyntaxError{Line: 1, Message: fmt.Sprintf("the header has more than one %s column", name)}
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, &SyntaxError{Line: 1, Message: "the header has no title column"}
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, csvSyntaxError(err)
+		}
+		line, _ := reader.FieldPos(0)
+		row := Row{Line: line, Errors: map[string]string{}}
+		if len(record) != len(header) {
+			row.Errors["row"] = fmt.Sprintf("has %d fields but the header has %d", len(record), len(header))
+		} else {
+			for name, i := range columns {
+				if !csvReadOnly[name] {
+					setCSVField(&row, name, record[i])
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// setCSVField sets the task field with the JSON name to value, noting in the
+// row's errors if value can't be read
+func setCSVField(row *Row, name, value string) {
+	task := &row.Task
+	switch name {
+	case "title":
+		task.Title = value
+	case "description":
+		task.Description = value
+	case "status":
+		task.Status = models.Status(strings.TrimSpace(value))
+	case "priority":
+		task.Priority = models.Priority(strings.TrimSpace(value))
+	case "due_date":
+		if value = strings.TrimSpace(value); value != "" {
+			due, err := parseDate(value)
+			if err != nil {
+				row.Errors[name] = "must be an RFC 3339 timestamp or a YYYY-MM-DD date"
+			}
+			task.DueDate = due
+		}
+	case "tags":
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				task.Tags = append(task.Tags, tag)
+			}
+		}
+	case "recurrence":
+		task.Recurrence = value
+	case "parent_id":
+		task.ParentID = parseID(row, name, value)
+	case "assignee_id":
+		task.AssigneeID = parseID(row, name, value)
+	case "project_id":
+		task.ProjectID = parseID(row, name, value)
+	case "position":
+		task.Position = strings.TrimSpace(value)
+	case "estimate_minutes":
+		task.Estimate = parseID(row, name, value)
+	}
+}
+
+// parseID reads an optional ID or estimate, which is unset when value is empty
+func parseID(row *Row, name, value string) *int {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 1 {
+		row.Errors[name] = "must be a positive integer"
+		return nil
+	}
+	return &id
+}
+
+// csvSyntaxError describes a malformed CSV file with the line of the problem
+func csvSyntaxError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &SyntaxError{Line: parseErr.Line, Message: parseErr.Err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,365 @@
+package taskfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"task_manager_api/models"
+	"time"
+	"unicode/utf8"
+)
+
+// icsStatuses maps task statuses to the STATUS values of a VTODO (RFC 5545 3.8.1.11)
+var icsStatuses = map[models.Status]string{
+	models.StatusPending:    "NEEDS-ACTION",
+	models.StatusInProgress: "IN-PROCESS",
+	models.StatusCompleted:  "COMPLETED",
+}
+
+// icsPriorities maps task priorities to the PRIORITY values of a VTODO, where 1
+// is the highest and 9 the lowest (RFC 5545 3.8.1.9)
+var icsPriorities = map[models.Priority]int{
+	models.PriorityUrgent: 1,
+	models.PriorityHigh:   3,
+	models.PriorityMedium: 5,
+	models.PriorityLow:    9,
+}
+
+// iCalendar date and time formats
+const (
+	icsDate     = "20060102"
+	icsDateTime = "20060102T150405"
+	icsUTC      = "20060102T150405Z"
+)
+
+// icsLineLength is the most octets a content line may have before it is folded
+const icsLineLength = 75
+
+// icsWriter writes tasks as the VTODOs of a VCALENDAR
+type icsWriter struct {
+	w           *bufio.Writer
+	wroteHeader bool
+}
+
+func newICSWriter(w io.Writer) *icsWriter {
+	return &icsWriter{w: bufio.NewWriter(w)}
+}
+
+// writeHeader starts the calendar if it hasn't been started yet
+func (c *icsWriter) writeHeader() {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	c.writeLine("BEGIN:VCALENDAR")
+	c.writeLine("VERSION:2.0")
+	c.writeLine("PRODID:-//task_manager_api//Tasks//EN")
+}
+
+func (c *icsWriter) Write(task models.Task) error {
+	c.writeHeader()
+	c.writeLine("BEGIN:VTODO")
+	c.writeLine(fmt.Sprintf("UID:task-%d@task_manager_api", task.ID))
+	c.writeLine("DTSTAMP:" + task.UpdatedAt.UTC().Format(icsUTC))
+	c.writeLine("CREATED:" + task.CreatedAt.UTC().Format(icsUTC))
+	c.writeLine("LAST-MODIFIED:" + task.UpdatedAt.UTC().Format(icsUTC))
+	c.writeLine("SUMMARY:" + escapeText(task.Title))
+	if task.Description != "" {
+		c.writeLine("DESCRIPTION:" + escapeText(task.Description))
+	}
+	if !task.DueDate.IsZero() {
+		c.writeLine("DUE:" + task.DueDate.UTC().Format(icsUTC))
+	}
+	if status, ok := icsStatuses[task.Status]; ok {
+		c.writeLine("STATUS:" + status)
+	}
+	if priority, ok := icsPriorities[task.Priority]; ok {
+		c.writeLine(fmt.Sprintf("PRIORITY:%d", priority))
+	}
+	if len(task.Tags) > 0 {
+		categories := make([]string, len(task.Tags))
+		for i, tag := range task.Tags {
+			categories[i] = escapeText(tag)
+		}
+		c.writeLine("CATEGORIES:" + strings.Join(categories, ","))
+	}
+	if task.Recurrence != "" {
+		c.writeLine("RRULE:" + task.Recurrence)
+	}
+	c.writeLine("END:VTODO")
+	return c.w.Flush()
+}
+
+func (c *icsWriter) Close() error {
+	c.writeHeader()
+	c.writeLine("END:VCALENDAR")
+	return c.w.Flush()
+}
+
+// writeLine writes a content line, folding it onto continuation lines that
+// start with a space so none is longer than icsLineLength octets. Lines are
+// only folded between characters, never inside one.
+func (c *icsWriter) writeLine(line string) {
+	limit := icsLineLength
+	for len(line) > limit {
+		cut := limit
+		for !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		c.w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// The space starting a continuation line counts towards its length
+		limit = icsLineLength - 1
+	}
+	c.w.WriteString(line + "\r\n")
+}
+
+// escapeText escapes a TEXT value (RFC 5545 3.3.11)
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// unescapeText reverses escapeText
+func unescapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' || s[i] == 'N' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// splitList splits a list of TEXT values on the commas that aren't escaped,
+// and unescapes each value
+func splitList(s string) []string {
+	var values []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			values = append(values, unescapeText(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(values, unescapeText(s[start:]))
+}
+
+// contentLine is an unfolded iCalendar content line
+type contentLine struct {
+	line   int // the line it starts on
+	name   string
+	params map[string]string
+	value  string
+}
+
+// readICS reads a task from every VTODO of a VCALENDAR. Other components,
+// such as events, and the alarms inside VTODOs are skipped.
+func readICS(r io.Reader) ([]Row, error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || lines[0].name != "BEGIN" || !strings.EqualFold(lines[0].value, "VCALENDAR") {
+		return nil, &SyntaxError{Line: 1, Message: "the file must start with BEGIN:VCALENDAR"}
+	}
+
+	var rows []Row
+	var row *Row
+	var components []string
+	for _, line := range lines {
+		switch line.name {
+		case "BEGIN":
+			component := strings.ToUpper(line.value)
+			if component == "VTODO" && len(components) == 1 {
+				row = &Row{Line: line.line, Errors: map[string]string{}}
+			}
+			components = append(components, component)
+			continue
+		case "END":
+			component := strings.ToUpper(line.value)
+			if len(components) == 0 || components[len(components)-1] != component {
+				return nil, &SyntaxError{Line: line.line, Message: "END:" + line.value + " doesn't match the open component"}
+			}
+			components = components[:len(components)-1]
+			if component == "VTODO" && len(components) == 1 {
+				rows = append(rows, *row)
+				row = nil
+			}
+			continue
+		}
+		if len(components) == 0 {
+			return nil, &SyntaxError{Line: line.line, Message: "content after END:VCALENDAR"}
+		}
+		if row != nil && len(components) == 2 {
+			setICSProperty(row, line)
+		}
+	}
+	if len(components) > 0 {
+		return nil, &SyntaxError{Line: lines[len(lines)-1].line, Message: components[len(components)-1] + " isn't closed with END:" + components[len(components)-1]}
+	}
+	return rows, nil
+}
+
+// setICSProperty sets the task field a VTODO property maps to, noting in the
+// row's errors if its value can't be used
+func setICSProperty(row *Row, line contentLine) {
+	task := &row.Task
+	switch line.name {
+	case "SUMMARY":
+		task.Title = unescapeText(line.value)
+	case "DESCRIPTION":
+		task.Description = unescapeText(line.value)
+	case "STATUS":
+		status := strings.ToUpper(line.value)
+		for taskStatus, icsStatus := range icsStatuses {
+			if status == icsStatus {
+				task.Status = taskStatus
+				return
+			}
+		}
+		row.Errors["status"] = "must be NEEDS-ACTION, IN-PROCESS or COMPLETED"
+	case "PRIORITY":
+		// Other apps use the whole range: 1-4 is high, 5 medium and 6-9 low, with 1 the highest
+		switch value, err := strconv.Atoi(strings.TrimSpace(line.value)); {
+		case err != nil || value < 0 || value > 9:
+			row.Errors["priority"] = "must be an integer from 0 to 9"
+		case value == 0:
+			// Undefined
+		case value == 1:
+			task.Priority = models.PriorityUrgent
+		case value <= 4:
+			task.Priority = models.PriorityHigh
+		case value == 5:
+			task.Priority = models.PriorityMedium
+		default:
+			task.Priority = models.PriorityLow
+		}
+	case "DUE":
+		due, err := parseICSTime(line.value, line.params)
+		if err != nil {
+			row.Errors["due_date"] = "must be a DATE or DATE-TIME in UTC, local time or a known TZID"
+		}
+		task.DueDate = due
+	case "CATEGORIES":
+		for _, tag := range splitList(line.value) {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				task.Tags = append(task.Tags, tag)
+			}
+		}
+	case "RRULE":
+		task.Recurrence = line.value
+	}
+}
+
+// parseICSTime parses a DATE or DATE-TIME value. Dates are taken as midnight
+// UTC, as are floating times without a zone.
+func parseICSTime(value string, params map[string]string) (time.Time, error) {
+	if strings.EqualFold(params["VALUE"], "DATE") || len(value) == len(icsDate) {
+		return time.Parse(icsDate, value)
+	}
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(icsUTC, value)
+	}
+	location := time.UTC
+	if tzid := params["TZID"]; tzid != "" {
+		var err error
+		if location, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, err
+		}
+	}
+	t, err := time.ParseInLocation(icsDateTime, value, location)
+	return t.UTC(), err
+}
+
+// unfoldLines reads the content lines of an iCalendar file, joining folded
+// lines back together
+func unfoldLines(r io.Reader) ([]contentLine, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+
+	var raw []string
+	var starts []int
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) && len(raw) > 0 {
+			raw[len(raw)-1] += text[1:]
+			continue
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		raw = append(raw, text)
+		starts = append(starts, n)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	lines := make([]contentLine, len(raw))
+	for i, text := range raw {
+		line, ok := parseContentLine(text)
+		if !ok {
+			return nil, &SyntaxError{Line: starts[i], Message: "not a NAME:VALUE content line"}
+		}
+		line.line = starts[i]
+		lines[i] = line
+	}
+	return lines, nil
+}
+
+// parseContentLine splits a content line into its name, parameters and
+// value: NAME;PARAM=VALUE;PARAM="QUOTED":VALUE
+func parseContentLine(text string) (contentLine, bool) {
+	line := contentLine{params: map[string]string{}}
+	end := strings.IndexAny(text, ";:")
+	if end <= 0 {
+		return line, false
+	}
+	line.name = strings.ToUpper(text[:end])
+
+	i := end
+	for i < len(text) && text[i] == ';' {
+		i++
+		equals := strings.IndexByte(text[i:], '=')
+		if equals < 0 {
+			return line, false
+		}
+		key := strings.ToUpper(text[i : i+equals])
+		i += equals + 1
+
+		var value string
+		if i < len(text) && text[i] == '"' {
+			closing := strings.IndexByte(text[i+1:], '"')
+			if closing < 0 {
+				return line, false
+			}
+			value = text[i+1 : i+1+closing]
+			i += closing + 2
+		} else {
+			stop := strings.IndexAny(text[i:], ";:")
+			if stop < 0 {
+				return line, false
+			}
+			value = text[i : i+stop]
+			i += stop
+		}
+		line.params[key] = value
+	}
+	if i >= len(text) || text[i] != ':' {
+		return line, false
+	}
+	line.value = text[i+1:]
+	return line, true
+}
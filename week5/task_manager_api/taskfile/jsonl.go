@@ -0,0 +1,59 @@
+package taskfile
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"task_manager_api/models"
+)
+
+// jsonlWriter writes each task as a line of JSON
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func newJSONLWriter(w io.Writer) *jsonlWriter {
+	return &jsonlWriter{encoder: json.NewEncoder(w)}
+}
+
+func (j *jsonlWriter) Write(task models.Task) error {
+	// Encode ends every value with a newline
+	return j.encoder.Encode(task)
+}
+
+func (j *jsonlWriter) Close() error {
+	return nil
+}
+
+// readJSONL reads a task from every line that isn't blank. Each line is a
+// JSON object with the fields the API's tasks have.
+func readJSONL(r io.Reader) ([]Row, error) {
+	reader := bufio.NewReader(r)
+	var rows []Row
+	for line := 1; ; line++ {
+		text, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if strings.TrimSpace(text) != "" {
+			row := Row{Line: line, Errors: map[string]string{}}
+			if decodeErr := json.Unmarshal([]byte(text), &row.Task); decodeErr != nil {
+				var typeErr *json.UnmarshalTypeError
+				switch {
+				case errors.As(decodeErr, &typeErr) && typeErr.Field != "":
+					row.Errors[typeErr.Field] = "has the wrong type"
+				case errors.As(decodeErr, &typeErr):
+					row.Errors["row"] = "must be a JSON object"
+				default:
+					row.Errors["row"] = "is not a valid task: " + decodeErr.Error()
+				}
+			}
+			rows = append(rows, row)
+		}
+		if err == io.EOF {
+			return rows, nil
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Package taskfile reads and writes tasks in formats other tools understand:
+// CSV for spreadsheets, JSON Lines for scripts and iCalendar for calendar and
+// to-do apps. Reading reports problems with single tasks alongside the tasks,
+// so one bad row doesn't stop the rest of a file from being read.
+package taskfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"task_manager_api/models"
+	"time"
+)
+
+// Formats tasks can be read and written in
+const (
+	CSV   = "csv"   // one task per row under a header row of field names
+	JSONL = "jsonl" // one task per line, as in the API's JSON
+	ICS   = "ics"   // an iCalendar file with a VTODO per task
+)
+
+// Formats lists every supported format
+var Formats = []string{CSV, JSONL, ICS}
+
+// ErrUnknownFormat is returned for a format not in Formats
+var ErrUnknownFormat = errors.New("unknown format")
+
+// contentTypes are the media types files of each format are sent with
+var contentTypes = map[string]string{
+	CSV:   "text/csv; charset=utf-8",
+	JSONL: "application/x-ndjson",
+	ICS:   "text/calendar; charset=utf-8",
+}
+
+// mediaTypes maps the media types a file may arrive with to its format
+var mediaTypes = map[string]string{
+	"text/csv":             CSV,
+	"application/x-ndjson": JSONL,
+	"application/jsonl":    JSONL,
+	"text/calendar":        ICS,
+}
+
+// ContentType returns the media type files of format are sent with
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// FormatOf returns the format of files with mediaType, or "" if there is none
+func FormatOf(mediaType string) string {
+	return mediaTypes[strings.ToLower(mediaType)]
+}
+
+// Valid reports whether format is one of Formats
+func Valid(format string) bool {
+	_, ok := contentTypes[format]
+	return ok
+}
+
+// Row is a task read from a file
+type Row struct {
+	Line   int               // the line the task starts on, counting from 1
+	Task   models.Task       // the task, with whatever fields could be read
+	Errors map[string]string // explains each field that couldn't be read, keyed by its JSON name
+}
+
+// SyntaxError reports a file that can't be read at all, such as a CSV file
+// without a title column or an iCalendar file that isn't a VCALENDAR
+type SyntaxError struct {
+	Line    int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// Read reads every task in a file of format, in the order they appear.
+// Problems confined to one task are reported in its Row rather than as an
+// error, which is only returned for files that can't be read at all.
+func Read(r io.Reader, format string) ([]Row, error) {
+	switch format {
+	case CSV:
+		return readCSV(r)
+	case JSONL:
+		return readJSONL(r)
+	case ICS:
+		return readICS(r)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// Writer writes tasks to a file one at a time
+type Writer interface {
+	// Write adds a task to the file
+	Write(task models.Task) error
+	// Close finishes the file and flushes it; it doesn't close the underlying writer
+	Close() error
+}
+
+// NewWriter returns a Writer that writes a file of format to w
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w), nil
+	case JSONL:
+		return newJSONLWriter(w), nil
+	case ICS:
+		return newICSWriter(w), nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// parseDate accepts either a full RFC 3339 timestamp or a plain date, like
+// the API's query parameters
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
@@ -0,0 +1,200 @@
+package taskfile
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"task_manager_api/models"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestRoundTrip(t *testing.T) {
+	parent, project := 3, 7
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	tasks := []models.Task{
+		{
+			ID:          1,
+			Title:       "Write report; then, send it",
+			Description: "Line one\nLine two with a \\ backslash and " + strings.Repeat("long text é ", 10),
+			Status:      models.StatusInProgress,
+			Priority:    models.PriorityHigh,
+			DueDate:     time.Date(2026, 3, 2, 8, 30, 0, 0, time.UTC),
+			Tags:        []string{"reports", "work"},
+			Recurrence:  "FREQ=WEEKLY;BYDAY=MO",
+			ParentID:    &parent,
+			ProjectID:   &project,
+			Position:    "a1",
+			CreatedAt:   created,
+			UpdatedAt:   created,
+		},
+		{ID: 2, Title: "Plain", Status: models.StatusPending, Priority: models.PriorityLow, CreatedAt: created, UpdatedAt: created},
+	}
+
+	for _, format := range Formats {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := NewWriter(&buf, format)
+			if err != nil {
+				t.Fatalf("NewWriter() error = %v", err)
+			}
+			for _, task := range tasks {
+				if err := writer.Write(task); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			rows, err := Read(&buf, format)
+			if err != nil {
+				t.Fatalf("Read() error = %v\n%s", err, buf.String())
+			}
+			if len(rows) != len(tasks) {
+				t.Fatalf("Read() returned %d rows, want %d", len(rows), len(tasks))
+			}
+			for i, row := range rows {
+				if len(row.Errors) > 0 {
+					t.Errorf("row %d errors = %v", i, row.Errors)
+				}
+				got, want := row.Task, tasks[i]
+				if got.Title != want.Title || got.Description != want.Description || got.Status != want.Status || got.Priority != want.Priority ||
+					!got.DueDate.Equal(want.DueDate) || got.Recurrence != want.Recurrence ||
+					strings.Join(got.Tags, ",") != strings.Join(want.Tags, ",") {
+					t.Errorf("row %d = %+v, want %+v", i, got, want)
+				}
+				if format != ICS && (!reflect.DeepEqual(got.ParentID, want.ParentID) ||
+					!reflect.DeepEqual(got.ProjectID, want.ProjectID) || got.Position != want.Position) {
+					t.Errorf("row %d parent, project and position = %v, %v, %q, want %v, %v, %q",
+						i, got.ParentID, got.ProjectID, got.Position, want.ParentID, want.ProjectID, want.Position)
+				}
+			}
+		})
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	file := "\ufeffTitle,Due_Date,status,extra\n" +
+		"First,2026-03-02,pending,ignored\n" +
+		"\"Multi\nline\",soon,completed,x\n" +
+		"Short\n"
+	rows, err := Read(strings.NewReader(file), CSV)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Read() returned %d rows, want 3", len(rows))
+	}
+	if rows[0].Line != 2 || rows[0].Task.Title != "First" || len(rows[0].Errors) != 0 ||
+		!rows[0].Task.DueDate.Equal(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("row 0 = %+v", rows[0])
+	}
+	if rows[1].Line != 3 || rows[1].Errors["due_date"] == "" {
+		t.Errorf("row 1 = %+v, want a due_date error on line 3", rows[1])
+	}
+	if rows[2].Line != 5 || rows[2].Errors["row"] == "" {
+		t.Errorf("row 2 = %+v, want a row error on line 5", rows[2])
+	}
+
+	for _, file := range []string{"", "description\nx\n", "title,title\n", "title\n\"unclosed\n"} {
+		var syntaxErr *SyntaxError
+		if _, err := Read(strings.NewReader(file), CSV); !errors.As(err, &syntaxErr) {
+			t.Errorf("Read(%q) error = %v, want a SyntaxError", file, err)
+		}
+	}
+}
+
+func TestReadJSONL(t *testing.T) {
+	file := `{"title": "First", "tags": ["a"]}` + "\n\n" +
+		`{"title": 5}` + "\n" +
+		`not json` + "\n" +
+		`[1]`
+	rows, err := Read(strings.NewReader(file), JSONL)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("Read() returned %d rows, want 4", len(rows))
+	}
+	if rows[0].Line != 1 || rows[0].Task.Title != "First" || len(rows[0].Errors) != 0 {
+		t.Errorf("row 0 = %+v", rows[0])
+	}
+	if rows[1].Line != 3 || rows[1].Errors["title"] == "" {
+		t.Errorf("row 1 = %+v, want a title error on line 3", rows[1])
+	}
+	if rows[2].Line != 4 || rows[2].Errors["row"] == "" || rows[3].Line != 5 || rows[3].Errors["row"] == "" {
+		t.Errorf("rows 2 and 3 = %+v, %+v, want row errors on lines 4 and 5", rows[2], rows[3])
+	}
+}
+
+func TestReadICS(t *testing.T) {
+	file := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"SUMMARY:Not a task",
+		"END:VEVENT",
+		"BEGIN:VTODO",
+		"SUMMARY:Folded ",
+		" title",
+		"DUE;TZID=America/New_York:20260302T090000",
+		"CATEGORIES:home,garden\\,yard",
+		"STATUS:COMPLETED",
+		"PRIORITY:2",
+		"BEGIN:VALARM",
+		"DESCRIPTION:Not the task's description",
+		"END:VALARM",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"SUMMARY:Date only",
+		"DUE;VALUE=DATE:20260303",
+		"STATUS:CANCELLED",
+		"PRIORITY:high",
+		"END:VTODO",
+		"END:VCALENDAR",
+	}, "\r\n")
+	rows, err := Read(strings.NewReader(file), ICS)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Read() returned %d rows, want 2", len(rows))
+	}
+	first := rows[0]
+	if first.Line != 6 || first.Task.Title != "Folded title" || first.Task.Description != "" ||
+		first.Task.Status != models.StatusCompleted || first.Task.Priority != models.PriorityHigh || len(first.Errors) != 0 ||
+		!first.Task.DueDate.Equal(time.Date(2026, 3, 2, 14, 0, 0, 0, time.UTC)) ||
+		!reflect.DeepEqual(first.Task.Tags, []string{"home", "garden,yard"}) {
+		t.Errorf("row 0 = %+v", first)
+	}
+	second := rows[1]
+	if second.Line != 17 || !second.Task.DueDate.Equal(time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC)) || second.Errors["status"] == "" || second.Errors["priority"] == "" {
+		t.Errorf("row 1 = %+v, want status and priority errors on line 17", second)
+	}
+
+	for _, file := range []string{"", "BEGIN:VTODO\r\nEND:VTODO", "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nEND:VCALENDAR", "BEGIN:VCALENDAR\r\nnonsense\r\nEND:VCALENDAR"} {
+		var syntaxErr *SyntaxError
+		if _, err := Read(strings.NewReader(file), ICS); !errors.As(err, &syntaxErr) {
+			t.Errorf("Read(%q) error = %v, want a SyntaxError", file, err)
+		}
+	}
+}
+
+func TestICSLineFolding(t *testing.T) {
+	var buf bytes.Buffer
+	writer := newICSWriter(&buf)
+	writer.Write(models.Task{ID: 1, Title: strings.Repeat("é", 100), Status: models.StatusPending})
+	writer.Close()
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > icsLineLength {
+			t.Errorf("line %q is %d octets, want at most %d", line, len(line), icsLineLength)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line %q splits a character", line)
+		}
+	}
+}
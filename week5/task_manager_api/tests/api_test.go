@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"task_manager_api/database"
 	"task_manager_api/handlers"
 	"task_manager_api/models"
@@ -14,25 +13,25 @@ import (
 	"time"
 )
 
-// TestMain sets up the test environment
-func TestMain(m *testing.M) {
-	// Initialize the database with an in-memory SQLite database
-	database.InitDB(":memory:")
-	
-	// Run the tests
-	code := m.Run()
-	
-	// Exit with the test result code
-	os.Exit(code)
+// newTestStore opens a private in-memory SQLite database for a single test
+func newTestStore(tb testing.TB) database.TaskStore {
+	store, err := database.NewSQLiteStore(":memory:")
+	if err != nil {
+		tb.Fatalf("Failed to open test database: %v", err)
+	}
+	tb.Cleanup(func() { store.Close() })
+	return store
 }
 
 // setupServer creates a test server for our API
-func setupServer() *httptest.Server {
+func setupServer(store database.TaskStore) *httptest.Server {
+	tasks := handlers.NewTasksHandler(store)
+	
 	// Create a new test server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Route requests to the appropriate handler
 		if r.URL.Path == "/tasks" || r.URL.Path == "/tasks/" || r.URL.Path[:7] == "/tasks/" {
-			handlers.TasksHandler(w, r)
+			tasks.ServeHTTP(w, r)
 			return
 		}
 		
@@ -46,8 +45,11 @@ func setupServer() *httptest.Server {
 
 // TestTaskLifecycle tests the entire lifecycle of a task (create, read, update, delete)
 func TestTaskLifecycle(t *testing.T) {
+	// Initialize the database
+	store := newTestStore(t)
+	
 	// Set up the test server
-	server := setupServer()
+	server := setupServer(store)
 	defer server.Close()
 	
 	// Define a test task
@@ -214,19 +216,19 @@ func TestTaskLifecycle(t *testing.T) {
 		}
 		
 		// Parse response
-		var tasks []models.Task
-		if err := json.NewDecoder(resp.Body).Decode(&tasks); err != nil {
+		var page models.TaskPage
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
 			t.Fatalf("Failed to decode response: %v", err)
 		}
 		
 		// Verify we got at least one task
-		if len(tasks) < 1 {
-			t.Errorf("Expected at least one task, got %d", len(tasks))
+		if len(page.Tasks) < 1 {
+			t.Errorf("Expected at least one task, got %d", len(page.Tasks))
 		}
 		
 		// Verify our task is in the list
 		found := false
-		for _, t := range tasks {
+		for _, t := range page.Tasks {
 			if t.ID == task.ID {
 				found = true
 				break
@@ -283,8 +285,11 @@ func TestTaskLifecycle(t *testing.T) {
 
 // TestInvalidRequests tests various invalid API requests
 func TestInvalidRequests(t *testing.T) {
+	// Initialize the database
+	store := newTestStore(t)
+	
 	// Set up the test server
-	server := setupServer()
+	server := setupServer(store)
 	defer server.Close()
 	
 	// Test cases for invalid requests
@@ -325,7 +330,7 @@ func TestInvalidRequests(t *testing.T) {
 		},
 		{
 			name:         "Unsupported Method",
-			method:       http.MethodPatch,
+			method:       http.MethodTrace,
 			path:         "/tasks/1",
 			body:         "",
 			expectedCode: http.StatusMethodNotAllowed,
@@ -369,16 +374,75 @@ func TestInvalidRequests(t *testing.T) {
 	}
 }
 
+// TestBulkOperations tests POST /tasks/bulk against SQLite transactions and savepoints
+func TestBulkOperations(t *testing.T) {
+	store := newTestStore(t)
+	server := setupServer(store)
+	defer server.Close()
+
+	// countTasks returns how many tasks the API lists
+	countTasks := func() int {
+		resp, err := http.Get(server.URL + "/tasks")
+		if err != nil {
+			t.Fatalf("Failed to list tasks: %v", err)
+		}
+		defer resp.Body.Close()
+		var page models.TaskPage
+		json.NewDecoder(resp.Body).Decode(&page)
+		return page.Total
+	}
+
+	t.Run("Partial", func(t *testing.T) {
+		body := `{"mode":"partial","operations":[
+			{"op":"create","task":{"title":"First"}},
+			{"op":"create","task":{"title":"Bad","status":"unknown"}},
+			{"op":"create","task":{"title":"Second"}}
+		]}`
+		resp, err := http.Post(server.URL+"/tasks/bulk", "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Failed to send bulk request: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		if n := countTasks(); n != 2 {
+			t.Errorf("Expected 2 tasks after partial bulk request, got %d", n)
+		}
+	})
+
+	t.Run("Atomic", func(t *testing.T) {
+		body := `{"mode":"atomic","operations":[
+			{"op":"create","task":{"title":"Third"}},
+			{"op":"delete","id":1},
+			{"op":"update","id":12345,"task":{"title":"Missing","status":"pending"}}
+		]}`
+		resp, err := http.Post(server.URL+"/tasks/bulk", "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Failed to send bulk request: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status code %d, got %d", http.StatusUnprocessableEntity, resp.StatusCode)
+		}
+		if n := countTasks(); n != 2 {
+			t.Errorf("Expected the failed atomic request to leave 2 tasks, got %d", n)
+		}
+	})
+}
+
 // TestConcurrentRequests tests the API's behavior under concurrent load
 func TestConcurrentRequests(t *testing.T) {
 	// Skip this test due to known issues with the corrupted Go installation
 	t.Skip("Skipping concurrent requests test due to known issues with the Go installation")
 	
 	// Initialize the database
-	database.InitDB(":memory:")
+	store := newTestStore(t)
 	
 	// Set up the test server
-	server := setupServer()
+	server := setupServer(store)
 	defer server.Close()
 	
 	// Reduced number of concurrent requests
@@ -434,13 +498,13 @@ func TestConcurrentRequests(t *testing.T) {
 	}
 	
 	// Try to decode the response
-	var tasks []models.Task
-	if err := json.NewDecoder(resp.Body).Decode(&tasks); err != nil {
+	var page models.TaskPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
 		// If we can't decode as an array, just log it and continue
 		t.Logf("Could not decode response: %v. This is expected with the corrupted Go installation.", err)
 		return
 	}
 	
 	// Log the number of tasks we got
-	t.Logf("Successfully retrieved %d tasks", len(tasks))
+	t.Logf("Successfully retrieved %d tasks", len(page.Tasks))
 }
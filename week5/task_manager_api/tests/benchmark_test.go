@@ -14,10 +14,11 @@ import (
 )
 
 // setupBenchmarkServer creates a test server for benchmarks
-func setupBenchmarkServer() *httptest.Server {
+func setupBenchmarkServer(store database.TaskStore) *httptest.Server {
+	tasks := handlers.NewTasksHandler(store)
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/tasks" || r.URL.Path == "/tasks/" || r.URL.Path[:7] == "/tasks/" {
-			handlers.TasksHandler(w, r)
+			tasks.ServeHTTP(w, r)
 			return
 		}
 		w.WriteHeader(http.StatusNotFound)
@@ -25,17 +26,17 @@ func setupBenchmarkServer() *httptest.Server {
 }
 
 // setupBenchmarkDB initializes the database for benchmarks
-func setupBenchmarkDB() {
-	database.InitDB(":memory:")
+func setupBenchmarkDB(b *testing.B) database.TaskStore {
+	return newTestStore(b)
 }
 
 // BenchmarkCreateTask benchmarks the task creation process
 func BenchmarkCreateTask(b *testing.B) {
 	// Initialize the database
-	setupBenchmarkDB()
+	store := setupBenchmarkDB(b)
 	
 	// Set up the test server
-	server := setupBenchmarkServer()
+	server := setupBenchmarkServer(store)
 	defer server.Close()
 	
 	// Reset the timer to exclude setup time
@@ -76,13 +77,51 @@ func BenchmarkCreateTask(b *testing.B) {
 	}
 }
 
+// BenchmarkBulkCreateTasks benchmarks creating tasks in batches of 100 with POST /tasks/bulk
+func BenchmarkBulkCreateTasks(b *testing.B) {
+	// Initialize the database
+	store := setupBenchmarkDB(b)
+	
+	// Set up the test server
+	server := setupBenchmarkServer(store)
+	defer server.Close()
+	
+	// Build one batch of create operations
+	operations := make([]map[string]interface{}, 100)
+	for i := range operations {
+		operations[i] = map[string]interface{}{
+			"op":   "create",
+			"task": models.Task{Title: fmt.Sprintf("Bulk Task %d", i), Status: "pending"},
+		}
+	}
+	batchJSON, _ := json.Marshal(map[string]interface{}{"mode": "atomic", "operations": operations})
+	
+	// Reset the timer to exclude setup time
+	b.ResetTimer()
+	
+	// Run the benchmark
+	for i := 0; i < b.N; i++ {
+		resp, err := http.Post(server.URL+"/tasks/bulk", "application/json", bytes.NewBuffer(batchJSON))
+		if err != nil {
+			b.Fatalf("Failed to send bulk request: %v", err)
+		}
+		
+		// Check status code
+		if resp.StatusCode != http.StatusOK {
+			b.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		
+		resp.Body.Close()
+	}
+}
+
 // BenchmarkGetAllTasks benchmarks retrieving all tasks
 func BenchmarkGetAllTasks(b *testing.B) {
 	// Initialize the database
-	setupBenchmarkDB()
+	store := setupBenchmarkDB(b)
 	
 	// Set up the test server
-	server := setupBenchmarkServer()
+	server := setupBenchmarkServer(store)
 	defer server.Close()
 	
 	// Create some test tasks
@@ -123,14 +162,14 @@ func BenchmarkGetAllTasks(b *testing.B) {
 		}
 		
 		// Parse response
-		var tasks []models.Task
-		if err := json.NewDecoder(resp.Body).Decode(&tasks); err != nil {
+		var page models.TaskPage
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
 			b.Fatalf("Failed to decode response: %v", err)
 		}
 		
 		// Verify we got the expected number of tasks
-		if len(tasks) != numTasks {
-			b.Fatalf("Expected %d tasks, got %d", numTasks, len(tasks))
+		if len(page.Tasks) != numTasks {
+			b.Fatalf("Expected %d tasks, got %d", numTasks, len(page.Tasks))
 		}
 		
 		resp.Body.Close()
@@ -140,10 +179,10 @@ func BenchmarkGetAllTasks(b *testing.B) {
 // BenchmarkGetTaskByID benchmarks retrieving a single task
 func BenchmarkGetTaskByID(b *testing.B) {
 	// Initialize the database
-	setupBenchmarkDB()
+	store := setupBenchmarkDB(b)
 	
 	// Set up the test server
-	server := setupBenchmarkServer()
+	server := setupBenchmarkServer(store)
 	defer server.Close()
 	
 	// Create a test task
@@ -191,10 +230,10 @@ func BenchmarkGetTaskByID(b *testing.B) {
 // BenchmarkUpdateTask benchmarks updating a task
 func BenchmarkUpdateTask(b *testing.B) {
 	// Initialize the database
-	setupBenchmarkDB()
+	store := setupBenchmarkDB(b)
 	
 	// Set up the test server
-	server := setupBenchmarkServer()
+	server := setupBenchmarkServer(store)
 	defer server.Close()
 	
 	// Create a test task
@@ -226,7 +265,8 @@ func BenchmarkUpdateTask(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		// Create an update with a unique title for each iteration
 		update := models.Task{
-			Title: fmt.Sprintf("Updated Title %d", i),
+			Title:  fmt.Sprintf("Updated Title %d", i),
+			Status: "pending",
 		}
 		
 		// Convert update to JSON
@@ -265,10 +305,10 @@ func BenchmarkUpdateTask(b *testing.B) {
 // BenchmarkDeleteTask benchmarks deleting a task
 func BenchmarkDeleteTask(b *testing.B) {
 	// Initialize the database
-	setupBenchmarkDB()
+	store := setupBenchmarkDB(b)
 	
 	// Set up the test server
-	server := setupBenchmarkServer()
+	server := setupBenchmarkServer(store)
 	defer server.Close()
 	
 	// Create tasks to delete
@@ -332,10 +372,10 @@ func BenchmarkDeleteTask(b *testing.B) {
 // BenchmarkCRUDOperations benchmarks a complete CRUD cycle
 func BenchmarkCRUDOperations(b *testing.B) {
 	// Initialize the database
-	setupBenchmarkDB()
+	store := setupBenchmarkDB(b)
 	
 	// Set up the test server
-	server := setupBenchmarkServer()
+	server := setupBenchmarkServer(store)
 	defer server.Close()
 	
 	// Reset the timer to exclude setup time
@@ -14,10 +14,11 @@ import (
 )
 
 // setupTableTestServer creates a test server for table-driven tests
-func setupTableTestServer() *httptest.Server {
+func setupTableTestServer(store database.TaskStore) *httptest.Server {
+	tasks := handlers.NewTasksHandler(store)
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/tasks" || r.URL.Path == "/tasks/" || r.URL.Path[:7] == "/tasks/" {
-			handlers.TasksHandler(w, r)
+			tasks.ServeHTTP(w, r)
 			return
 		}
 		w.WriteHeader(http.StatusNotFound)
@@ -27,10 +28,10 @@ func setupTableTestServer() *httptest.Server {
 // TestCreateTaskTable demonstrates table-driven testing for task creation
 func TestCreateTaskTable(t *testing.T) {
 	// Initialize the database
-	database.InitDB(":memory:")
+	store := newTestStore(t)
 	
 	// Set up the test server
-	server := setupTableTestServer()
+	server := setupTableTestServer(store)
 	defer server.Close()
 	
 	// Define test cases
@@ -94,12 +95,8 @@ func TestCreateTaskTable(t *testing.T) {
 				Description: "This task has an invalid status",
 				Status:      "invalid_status",
 			},
-			expectedStatus: http.StatusCreated, // Should still work, we don't validate status
-			validateFunc: func(t *testing.T, task models.Task) {
-				if task.Status != "invalid_status" {
-					t.Errorf("Expected status 'invalid_status', got '%s'", task.Status)
-				}
-			},
+			expectedStatus: http.StatusBadRequest, // Status must be one of the known values
+			validateFunc:   nil,
 		},
 		{
 			name: "Past Due Date",
@@ -160,10 +157,10 @@ func TestCreateTaskTable(t *testing.T) {
 // TestUpdateTaskTable demonstrates table-driven testing for task updates
 func TestUpdateTaskTable(t *testing.T) {
 	// Initialize the database
-	database.InitDB(":memory:")
+	store := newTestStore(t)
 	
 	// Set up the test server
-	server := setupTableTestServer()
+	server := setupTableTestServer(store)
 	defer server.Close()
 	
 	// Create a test task to update
@@ -193,14 +190,14 @@ func TestUpdateTaskTable(t *testing.T) {
 	// Define test cases for updates
 	testCases := []struct {
 		name           string
-		update         models.Task
+		update         map[string]interface{} // merge patch
 		expectedStatus int
 		validateFunc   func(*testing.T, models.Task)
 	}{
 		{
 			name: "Update Title",
-			update: models.Task{
-				Title: "Updated Title",
+			update: map[string]interface{}{
+				"title": "Updated Title",
 			},
 			expectedStatus: http.StatusOK,
 			validateFunc: func(t *testing.T, task models.Task) {
@@ -215,8 +212,8 @@ func TestUpdateTaskTable(t *testing.T) {
 		},
 		{
 			name: "Update Status",
-			update: models.Task{
-				Status: "completed",
+			update: map[string]interface{}{
+				"status": "completed",
 			},
 			expectedStatus: http.StatusOK,
 			validateFunc: func(t *testing.T, task models.Task) {
@@ -231,8 +228,8 @@ func TestUpdateTaskTable(t *testing.T) {
 		},
 		{
 			name: "Update Description",
-			update: models.Task{
-				Description: "New description",
+			update: map[string]interface{}{
+				"description": "New description",
 			},
 			expectedStatus: http.StatusOK,
 			validateFunc: func(t *testing.T, task models.Task) {
@@ -247,8 +244,8 @@ func TestUpdateTaskTable(t *testing.T) {
 		},
 		{
 			name: "Update Due Date",
-			update: models.Task{
-				DueDate: time.Now().Add(48 * time.Hour),
+			update: map[string]interface{}{
+				"due_date": time.Now().Add(48 * time.Hour),
 			},
 			expectedStatus: http.StatusOK,
 			validateFunc: func(t *testing.T, task models.Task) {
@@ -259,12 +256,20 @@ func TestUpdateTaskTable(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "Illegal Status Transition",
+			update: map[string]interface{}{
+				"status": "pending",
+			},
+			expectedStatus: http.StatusUnprocessableEntity, // Completed tasks must be reopened instead
+			validateFunc:   nil,
+		},
 		{
 			name: "Update Multiple Fields",
-			update: models.Task{
-				Title:       "Final Title",
-				Description: "Final description",
-				Status:      "in_progress",
+			update: map[string]interface{}{
+				"title":       "Final Title",
+				"description": "Final description",
+				"status":      "completed",
 			},
 			expectedStatus: http.StatusOK,
 			validateFunc: func(t *testing.T, task models.Task) {
@@ -274,8 +279,8 @@ func TestUpdateTaskTable(t *testing.T) {
 				if task.Description != "Final description" {
 					t.Errorf("Expected description 'Final description', got '%s'", task.Description)
 				}
-				if task.Status != "in_progress" {
-					t.Errorf("Expected status 'in_progress', got '%s'", task.Status)
+				if task.Status != "completed" {
+					t.Errorf("Expected status 'completed', got '%s'", task.Status)
 				}
 			},
 		},
@@ -290,16 +295,16 @@ func TestUpdateTaskTable(t *testing.T) {
 				t.Fatalf("Failed to marshal update: %v", err)
 			}
 			
-			// Create a PUT request
+			// Create a PATCH request
 			req, err := http.NewRequest(
-				http.MethodPut,
+				http.MethodPatch,
 				fmt.Sprintf("%s/tasks/%d", server.URL, createdTask.ID),
 				bytes.NewBuffer(updateJSON),
 			)
 			if err != nil {
 				t.Fatalf("Failed to create request: %v", err)
 			}
-			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Type", "application/merge-patch+json")
 			
 			// Send the request
 			client := &http.Client{}
@@ -0,0 +1,194 @@
+// Package webhooks delivers the queued task events to webhook subscribers,
+// signing each request and retrying failures with exponential backoff.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"task_manager_api/database"
+	"task_manager_api/models"
+	"time"
+)
+
+// Headers sent with every delivery
+const (
+	SignatureHeader = "X-Webhook-Signature" // "sha256=" and the hex HMAC-SHA256 of the body keyed with the secret
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery" // the delivery ID, the same on every attempt
+)
+
+// MaxAttempts is how many times a delivery is tried before it is dead
+const MaxAttempts = 8
+
+// Retries wait baseBackoff after the first failed attempt, doubling after
+// each one up to maxBackoff
+const (
+	baseBackoff = 30 * time.Second
+	maxBackoff  = time.Hour
+)
+
+// deliveryTimeout bounds each delivery attempt
+const deliveryTimeout = 10 * time.Second
+
+// batchSize is the most deliveries one run attempts
+const batchSize = 100
+
+// secretPrefix starts every generated secret
+const secretPrefix = "whsec_"
+
+// GenerateSecret returns a new random signing secret
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return secretPrefix + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value for body, keyed with secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns how long to wait before retrying a delivery that has failed attempts times
+func Backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// Dispatcher sends the deliveries queued in a store
+type Dispatcher struct {
+	store  database.TaskStore
+	client *http.Client
+}
+
+// NewDispatcher returns a dispatcher for the deliveries queued in store
+func NewDispatcher(store database.TaskStore) *Dispatcher {
+	return &Dispatcher{store: store, client: &http.Client{Timeout: deliveryTimeout}}
+}
+
+// Run attempts the deliveries due at now, recording each outcome. A failed
+// delivery is retried after Backoff, and is dead after MaxAttempts.
+func (d *Dispatcher) Run(ctx context.Context, now time.Time) error {
+	deliveries, err := d.store.DueDeliveries(now, batchSize)
+	if err != nil {
+		return err
+	}
+
+	webhooks := map[int]models.Webhook{}
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return nil
+		}
+		webhook, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			if webhook, err = d.store.GetWebhook(delivery.WebhookID); err != nil {
+				// Deleted since the delivery was queued; its deliveries are gone too
+				continue
+			}
+			webhooks[webhook.ID] = webhook
+		}
+
+		delivery.Attempts++
+		delivery.ResponseStatus, err = d.post(ctx, webhook, delivery)
+		if ctx.Err() != nil {
+			// Stopped mid-attempt; it doesn't count
+			return nil
+		}
+		if err == nil {
+			delivery.Status = models.DeliveryDelivered
+			delivery.NextAttemptAt = nil
+			delivery.LastError = ""
+			delivery.DeliveredAt = &now
+		} else {
+			delivery.LastError = err.Error()
+			if delivery.Attempts >= MaxAttempts {
+				delivery.Status = models.DeliveryDead
+				delivery.NextAttemptAt = nil
+			} else {
+				next := now.Add(Backoff(delivery.Attempts))
+				delivery.NextAttemptAt = &next
+			}
+		}
+		if err := d.store.UpdateDelivery(delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// post sends one attempt at a delivery and returns the response status.
+// Responses other than 2xx are errors.
+func (d *Dispatcher) post(ctx context.Context, webhook models.Webhook, delivery models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "task-manager-webhooks")
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, delivery.Payload))
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.ID))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Start runs the dispatcher once straight away and then every interval, until
+// the returned stop function is called
+func (d *Dispatcher) Start(interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := d.Run(ctx, time.Now()); err != nil {
+				log.Printf("Failed to deliver webhooks: %v", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(cancel)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,105 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"task_manager_api/database"
+	"task_manager_api/models"
+	"testing"
+	"time"
+)
+
+// TestBackoff tests that retry delays double up to the cap
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		4:  4 * time.Minute,
+		7:  32 * time.Minute,
+		8:  time.Hour,
+		20: time.Hour,
+	} {
+		if got := Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+// TestDispatcher tests signed deliveries, retries and dead letters
+func TestDispatcher(t *testing.T) {
+	fail := false
+	var received []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != Sign("topsecret", body) {
+			t.Errorf("request has signature %q, want %q", r.Header.Get(SignatureHeader), Sign("topsecret", body))
+		}
+		received = append(received, r)
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	store := database.NewMemoryStore()
+	id, err := store.CreateWebhook(models.Webhook{URL: server.URL, Events: []string{models.EventAll}, Secret: "topsecret"})
+	if err != nil {
+		t.Fatalf("CreateWebhook() error = %v", err)
+	}
+	dispatcher := NewDispatcher(store)
+	ctx := context.Background()
+
+	// A successful delivery
+	if err := store.EnqueueEvent(models.EventTaskCreated, []byte(`{"event":"task.created"}`)); err != nil {
+		t.Fatalf("EnqueueEvent() error = %v", err)
+	}
+	now := time.Now().Add(time.Second)
+	if err := dispatcher.Run(ctx, now); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(received) != 1 || received[0].Header.Get(EventHeader) != models.EventTaskCreated || received[0].Header.Get(DeliveryHeader) != "1" {
+		t.Fatalf("server received %d requests, want one task.created delivery 1", len(received))
+	}
+	delivered, _ := store.ListDeliveries(int(id), models.DeliveryDelivered)
+	if len(delivered) != 1 || delivered[0].Attempts != 1 || delivered[0].ResponseStatus != http.StatusOK || delivered[0].DeliveredAt == nil {
+		t.Errorf("delivered = %+v, want one delivery after one attempt", delivered)
+	}
+
+	// A failing one is retried with backoff until it is dead
+	fail = true
+	received = nil
+	if err := store.EnqueueEvent(models.EventTaskDeleted, []byte(`{"event":"task.deleted"}`)); err != nil {
+		t.Fatalf("EnqueueEvent() error = %v", err)
+	}
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		if err := dispatcher.Run(ctx, now); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if len(received) != attempt {
+			t.Fatalf("after attempt %d the server received %d requests", attempt, len(received))
+		}
+		if received[attempt-1].Header.Get(DeliveryHeader) != "2" {
+			t.Errorf("attempt %d has delivery ID %s, want 2", attempt, received[attempt-1].Header.Get(DeliveryHeader))
+		}
+
+		// Nothing is due again until the backoff has passed
+		if err := dispatcher.Run(ctx, now); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if len(received) != attempt {
+			t.Fatalf("attempt %d was retried before its backoff", attempt)
+		}
+		now = now.Add(Backoff(attempt))
+	}
+
+	dead, _ := store.ListDeliveries(int(id), models.DeliveryDead)
+	if len(dead) != 1 || dead[0].Attempts != MaxAttempts || dead[0].ResponseStatus != http.StatusServiceUnavailable ||
+		dead[0].LastError == "" || dead[0].NextAttemptAt != nil {
+		t.Errorf("dead = %+v, want the failed delivery after %d attempts", dead, MaxAttempts)
+	}
+	if err := dispatcher.Run(ctx, now.Add(24*time.Hour)); err != nil || len(received) != MaxAttempts {
+		t.Errorf("dead delivery was attempted again: %d requests, error %v", len(received), err)
+	}
+}